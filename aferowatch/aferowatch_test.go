@@ -0,0 +1,146 @@
+package aferowatch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/afero"
+)
+
+func collect(t *testing.T, w *Watcher, n int) []fsnotify.Event {
+	t.Helper()
+	var have []fsnotify.Event
+	for len(have) < n {
+		select {
+		case e := <-w.Events:
+			have = append(have, e)
+		case err := <-w.Errors:
+			t.Fatal(err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout; have %v", have)
+		}
+	}
+	return have
+}
+
+func TestMemMapFs(t *testing.T) {
+	fs := NewMemMapFs()
+	if err := fs.MkdirAll("/dir/sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add("/nonexistent"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("wrong error adding nonexistent path: %v", err)
+	}
+	if err := w.Add("/dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := afero.WriteFile(fs, "/dir/file", []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Not watched recursively.
+	if err := afero.WriteFile(fs, "/dir/sub/file", []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/dir/file", "/dir/renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll("/dir/sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []fsnotify.Event{
+		{Name: "/dir/file", Op: fsnotify.Create},
+		{Name: "/dir/file", Op: fsnotify.Write},
+		{Name: "/dir/file", Op: fsnotify.Rename},
+		{Name: "/dir/renamed", Op: fsnotify.Create},
+		{Name: "/dir/sub", Op: fsnotify.Remove},
+	}
+	have := collect(t, w, len(want))
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("event %d:\nhave: %s\nwant: %s", i, have[i], want[i])
+		}
+	}
+
+	if err := w.Remove("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Remove("/dir"); err != fsnotify.ErrNonExistentWatch {
+		t.Errorf("wrong error removing twice: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-w.Events; ok {
+		t.Error("Events not closed")
+	}
+}
+
+func TestMemMapFsRecursive(t *testing.T) {
+	fs := NewMemMapFs()
+	if err := fs.Mkdir("/dir", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add("/dir/..."); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.MkdirAll("/dir/a/b", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	want := []fsnotify.Event{
+		{Name: "/dir/a", Op: fsnotify.Create},
+		{Name: "/dir/a/b", Op: fsnotify.Create},
+	}
+	have := collect(t, w, len(want))
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("event %d:\nhave: %s\nwant: %s", i, have[i], want[i])
+		}
+	}
+}
+
+func TestOsFs(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w, err := NewWatcher(afero.NewOsFs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(tmp, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if e := collect(t, w, 1)[0]; e.Name != file || !e.Has(fsnotify.Create) {
+		t.Errorf("wrong event: %s", e)
+	}
+}
+
+func TestNotSupported(t *testing.T) {
+	if _, err := NewWatcher(afero.NewMemMapFs()); err != ErrNotSupported {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package aferowatch
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/afero"
+)
+
+// Fs is an afero.Fs that sends events to the watchers created for it for all
+// changes made through it.
+//
+// Changes made to the underlying filesystem directly aren't seen.
+type Fs struct {
+	afero.Fs
+
+	mu       sync.Mutex // Protects watchers.
+	watchers map[*Watcher]struct{}
+}
+
+// Wrap returns a filesystem that can be watched with NewWatcher().
+func Wrap(fs afero.Fs) *Fs {
+	return &Fs{Fs: fs, watchers: make(map[*Watcher]struct{})}
+}
+
+// NewMemMapFs returns a new afero.MemMapFs that can be watched with
+// NewWatcher().
+func NewMemMapFs() *Fs { return Wrap(afero.NewMemMapFs()) }
+
+func (fs *Fs) addWatcher(w *Watcher) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.watchers[w] = struct{}{}
+}
+
+func (fs *Fs) removeWatcher(w *Watcher) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.watchers, w)
+}
+
+// notify sends the event to all watchers.
+func (fs *Fs) notify(name string, op fsnotify.Op) {
+	e := fsnotify.Event{Name: filepath.Clean(name), Op: op}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for w := range fs.watchers {
+		w.queueEvent(e)
+	}
+}
+
+// Name returns the name of the underlying filesystem.
+func (fs *Fs) Name() string { return "aferowatch(" + fs.Fs.Name() + ")" }
+
+// Create creates a file, like os.Create().
+func (fs *Fs) Create(name string) (afero.File, error) {
+	existed := exists(fs.Fs, name)
+	f, err := fs.Fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if existed {
+		fs.notify(name, fsnotify.Write) // Truncated.
+	} else {
+		fs.notify(name, fsnotify.Create)
+	}
+	return &file{File: f, fs: fs, name: name}, nil
+}
+
+// Mkdir creates a directory, like os.Mkdir().
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	if err := fs.Fs.Mkdir(name, perm); err != nil {
+		return err
+	}
+	fs.notify(name, fsnotify.Create)
+	return nil
+}
+
+// MkdirAll creates a directory and all parents that don't exist yet, like
+// os.MkdirAll().
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	var created []string
+	for p := filepath.Clean(path); !exists(fs.Fs, p); p = filepath.Dir(p) {
+		created = append(created, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	if err := fs.Fs.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	for i := len(created) - 1; i >= 0; i-- {
+		fs.notify(created[i], fsnotify.Create)
+	}
+	return nil
+}
+
+// Open opens a file for reading, like os.Open().
+func (fs *Fs) Open(name string) (afero.File, error) {
+	f, err := fs.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{File: f, fs: fs, name: name}, nil
+}
+
+// OpenFile opens a file, like os.OpenFile().
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	existed := exists(fs.Fs, name)
+	f, err := fs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !existed && flag&os.O_CREATE != 0:
+		fs.notify(name, fsnotify.Create)
+	case existed && flag&os.O_TRUNC != 0:
+		fs.notify(name, fsnotify.Write)
+	}
+	return &file{File: f, fs: fs, name: name}, nil
+}
+
+// Remove removes a file or empty directory, like os.Remove().
+func (fs *Fs) Remove(name string) error {
+	if err := fs.Fs.Remove(name); err != nil {
+		return err
+	}
+	fs.notify(name, fsnotify.Remove)
+	return nil
+}
+
+// RemoveAll removes path and everything it contains, like os.RemoveAll().
+func (fs *Fs) RemoveAll(path string) error {
+	var removed []string
+	afero.Walk(fs.Fs, path, func(p string, _ os.FileInfo, err error) error {
+		if err == nil {
+			removed = append(removed, p)
+		}
+		return nil
+	})
+	if err := fs.Fs.RemoveAll(path); err != nil {
+		return err
+	}
+	// Send the events for the contents of a directory before the directory.
+	sort.Sort(sort.Reverse(sort.StringSlice(removed)))
+	for _, p := range removed {
+		fs.notify(p, fsnotify.Remove)
+	}
+	return nil
+}
+
+// Rename renames a file, like os.Rename().
+func (fs *Fs) Rename(oldname, newname string) error {
+	if err := fs.Fs.Rename(oldname, newname); err != nil {
+		return err
+	}
+	fs.notify(oldname, fsnotify.Rename)
+	fs.notify(newname, fsnotify.Create)
+	return nil
+}
+
+// Chmod changes the mode of a file, like os.Chmod().
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	if err := fs.Fs.Chmod(name, mode); err != nil {
+		return err
+	}
+	fs.notify(name, fsnotify.Chmod)
+	return nil
+}
+
+// Chown changes the owner of a file, like os.Chown().
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	if err := fs.Fs.Chown(name, uid, gid); err != nil {
+		return err
+	}
+	fs.notify(name, fsnotify.Chmod)
+	return nil
+}
+
+// Chtimes changes the access and modification times of a file, like
+// os.Chtimes().
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := fs.Fs.Chtimes(name, atime, mtime); err != nil {
+		return err
+	}
+	fs.notify(name, fsnotify.Chmod)
+	return nil
+}
+
+// file sends a Write event for every write.
+type file struct {
+	afero.File
+	fs   *Fs
+	name string
+}
+
+func (f *file) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	if n > 0 {
+		f.fs.notify(f.name, fsnotify.Write)
+	}
+	return n, err
+}
+
+func (f *file) WriteAt(b []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(b, off)
+	if n > 0 {
+		f.fs.notify(f.name, fsnotify.Write)
+	}
+	return n, err
+}
+
+func (f *file) WriteString(s string) (int, error) {
+	n, err := f.File.WriteString(s)
+	if n > 0 {
+		f.fs.notify(f.name, fsnotify.Write)
+	}
+	return n, err
+}
+
+func (f *file) Truncate(size int64) error {
+	if err := f.File.Truncate(size); err != nil {
+		return err
+	}
+	f.fs.notify(f.name, fsnotify.Write)
+	return nil
+}
@@ -0,0 +1,15 @@
+module github.com/fsnotify/fsnotify/aferowatch
+
+go 1.17
+
+require (
+	github.com/fsnotify/fsnotify v1.5.4
+	github.com/spf13/afero v1.9.2
+)
+
+require (
+	golang.org/x/sys v0.0.0-20220731174439-a90be440212d // indirect
+	golang.org/x/text v0.3.8 // indirect
+)
+
+replace github.com/fsnotify/fsnotify => ../
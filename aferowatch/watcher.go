@@ -0,0 +1,252 @@
+// Package aferowatch watches afero filesystems with the same API as
+// fsnotify.Watcher.
+//
+// An afero.OsFs is watched with a regular fsnotify.Watcher. Other filesystems
+// such as afero.MemMapFs don't have any way to get notified of changes, so
+// they need to be wrapped with Wrap() (or created with NewMemMapFs()); all
+// changes made through the wrapped filesystem send events to the watchers
+// created for it:
+//
+//	fs := aferowatch.NewMemMapFs()
+//	w, err := aferowatch.NewWatcher(fs)
+//	w.Add("/dir")
+//
+//	afero.WriteFile(fs, "/dir/file", []byte("data"), 0o644)
+//	<-w.Events // "/dir/file": CREATE
+//	<-w.Events // "/dir/file": WRITE
+//
+// This is useful to test code that uses the watcher without touching the disk.
+package aferowatch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/afero"
+)
+
+// ErrNotSupported is returned by NewWatcher() for a filesystem that can't be
+// watched.
+var ErrNotSupported = errors.New("fsnotify/aferowatch: filesystem can't be watched; use Wrap()")
+
+var _ fsnotify.Notifier = (*Watcher)(nil)
+
+// Watcher watches a set of files in an afero filesystem, delivering events to
+// a channel.
+type Watcher struct {
+	// Events sends the filesystem change events.
+	Events chan fsnotify.Event
+
+	// Errors sends any errors.
+	Errors chan error
+
+	os *fsnotify.Watcher // Set for OsFs.
+	fs *Fs               // Set for a wrapped filesystem.
+
+	mu       sync.Mutex      // Protects everything below.
+	watches  map[string]bool // Watched paths, and if they're recursive.
+	queue    []fsnotify.Event
+	wake     chan struct{} // Sent on when something is added to queue.
+	done     chan struct{} // Closed on Close().
+	doneResp chan struct{}
+}
+
+// NewWatcher creates a new watcher for fs, which must be an afero.OsFs or a
+// filesystem returned by Wrap().
+func NewWatcher(fs afero.Fs) (*Watcher, error) {
+	switch fs := fs.(type) {
+	case *afero.OsFs:
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		return &Watcher{Events: w.Events, Errors: w.Errors, os: w}, nil
+	case *Fs:
+		w := &Watcher{
+			Events:   make(chan fsnotify.Event),
+			Errors:   make(chan error),
+			fs:       fs,
+			watches:  make(map[string]bool),
+			wake:     make(chan struct{}, 1),
+			done:     make(chan struct{}),
+			doneResp: make(chan struct{}),
+		}
+		fs.addWatcher(w)
+		go w.deliver()
+		return w, nil
+	}
+	return nil, ErrNotSupported
+}
+
+// Close removes all watches and closes the Events and Errors channels.
+func (w *Watcher) Close() error {
+	if w.os != nil {
+		return w.os.Close()
+	}
+
+	w.mu.Lock()
+	select {
+	case <-w.done:
+		w.mu.Unlock()
+		return nil
+	default:
+	}
+	close(w.done)
+	w.mu.Unlock()
+
+	w.fs.removeWatcher(w)
+	<-w.doneResp
+	return nil
+}
+
+// Add starts watching the named file or directory (non-recursively). A path
+// ending with "/..." is watched recursively.
+func (w *Watcher) Add(name string) error { return w.AddWith(name) }
+
+// AddWith is like Add, but allows adding options.
+//
+// The options are ignored for wrapped filesystems.
+func (w *Watcher) AddWith(name string, opts ...fsnotify.AddOption) error {
+	if w.os != nil {
+		return w.os.AddWith(name, opts...)
+	}
+
+	name, recurse := filepath.Clean(name), false
+	if filepath.Base(name) == "..." {
+		name, recurse = filepath.Dir(name), true
+	}
+	if _, err := w.fs.Stat(name); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done:
+		return errors.New("fsnotify/aferowatch: watcher closed")
+	default:
+	}
+	w.watches[name] = recurse
+	return nil
+}
+
+// EventsChan returns the Events channel, to implement fsnotify.Notifier.
+func (w *Watcher) EventsChan() <-chan fsnotify.Event { return w.Events }
+
+// ErrorsChan returns the Errors channel, to implement fsnotify.Notifier.
+func (w *Watcher) ErrorsChan() <-chan error { return w.Errors }
+
+// Remove stops watching the named file or directory.
+func (w *Watcher) Remove(name string) error {
+	if w.os != nil {
+		return w.os.Remove(name)
+	}
+
+	name = filepath.Clean(name)
+	if filepath.Base(name) == "..." {
+		name = filepath.Dir(name)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.watches[name]; !ok {
+		return fsnotify.ErrNonExistentWatch
+	}
+	delete(w.watches, name)
+	return nil
+}
+
+// WatchList returns all paths added with Add() (and are not yet removed).
+func (w *Watcher) WatchList() []string {
+	if w.os != nil {
+		return w.os.WatchList()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := make([]string, 0, len(w.watches))
+	for name := range w.watches {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// watching reports if name is watched: either the path itself, its parent
+// directory, or a recursive watch above that.
+func (w *Watcher) watching(name string) bool {
+	if _, ok := w.watches[name]; ok {
+		return true
+	}
+	dir := filepath.Dir(name)
+	if _, ok := w.watches[dir]; ok {
+		return true
+	}
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+		if w.watches[dir] {
+			return true
+		}
+	}
+}
+
+// queueEvent adds e to the queue if it's watched.
+func (w *Watcher) queueEvent(e fsnotify.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.watching(e.Name) {
+		return
+	}
+	w.queue = append(w.queue, e)
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends the queued events until the watcher is closed.
+//
+// Events are queued rather than sent directly so that changing the filesystem
+// never blocks on the consumer.
+func (w *Watcher) deliver() {
+	defer func() {
+		close(w.Events)
+		close(w.Errors)
+		close(w.doneResp)
+	}()
+
+	for {
+		w.mu.Lock()
+		queue := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+
+		for _, e := range queue {
+			select {
+			case w.Events <- e:
+			case <-w.done:
+				return
+			}
+		}
+
+		select {
+		case <-w.wake:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// exists reports if the named file exists in fs.
+func exists(fs afero.Fs, name string) bool {
+	_, err := fs.Stat(name)
+	return err == nil || !os.IsNotExist(err)
+}
@@ -0,0 +1,89 @@
+package fsnotify
+
+import (
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// appendQueue merges the Write events for a file that grew into one event per
+// window, for WithAppendOnly().
+type appendQueue struct {
+	mu      sync.Mutex
+	pending map[string]*appendEvent // key: path
+}
+
+type appendEvent struct {
+	e       Event
+	timer   Timer
+	flushed chan struct{} // Closed when the event is sent before the timer fires.
+}
+
+func newAppendQueue() *appendQueue {
+	return &appendQueue{pending: make(map[string]*appendEvent)}
+}
+
+// len returns the number of queued events.
+func (q *appendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// send sends e with deliver, or queues it to be merged with the next Write
+// events for the same file.
+// Returns false if the watcher is closed.
+func (q *appendQueue) send(e Event, window time.Duration, clock Clock, deliver func(Event) bool, done <-chan struct{}, labels pprof.LabelSet) bool {
+	e.Op &^= Chmod
+	if e.Op == 0 {
+		return true
+	}
+	if e.Has(Write) && !e.Has(Truncate) {
+		// Didn't grow, or not a regular file.
+		if e.PrevSize >= 0 && e.Size <= e.PrevSize {
+			return true
+		}
+	}
+
+	if e.Op != Write || window <= 0 {
+		if !q.flush(e.Name, deliver) {
+			return false
+		}
+		return deliver(e)
+	}
+
+	q.mu.Lock()
+	if pe, ok := q.pending[e.Name]; ok {
+		pe.e.Size = e.Size
+		q.mu.Unlock()
+		return true
+	}
+	pe := &appendEvent{e: e, timer: clock.NewTimer(window), flushed: make(chan struct{})}
+	q.pending[e.Name] = pe
+	q.mu.Unlock()
+
+	goLabeled(labels, "appendonly", func() {
+		select {
+		case <-pe.timer.C():
+			q.flush(e.Name, deliver)
+		case <-pe.flushed:
+		case <-done:
+		}
+	})
+	return true
+}
+
+// flush sends the queued event for name, if there is one.
+// Returns false if the watcher is closed.
+func (q *appendQueue) flush(name string, deliver func(Event) bool) bool {
+	q.mu.Lock()
+	pe, ok := q.pending[name]
+	delete(q.pending, name)
+	q.mu.Unlock()
+	if !ok {
+		return true
+	}
+	pe.timer.Stop()
+	close(pe.flushed)
+	return deliver(pe.e)
+}
@@ -4,17 +4,27 @@
 package fsnotify
 
 import (
+	"context"
 	"errors"
+	"runtime/pprof"
+	"time"
 )
 
+// backendName is empty, as there is no backend on this platform.
+const backendName = ""
+
 // Watcher watches a set of files, delivering events to a channel.
 type Watcher struct {
-	Events chan Event
-	Errors chan error
+	Events  chan Event
+	Errors  chan error
+	started runState
 }
 
 // NewWatcher establishes a new watcher with the underlying OS and begins waiting for events.
-func NewWatcher() (*Watcher, error) {
+func NewWatcher() (*Watcher, error) { return NewWatcherWith() }
+
+// NewWatcherWith is like NewWatcher, but allows adding options.
+func NewWatcherWith(opts ...watcherOpt) (*Watcher, error) {
 	return nil, errors.New("FEN based watcher not yet supported for fsnotify\n")
 }
 
@@ -28,6 +38,120 @@ func (w *Watcher) Add(name string) error {
 	return nil
 }
 
+// AddWith is like Add, but allows adding options.
+func (w *Watcher) AddWith(name string, opts ...addOpt) error {
+	return nil
+}
+
+// Export returns a description of all watches added with Add() or AddWith().
+func (w *Watcher) Export() []WatchSpec {
+	return nil
+}
+
+// Clone creates a new watcher with the same options and watches as w.
+func (w *Watcher) Clone() (*Watcher, error) { return NewWatcherWith() }
+
+func (w *Watcher) watchOpts() map[string]withOpts { return nil }
+
+// Check verifies that the watches added with Add() or AddWith() are still
+// live.
+func (w *Watcher) Check() ([]WatchHealth, error) {
+	return nil, nil
+}
+
+// Duplicates returns the number of events that were dropped by WithDedup().
+func (w *Watcher) Duplicates() uint64 {
+	return 0
+}
+
+// Stats returns counters for the work the watcher did.
+func (w *Watcher) Stats() Stats { return Stats{} }
+
+// goroutineLabels returns the pprof labels for goroutines of the watcher.
+func (w *Watcher) goroutineLabels() pprof.LabelSet { return pprof.LabelSet{} }
+
+// ID returns the ID of the watcher, which is unique in the process. The
+// goroutines of the watcher have it as the "fsnotify.watcher" pprof label.
+func (w *Watcher) ID() uint64 { return 0 }
+
+// Done returns a channel that's closed once the watcher is closed and all
+// cleanup is finished.
+func (w *Watcher) Done() <-chan struct{} { return nil }
+
+// State returns the state of the watcher; this is always StateClosed as there
+// is no backend on this platform.
+func (w *Watcher) State() WatcherState { return StateClosed }
+
+// IsClosed reports if Close() was called.
+func (w *Watcher) IsClosed() bool { return true }
+
+// BackendName returns the name of the backend the watcher uses; this is empty
+// as there is no backend on this platform.
+func (w *Watcher) BackendName() string { return backendName }
+
+// Supports reports if the platform supports the feature f.
+func (w *Watcher) Supports(f Feature) bool { return false }
+
+// Next returns the next event or error for a watcher created with
+// WithSynchronous().
+func (w *Watcher) Next(ctx context.Context) (Event, error) {
+	return Event{}, ErrSynchronousNotSupported
+}
+
+// SysFd returns the file descriptor of the backend.
+func (w *Watcher) SysFd() (uintptr, error) { return 0, ErrBackendNotAvailable }
+
+// TryRead is like Next, but doesn't block.
+func (w *Watcher) TryRead() (Event, bool, error) {
+	return Event{}, false, ErrSynchronousNotSupported
+}
+
+// DebugString returns a description of the internal state of the watcher, for
+// diagnosing missed events; see DebugHandler(). The format may change.
+func (w *Watcher) DebugString() string { return "" }
+
+// For WatchGroup.Pause() and WatchGroup.Paused().
+func (w *Watcher) pauseGroup(name string, paused bool) {}
+func (w *Watcher) groupPaused(name string) bool        { return false }
+
+// For WatchGroup.SetQuota() and WatchGroup.Watches().
+func (w *Watcher) setGroupQuota(name string, q GroupQuota) {}
+func (w *Watcher) groupWatches(name string) int            { return 0 }
+
+// OnBackpressure sets a function that's called when sending an event on the
+// Events channel has been blocked for longer than threshold.
+func (w *Watcher) OnBackpressure(threshold time.Duration, fn func(Backpressure)) {}
+
+// Subscribe returns a channel that receives all events for which filter
+// returns true.
+func (w *Watcher) Subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	ch := make(chan Event)
+	close(ch)
+	return ch, func() {}
+}
+
+// SubscribeWith is like Subscribe, but returns a Subscription that only
+// receives the events that match all options.
+func (w *Watcher) SubscribeWith(opts ...SubscribeOption) *Subscription {
+	ch, _ := w.Subscribe(nil)
+	return &Subscription{Events: ch, cancel: func() {}}
+}
+
+// Use adds fn to the functions that are called for every event before it's
+// sent.
+func (w *Watcher) Use(fn func(Event) (Event, bool)) {}
+
+// AddFd is like AddWith, but for an already-open file descriptor.
+func (w *Watcher) AddFd(fd uintptr, name string, opts ...addOpt) error {
+	return nil
+}
+
+// AddAt is like AddWith, but path is relative to the directory file
+// descriptor dirfd.
+func (w *Watcher) AddAt(dirfd uintptr, path string, opts ...addOpt) error {
+	return nil
+}
+
 // Remove stops watching the the named file or directory (non-recursively).
 func (w *Watcher) Remove(name string) error {
 	return nil
@@ -4,18 +4,26 @@
 package fsnotify
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime/pprof"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
 
+// backendName is the name of the backend; see Watcher.BackendName().
+const backendName = "inotify"
+
 // Watcher watches a set of files, delivering events to a channel.
 type Watcher struct {
 	// Store fd here as os.File.Read() will no longer return on close after
@@ -25,19 +33,75 @@ type Watcher struct {
 	Errors      chan error
 	mu          sync.Mutex // Map access
 	inotifyFile *os.File
-	watches     map[string]*watch // Map of inotify watches (key: path)
-	paths       map[int]string    // Map of watched paths (key: watch descriptor)
-	done        chan struct{}     // Channel for sending a "quit message" to the reader goroutine
-	doneResp    chan struct{}     // Channel to respond to Close
+	watches     map[string]*watch   // Map of inotify watches (key: path)
+	paths       map[int]string      // Map of watched paths (key: watch descriptor)
+	uppers      map[int]string      // Watches in the upper directory of overlayfs, for WithOverlayUpper() (key: watch descriptor)
+	userWatches map[string]withOpts // Watches added with AddWith(), and their options (key: path)
+	scans       scanGate            // Holds back new events while scanning for WithInitialScan() and WithCatchUp()
+	pipe        *pipeline           // Userspace processing of events
+	done        chan struct{}       // Channel for sending a "quit message" to the reader goroutine
+	doneResp    chan struct{}       // Closed when the reader goroutine exited; returned by Done()
+	sendMu      sync.RWMutex        // Read-locked while sending; the reader write-locks it before closing the channels
+	mounts      *MountWatcher       // Started for the first watch with WithMounts()
+	movedFrom   movedDir            // Last IN_MOVED_FROM for a directory; only used by readEvents()
+	overlayLast overlayEvent        // Last event that was sent; only used by readEvents()
+	onError     func(error)         // Set with WithErrorHandler()
+	id          uint64              // Returned by ID()
+	sync        *syncQueue          // Events for Next(); set with WithSynchronous()
+	nextMu      sync.Mutex          // Held by Next()
+	nextBuf     []byte              // Buffer for Next()
+	drain       time.Duration       // Set with WithDrainOnClose()
+	closing     bool                // Set when Close() is first called, before it waits to drain
+	drained     chan struct{}       // Closed by the reader once it drained the events, for WithDrainOnClose()
+	drainUntil  time.Time           // Deadline to drain the events
+	started     runState            // Set by Start()
+	opts        []watcherOpt        // Options passed to NewWatcherWith(), for Clone()
+}
+
+// movedDir is the path of a directory that was moved away, with the cookie of
+// the event to find the matching IN_MOVED_TO.
+type movedDir struct {
+	cookie uint32
+	name   string
+}
+
+// overlayEvent is an event from either the merged or upper directory of
+// overlayfs, to send a change made through the overlay only once.
+type overlayEvent struct {
+	name  string
+	op    Op
+	upper bool
 }
 
 // NewWatcher establishes a new watcher with the underlying OS and begins waiting for events.
-func NewWatcher() (*Watcher, error) {
+func NewWatcher() (*Watcher, error) { return NewWatcherWith() }
+
+// NewWatcherWith is like NewWatcher, but allows adding options.
+//
+// Possible options are:
+//
+//   - WithErrorHandler  call a function for errors, rather than sending them
+//     on the Errors channel.
+//   - WithSynchronous   read events with Next(), without starting a goroutine.
+//   - WithDrainOnClose  send all events that were read before closing the
+//     channels in Close().
+//   - WithNames         set how paths are reported in Event.Name.
+//   - WithPortable      send events in the same shape on all platforms.
+//   - WithoutStatChecks don't check if a directory still exists (kqueue).
+func NewWatcherWith(opts ...watcherOpt) (*Watcher, error) {
+	with := getWatcherOptions(opts...)
+	if err := checkBackend(with.backend); err != nil {
+		return nil, err
+	}
+
 	// Create inotify fd
 	// Need to set the FD to nonblocking mode in order for SetDeadline methods to work
 	// Otherwise, blocking i/o operations won't terminate on close
 	fd, errno := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
 	if fd == -1 {
+		if errno == unix.EMFILE {
+			return nil, &limitError{limit: "fs.inotify.max_user_instances or RLIMIT_NOFILE", err: errno}
+		}
 		return nil, errno
 	}
 
@@ -46,18 +110,61 @@ func NewWatcher() (*Watcher, error) {
 		inotifyFile: os.NewFile(uintptr(fd), ""),
 		watches:     make(map[string]*watch),
 		paths:       make(map[int]string),
+		uppers:      make(map[int]string),
+		userWatches: make(map[string]withOpts),
 		Events:      make(chan Event),
 		Errors:      make(chan error),
 		done:        make(chan struct{}),
 		doneResp:    make(chan struct{}),
+		onError:     with.onError,
+		opts:        append([]watcherOpt(nil), opts...),
+		drained:     make(chan struct{}),
+	}
+	w.pipe = newPipeline(w.emit)
+	w.pipe.names = with.names
+	if with.portable {
+		w.pipe.portable = newPortableQueue(w.pipe.queue)
 	}
+	w.pipe.readd = w.readd
+	w.pipe.sendErr = w.sendError
+	w.pipe.labels, w.id = watcherLabels(backendName)
+	trackWatcher(w.id, backendName)
+	w.scans.labels = w.pipe.labels
 
-	go w.readEvents()
+	if with.synchronous {
+		w.sync = new(syncQueue)
+		return w, nil
+	}
+	w.drain = with.drain
+	goLabeled(w.pipe.labels, "reader", w.readEvents)
 	return w, nil
 }
 
 // Returns true if the event was sent, or false if watcher is closed.
 func (w *Watcher) sendEvent(e Event) bool {
+	w.scans.wait()
+	return w.sendSynthetic(e)
+}
+
+// sendSynthetic sends an event that didn't come from inotify, without waiting
+// for scans to finish.
+// Returns true if the event was sent, or false if watcher is closed.
+func (w *Watcher) sendSynthetic(e Event) bool {
+	return w.pipe.send(e, w.optsFor(e.Name))
+}
+
+// emit sends the event on the Events channel, after all processing.
+// Returns true if the event was sent, or false if watcher is closed.
+func (w *Watcher) emit(e Event) bool {
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
+	if w.isClosed() { // The channels may be closed already.
+		return false
+	}
+	if w.sync != nil {
+		w.sync.push(e, nil)
+		return true
+	}
 	select {
 	case w.Events <- e:
 		return true
@@ -68,8 +175,21 @@ func (w *Watcher) sendEvent(e Event) bool {
 
 // Returns true if the error was sent, or false if watcher is closed.
 func (w *Watcher) sendError(err error) bool {
+	if w.onError != nil {
+		w.onError(newWatchError(err, ""))
+		return true
+	}
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
+	if w.isClosed() { // The channels may be closed already.
+		return false
+	}
+	if w.sync != nil {
+		w.sync.push(Event{}, newWatchError(err, ""))
+		return true
+	}
 	select {
-	case w.Errors <- err:
+	case w.Errors <- newWatchError(err, ""):
 		return true
 	case <-w.done:
 	}
@@ -88,14 +208,42 @@ func (w *Watcher) isClosed() bool {
 // Close removes all watches and closes the events channel.
 func (w *Watcher) Close() error {
 	w.mu.Lock()
-	if w.isClosed() {
+	if w.closing {
 		w.mu.Unlock()
 		return nil
 	}
+	w.closing = true
+	w.drainUntil = time.Now().Add(w.drain)
+	w.mu.Unlock()
+
+	// Wake up the reader to read the rest of the events, and wait for them to
+	// be sent.
+	draining := w.drain > 0 && w.inotifyFile.SetReadDeadline(time.Now()) == nil
+	if draining {
+		t := time.NewTimer(w.drain)
+		select {
+		case <-w.drained:
+		case <-t.C:
+		}
+		t.Stop()
+	}
 
 	// Send 'close' signal to goroutine, and set the Watcher to closed.
+	w.mu.Lock()
 	close(w.done)
+	mounts := w.mounts
 	w.mu.Unlock()
+	untrackWatcher(w.id)
+	w.pipe.close()
+	if mounts != nil {
+		mounts.Close()
+	}
+
+	// The reader doesn't block on the file while draining; wait for it to
+	// exit before closing the file, as it reads from the fd directly.
+	if draining {
+		<-w.doneResp
+	}
 
 	// Causes any blocking reads to return with an error, provided the file still supports deadline operations
 	err := w.inotifyFile.Close()
@@ -103,22 +251,517 @@ func (w *Watcher) Close() error {
 		return err
 	}
 
+	if w.sync != nil {
+		w.sendMu.Lock()
+		close(w.Events)
+		close(w.Errors)
+		w.sendMu.Unlock()
+		close(w.doneResp)
+		return nil
+	}
+
 	// Wait for goroutine to close
 	<-w.doneResp
 
 	return nil
 }
 
+// Next returns the next event or error for a watcher created with
+// WithSynchronous(), reading events from the kernel if there are none
+// waiting. It blocks until there is one, ctx is done, or the watcher is
+// closed, in which case it returns ctx.Err() or ErrClosed.
+//
+// Errors are returned as they would be sent on the Errors channel; the watcher
+// can still be used after an error. Next must not be called concurrently.
+func (w *Watcher) Next(ctx context.Context) (Event, error) {
+	if w.sync == nil {
+		return Event{}, errors.New("fsnotify: Next() requires WithSynchronous()")
+	}
+	w.nextMu.Lock()
+	defer w.nextMu.Unlock()
+	if w.nextBuf == nil {
+		w.nextBuf = make([]byte, unix.SizeofInotifyEvent*4096)
+	}
+
+	for {
+		if it, ok := w.sync.pop(); ok {
+			return it.e, it.err
+		}
+		if w.isClosed() {
+			return Event{}, ErrClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return Event{}, err
+		}
+
+		if err := w.inotifyFile.SetReadDeadline(syncDeadline(ctx)); err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return Event{}, ErrClosed
+			}
+			return Event{}, err
+		}
+		n, err := w.inotifyFile.Read(w.nextBuf)
+		switch {
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			continue
+		case errors.Is(err, os.ErrClosed):
+			return Event{}, ErrClosed
+		case err != nil:
+			return Event{}, err
+		}
+		w.handleEvents(w.nextBuf[:n])
+	}
+}
+
+// SysFd returns the inotify file descriptor, so that it can be added to
+// an external poller (such as epoll) to know when TryRead() has events to
+// read. It must not be read from or closed.
+//
+// This is only useful with WithSynchronous(); without it the reader goroutine
+// already reads from it. It returns ErrClosed after the watcher is closed.
+func (w *Watcher) SysFd() (uintptr, error) {
+	if w.isClosed() {
+		return 0, ErrClosed
+	}
+	return uintptr(w.fd), nil
+}
+
+// TryRead is like Next, but doesn't block: it returns false if there are no
+// events waiting and nothing can be read from the kernel right now. Use
+// SysFd() to wait until there is something to read.
+func (w *Watcher) TryRead() (Event, bool, error) {
+	if w.sync == nil {
+		return Event{}, false, errors.New("fsnotify: TryRead() requires WithSynchronous()")
+	}
+	w.nextMu.Lock()
+	defer w.nextMu.Unlock()
+	if w.nextBuf == nil {
+		w.nextBuf = make([]byte, unix.SizeofInotifyEvent*4096)
+	}
+
+	rc, err := w.inotifyFile.SyscallConn()
+	if err != nil {
+		return Event{}, false, err
+	}
+	for {
+		if it, ok := w.sync.pop(); ok {
+			return it.e, true, it.err
+		}
+		if w.isClosed() {
+			return Event{}, false, ErrClosed
+		}
+
+		// Read from the fd directly, as os.File.Read() would wait for it to
+		// become readable.
+		var (
+			n     int
+			errno error
+		)
+		err := rc.Read(func(fd uintptr) bool {
+			n, errno = unix.Read(int(fd), w.nextBuf)
+			return true
+		})
+		switch {
+		case errors.Is(err, os.ErrClosed):
+			return Event{}, false, ErrClosed
+		case err != nil:
+			return Event{}, false, err
+		case errno == unix.EINTR:
+			continue
+		case errno == unix.EAGAIN:
+			return Event{}, false, nil
+		case errno != nil:
+			return Event{}, false, errno
+		}
+		w.handleEvents(w.nextBuf[:n])
+	}
+}
+
 // Add starts watching the named file or directory (non-recursively).
-func (w *Watcher) Add(name string) error {
-	name = filepath.Clean(name)
+func (w *Watcher) Add(name string) error { return w.AddWith(name) }
+
+// AddWith is like Add, but allows adding options. When using Add() the
+// defaults described below are used.
+//
+// A path ending in "/..." is watched recursively: all subdirectories are
+// watched as well, and directories created later on are added automatically.
+//
+// AddWith and Remove can be called from the goroutine that reads the Events
+// channel, for example to watch a directory from its Create event; they don't
+// wait for the events to be read.
+//
+// Possible options are:
+//
+//   - WithInitialScan   send events for files that already exist.
+//   - WithCatchUp       send events for files changed since a point in time.
+//   - WithContentHash   drop Write events if the content didn't change.
+//   - WithIgnore        exclude paths matching gitignore rules.
+//   - WithIgnorePreset  exclude editor, OS, VCS, or build tool files.
+//   - WithInclude       only send events for paths matching glob patterns.
+//   - WithExclude       exclude paths matching glob patterns.
+//   - WithIncludeRegexp only send events for paths matching regular expressions.
+//   - WithExcludeRegexp exclude paths matching regular expressions.
+//   - WithMaxDepth      limit how deep a recursive watch descends.
+//   - WithSkipHidden    exclude hidden files and directories.
+//   - WithoutChmod      don't watch for Chmod events.
+//   - WithDedup         drop events identical to the previous event.
+//   - WithClock         use a fake clock for the time-based options, for tests.
+//   - WithFileID        follow moved directories (only on Linux).
+//   - WithMounts        watch filesystems mounted in a recursive watch (only on Linux).
+//   - WithoutFollow     watch a symbolic link itself, rather than its target.
+//   - WithHardlinks     send events for changes through other hard links.
+//   - WithCaseInsensitive
+//     match paths case-insensitively on case-insensitive filesystems.
+//   - WithNFC           convert names to Unicode NFC (only on macOS).
+//   - WithSpecialFiles  watch named pipes and devices (only needed on kqueue).
+//   - WithTruncate      set Truncate on Write events for files that became smaller.
+//   - WithSizes         set the file size before and after Write events.
+//   - WithAppendOnly    send merged events for files that grew, for following log files.
+//   - WithOverlayUpper  also watch the upper directory of overlayfs mounts (only on Linux).
+//   - WithOps           only send events with some operations.
+//   - WithDebounce      merge the events for a path until it stops changing.
+//   - WithSettle        send a Settled event once a watch stops changing.
+//   - WithCloseWrite    send CloseWrite events when files are closed (only on Linux).
+//   - WithCompleteCreate
+//     send Create events once files are done being copied.
+//   - WithReplace       send a Replaced event if the directory is replaced.
+//   - WithReplaceDiff   also send the differences after a Replaced event.
+//   - WithPriority      send events ahead of other watches if they're not read fast enough.
+//   - WithGroup         add the watch to a watch group; see Group().
+//   - WithRelativeNames set Event.Name relative to the watched path.
+//   - WithoutFUSE       return an error for paths on FUSE filesystems.
+//   - WithoutParentDuplicates
+//     send events once if both a file and its directory are watched.
+func (w *Watcher) AddWith(name string, opts ...addOpt) error {
 	if w.isClosed() {
 		return errors.New("inotify instance already closed")
 	}
+	with := getOptions(opts...)
+
+	name, err := with.expandPath(name)
+	if err != nil {
+		return err
+	}
+	name, recurse := recursivePath(name)
+	with.setRoot(name, recurse)
+	if with.noFUSE {
+		if err := checkFUSE(name); err != nil {
+			return err
+		}
+	}
+	if with.overlayUpper {
+		var err error
+		with.mountList, err = readMountList()
+		if err != nil {
+			return err
+		}
+	}
+
+	if with.scanning() {
+		w.scans.start()
+	}
+	if err := w.addPaths(name, recurse, with); err != nil {
+		if with.scanning() {
+			w.scans.done()
+		}
+		return err
+	}
+
+	w.mu.Lock()
+	w.userWatches[name] = with
+	w.mu.Unlock()
+	if with.group != "" {
+		if err := w.pipe.checkWatches(with.group, w.groupWatches, 0); err != nil {
+			if recurse {
+				w.Remove(filepath.Join(name, "..."))
+			} else {
+				w.Remove(name)
+			}
+			if with.scanning() {
+				w.scans.done()
+			}
+			return err
+		}
+	}
+	if with.trackSizes() {
+		w.pipe.sizes.seed(name, with)
+	}
+	if with.replaceDiff {
+		w.pipe.replaces.seed(name, with)
+	}
+	if with.priority {
+		w.pipe.prioritize()
+	}
+
+	if recurse && with.mounts {
+		if err := w.watchMounts(); err != nil {
+			if with.scanning() {
+				w.scans.done()
+			}
+			return err
+		}
+	}
+	if with.scanning() {
+		w.scans.run(name, with, w.sendSynthetic, w.sendError)
+	}
+	return nil
+}
 
+// watchMounts starts the MountWatcher for WithMounts(), if it's not running
+// yet.
+func (w *Watcher) watchMounts() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.mounts != nil || w.isClosed() {
+		return nil
+	}
+	m, err := NewMountWatcher()
+	if err != nil {
+		return err
+	}
+	w.mounts = m
+	goLabeled(w.pipe.labels, "mounts", func() { w.readMounts(m) })
+	return nil
+}
+
+// readMounts re-adds the watches for directories that something was mounted
+// on or unmounted from, until the watcher is closed.
+func (w *Watcher) readMounts(m *MountWatcher) {
+	for {
+		select {
+		case e, ok := <-m.Events:
+			if !ok {
+				return
+			}
+			name, ok := w.mountWatched(e.Path)
+			if !ok {
+				continue
+			}
+			// Adding a watch for the mount point gets a new watch for the root
+			// of the mounted filesystem, or the directory below it after an
+			// unmount.
+			if !w.addRecursive(name) {
+				return
+			}
+		case err, ok := <-m.Errors:
+			if !ok {
+				return
+			}
+			if !w.sendError(err) {
+				return
+			}
+		}
+	}
+}
+
+// mountWatched returns the path of the mount point path as used in the watch,
+// if it's in a recursive watch with WithMounts(). The mount point path is
+// always absolute, but the watch can be relative.
+func (w *Watcher) mountWatched(path string) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for root, with := range w.userWatches {
+		if !with.recurse || !with.mounts {
+			continue
+		}
+		abs, err := filepath.Abs(root)
+		if err != nil || !isUnder(path, abs) {
+			continue
+		}
+		rel, _ := filepath.Rel(abs, path)
+		name := filepath.Join(root, rel)
+		if with.skip(name, true) || with.tooDeep(name) {
+			return "", false
+		}
+		return name, true
+	}
+	return "", false
+}
+
+// AddFd is like AddWith, but watches the already-open file descriptor fd,
+// rather than looking up the path. This allows watching files that were opened
+// before dropping privileges. Events and Remove() use name, which should be the
+// path fd was opened with.
+//
+// The watch is added through /proc/self/fd, so /proc must be mounted. The fd
+// can be closed once AddFd returns. Recursive watches and the WithInitialScan
+// and WithCatchUp options aren't supported, as they need to read the
+// directory by name.
+func (w *Watcher) AddFd(fd uintptr, name string, opts ...addOpt) error {
+	if w.isClosed() {
+		return errors.New("inotify instance already closed")
+	}
+	with := getOptions(opts...)
+	if with.scanning() {
+		return errors.New("fsnotify: AddFd: can't scan a file descriptor")
+	}
+
+	name = filepath.Clean(name)
+	with.setRoot(name, false)
+	err := w.addTarget(name, "/proc/self/fd/"+strconv.FormatUint(uint64(fd), 10), false, false, with)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.userWatches[name] = with
+	w.mu.Unlock()
+	return nil
+}
+
+// AddAt is like AddWith, but path is relative to the directory file descriptor
+// dirfd, as with openat(2). The watch is added for the opened file, so it stays
+// correct if dirfd or its parent directories are renamed later on. Events and
+// Remove() use path as the name.
+//
+// path must be a relative path without ".." elements (see fs.ValidPath). Note
+// that symbolic links are followed, so this is not a security boundary.
+//
+// The same limitations as with AddFd() apply.
+func (w *Watcher) AddAt(dirfd uintptr, path string, opts ...addOpt) error {
+	if !fs.ValidPath(filepath.ToSlash(path)) {
+		return &fs.PathError{Op: "watch", Path: path, Err: fs.ErrInvalid}
+	}
+	fd, err := unix.Openat(int(dirfd), path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &fs.PathError{Op: "openat", Path: path, Err: err}
+	}
+	defer unix.Close(fd)
+	return w.AddFd(uintptr(fd), path, opts...)
+}
+
+// addPaths adds the watches for name, and everything below it for recursive
+// watches.
+func (w *Watcher) addPaths(name string, recurse bool, with withOpts) error {
+	if !recurse {
+		err := w.add(name, false, with)
+		if err == nil && with.hardlinks {
+			err = w.addLinks(name, with)
+		}
+		return err
+	}
+	return filepath.WalkDir(name, func(root string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			if root == name {
+				return fmt.Errorf("fsnotify: not a directory: %q", name)
+			}
+			if with.hardlinks && !with.skip(root, false) {
+				return w.addLink(root, with)
+			}
+			return nil
+		}
+		if with.skip(root, true) || with.tooDeep(root) {
+			return filepath.SkipDir
+		}
+		return w.add(root, true, with)
+	})
+}
+
+func (w *Watcher) add(name string, recurse bool, with withOpts) error {
+	return w.addTarget(name, name, recurse, false, with)
+}
+
+// addLinks adds watches for all files in the directory dir that have more
+// than one hard link, for WithHardlinks(). It does nothing if dir is a file.
+func (w *Watcher) addLinks(dir string, with withOpts) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.Type().IsRegular() && !with.skip(path, false) {
+			if err := w.addLink(path, with); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addLink adds a watch for the file path if it has more than one hard link,
+// for WithHardlinks(). This watch sends the events for changes made through
+// other links.
+func (w *Watcher) addLink(path string, with withOpts) error {
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil
+	}
+	if n, err := LinkCount(path); err != nil || n < 2 {
+		return nil
+	}
+	w.mu.Lock()
+	_, ok := w.watches[path]
+	w.mu.Unlock()
+	if ok {
+		return nil
+	}
+	err = w.addTarget(path, path, false, true, with)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// updateLink adds or removes the watch for WithHardlinks() for the file path
+// in a watched directory after an event for it.
+func (w *Watcher) updateLink(path string, mask uint32) bool {
+	if mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0 {
+		w.mu.Lock()
+		if watch := w.watches[path]; watch != nil && watch.link {
+			w.remove(path)
+		}
+		w.mu.Unlock()
+		return true
+	}
+	if mask&(unix.IN_CREATE|unix.IN_MOVED_TO|unix.IN_ATTRIB) == 0 {
+		return true
+	}
+
+	// The last other link was removed.
+	if n, err := LinkCount(path); err == nil && n < 2 {
+		w.mu.Lock()
+		if watch := w.watches[path]; watch != nil && watch.link {
+			w.remove(path)
+		}
+		w.mu.Unlock()
+		return true
+	}
+	if err := w.addLink(path, w.optsFor(path)); err != nil {
+		return w.sendError(err)
+	}
+	return true
+}
+
+// removeLinks removes the watches for WithHardlinks() for the files in dir.
+//
+// Must be called with w.mu locked.
+func (w *Watcher) removeLinks(dir string) {
+	for path, watch := range w.watches {
+		if watch.link && filepath.Dir(path) == dir {
+			w.remove(path)
+		}
+	}
+}
+
+// addTarget adds a watch for the path target, which is stored as name. link
+// is set for watches added by WithHardlinks().
+func (w *Watcher) addTarget(name, target string, recurse, link bool, with withOpts) error {
 	var flags uint32 = unix.IN_MOVED_TO | unix.IN_MOVED_FROM |
 		unix.IN_CREATE | unix.IN_ATTRIB | unix.IN_MODIFY |
 		unix.IN_MOVE_SELF | unix.IN_DELETE | unix.IN_DELETE_SELF
+	if with.noChmod {
+		flags &^= unix.IN_ATTRIB
+	}
+	if with.closeWrite {
+		flags |= unix.IN_CLOSE_WRITE
+	}
+	if with.noFollow && with.root == name && target == name {
+		flags |= unix.IN_DONT_FOLLOW
+	}
 
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -126,29 +769,106 @@ func (w *Watcher) Add(name string) error {
 	if watchEntry != nil {
 		flags |= watchEntry.flags | unix.IN_MASK_ADD
 	}
-	wd, errno := unix.InotifyAddWatch(w.fd, name, flags)
+	wd, errno := unix.InotifyAddWatch(w.fd, target, flags)
 	if wd == -1 {
+		if errno == unix.ENOSPC {
+			return &limitError{limit: "fs.inotify.max_user_watches", err: errno}
+		}
 		return errno
 	}
 
 	if watchEntry == nil {
-		w.watches[name] = &watch{wd: uint32(wd), flags: flags}
+		watchEntry = &watch{wd: uint32(wd), flags: flags, path: name, recurse: recurse, link: link}
+		w.watches[name] = watchEntry
 		w.paths[wd] = name
 	} else {
+		// The wd is different if the path now refers to another directory,
+		// for example after mounting a filesystem on it. Remove the watch
+		// for the old directory, which would otherwise still send events
+		// with this path.
+		if old := watchEntry.wd; old != uint32(wd) {
+			if w.paths[int(old)] == name {
+				delete(w.paths, int(old))
+				unix.InotifyRmWatch(w.fd, old)
+			}
+			watchEntry.fi = nil
+		}
 		watchEntry.wd = uint32(wd)
+		w.paths[wd] = name
 		watchEntry.flags = flags
+		watchEntry.recurse = watchEntry.recurse || recurse
+	}
+	if with.fileID && watchEntry.fi == nil {
+		watchEntry.fi, _ = os.Stat(target)
+	}
+	if with.overlayUpper && !link {
+		w.addUpper(watchEntry, target, flags&^unix.IN_MASK_ADD, with)
 	}
-
 	return nil
 }
 
+// addUpper adds a watch for the directory in the upper directory of overlayfs
+// that corresponds to target, for WithOverlayUpper(). Errors are ignored: the
+// directory doesn't exist in the upper directory until it's copied up.
+//
+// Must be called with w.mu locked.
+func (w *Watcher) addUpper(watchEntry *watch, target string, flags uint32, with withOpts) {
+	path, ok := overlayUpper(with.mountList, target)
+	if !ok {
+		return
+	}
+	wd, _ := unix.InotifyAddWatch(w.fd, path, flags)
+	if wd == -1 {
+		return
+	}
+	if _, ok := w.paths[wd]; ok {
+		return // The upper directory is also watched itself.
+	}
+	if old := watchEntry.upper; old != 0 && old != uint32(wd) {
+		delete(w.uppers, int(old))
+		unix.InotifyRmWatch(w.fd, old)
+	}
+	watchEntry.upper = uint32(wd)
+	w.uppers[wd] = watchEntry.path
+}
+
 // Remove stops watching the named file or directory (non-recursively).
+//
+// Use a path ending in "/..." to remove a recursive watch.
 func (w *Watcher) Remove(name string) error {
-	name = filepath.Clean(name)
+	name, recurse := recursivePath(name)
 
-	// Fetch the watch.
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	if !recurse {
+		err := w.remove(name)
+		if err == nil {
+			delete(w.userWatches, name)
+			w.removeLinks(name)
+		}
+		return err
+	}
+
+	watch, ok := w.watches[name]
+	if !ok || !watch.recurse {
+		return fmt.Errorf("%w: %s", ErrNonExistentWatch, name)
+	}
+	delete(w.userWatches, name)
+	prefix := name + string(filepath.Separator)
+	for pathname, watch := range w.watches {
+		if watch.recurse && (pathname == name || strings.HasPrefix(pathname, prefix)) {
+			if err := w.remove(pathname); err != nil {
+				return err
+			}
+			w.removeLinks(pathname)
+		}
+	}
+	return nil
+}
+
+// Must be called with w.mu locked.
+func (w *Watcher) remove(name string) error {
+	// Fetch the watch.
 	watch, ok := w.watches[name]
 
 	// Remove it from inotify.
@@ -161,6 +881,10 @@ func (w *Watcher) Remove(name string) error {
 	// inotify's kernel state.
 	delete(w.paths, int(watch.wd))
 	delete(w.watches, name)
+	if watch.upper != 0 {
+		delete(w.uppers, int(watch.upper))
+		unix.InotifyRmWatch(w.fd, watch.upper)
+	}
 
 	// inotify_rm_watch will return EINVAL if the file has been deleted;
 	// the inotify will already have been removed.
@@ -183,34 +907,329 @@ func (w *Watcher) Remove(name string) error {
 }
 
 // WatchList returns the directories and files that are being monitered.
+//
+// Recursive watches are returned once, as "dir/...".
+//
+// Paths added WithExpand() are returned in the expanded form; Export() also
+// has the form they were added with.
 func (w *Watcher) WatchList() []string {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	entries := make([]string, 0, len(w.watches))
-	for pathname := range w.watches {
+	for pathname, watch := range w.watches {
+		if watch.link {
+			continue
+		}
+		if watch.recurse {
+			if parent, ok := w.watches[filepath.Dir(pathname)]; ok && parent.recurse {
+				continue
+			}
+			pathname = filepath.Join(pathname, "...")
+		}
 		entries = append(entries, pathname)
 	}
 
 	return entries
 }
 
+// Check verifies that the watches added with Add() or AddWith() are still
+// live, and adds watches that were lost again. The kernel removes watches
+// without telling us when a filesystem is unmounted, and a path that was
+// replaced (for example by renaming another directory over it) is no longer
+// the file that's watched.
+//
+// Watches for paths that were removed are already reported with a Remove event
+// and aren't checked. Subdirectories of recursive watches aren't checked
+// either, but are added again if the top-level directory is restored.
+//
+// Use CheckEvery() to check the watches periodically.
+func (w *Watcher) Check() ([]WatchHealth, error) {
+	if w.isClosed() {
+		return nil, errClosed
+	}
+	w.mu.Lock()
+	userWatches := make(map[string]withOpts, len(w.userWatches))
+	for name, with := range w.userWatches {
+		userWatches[name] = with
+	}
+	w.mu.Unlock()
+
+	health := make([]WatchHealth, 0, len(userWatches))
+	for name, with := range userWatches {
+		h := WatchHealth{Path: name, Status: WatchOK}
+		if with.recurse {
+			h.Path = filepath.Join(name, "...")
+		}
+		if !w.checkWatch(name) {
+			h.Status = WatchRestored
+			if err := w.addPaths(name, with.recurse, with); err != nil {
+				h.Status, h.Err = WatchBroken, err
+			}
+		}
+		health = append(health, h)
+	}
+	sortWatchHealth(health)
+	return health, nil
+}
+
+// checkWatch reports if the kernel still has the watch for name, and if name
+// still refers to the watched file.
+func (w *Watcher) checkWatch(name string) bool {
+	w.mu.Lock()
+	watch := w.watches[name]
+	var wd, flags uint32
+	if watch != nil {
+		wd, flags = watch.wd, watch.flags
+	}
+	w.mu.Unlock()
+	if watch == nil {
+		return false
+	}
+
+	// Adding a watch for a file that's already watched returns the existing
+	// watch descriptor, and IN_MASK_ADD with the same flags doesn't change it.
+	// A new descriptor means the old watch is gone.
+	have, err := unix.InotifyAddWatch(w.fd, name, flags|unix.IN_MASK_ADD)
+	return err == nil && uint32(have) == wd
+}
+
+// optsFor returns the options of the watch the path name belongs to.
+func (w *Watcher) optsFor(name string) withOpts {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return lookupOpts(w.userWatches, name)
+}
+
+// Export returns a description of all watches added with Add() or AddWith(),
+// which can be added to another watcher with Import().
+func (w *Watcher) Export() []WatchSpec {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	specs := make([]WatchSpec, 0, len(w.userWatches))
+	for pathname, with := range w.userWatches {
+		specs = append(specs, newWatchSpec(pathname, with))
+	}
+	sortWatchSpecs(specs)
+	return specs
+}
+
+// Clone creates a new watcher with the same options as w, and adds all watches
+// that were added to w with Add() or AddWith() with the same options. This can
+// be used to start over after an error the watcher can't recover from, such as
+// ErrEventOverflow, without keeping track of the watches.
+//
+// The new watcher has its own Events and Errors channels; w isn't closed.
+func (w *Watcher) Clone() (*Watcher, error) {
+	return cloneWatcher(w.opts, w.watchOpts())
+}
+
+// watchRoots returns the sorted paths of the watches added with Add() or
+// AddWith().
+func (w *Watcher) watchRoots() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	roots := make(map[string]struct{}, len(w.userWatches))
+	for name := range w.userWatches {
+		roots[name] = struct{}{}
+	}
+	return sortedRoots(roots)
+}
+
+// watchOpts returns a copy of the watches added with Add() or AddWith(), and
+// their options.
+func (w *Watcher) watchOpts() map[string]withOpts {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watches := make(map[string]withOpts, len(w.userWatches))
+	for name, with := range w.userWatches {
+		watches[name] = with
+	}
+	return watches
+}
+
+// Duplicates returns the number of events that were dropped by WithDedup().
+func (w *Watcher) Duplicates() uint64 {
+	return w.pipe.duplicates()
+}
+
+// Stats returns counters for the work the watcher did; this is always zero as
+// there is no stat cache.
+func (w *Watcher) Stats() Stats { return Stats{} }
+
+// goroutineLabels returns the pprof labels for goroutines of the watcher.
+func (w *Watcher) goroutineLabels() pprof.LabelSet { return w.pipe.labels }
+
+// ID returns the ID of the watcher, which is unique in the process. The
+// goroutines of the watcher have it as the "fsnotify.watcher" pprof label.
+func (w *Watcher) ID() uint64 { return w.id }
+
+// Done returns a channel that's closed once the watcher is closed and all
+// cleanup is finished: the reader goroutine exited, the kernel resources are
+// released, and the Events and Errors channels are closed.
+func (w *Watcher) Done() <-chan struct{} { return w.doneResp }
+
+// State returns StateRunning, StateClosing once Close() is called, or
+// StateClosed once Close() is finished and Done() is closed.
+func (w *Watcher) State() WatcherState {
+	w.mu.Lock()
+	closing := w.closing
+	w.mu.Unlock()
+	return watcherState(w.doneResp, closing)
+}
+
+// IsClosed reports if Close() was called; Add() returns an error after this.
+func (w *Watcher) IsClosed() bool { return w.State() != StateRunning }
+
+// BackendName returns the name of the backend the watcher uses: "inotify".
+func (w *Watcher) BackendName() string { return backendName }
+
+// Supports reports if the platform supports the feature f. Options for
+// features that aren't supported are ignored or return an error, as documented
+// for every option.
+func (w *Watcher) Supports(f Feature) bool {
+	switch f {
+	case FeatureRecursive, FeatureCloseWrite, FeatureMounts, FeatureAddFd,
+		FeatureNoFollow, FeatureSynchronous:
+		return true
+	}
+	return false
+}
+
+// DebugString returns a description of the internal state of the watcher, for
+// diagnosing missed events; see DebugHandler(). The format may change.
+func (w *Watcher) DebugString() string {
+	var b strings.Builder
+	w.mu.Lock()
+	fmt.Fprintf(&b, "watcher %d, backend: inotify (fd %d)\n", w.id, w.fd)
+	watches := make([]string, 0, len(w.watches))
+	for path, watch := range w.watches {
+		watches = append(watches, fmt.Sprintf("%s wd=%d flags=%#x recurse=%t link=%t upper=%d",
+			path, watch.wd, watch.flags, watch.recurse, watch.link, watch.upper))
+	}
+	debugSection(&b, "watches", watches)
+	paths := make([]string, 0, len(w.paths))
+	for wd, path := range w.paths {
+		paths = append(paths, fmt.Sprintf("%6d %s", wd, path))
+	}
+	debugSection(&b, "paths (key: wd)", paths)
+	uppers := make([]string, 0, len(w.uppers))
+	for wd, path := range w.uppers {
+		uppers = append(uppers, fmt.Sprintf("%6d %s", wd, path))
+	}
+	debugSection(&b, "overlayfs upper watches (key: wd)", uppers)
+	debugUserWatches(&b, w.userWatches)
+	w.mu.Unlock()
+
+	w.pipe.debugString(&b)
+	return b.String()
+}
+
+// For WatchGroup.Pause() and WatchGroup.Paused().
+func (w *Watcher) pauseGroup(name string, paused bool) { w.pipe.pause(name, paused) }
+func (w *Watcher) groupPaused(name string) bool        { return w.pipe.isPaused(name) }
+
+// For WatchGroup.SetQuota().
+func (w *Watcher) setGroupQuota(name string, q GroupQuota) { w.pipe.setQuota(name, q) }
+
+// groupWatches returns the number of inotify watches for the group name.
+func (w *Watcher) groupWatches(name string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var n int
+	for path := range w.watches {
+		if lookupOpts(w.userWatches, path).group == name {
+			n++
+		}
+	}
+	return n
+}
+
+// OnBackpressure sets a function that's called when sending an event on the
+// Events channel has been blocked for longer than threshold, and again every
+// threshold while it stays blocked, so that programs can log or shed load
+// rather than stall silently. Events that are sent to a subscription aren't
+// tracked.
+//
+// fn is called from a separate goroutine; it must not block, as events
+// continue to be sent. Use a nil fn or a threshold of 0 to remove it. If fn
+// panics a *PanicError is sent on the Errors channel.
+func (w *Watcher) OnBackpressure(threshold time.Duration, fn func(Backpressure)) {
+	w.pipe.onBackpressure(threshold, fn)
+}
+
+// Subscribe returns a channel that receives all events for which filter
+// returns true, so that different parts of a program can each receive their
+// own events. A nil filter matches all events.
+//
+// Events that match one or more subscriptions are sent to all of them, and not
+// on the Events channel; other events are still sent on the Events channel.
+// Like the Events channel the subscription channels must be read, as the
+// watcher blocks until the event is received.
+//
+// The channel is closed when the returned function is called, or when the
+// watcher is closed.
+//
+// If filter panics the event isn't sent to the subscription, and a *PanicError
+// is sent on the Errors channel.
+func (w *Watcher) Subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	return w.pipe.subscribe(filter)
+}
+
+// SubscribeWith is like Subscribe, but returns a Subscription that only
+// receives the events that match all options, with its own buffer:
+//
+//	s := w.SubscribeWith(fsnotify.SubscribePatterns("*.go"), fsnotify.SubscribeOps(fsnotify.Write))
+//	defer s.Close()
+//
+// This allows several differently filtered views over the same watches.
+func (w *Watcher) SubscribeWith(opts ...SubscribeOption) *Subscription {
+	ch, cancel := w.pipe.subscribeWith(getSubscribeOptions(opts...))
+	return &Subscription{Events: ch, cancel: cancel}
+}
+
+// Use adds fn to the functions that are called for every event before it's
+// sent on the Events channel or to a subscription. fn can return a changed
+// event, for example to rewrite the path, or false to drop the event. The
+// functions are called in the order they were added, after all options of the
+// watch are applied.
+//
+// fn is called from the goroutine that sends events; sending blocks until it
+// returns. There is no way to remove a function once it's added.
+//
+// If fn panics the event is dropped, and a *PanicError is sent on the Errors
+// channel.
+func (w *Watcher) Use(fn func(Event) (Event, bool)) {
+	w.pipe.use(fn)
+}
+
 type watch struct {
-	wd    uint32 // Watch descriptor (as returned by the inotify_add_watch() syscall)
-	flags uint32 // inotify flags of this watch (see inotify(7) for the list of valid flags)
+	wd      uint32 // Watch descriptor (as returned by the inotify_add_watch() syscall)
+	flags   uint32 // inotify flags of this watch (see inotify(7) for the list of valid flags)
+	path    string // Watch path.
+	recurse bool   // Part of a recursive watch ("dir/...").
+	link    bool   // Watch for a file with hard links, added by WithHardlinks().
+	moved   bool   // Moved by renameWatches(), which also reports the IN_MOVE_SELF.
+	upper   uint32 // Watch descriptor in the upper directory of overlayfs, for WithOverlayUpper(); 0 if none.
+
+	// Set for WithFileID(), to find the watch after the directory was moved.
+	fi os.FileInfo
 }
 
 // readEvents reads from the inotify file descriptor, converts the
 // received events into Event objects and sends them via the Events channel
 func (w *Watcher) readEvents() {
-	var (
-		buf   [unix.SizeofInotifyEvent * 4096]byte // Buffer for a maximum of 4096 raw events
-		errno error                                // Syscall errno
-	)
+	var buf [unix.SizeofInotifyEvent * 4096]byte // Buffer for a maximum of 4096 raw events
 
 	defer close(w.doneResp)
-	defer close(w.Errors)
-	defer close(w.Events)
+	defer func() {
+		// Wait for other goroutines that are sending.
+		w.sendMu.Lock()
+		close(w.Events)
+		close(w.Errors)
+		w.sendMu.Unlock()
+	}()
 
 	for {
 		// See if we have been closed.
@@ -222,6 +1241,11 @@ func (w *Watcher) readEvents() {
 		switch {
 		case errors.Unwrap(err) == os.ErrClosed:
 			return
+		case errors.Is(err, os.ErrDeadlineExceeded) && w.drain > 0:
+			// Close() was called with WithDrainOnClose().
+			w.drainEvents(buf[:])
+			<-w.done
+			return
 		case err != nil:
 			if !w.sendError(err) {
 				return
@@ -229,77 +1253,358 @@ func (w *Watcher) readEvents() {
 			continue
 		}
 
-		if n < unix.SizeofInotifyEvent {
-			var err error
-			if n == 0 {
-				// If EOF is received. This should really never happen.
-				err = io.EOF
-			} else if n < 0 {
-				// If an error occurred while reading.
-				err = errno
-			} else {
-				// Read was too short.
-				err = errors.New("notify: short read in readEvents()")
+		if !w.handleEvents(buf[:n]) {
+			return
+		}
+	}
+}
+
+// drainEvents sends the events that are still queued in the kernel, and waits
+// for the pipeline to send them, for WithDrainOnClose().
+func (w *Watcher) drainEvents(buf []byte) {
+	defer close(w.drained)
+	for !w.isClosed() {
+		n, err := unix.Read(w.fd, buf)
+		if err != nil || n <= 0 { // EAGAIN once the queue is empty.
+			break
+		}
+		if !w.handleEvents(buf[:n]) {
+			return
+		}
+	}
+	w.mu.Lock()
+	deadline := w.drainUntil
+	w.mu.Unlock()
+	w.pipe.flush(deadline)
+}
+
+// handleEvents converts the raw inotify events in buf into Event objects and
+// sends them. Returns false if the watcher is closed.
+func (w *Watcher) handleEvents(buf []byte) bool {
+	n := len(buf)
+	if n < unix.SizeofInotifyEvent {
+		var err error
+		if n == 0 {
+			// If EOF is received. This should really never happen.
+			err = io.EOF
+		} else {
+			// Read was too short.
+			err = errors.New("notify: short read in readEvents()")
+		}
+		return w.sendError(err)
+	}
+
+	var offset uint32
+	// We don't know how many events we just read into the buffer
+	// While the offset points to at least one whole event...
+	for offset <= uint32(n-unix.SizeofInotifyEvent) {
+		var (
+			// Point "raw" to the event in the buffer
+			raw     = (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			mask    = uint32(raw.Mask)
+			nameLen = uint32(raw.Len)
+		)
+
+		if mask&unix.IN_Q_OVERFLOW != 0 {
+			if !w.sendError(&GapError{Roots: w.watchRoots(), Err: ErrEventOverflow}) {
+				return false
 			}
-			if !w.sendError(err) {
-				return
+		}
+
+		var child string
+		if nameLen > 0 {
+			// Point "bytes" at the first byte of the filename
+			bytes := (*[unix.PathMax]byte)(unsafe.Pointer(&buf[offset+unix.SizeofInotifyEvent]))[:nameLen:nameLen]
+			// The filename is padded with NULL bytes. TrimRight() gets rid of those.
+			child = strings.TrimRight(string(bytes[0:nameLen]), "\000")
+		}
+
+		if e, upper, send := w.upperEvent(int(raw.Wd), child, mask); upper {
+			if send && !w.overlayDuplicate(e, true) && !w.sendEvent(e) {
+				return false
 			}
+			offset += unix.SizeofInotifyEvent + nameLen
 			continue
 		}
 
-		var offset uint32
-		// We don't know how many events we just read into the buffer
-		// While the offset points to at least one whole event...
-		for offset <= uint32(n-unix.SizeofInotifyEvent) {
-			var (
-				// Point "raw" to the event in the buffer
-				raw     = (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
-				mask    = uint32(raw.Mask)
-				nameLen = uint32(raw.Len)
-			)
-
-			if mask&unix.IN_Q_OVERFLOW != 0 {
-				if !w.sendError(ErrEventOverflow) {
-					return
-				}
+		// If the event happened to the watched directory or the watched file, the kernel
+		// doesn't append the filename to the event, but we would like to always fill the
+		// the "Name" field with a valid filename. We retrieve the path of the watch from
+		// the "paths" map.
+		w.mu.Lock()
+		name, ok := w.paths[int(raw.Wd)]
+		var recurse bool
+		if watch := w.watches[name]; ok && watch != nil {
+			recurse = watch.recurse
+		}
+		dup := ok && w.isParentDuplicate(name, child, mask)
+		// The parent directory already sent the rename of a directory
+		// that was moved with renameWatches().
+		if watch := w.watches[name]; ok && watch != nil && child == "" && watch.moved && mask&unix.IN_MOVE_SELF != 0 {
+			watch.moved = false
+			dup = true
+		}
+		// IN_DELETE_SELF occurs when the file/directory being watched is removed.
+		// This is a sign to clean up the maps, otherwise we are no longer in sync
+		// with the inotify kernel state which has already deleted the watch
+		// automatically.
+		if ok && mask&unix.IN_DELETE_SELF == unix.IN_DELETE_SELF {
+			delete(w.paths, int(raw.Wd))
+			delete(w.watches, name)
+			delete(w.userWatches, name)
+		}
+		w.mu.Unlock()
+
+		if child != "" {
+			name += "/" + child
+		}
+
+		// Update the watches of a directory that was moved here before
+		// the events from its own watch are read. The IN_MOVED_FROM and
+		// IN_MOVED_TO events of a rename have the same cookie.
+		if mask&unix.IN_MOVED_FROM != 0 && mask&unix.IN_ISDIR != 0 {
+			w.movedFrom = movedDir{cookie: raw.Cookie, name: name}
+		}
+		if mask&unix.IN_MOVED_TO != 0 && mask&unix.IN_ISDIR != 0 {
+			from := w.movedFrom
+			w.movedFrom = movedDir{}
+			if from.name == "" || from.cookie != raw.Cookie || !w.followRename(from.name, name) {
+				w.followMove(name)
+			}
+		}
+
+		event := w.newEvent(name, mask)
+
+		// Send the events that are not ignored on the events channel
+		if mask&(unix.IN_IGNORED|unix.IN_UNMOUNT) == 0 && !dup && !w.overlayDuplicate(event, false) {
+			if !w.sendEvent(event) {
+				return false
+			}
+		}
+
+		// The filesystem was unmounted, which removes the watch. This is
+		// expected with WithMounts(), as the watches are re-added.
+		if mask&unix.IN_UNMOUNT != 0 && !w.optsFor(name).mounts {
+			if !w.sendError(&WatchError{Kind: KindWatchLost, Path: name, Err: ErrWatchLost}) {
+				return false
 			}
+		}
 
-			// If the event happened to the watched directory or the watched file, the kernel
-			// doesn't append the filename to the event, but we would like to always fill the
-			// the "Name" field with a valid filename. We retrieve the path of the watch from
-			// the "paths" map.
-			w.mu.Lock()
-			name, ok := w.paths[int(raw.Wd)]
-			// IN_DELETE_SELF occurs when the file/directory being watched is removed.
-			// This is a sign to clean up the maps, otherwise we are no longer in sync
-			// with the inotify kernel state which has already deleted the watch
-			// automatically.
-			if ok && mask&unix.IN_DELETE_SELF == unix.IN_DELETE_SELF {
-				delete(w.paths, int(raw.Wd))
-				delete(w.watches, name)
+		// Keep track of files with hard links in a watched directory.
+		if child != "" && mask&unix.IN_ISDIR == 0 && w.optsFor(name).hardlinks {
+			if !w.updateLink(name, mask) {
+				return false
 			}
-			w.mu.Unlock()
+		}
 
-			if nameLen > 0 {
-				// Point "bytes" at the first byte of the filename
-				bytes := (*[unix.PathMax]byte)(unsafe.Pointer(&buf[offset+unix.SizeofInotifyEvent]))[:nameLen:nameLen]
-				// The filename is padded with NULL bytes. TrimRight() gets rid of those.
-				name += "/" + strings.TrimRight(string(bytes[0:nameLen]), "\000")
+		// Add watches for new directories in a recursive watch, and send
+		// Create events for anything that was created in them before the
+		// watch was set up.
+		if recurse && mask&unix.IN_ISDIR != 0 && event.Has(Create) {
+			if !w.addRecursive(event.Name) {
+				return false
 			}
+		}
 
-			event := w.newEvent(name, mask)
+		// Move to the next event in the buffer
+		offset += unix.SizeofInotifyEvent + nameLen
+	}
+	return true
+}
 
-			// Send the events that are not ignored on the events channel
-			if mask&unix.IN_IGNORED == 0 {
-				if !w.sendEvent(event) {
-					return
+// addRecursive adds watches for the new directory dir and all its
+// subdirectories. Returns false if the watcher is closed.
+func (w *Watcher) addRecursive(dir string) bool {
+	with := w.optsFor(dir)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if with.skip(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path != dir && !w.sendEvent(Event{Name: path, Op: Create}) {
+			return errClosed
+		}
+		if d.IsDir() {
+			if with.tooDeep(path) {
+				return filepath.SkipDir
+			}
+			if with.group != "" {
+				if skip, err := w.pipe.skipWatch(with.group, w.groupWatches); skip {
+					if err != nil && !w.sendError(err) {
+						return errClosed
+					}
+					return filepath.SkipDir
 				}
 			}
+			return w.add(path, true, with)
+		}
+		if with.hardlinks && d.Type().IsRegular() {
+			return w.addLink(path, with)
+		}
+		return nil
+	})
+	switch {
+	case err == errClosed:
+		return false
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return w.sendError(err)
+	}
+	return true
+}
 
-			// Move to the next event in the buffer
-			offset += unix.SizeofInotifyEvent + nameLen
+// followMove updates the paths of the watches for the directory that was moved
+// to name, and everything below it, if it was added with WithFileID().
+func (w *Watcher) followMove(name string) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path, watch := range w.watches {
+		if watch.fi != nil && path != name && os.SameFile(watch.fi, fi) {
+			w.renameWatches(path, name)
+			return
+		}
+	}
+}
+
+// followRename updates the paths of the watches for the directory from that
+// was renamed to name, if it's part of a recursive watch. Returns false if it's
+// not.
+func (w *Watcher) followRename(from, name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if watch := w.watches[from]; watch == nil || !watch.recurse {
+		return false
+	}
+	w.renameWatches(from, name)
+	return true
+}
+
+// renameWatches changes the paths of the watches for the directory from, and
+// everything below it, to name.
+//
+// Must be called with w.mu locked.
+func (w *Watcher) renameWatches(from, name string) {
+	var moved []*watch
+	for path, watch := range w.watches {
+		if path == from || strings.HasPrefix(path, from+"/") {
+			moved = append(moved, watch)
+			delete(w.watches, path)
+		}
+	}
+	for _, watch := range moved {
+		watch.path = name + strings.TrimPrefix(watch.path, from)
+		watch.moved = watch.path == name
+		w.watches[watch.path] = watch
+		w.paths[int(watch.wd)] = watch.path
+		if watch.upper != 0 {
+			w.uppers[int(watch.upper)] = watch.path
+		}
+	}
+
+	userWatches := make(map[string]withOpts)
+	for path, with := range w.userWatches {
+		if path == from || strings.HasPrefix(path, from+"/") {
+			userWatches[path] = with
+			delete(w.userWatches, path)
+		}
+	}
+	for path, with := range userWatches {
+		with.root = name + strings.TrimPrefix(path, from)
+		w.userWatches[with.root] = with
+	}
+}
+
+// upperEvent returns the event for an inotify event from a watch in the upper
+// directory of overlayfs, for WithOverlayUpper(). upper is false if wd isn't
+// such a watch, and send is false if the event shouldn't be sent.
+func (w *Watcher) upperEvent(wd int, child string, mask uint32) (e Event, upper, send bool) {
+	w.mu.Lock()
+	name, ok := w.uppers[wd]
+	if _, main := w.paths[wd]; main {
+		ok = false
+	}
+	if ok && mask&unix.IN_IGNORED != 0 {
+		delete(w.uppers, wd)
+		if watch := w.watches[name]; watch != nil && watch.upper == uint32(wd) {
+			watch.upper = 0
+		}
+	}
+	w.mu.Unlock()
+
+	// Changes to the directory itself are sent by the watch in the merged
+	// directory; the upper directory may be removed or replaced while the
+	// merged directory stays the same.
+	if !ok || child == "" {
+		return Event{}, ok, false
+	}
+	e = w.newEvent(name+"/"+child, mask)
+	// Removing a file from a lower layer creates a whiteout with the same name
+	// in the upper directory; the file doesn't exist in the merged directory.
+	if e.Has(Create) {
+		if _, err := os.Lstat(e.Name); err != nil {
+			return e, true, false
+		}
+	}
+	return e, true, true
+}
+
+// overlayDuplicate reports if e is the same change as the previous event, and
+// one was sent by the watch in the merged directory of overlayfs and the other
+// by the watch in the upper directory.
+//
+// Only used by readEvents().
+func (w *Watcher) overlayDuplicate(e Event, upper bool) bool {
+	last := w.overlayLast
+	if e.Name == last.name && e.Op == last.op && upper != last.upper {
+		w.overlayLast = overlayEvent{}
+		return true
+	}
+	w.overlayLast = overlayEvent{name: e.Name, op: e.Op, upper: upper}
+	return false
+}
+
+// isParentDuplicate reports if an event for child in the watch for path is
+// also sent by another watch, because both a file and its parent directory are
+// watched with WithoutParentDuplicates(). The event from the file's own watch
+// is sent, except for deletes: the file's watch sends IN_DELETE_SELF before
+// the parent sends IN_DELETE, and the file's watch is gone by then.
+//
+// Must be called with w.mu locked.
+func (w *Watcher) isParentDuplicate(path, child string, mask uint32) bool {
+	if child == "" {
+		// The watch for a file with hard links only sends changes to the
+		// contents and attributes; everything else comes from the directory.
+		if watch := w.watches[path]; watch != nil && watch.link {
+			return mask&(unix.IN_MODIFY|unix.IN_ATTRIB) == 0
+		}
+		if mask&unix.IN_DELETE_SELF == 0 || !lookupOpts(w.userWatches, path).noParentDups {
+			return false
 		}
+		_, ok := w.watches[filepath.Dir(path)]
+		return ok
+	}
+
+	path += "/" + child
+	if mask&(unix.IN_MODIFY|unix.IN_ATTRIB|unix.IN_MOVED_FROM) == 0 {
+		return false
 	}
+	watch, ok := w.watches[path]
+	if !ok {
+		return false
+	}
+	if watch.link {
+		return mask&(unix.IN_MODIFY|unix.IN_ATTRIB) != 0
+	}
+	return lookupOpts(w.userWatches, path).noParentDups
 }
 
 // newEvent returns an platform-independent Event based on an inotify mask.
@@ -320,5 +1625,8 @@ func (w *Watcher) newEvent(name string, mask uint32) Event {
 	if mask&unix.IN_ATTRIB == unix.IN_ATTRIB {
 		e.Op |= Chmod
 	}
+	if mask&unix.IN_CLOSE_WRITE == unix.IN_CLOSE_WRITE {
+		e.Op |= CloseWrite
+	}
 	return e
 }
@@ -8,10 +8,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // TODO: I'm not sure if these tests are still needed; I think they've become
@@ -325,7 +328,7 @@ func TestInotifyOverflow(t *testing.T) {
 		case err := <-errChan:
 			t.Fatalf("Got an error from file creator goroutine: %v", err)
 		case err := <-w.Errors:
-			if err == ErrEventOverflow {
+			if errors.Is(err, ErrEventOverflow) {
 				overflows++
 			} else {
 				t.Fatalf("Got an error from watcher: %v", err)
@@ -496,3 +499,241 @@ func TestInotifyDeleteOpenedFile(t *testing.T) {
 	fd.Close()
 	checkEvent(Remove)
 }
+
+func TestInotifyWithFileID(t *testing.T) {
+	tests := []testCase{
+		{"follow moved dir", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "a")
+			for _, p := range []string{tmp, filepath.Join(tmp, "a")} {
+				if err := w.AddWith(p, WithFileID()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mv(t, filepath.Join(tmp, "a"), tmp, "b")
+			touch(t, tmp, "b", "file")
+		}, `
+			rename /a
+			create /b
+			create /b/file
+		`},
+		{"without option", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "a")
+			addWatch(t, w, tmp)
+			addWatch(t, w, tmp, "a")
+
+			mv(t, filepath.Join(tmp, "a"), tmp, "b")
+			touch(t, tmp, "b", "file")
+		}, `
+			rename /a
+			create /b
+			rename /a
+			create /a/file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestInotifyRenameRecursive(t *testing.T) {
+	tests := []testCase{
+		{"rename subdirectory", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "a")
+			mkdir(t, tmp, "a", "b")
+			addWatch(t, w, tmp, "...")
+
+			mv(t, filepath.Join(tmp, "a"), tmp, "c")
+			touch(t, tmp, "c", "b", "file")
+
+			// The watches for the old paths should be gone.
+			w.mu.Lock()
+			for path := range w.watches {
+				if rel, _ := filepath.Rel(tmp, path); rel == "a" || strings.HasPrefix(rel, "a/") {
+					t.Errorf("watch for old path: %s", rel)
+				}
+			}
+			w.mu.Unlock()
+			if err := w.Remove(filepath.Join(tmp, "...")); err != nil {
+				t.Error(err)
+			}
+		}, `
+			rename /a
+			create /c
+			create /c/b
+			create /c/b/file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestInotifyCheck(t *testing.T) {
+	tests := []testCase{
+		{"replaced directory", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "a")
+			addWatch(t, w, tmp)
+			addWatch(t, w, tmp, "a")
+
+			// The watch follows the directory to /b.
+			mv(t, filepath.Join(tmp, "a"), tmp, "b")
+			mkdir(t, tmp, "a")
+			eventSeparator()
+
+			health, err := w.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []WatchHealth{
+				{Path: tmp, Status: WatchOK},
+				{Path: filepath.Join(tmp, "a"), Status: WatchRestored},
+			}
+			if !reflect.DeepEqual(health, want) {
+				t.Errorf("\nhave: %v\nwant: %v", health, want)
+			}
+
+			touch(t, tmp, "a", "file")
+			touch(t, tmp, "b", "file")
+		}, `
+			rename /a
+			create /b
+			rename /a
+			create /a
+			create /a/file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestInotifyCheckEvery(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "a")
+	w := newWatcher(t, filepath.Join(tmp, "a"))
+	defer w.Close()
+	go func() {
+		for range w.Events {
+		}
+	}()
+
+	reports := make(chan []WatchHealth, 100)
+	stop := w.CheckEvery(10*time.Millisecond, func(h []WatchHealth) {
+		select {
+		case reports <- h:
+		default:
+		}
+	})
+	defer stop()
+
+	mv(t, filepath.Join(tmp, "a"), tmp, "b")
+	mkdir(t, tmp, "a")
+
+	// A check may run between the mv and mkdir and report the watch as
+	// broken; it's restored by the next check.
+	want := []WatchHealth{{Path: filepath.Join(tmp, "a"), Status: WatchRestored}}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case h := <-reports:
+			if reflect.DeepEqual(h, want) {
+				return
+			}
+			if len(h) != 1 || h[0].Status != WatchBroken {
+				t.Fatalf("\nhave: %v\nwant: %v", h, want)
+			}
+		case <-timeout:
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestInotifySpecialFiles(t *testing.T) {
+	tests := []testCase{
+		{"fifo", func(t *testing.T, w *Watcher, tmp string) {
+			fifo := filepath.Join(tmp, "fifo")
+			if err := unix.Mkfifo(fifo, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			// inotify doesn't need WithSpecialFiles().
+			addWatch(t, w, fifo)
+
+			f, err := os.OpenFile(fifo, os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := f.Write([]byte("data")); err != nil {
+				t.Fatal(err)
+			}
+		}, `
+			write /fifo
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestInotifyWithTruncate(t *testing.T) {
+	tests := []testCase{
+		{"truncate", func(t *testing.T, w *Watcher, tmp string) {
+			file := filepath.Join(tmp, "file")
+			cat(t, "hello, world", file)
+			if err := w.AddWith(tmp, WithTruncate()); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Truncate(file, 5); err != nil {
+				t.Fatal(err)
+			}
+			eventSeparator()
+			cat(t, "!!", file)
+			if err := os.Truncate(file, 0); err != nil {
+				t.Fatal(err)
+			}
+		}, `
+			write|truncate /file
+			write          /file
+			write|truncate /file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestInotifyPreflightUsed(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "dir")
+	w := newWatcher(t, tmp, filepath.Join(tmp, "dir"))
+	defer w.Close()
+
+	r, err := Preflight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := make(map[string]int)
+	for _, l := range r.Limits {
+		used[l.Name] = l.Used
+	}
+	// Other tests may have watchers too.
+	if used["fs.inotify.max_user_watches"] < 2 || used["fs.inotify.max_user_instances"] < 1 || used["RLIMIT_NOFILE"] < 1 {
+		t.Errorf("wrong usage: %v", r.Limits)
+	}
+}
@@ -4,16 +4,23 @@
 package fsnotify
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime/pprof"
+	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
 
+// backendName is the name of the backend; see Watcher.BackendName().
+const backendName = "kqueue"
+
 // Watcher watches a set of files, delivering events to a channel.
 type Watcher struct {
 	Events chan Event
@@ -26,11 +33,28 @@ type Watcher struct {
 	mu           sync.Mutex                  // Protects access to watcher data
 	watches      map[string]int              // Watched file descriptors (key: path).
 	watchesByDir map[string]map[int]struct{} // Watched file descriptors indexed by the parent directory (key: dirname(path)).
-	userWatches  map[string]struct{}         // Watches added with Watcher.Add()
+	userWatches  map[string]withOpts         // Watches added with Watcher.Add(), and their options
+	recursive    map[string]struct{}         // Directories that are part of a recursive watch ("dir/...").
 	dirFlags     map[string]uint32           // Watched directories to fflags used in kqueue.
 	paths        map[int]pathInfo            // File descriptors to path names for processing kqueue events.
 	fileExists   map[string]struct{}         // Keep track of if we know this file exists (to stop duplicate create events).
 	isClosed     bool                        // Set to true when Close() is first called
+	scans        scanGate                    // Holds back new events while scanning for WithInitialScan() and WithCatchUp()
+	pipe         *pipeline                   // Userspace processing of events
+	sendMu       sync.RWMutex                // Read-locked while sending; the reader write-locks it before closing the channels
+	onError      func(error)                 // Set with WithErrorHandler()
+	id           uint64                      // Returned by ID()
+	doneResp     chan struct{}               // Closed when the reader goroutine exited; returned by Done()
+	sync         *syncQueue                  // Events for Next(); set with WithSynchronous()
+	nextMu       sync.Mutex                  // Held by Next(), and by Close() to close the kqueue
+	nextBuf      []unix.Kevent_t             // Buffer for Next()
+	drain        time.Duration               // Set with WithDrainOnClose()
+	drained      chan struct{}               // Closed by the reader once it drained the events, for WithDrainOnClose()
+	drainUntil   time.Time                   // Deadline to drain the events
+	started      runState                    // Set by Start()
+	opts         []watcherOpt                // Options passed to NewWatcherWith(), for Clone()
+	stats        statCache                   // Lstat() results for bursts of events
+	noStat       bool                        // Set with WithoutStatChecks()
 }
 
 type pathInfo struct {
@@ -39,7 +63,25 @@ type pathInfo struct {
 }
 
 // NewWatcher establishes a new watcher with the underlying OS and begins waiting for events.
-func NewWatcher() (*Watcher, error) {
+func NewWatcher() (*Watcher, error) { return NewWatcherWith() }
+
+// NewWatcherWith is like NewWatcher, but allows adding options.
+//
+// Possible options are:
+//
+//   - WithErrorHandler  call a function for errors, rather than sending them
+//     on the Errors channel.
+//   - WithSynchronous   read events with Next(), without starting a goroutine.
+//   - WithDrainOnClose  send all events that were read before closing the
+//     channels in Close().
+//   - WithNames         set how paths are reported in Event.Name.
+//   - WithPortable      send events in the same shape on all platforms.
+//   - WithoutStatChecks don't check if a directory still exists (kqueue).
+func NewWatcherWith(opts ...watcherOpt) (*Watcher, error) {
+	with := getWatcherOptions(opts...)
+	if err := checkBackend(with.backend); err != nil {
+		return nil, err
+	}
 	kq, closepipe, err := newKqueue()
 	if err != nil {
 		return nil, err
@@ -53,13 +95,34 @@ func NewWatcher() (*Watcher, error) {
 		dirFlags:     make(map[string]uint32),
 		paths:        make(map[int]pathInfo),
 		fileExists:   make(map[string]struct{}),
-		userWatches:  make(map[string]struct{}),
+		userWatches:  make(map[string]withOpts),
+		recursive:    make(map[string]struct{}),
 		Events:       make(chan Event),
 		Errors:       make(chan error),
 		done:         make(chan struct{}),
+		doneResp:     make(chan struct{}),
+		drained:      make(chan struct{}),
+		onError:      with.onError,
+		opts:         append([]watcherOpt(nil), opts...),
+		noStat:       with.noStat,
 	}
-
-	go w.readEvents()
+	w.pipe = newPipeline(w.emit)
+	w.pipe.names = with.names
+	if with.portable {
+		w.pipe.portable = newPortableQueue(w.pipe.queue)
+	}
+	w.pipe.readd = w.readd
+	w.pipe.sendErr = w.sendError
+	w.pipe.labels, w.id = watcherLabels(backendName)
+	trackWatcher(w.id, backendName)
+	w.scans.labels = w.pipe.labels
+
+	if with.synchronous {
+		w.sync = new(syncQueue)
+		return w, nil
+	}
+	w.drain = with.drain
+	goLabeled(w.pipe.labels, "reader", w.readEvents)
 	return w, nil
 }
 
@@ -100,20 +163,62 @@ func newKqueue() (kq int, closepipe [2]int, err error) {
 
 // Returns true if the event was sent, or false if watcher is closed.
 func (w *Watcher) sendEvent(e Event) bool {
+	w.scans.wait()
+	return w.sendSynthetic(e)
+}
+
+// sendSynthetic sends an event that didn't come from kqueue, without waiting
+// for scans to finish.
+// Returns true if the event was sent, or false if watcher is closed.
+func (w *Watcher) sendSynthetic(e Event) bool {
+	return w.pipe.send(e, w.optsFor(e.Name))
+}
+
+// emit sends the event on the Events channel, after all processing.
+// Returns true if the event was sent, or false if watcher is closed.
+func (w *Watcher) emit(e Event) bool {
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
+	select {
+	case <-w.done:
+		return false // The channels may be closed already.
+	default:
+	}
+	if w.sync != nil {
+		w.sync.push(e, nil)
+		return true
+	}
 	select {
 	case w.Events <- e:
 		return true
 	case <-w.done:
+	case <-w.pipe.done:
 	}
 	return false
 }
 
 // Returns true if the error was sent, or false if watcher is closed.
 func (w *Watcher) sendError(err error) bool {
+	if w.onError != nil {
+		w.onError(newWatchError(err, ""))
+		return true
+	}
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
 	select {
-	case w.Errors <- err:
+	case <-w.done:
+		return false // The channels may be closed already.
+	default:
+	}
+	if w.sync != nil {
+		w.sync.push(Event{}, newWatchError(err, ""))
+		return true
+	}
+	select {
+	case w.Errors <- newWatchError(err, ""):
 		return true
 	case <-w.done:
+	case <-w.pipe.done:
 	}
 	return false
 }
@@ -126,6 +231,8 @@ func (w *Watcher) Close() error {
 		return nil
 	}
 	w.isClosed = true
+	w.drainUntil = time.Now().Add(w.drain)
+	untrackWatcher(w.id)
 
 	// copy paths to remove while locked
 	pathsToRemove := make([]string, 0, len(w.watches))
@@ -135,28 +242,348 @@ func (w *Watcher) Close() error {
 	w.mu.Unlock()
 	// unlock before calling Remove, which also locks
 
+	// Send "quit" message to the reader goroutine. With WithDrainOnClose() it
+	// first reads the rest of the events; wait for them to be sent before
+	// removing the watches.
+	draining := w.drain > 0
+	if draining {
+		unix.Close(w.closepipe[1])
+		t := time.NewTimer(w.drain)
+		select {
+		case <-w.drained:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+
 	for _, name := range pathsToRemove {
 		w.Remove(name)
 	}
+	w.pipe.close()
+
+	if !draining {
+		unix.Close(w.closepipe[1])
+	}
 
-	// Send "quit" message to the reader goroutine.
-	unix.Close(w.closepipe[1])
+	// There is no reader goroutine with WithSynchronous(); close the kqueue
+	// here unless Next() already saw the closepipe.
+	if w.sync != nil {
+		w.nextMu.Lock()
+		defer w.nextMu.Unlock()
+		select {
+		case <-w.done:
+		default:
+			w.closeReader()
+		}
+	}
 
 	return nil
 }
 
+// Next returns the next event or error for a watcher created with
+// WithSynchronous(), reading events from the kernel if there are none
+// waiting. It blocks until there is one, ctx is done, or the watcher is
+// closed, in which case it returns ctx.Err() or ErrClosed.
+//
+// Errors are returned as they would be sent on the Errors channel; the watcher
+// can still be used after an error. Next must not be called concurrently.
+func (w *Watcher) Next(ctx context.Context) (Event, error) {
+	if w.sync == nil {
+		return Event{}, errors.New("fsnotify: Next() requires WithSynchronous()")
+	}
+	w.nextMu.Lock()
+	defer w.nextMu.Unlock()
+	if w.nextBuf == nil {
+		w.nextBuf = make([]unix.Kevent_t, 10)
+	}
+
+	for {
+		if it, ok := w.sync.pop(); ok {
+			return it.e, it.err
+		}
+		select {
+		case <-w.done:
+			return Event{}, ErrClosed
+		default:
+		}
+		if err := ctx.Err(); err != nil {
+			return Event{}, err
+		}
+
+		wait := time.Until(syncDeadline(ctx))
+		if wait < 0 {
+			wait = 0
+		}
+		ts := unix.NsecToTimespec(int64(wait))
+		n, err := unix.Kevent(w.kq, nil, w.nextBuf, &ts)
+		switch {
+		case err == unix.EINTR:
+			continue
+		case err != nil:
+			return Event{}, err
+		}
+		if w.handleKevents(w.nextBuf[:n]) {
+			w.closeReader()
+		}
+	}
+}
+
+// SysFd returns the kqueue file descriptor, so that it can be added to
+// an external poller (such as epoll) to know when TryRead() has events to
+// read. It must not be read from or closed.
+//
+// This is only useful with WithSynchronous(); without it the reader goroutine
+// already reads from it. It returns ErrClosed after the watcher is closed.
+func (w *Watcher) SysFd() (uintptr, error) {
+	select {
+	case <-w.done:
+		return 0, ErrClosed
+	default:
+	}
+	return uintptr(w.kq), nil
+}
+
+// TryRead is like Next, but doesn't block: it returns false if there are no
+// events waiting and nothing can be read from the kernel right now. Use
+// SysFd() to wait until there is something to read.
+func (w *Watcher) TryRead() (Event, bool, error) {
+	if w.sync == nil {
+		return Event{}, false, errors.New("fsnotify: TryRead() requires WithSynchronous()")
+	}
+	w.nextMu.Lock()
+	defer w.nextMu.Unlock()
+	if w.nextBuf == nil {
+		w.nextBuf = make([]unix.Kevent_t, 10)
+	}
+
+	for {
+		if it, ok := w.sync.pop(); ok {
+			return it.e, true, it.err
+		}
+		select {
+		case <-w.done:
+			return Event{}, false, ErrClosed
+		default:
+		}
+
+		var ts unix.Timespec // Zero timeout: return right away.
+		n, err := unix.Kevent(w.kq, nil, w.nextBuf, &ts)
+		switch {
+		case err == unix.EINTR:
+			continue
+		case err != nil:
+			return Event{}, false, err
+		case n == 0:
+			return Event{}, false, nil
+		}
+		if w.handleKevents(w.nextBuf[:n]) {
+			w.closeReader()
+		}
+	}
+}
+
 // Add starts watching the named file or directory (non-recursively).
-func (w *Watcher) Add(name string) error {
+func (w *Watcher) Add(name string) error { return w.AddWith(name) }
+
+// AddWith is like Add, but allows adding options. When using Add() the
+// defaults described below are used.
+//
+// A path ending in "/..." is watched recursively: all subdirectories are
+// watched as well, and directories created later on are added automatically.
+//
+// AddWith and Remove can be called from the goroutine that reads the Events
+// channel, for example to watch a directory from its Create event; they don't
+// wait for the events to be read.
+//
+// Possible options are:
+//
+//   - WithInitialScan   send events for files that already exist.
+//   - WithCatchUp       send events for files changed since a point in time.
+//   - WithContentHash   drop Write events if the content didn't change.
+//   - WithIgnore        exclude paths matching gitignore rules.
+//   - WithIgnorePreset  exclude editor, OS, VCS, or build tool files.
+//   - WithInclude       only send events for paths matching glob patterns.
+//   - WithExclude       exclude paths matching glob patterns.
+//   - WithIncludeRegexp only send events for paths matching regular expressions.
+//   - WithExcludeRegexp exclude paths matching regular expressions.
+//   - WithMaxDepth      limit how deep a recursive watch descends.
+//   - WithSkipHidden    exclude hidden files and directories.
+//   - WithoutChmod      don't watch for Chmod events.
+//   - WithDedup         drop events identical to the previous event.
+//   - WithClock         use a fake clock for the time-based options, for tests.
+//   - WithFileID        follow moved directories (only on Linux).
+//   - WithMounts        watch filesystems mounted in a recursive watch (only on Linux).
+//   - WithoutFollow     watch a symbolic link itself, rather than its target.
+//   - WithHardlinks     send events for changes through other hard links.
+//   - WithCaseInsensitive
+//     match paths case-insensitively on case-insensitive filesystems.
+//   - WithNFC           convert names to Unicode NFC (only on macOS).
+//   - WithSpecialFiles  watch named pipes and devices (only needed on kqueue).
+//   - WithTruncate      set Truncate on Write events for files that became smaller.
+//   - WithSizes         set the file size before and after Write events.
+//   - WithAppendOnly    send merged events for files that grew, for following log files.
+//   - WithOverlayUpper  also watch the upper directory of overlayfs mounts (only on Linux).
+//   - WithOps           only send events with some operations.
+//   - WithDebounce      merge the events for a path until it stops changing.
+//   - WithSettle        send a Settled event once a watch stops changing.
+//   - WithCloseWrite    send CloseWrite events when files are closed (only on Linux).
+//   - WithCompleteCreate
+//     send Create events once files are done being copied.
+//   - WithReplace       send a Replaced event if the directory is replaced.
+//   - WithReplaceDiff   also send the differences after a Replaced event.
+//   - WithPriority      send events ahead of other watches if they're not read fast enough.
+//   - WithGroup         add the watch to a watch group; see Group().
+//   - WithRelativeNames set Event.Name relative to the watched path.
+//   - WithoutFUSE       return an error for paths on FUSE filesystems.
+//   - WithoutParentDuplicates
+//     send events once if both a file and its directory are watched.
+func (w *Watcher) AddWith(name string, opts ...addOpt) error {
+	with := getOptions(opts...)
+
+	name, err := with.expandPath(name)
+	if err != nil {
+		return err
+	}
+	name, recurse := recursivePath(name)
+	with.setRoot(name, recurse)
+	if with.noFUSE {
+		if err := checkFUSE(name); err != nil {
+			return err
+		}
+	}
+	if recurse {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("fsnotify: not a directory: %q", name)
+		}
+	}
+
+	if with.scanning() {
+		w.scans.start()
+	}
+	w.mu.Lock()
+	w.userWatches[name] = with
+	if recurse {
+		w.recursive[name] = struct{}{}
+	}
+	w.mu.Unlock()
+	_, err = w.addWatch(name, noteFlags(with))
+	if err == nil && with.group != "" {
+		if err = w.pipe.checkWatches(with.group, w.groupWatches, 0); err != nil {
+			w.Remove(name)
+		}
+	}
+	if err != nil {
+		if with.scanning() {
+			w.scans.done()
+		}
+		return err
+	}
+	if with.trackSizes() {
+		w.pipe.sizes.seed(name, with)
+	}
+	if with.replaceDiff {
+		w.pipe.replaces.seed(name, with)
+	}
+	if with.priority {
+		w.pipe.prioritize()
+	}
+
+	if with.scanning() {
+		w.scans.run(name, with, w.sendSynthetic, w.sendError)
+	}
+	return nil
+}
+
+// AddFd is like AddWith, but watches the already-open file descriptor fd,
+// rather than opening the path. This allows watching files that were opened
+// before dropping privileges. Events and Remove() use name, which should be the
+// path fd was opened with.
+//
+// The watcher uses a duplicate of fd, so fd can be closed once AddFd returns.
+// Recursive watches and the WithInitialScan and WithCatchUp options aren't
+// supported, as they need to read the directory by name.
+func (w *Watcher) AddFd(fd uintptr, name string, opts ...addOpt) error {
+	with := getOptions(opts...)
+	if with.scanning() {
+		return errors.New("fsnotify: AddFd: can't scan a file descriptor")
+	}
+	name = filepath.Clean(name)
+	with.setRoot(name, false)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(int(fd), &st); err != nil {
+		return err
+	}
+
 	w.mu.Lock()
-	w.userWatches[name] = struct{}{}
+	if w.isClosed {
+		w.mu.Unlock()
+		return errors.New("kevent instance already closed")
+	}
+	watchfd, alreadyWatching := w.watches[name]
+	w.userWatches[name] = with
 	w.mu.Unlock()
-	_, err := w.addWatch(name, noteAllEvents)
+
+	if !alreadyWatching {
+		var err error
+		watchfd, err = unix.Dup(int(fd))
+		if err != nil {
+			w.mu.Lock()
+			delete(w.userWatches, name)
+			w.mu.Unlock()
+			return err
+		}
+	}
+	_, err := w.addWatchFd(name, watchfd, st.Mode&unix.S_IFMT == unix.S_IFDIR, alreadyWatching, noteFlags(with))
+	if err != nil {
+		w.mu.Lock()
+		delete(w.userWatches, name)
+		w.mu.Unlock()
+	}
 	return err
 }
 
+// AddAt is like AddWith, but path is relative to the directory file descriptor
+// dirfd, as with openat(2). The watch is added for the opened file, so it stays
+// correct if dirfd or its parent directories are renamed later on. Events and
+// Remove() use path as the name.
+//
+// path must be a relative path without ".." elements (see fs.ValidPath). Note
+// that symbolic links are followed, so this is not a security boundary.
+//
+// The same limitations as with AddFd() apply. In addition, kqueue reads the
+// contents of directories by name to watch the files in them, so watching a
+// directory only works if path is also valid from the working directory.
+func (w *Watcher) AddAt(dirfd uintptr, path string, opts ...addOpt) error {
+	if !fs.ValidPath(filepath.ToSlash(path)) {
+		return &fs.PathError{Op: "watch", Path: path, Err: fs.ErrInvalid}
+	}
+	fd, err := unix.Openat(int(dirfd), path, openMode, 0)
+	if err != nil {
+		return &fs.PathError{Op: "openat", Path: path, Err: err}
+	}
+	defer unix.Close(fd)
+	return w.AddFd(uintptr(fd), path, opts...)
+}
+
 // Remove stops watching the the named file or directory (non-recursively).
+//
+// Use a path ending in "/..." to remove a recursive watch.
 func (w *Watcher) Remove(name string) error {
-	name = filepath.Clean(name)
+	name, recurse := recursivePath(name)
+	if recurse {
+		w.mu.Lock()
+		_, ok := w.recursive[name]
+		w.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNonExistentWatch, name)
+		}
+	}
+
 	w.mu.Lock()
 	watchfd, ok := w.watches[name]
 	w.mu.Unlock()
@@ -168,12 +595,19 @@ func (w *Watcher) Remove(name string) error {
 	if err != nil {
 		return err
 	}
+	w.forget(name, watchfd)
+	return nil
+}
 
+// forget closes the file descriptor for the watch name, and removes it and the
+// watches for the files in it.
+func (w *Watcher) forget(name string, watchfd int) {
 	unix.Close(watchfd)
 
 	w.mu.Lock()
 	isDir := w.paths[watchfd].isDir
 	delete(w.watches, name)
+	delete(w.userWatches, name)
 
 	parentName := filepath.Dir(name)
 	delete(w.watchesByDir[parentName], watchfd)
@@ -184,6 +618,7 @@ func (w *Watcher) Remove(name string) error {
 
 	delete(w.paths, watchfd)
 	delete(w.dirFlags, name)
+	delete(w.recursive, name)
 	w.mu.Unlock()
 
 	// Find all watched paths that are in this directory that are not external.
@@ -204,11 +639,98 @@ func (w *Watcher) Remove(name string) error {
 			w.Remove(name)
 		}
 	}
+}
 
-	return nil
+// Check verifies that the watches added with Add() or AddWith() are still
+// live, and adds watches that were lost again; the file descriptor must still
+// be open, and the path must still refer to the file that was opened. A path
+// that was replaced, for example by renaming another directory over it, is
+// otherwise no longer watched.
+//
+// Watches for paths that were removed are already reported with a Remove event
+// and aren't checked.
+//
+// Use CheckEvery() to check the watches periodically.
+func (w *Watcher) Check() ([]WatchHealth, error) {
+	w.mu.Lock()
+	if w.isClosed {
+		w.mu.Unlock()
+		return nil, errClosed
+	}
+	userWatches := make(map[string]withOpts, len(w.userWatches))
+	for name, with := range w.userWatches {
+		userWatches[name] = with
+	}
+	w.mu.Unlock()
+
+	health := make([]WatchHealth, 0, len(userWatches))
+	for name, with := range userWatches {
+		h := WatchHealth{Path: name, Status: WatchOK}
+		if with.recurse {
+			h.Path = filepath.Join(name, "...")
+		}
+		if !w.checkWatch(name, with) {
+			h.Status = WatchRestored
+			if err := w.restoreWatch(name, with); err != nil {
+				h.Status, h.Err = WatchBroken, err
+			}
+		}
+		health = append(health, h)
+	}
+	sortWatchHealth(health)
+	return health, nil
+}
+
+// checkWatch reports if the file descriptor for the watch name is still valid,
+// and if name still refers to the same file.
+func (w *Watcher) checkWatch(name string, with withOpts) bool {
+	w.mu.Lock()
+	watchfd, ok := w.watches[name]
+	w.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	var have, want unix.Stat_t
+	if err := unix.Fstat(watchfd, &have); err != nil {
+		return false
+	}
+	stat := unix.Stat
+	if with.noFollow {
+		stat = unix.Lstat
+	}
+	if err := stat(name, &want); err != nil {
+		return false
+	}
+	return have.Dev == want.Dev && have.Ino == want.Ino
+}
+
+// restoreWatch removes the watch for name if there is one, and adds it again.
+func (w *Watcher) restoreWatch(name string, with withOpts) error {
+	w.mu.Lock()
+	watchfd, ok := w.watches[name]
+	w.mu.Unlock()
+	if ok {
+		// Closing the file descriptor also removes it from the kqueue, so
+		// the error doesn't matter.
+		w.register([]int{watchfd}, unix.EV_DELETE, 0)
+		w.forget(name, watchfd)
+	}
+
+	w.mu.Lock()
+	w.userWatches[name] = with
+	if with.recurse {
+		w.recursive[name] = struct{}{}
+	}
+	w.mu.Unlock()
+	_, err := w.addWatch(name, noteFlags(with))
+	return err
 }
 
 // WatchList returns the directories and files that are being monitered.
+//
+// Paths added WithExpand() are returned in the expanded form; Export() also
+// has the form they were added with.
 func (w *Watcher) WatchList() []string {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -221,9 +743,238 @@ func (w *Watcher) WatchList() []string {
 	return entries
 }
 
+// noFollow reports if name was added with WithoutFollow().
+func (w *Watcher) noFollow(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	with, ok := w.userWatches[name]
+	return ok && with.noFollow
+}
+
+// optsFor returns the options of the watch the path name belongs to.
+func (w *Watcher) optsFor(name string) withOpts {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return lookupOpts(w.userWatches, name)
+}
+
+// Export returns a description of all watches added with Add() or AddWith(),
+// which can be added to another watcher with Import().
+func (w *Watcher) Export() []WatchSpec {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	specs := make([]WatchSpec, 0, len(w.userWatches))
+	for pathname, with := range w.userWatches {
+		specs = append(specs, newWatchSpec(pathname, with))
+	}
+	sortWatchSpecs(specs)
+	return specs
+}
+
+// Clone creates a new watcher with the same options as w, and adds all watches
+// that were added to w with Add() or AddWith() with the same options. This can
+// be used to start over after an error the watcher can't recover from, such as
+// ErrEventOverflow, without keeping track of the watches.
+//
+// The new watcher has its own Events and Errors channels; w isn't closed.
+func (w *Watcher) Clone() (*Watcher, error) {
+	return cloneWatcher(w.opts, w.watchOpts())
+}
+
+// watchOpts returns a copy of the watches added with Add() or AddWith(), and
+// their options.
+func (w *Watcher) watchOpts() map[string]withOpts {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watches := make(map[string]withOpts, len(w.userWatches))
+	for name, with := range w.userWatches {
+		watches[name] = with
+	}
+	return watches
+}
+
+// Duplicates returns the number of events that were dropped by WithDedup().
+func (w *Watcher) Duplicates() uint64 {
+	return w.pipe.duplicates()
+}
+
+// Stats returns counters for the work the watcher did.
+func (w *Watcher) Stats() Stats { return w.stats.stats() }
+
+// goroutineLabels returns the pprof labels for goroutines of the watcher.
+func (w *Watcher) goroutineLabels() pprof.LabelSet { return w.pipe.labels }
+
+// ID returns the ID of the watcher, which is unique in the process. The
+// goroutines of the watcher have it as the "fsnotify.watcher" pprof label.
+func (w *Watcher) ID() uint64 { return w.id }
+
+// Done returns a channel that's closed once the watcher is closed and all
+// cleanup is finished: the reader goroutine exited, the kernel resources are
+// released, and the Events and Errors channels are closed.
+func (w *Watcher) Done() <-chan struct{} { return w.doneResp }
+
+// State returns StateRunning, StateClosing once Close() is called, or
+// StateClosed once Close() is finished and Done() is closed.
+func (w *Watcher) State() WatcherState {
+	w.mu.Lock()
+	closing := w.isClosed
+	w.mu.Unlock()
+	return watcherState(w.doneResp, closing)
+}
+
+// IsClosed reports if Close() was called; Add() returns an error after this.
+func (w *Watcher) IsClosed() bool { return w.State() != StateRunning }
+
+// BackendName returns the name of the backend the watcher uses: "kqueue".
+func (w *Watcher) BackendName() string { return backendName }
+
+// Supports reports if the platform supports the feature f. Options for
+// features that aren't supported are ignored or return an error, as documented
+// for every option.
+func (w *Watcher) Supports(f Feature) bool {
+	switch f {
+	case FeatureRecursive, FeatureAddFd, FeatureSynchronous:
+		return true
+	case FeatureNoFollow:
+		return openModeNoFollow != 0
+	}
+	return false
+}
+
+// DebugString returns a description of the internal state of the watcher, for
+// diagnosing missed events; see DebugHandler(). The format may change.
+func (w *Watcher) DebugString() string {
+	var b strings.Builder
+	w.mu.Lock()
+	fmt.Fprintf(&b, "watcher %d, backend: kqueue (fd %d)\n", w.id, w.kq)
+	watches := make([]string, 0, len(w.watches))
+	for path, fd := range w.watches {
+		watches = append(watches, fmt.Sprintf("%s fd=%d", path, fd))
+	}
+	debugSection(&b, "watches", watches)
+	byDir := make([]string, 0, len(w.watchesByDir))
+	for dir, fds := range w.watchesByDir {
+		byDir = append(byDir, fmt.Sprintf("%s %d fds", dir, len(fds)))
+	}
+	debugSection(&b, "watchesByDir", byDir)
+	paths := make([]string, 0, len(w.paths))
+	for fd, p := range w.paths {
+		paths = append(paths, fmt.Sprintf("%6d %s dir=%t", fd, p.name, p.isDir))
+	}
+	debugSection(&b, "open fds", paths)
+	dirFlags := make([]string, 0, len(w.dirFlags))
+	for dir, flags := range w.dirFlags {
+		dirFlags = append(dirFlags, fmt.Sprintf("%s %#x", dir, flags))
+	}
+	debugSection(&b, "dirFlags", dirFlags)
+	exists := make([]string, 0, len(w.fileExists))
+	for path := range w.fileExists {
+		exists = append(exists, path)
+	}
+	debugSection(&b, "fileExists", exists)
+	recursive := make([]string, 0, len(w.recursive))
+	for path := range w.recursive {
+		recursive = append(recursive, path)
+	}
+	debugSection(&b, "recursive", recursive)
+	debugUserWatches(&b, w.userWatches)
+	w.mu.Unlock()
+
+	w.pipe.debugString(&b)
+	return b.String()
+}
+
+// For WatchGroup.Pause() and WatchGroup.Paused().
+func (w *Watcher) pauseGroup(name string, paused bool) { w.pipe.pause(name, paused) }
+func (w *Watcher) groupPaused(name string) bool        { return w.pipe.isPaused(name) }
+
+// For WatchGroup.SetQuota().
+func (w *Watcher) setGroupQuota(name string, q GroupQuota) { w.pipe.setQuota(name, q) }
+
+// groupWatches returns the number of file descriptors watched for the group
+// name.
+func (w *Watcher) groupWatches(name string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var n int
+	for path := range w.watches {
+		if lookupOpts(w.userWatches, path).group == name {
+			n++
+		}
+	}
+	return n
+}
+
+// OnBackpressure sets a function that's called when sending an event on the
+// Events channel has been blocked for longer than threshold, and again every
+// threshold while it stays blocked, so that programs can log or shed load
+// rather than stall silently. Events that are sent to a subscription aren't
+// tracked.
+//
+// fn is called from a separate goroutine; it must not block, as events
+// continue to be sent. Use a nil fn or a threshold of 0 to remove it. If fn
+// panics a *PanicError is sent on the Errors channel.
+func (w *Watcher) OnBackpressure(threshold time.Duration, fn func(Backpressure)) {
+	w.pipe.onBackpressure(threshold, fn)
+}
+
+// Subscribe returns a channel that receives all events for which filter
+// returns true, so that different parts of a program can each receive their
+// own events. A nil filter matches all events.
+//
+// Events that match one or more subscriptions are sent to all of them, and not
+// on the Events channel; other events are still sent on the Events channel.
+// Like the Events channel the subscription channels must be read, as the
+// watcher blocks until the event is received.
+//
+// The channel is closed when the returned function is called, or when the
+// watcher is closed.
+//
+// If filter panics the event isn't sent to the subscription, and a *PanicError
+// is sent on the Errors channel.
+func (w *Watcher) Subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	return w.pipe.subscribe(filter)
+}
+
+// SubscribeWith is like Subscribe, but returns a Subscription that only
+// receives the events that match all options, with its own buffer:
+//
+//	s := w.SubscribeWith(fsnotify.SubscribePatterns("*.go"), fsnotify.SubscribeOps(fsnotify.Write))
+//	defer s.Close()
+//
+// This allows several differently filtered views over the same watches.
+func (w *Watcher) SubscribeWith(opts ...SubscribeOption) *Subscription {
+	ch, cancel := w.pipe.subscribeWith(getSubscribeOptions(opts...))
+	return &Subscription{Events: ch, cancel: cancel}
+}
+
+// Use adds fn to the functions that are called for every event before it's
+// sent on the Events channel or to a subscription. fn can return a changed
+// event, for example to rewrite the path, or false to drop the event. The
+// functions are called in the order they were added, after all options of the
+// watch are applied.
+//
+// fn is called from the goroutine that sends events; sending blocks until it
+// returns. There is no way to remove a function once it's added.
+//
+// If fn panics the event is dropped, and a *PanicError is sent on the Errors
+// channel.
+func (w *Watcher) Use(fn func(Event) (Event, bool)) {
+	w.pipe.use(fn)
+}
+
 // Watch all events (except NOTE_EXTEND, NOTE_LINK, NOTE_REVOKE)
 const noteAllEvents = unix.NOTE_DELETE | unix.NOTE_WRITE | unix.NOTE_ATTRIB | unix.NOTE_RENAME
 
+// noteFlags returns the kqueue flags for a watch with the options in with.
+func noteFlags(with withOpts) uint32 {
+	if with.noChmod {
+		return noteAllEvents &^ unix.NOTE_ATTRIB
+	}
+	return noteAllEvents
+}
+
 // addWatch adds name to the watched file set.
 // The flags are interpreted as described in kevent(2).
 // Returns the real path to the file which was added, if any, which may be different from the one passed in the case of symlinks.
@@ -250,9 +1001,13 @@ func (w *Watcher) addWatch(name string, flags uint32) (string, error) {
 			return "", err
 		}
 
-		// Don't watch sockets or named pipes
-		if (fi.Mode()&os.ModeSocket == os.ModeSocket) || (fi.Mode()&os.ModeNamedPipe == os.ModeNamedPipe) {
-			return "", nil
+		// Watch the link itself with WithoutFollow().
+		mode := openMode
+		if fi.Mode()&os.ModeSymlink == os.ModeSymlink && w.noFollow(name) {
+			if openModeNoFollow == 0 {
+				return "", fmt.Errorf("fsnotify: WithoutFollow: %q: %w", name, unix.ENOTSUP)
+			}
+			mode = openModeNoFollow
 		}
 
 		// Follow Symlinks
@@ -262,7 +1017,7 @@ func (w *Watcher) addWatch(name string, flags uint32) (string, error) {
 		// will act like everything is fine if the link can't be resolved.
 		// There will simply be no file events for broken symlinks. Hence the
 		// returns of nil on errors.
-		if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+		if fi.Mode()&os.ModeSymlink == os.ModeSymlink && mode == openMode {
 			name, err = filepath.EvalSymlinks(name)
 			if err != nil {
 				return "", nil
@@ -282,23 +1037,55 @@ func (w *Watcher) addWatch(name string, flags uint32) (string, error) {
 			}
 		}
 
+		if err := specialFileErr(name, fi.Mode(), w.optsFor(name)); err != nil {
+			return "", err
+		}
+		// Opening a named pipe blocks until there's a writer.
+		if fi.Mode()&(os.ModeNamedPipe|os.ModeDevice) != 0 {
+			mode |= unix.O_NONBLOCK
+		}
+
 		// Retry on EINTR; open() can return EINTR in practice on macOS.
 		// See #354, and go issues 11180 and 39237.
 		for {
-			watchfd, err = unix.Open(name, openMode, 0)
+			watchfd, err = unix.Open(name, mode, 0)
 			if err == nil {
 				break
 			}
 			if errors.Is(err, unix.EINTR) {
 				continue
 			}
+			switch {
+			case errors.Is(err, unix.EMFILE):
+				return "", &limitError{limit: "RLIMIT_NOFILE", err: err}
+			case errors.Is(err, unix.ENFILE):
+				return "", &limitError{limit: "kern.maxfiles", err: err}
+			}
 
 			return "", err
 		}
 
 		isDir = fi.IsDir()
 	}
+	return w.addWatchFd(name, watchfd, isDir, alreadyWatching, flags)
+}
+
+// specialFileErr returns ErrUnsupportedFileType if name is a file with the
+// mode that can't be watched. Sockets can't be opened, and named pipes and
+// devices are only watched with WithSpecialFiles(), as opening them can have
+// side effects.
+func specialFileErr(name string, mode os.FileMode, with withOpts) error {
+	switch {
+	case mode&os.ModeSocket != 0:
+		return fmt.Errorf("%w: socket %q", ErrUnsupportedFileType, name)
+	case mode&(os.ModeNamedPipe|os.ModeDevice) != 0 && !with.specialFiles:
+		return fmt.Errorf("%w: %q (use WithSpecialFiles)", ErrUnsupportedFileType, name)
+	}
+	return nil
+}
 
+// addWatchFd registers the open file descriptor watchfd for name.
+func (w *Watcher) addWatchFd(name string, watchfd int, isDir, alreadyWatching bool, flags uint32) (string, error) {
 	err := w.register([]int{watchfd}, unix.EV_ADD|unix.EV_CLEAR|unix.EV_ENABLE, flags)
 	if err != nil {
 		unix.Close(watchfd)
@@ -345,16 +1132,7 @@ func (w *Watcher) addWatch(name string, flags uint32) (string, error) {
 // Event values that it sends down the Events channel.
 func (w *Watcher) readEvents() {
 	eventBuffer := make([]unix.Kevent_t, 10)
-	defer func() {
-		err := unix.Close(w.kq)
-		if err != nil {
-			w.Errors <- err
-		}
-		unix.Close(w.closepipe[0])
-		close(w.done)
-		close(w.Events)
-		close(w.Errors)
-	}()
+	defer w.closeReader()
 
 	for closed := false; !closed; {
 		kevents, err := w.read(eventBuffer)
@@ -365,79 +1143,157 @@ func (w *Watcher) readEvents() {
 			}
 			continue
 		}
+		closed = w.handleKevents(kevents)
+	}
+	if w.drain > 0 {
+		w.drainEvents(eventBuffer)
+		// Close() removes the watches after this, which needs the kqueue.
+		<-w.pipe.done
+	}
+}
 
-		// Flush the events we received to the Events channel
-		for _, kevent := range kevents {
-			var (
-				watchfd = int(kevent.Ident)
-				mask    = uint32(kevent.Fflags)
-			)
+// drainEvents sends the events that are still queued in the kernel, and waits
+// for the pipeline to send them, for WithDrainOnClose().
+func (w *Watcher) drainEvents(buf []unix.Kevent_t) {
+	defer close(w.drained)
 
-			// Shut down the loop when the pipe is closed, but only after all
-			// other events have been processed.
-			if watchfd == w.closepipe[0] {
-				closed = true
-				continue
-			}
+	// The closepipe would be returned on every call from now on.
+	changes := make([]unix.Kevent_t, 1)
+	unix.SetKevent(&changes[0], w.closepipe[0], unix.EVFILT_READ, unix.EV_DELETE)
+	if _, err := unix.Kevent(w.kq, changes, nil, nil); err != nil {
+		return
+	}
 
+	var zero unix.Timespec
+	for {
+		n, err := unix.Kevent(w.kq, nil, buf, &zero)
+		if err != nil || n == 0 {
+			break
+		}
+		if w.handleKevents(buf[:n]) {
+			return
+		}
+	}
+	w.mu.Lock()
+	deadline := w.drainUntil
+	w.mu.Unlock()
+	w.pipe.flush(deadline)
+}
+
+// closeReader closes the kqueue and the channels, after the last events were
+// read.
+func (w *Watcher) closeReader() {
+	err := unix.Close(w.kq)
+	if err != nil {
+		w.sendError(err)
+	}
+	unix.Close(w.closepipe[0])
+	close(w.done)
+
+	// Wait for other goroutines that are sending.
+	w.sendMu.Lock()
+	close(w.Events)
+	close(w.Errors)
+	w.sendMu.Unlock()
+	close(w.doneResp)
+}
+
+// handleKevents converts the kevents into Event values and sends them.
+// Returns true if the watcher is closed.
+func (w *Watcher) handleKevents(kevents []unix.Kevent_t) bool {
+	closed := false
+	// Flush the events we received to the Events channel
+	for _, kevent := range kevents {
+		var (
+			watchfd = int(kevent.Ident)
+			mask    = uint32(kevent.Fflags)
+		)
+
+		// Shut down the loop when the pipe is closed, but only after all
+		// other events have been processed.
+		if watchfd == w.closepipe[0] {
+			closed = true
+			continue
+		}
+
+		w.mu.Lock()
+		path := w.paths[watchfd]
+		w.mu.Unlock()
+
+		event := w.newEvent(path.name, mask)
+
+		if path.isDir && !event.Has(Remove) && w.dirRemoved(event.Name) {
+			event.Op |= Remove
+		}
+
+		if event.Has(Rename) || event.Has(Remove) {
+			w.stats.forget(event.Name)
+			w.Remove(event.Name)
 			w.mu.Lock()
-			path := w.paths[watchfd]
+			delete(w.fileExists, event.Name)
+			_, inRecursive := w.recursive[filepath.Dir(event.Name)]
 			w.mu.Unlock()
 
-			event := w.newEvent(path.name, mask)
+			// kqueue doesn't say where a directory was renamed to; scan the
+			// parent of a recursive watch to add the watches for the new
+			// path, in case its NOTE_WRITE was already processed.
+			if path.isDir && event.Has(Rename) && !event.Has(Remove) && inRecursive {
+				w.sendDirectoryChangeEvents(filepath.Dir(event.Name))
+			}
+		}
 
-			if path.isDir && !event.Has(Remove) {
-				// Double check to make sure the directory exists. This can
-				// happen when we do a rm -fr on a recursively watched folders
-				// and we receive a modification event first but the folder has
-				// been deleted and later receive the delete event.
-				if _, err := os.Lstat(event.Name); os.IsNotExist(err) {
-					event.Op |= Remove
-				}
+		if path.isDir && event.Has(Write) && !event.Has(Remove) {
+			w.sendDirectoryChangeEvents(event.Name)
+		} else {
+			if !w.sendEvent(event) {
+				closed = true
+				continue
 			}
+		}
 
-			if event.Has(Rename) || event.Has(Remove) {
-				w.Remove(event.Name)
+		if event.Has(Remove) {
+			// Look for a file that may have overwritten this.
+			// For example, mv f1 f2 will delete f2, then create f2.
+			if path.isDir {
+				fileDir := filepath.Clean(event.Name)
 				w.mu.Lock()
-				delete(w.fileExists, event.Name)
+				_, found := w.watches[fileDir]
 				w.mu.Unlock()
-			}
-
-			if path.isDir && event.Has(Write) && !event.Has(Remove) {
-				w.sendDirectoryChangeEvents(event.Name)
-			} else {
-				if !w.sendEvent(event) {
-					closed = true
-					continue
-				}
-			}
-
-			if event.Has(Remove) {
-				// Look for a file that may have overwritten this.
-				// For example, mv f1 f2 will delete f2, then create f2.
-				if path.isDir {
-					fileDir := filepath.Clean(event.Name)
-					w.mu.Lock()
-					_, found := w.watches[fileDir]
-					w.mu.Unlock()
-					if found {
-						// make sure the directory exists before we watch for changes. When we
-						// do a recursive watch and perform rm -fr, the parent directory might
-						// have gone missing, ignore the missing directory and let the
-						// upcoming delete event remove the watch from the parent directory.
-						if _, err := os.Lstat(fileDir); err == nil {
-							w.sendDirectoryChangeEvents(fileDir)
-						}
-					}
-				} else {
-					filePath := filepath.Clean(event.Name)
-					if fileInfo, err := os.Lstat(filePath); err == nil {
-						w.sendFileCreatedEventIfNew(filePath, fileInfo)
+				if found {
+					// make sure the directory exists before we watch for changes. When we
+					// do a recursive watch and perform rm -fr, the parent directory might
+					// have gone missing, ignore the missing directory and let the
+					// upcoming delete event remove the watch from the parent directory.
+					//
+					// This is also done with WithoutStatChecks(), as reading a
+					// missing directory would send an error.
+					if _, err := w.stats.lstat(fileDir); err == nil {
+						w.sendDirectoryChangeEvents(fileDir)
 					}
 				}
+			} else {
+				filePath := filepath.Clean(event.Name)
+				if fileInfo, err := w.stats.lstat(filePath); err == nil {
+					w.sendFileCreatedEventIfNew(filePath, fileInfo)
+				}
 			}
 		}
 	}
+	return closed
+}
+
+// dirRemoved reports if the directory name no longer exists. This can happen
+// when we do a rm -fr on a recursively watched folders and we receive a
+// modification event first but the folder has been deleted and later receive
+// the delete event.
+//
+// This always reports false with WithoutStatChecks().
+func (w *Watcher) dirRemoved(name string) bool {
+	if w.noStat {
+		return false
+	}
+	_, err := w.stats.lstat(name)
+	return os.IsNotExist(err)
 }
 
 // newEvent returns an platform-independent Event based on kqueue Fflags.
@@ -460,35 +1316,32 @@ func (w *Watcher) newEvent(name string, mask uint32) Event {
 
 // watchDirectoryFiles to mimic inotify when adding a watch on a directory
 func (w *Watcher) watchDirectoryFiles(dirPath string) error {
-	// Get all files
-	files, err := ioutil.ReadDir(dirPath)
-	if err != nil {
-		return err
-	}
-
-	for _, fileInfo := range files {
-		path := filepath.Join(dirPath, fileInfo.Name())
+	// Stat the files in batches, so that the information for a large
+	// directory isn't all in memory at once.
+	return readDirBatches(dirPath, w.done, func(files []os.FileInfo) error {
+		for _, fileInfo := range files {
+			path := filepath.Join(dirPath, fileInfo.Name())
 
-		cleanPath, err := w.internalWatch(path, fileInfo)
-		if err != nil {
-			// No permission to read the file; that's not a problem: just skip.
-			// But do add it to w.fileExists to prevent it from being picked up
-			// as a "new" file later (it still shows up in the directory
-			// listing).
-			switch {
-			case errors.Is(err, unix.EACCES) || errors.Is(err, unix.EPERM):
-				cleanPath = filepath.Clean(path)
-			default:
-				return fmt.Errorf("%q: %w", filepath.Join(dirPath, fileInfo.Name()), err)
+			cleanPath, err := w.internalWatch(path, fileInfo)
+			if err != nil {
+				// No permission to read the file or a file that can't be
+				// watched; that's not a problem: just skip. But do add it to
+				// w.fileExists to prevent it from being picked up as a "new"
+				// file later (it still shows up in the directory listing).
+				switch {
+				case errors.Is(err, unix.EACCES) || errors.Is(err, unix.EPERM) || errors.Is(err, ErrUnsupportedFileType):
+					cleanPath = filepath.Clean(path)
+				default:
+					return fmt.Errorf("%q: %w", filepath.Join(dirPath, fileInfo.Name()), err)
+				}
 			}
-		}
 
-		w.mu.Lock()
-		w.fileExists[cleanPath] = struct{}{}
-		w.mu.Unlock()
-	}
-
-	return nil
+			w.mu.Lock()
+			w.fileExists[cleanPath] = struct{}{}
+			w.mu.Unlock()
+		}
+		return nil
+	})
 }
 
 // sendDirectoryEvents searches the directory for newly created files
@@ -496,21 +1349,21 @@ func (w *Watcher) watchDirectoryFiles(dirPath string) error {
 // the BSD version of fsnotify match Linux inotify which provides a
 // create event for files created in a watched directory.
 func (w *Watcher) sendDirectoryChangeEvents(dirPath string) {
-	// Get all files
-	files, err := ioutil.ReadDir(dirPath)
-	if err != nil {
-		if !w.sendError(err) {
-			return
-		}
-	}
-
-	// Search for new files
-	for _, fileInfo := range files {
-		filePath := filepath.Join(dirPath, fileInfo.Name())
-		err := w.sendFileCreatedEventIfNew(filePath, fileInfo)
-		if err != nil {
-			return
+	// Search for new files, in batches so that the information for a large
+	// directory isn't all in memory at once.
+	var stopped bool
+	err := readDirBatches(dirPath, w.done, func(files []os.FileInfo) error {
+		for _, fileInfo := range files {
+			filePath := filepath.Join(dirPath, fileInfo.Name())
+			if err := w.sendFileCreatedEventIfNew(filePath, fileInfo); err != nil {
+				stopped = true
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil && !stopped {
+		w.sendError(err)
 	}
 }
 
@@ -527,20 +1380,49 @@ func (w *Watcher) sendFileCreatedEventIfNew(filePath string, fileInfo os.FileInf
 	}
 
 	// like watchDirectoryFiles (but without doing another ReadDir)
-	filePath, err = w.internalWatch(filePath, fileInfo)
+	cleanPath, err := w.internalWatch(filePath, fileInfo)
+	if errors.Is(err, ErrUnsupportedFileType) {
+		cleanPath, err = filepath.Clean(filePath), nil
+	}
 	if err != nil {
 		return err
 	}
 
 	w.mu.Lock()
-	w.fileExists[filePath] = struct{}{}
+	w.fileExists[cleanPath] = struct{}{}
 	w.mu.Unlock()
 
 	return nil
 }
 
 func (w *Watcher) internalWatch(name string, fileInfo os.FileInfo) (string, error) {
+	// Don't use a file descriptor for excluded paths.
+	with := w.optsFor(name)
+	if with.skip(name, fileInfo.IsDir()) {
+		return filepath.Clean(name), nil
+	}
+	if with.group != "" {
+		if skip, err := w.pipe.skipWatch(with.group, w.groupWatches); skip {
+			if err != nil {
+				w.sendError(err)
+			}
+			return filepath.Clean(name), nil
+		}
+	}
+
 	if fileInfo.IsDir() {
+		// Subdirectories of a recursive watch get watched like the parent.
+		w.mu.Lock()
+		_, recurse := w.recursive[filepath.Dir(name)]
+		recurse = recurse && !with.tooDeep(name)
+		if recurse {
+			w.recursive[name] = struct{}{}
+		}
+		w.mu.Unlock()
+		if recurse {
+			return w.addWatch(name, noteFlags(with))
+		}
+
 		// mimic Linux providing delete events for subdirectories
 		// but preserve the flags used if currently watching subdirectory
 		w.mu.Lock()
@@ -552,7 +1434,7 @@ func (w *Watcher) internalWatch(name string, fileInfo os.FileInfo) (string, erro
 	}
 
 	// watch file to mimic Linux inotify
-	return w.addWatch(name, noteAllEvents)
+	return w.addWatch(name, noteFlags(with))
 }
 
 // Register events with the queue.
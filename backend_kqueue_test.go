@@ -0,0 +1,49 @@
+//go:build freebsd || openbsd || netbsd || dragonfly || darwin
+// +build freebsd openbsd netbsd dragonfly darwin
+
+package fsnotify
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithoutStatChecks(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	gone := filepath.Join(tmp, "gone")
+
+	// A Write for a directory that no longer exists is turned in to a Remove,
+	// except with WithoutStatChecks().
+	w := newWatcher(t)
+	defer w.Close()
+	if !w.dirRemoved(gone) {
+		t.Error("dirRemoved() is false without WithoutStatChecks()")
+	}
+
+	w, err := NewWatcherWith(WithoutStatChecks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.dirRemoved(gone) {
+		t.Error("dirRemoved() is true with WithoutStatChecks()")
+	}
+
+	if err := w.AddWith(tmp, WithOps(Create)); err != nil {
+		t.Fatal(err)
+	}
+	mkdir(t, tmp, "dir", noWait)
+	select {
+	case e := <-w.Events:
+		if want := (Event{Name: filepath.Join(tmp, "dir"), Op: Create}); e != want {
+			t.Errorf("wrong event\nhave: %s\nwant: %s", e, want)
+		}
+	case err := <-w.Errors:
+		t.Fatal(err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -4,75 +4,287 @@
 package fsnotify
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"runtime/pprof"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
 )
 
+// backendName is the name of the backend; see Watcher.BackendName().
+const backendName = "windows"
+
+// reopenPoll is how often the path of a watched directory that was removed is
+// checked for a new directory, according to the Clock of the watch.
+const reopenPoll = 100 * time.Millisecond
+
 // Watcher watches a set of files, delivering events to a channel.
 type Watcher struct {
 	Events chan Event
 	Errors chan error
 
-	port  windows.Handle // Handle to completion port
-	input chan *input    // Inputs to the reader are sent on this channel
-	quit  chan chan<- error
+	port   windows.Handle // Handle to completion port
+	input  chan *input    // Inputs to the reader are sent on this channel
+	quit   chan chan<- error
+	done   chan struct{} // Closed when Close() is called, or after draining with WithDrainOnClose()
+	sendMu sync.RWMutex  // Read-locked while sending; the reader write-locks it before closing the channels
+
+	mu          sync.Mutex          // Protects access to watches, userWatches, isClosed
+	watches     watchMap            // Map of watches (key: i-number)
+	userWatches map[string]withOpts // Watches added with AddWith(), and their options (key: path)
+	isClosed    bool                // Set to true when Close() is first called
+	scans       scanGate            // Holds back new events while scanning for WithInitialScan() and WithCatchUp()
+	pipe        *pipeline           // Userspace processing of events
+	onError     func(error)         // Set with WithErrorHandler()
+	id          uint64              // Returned by ID()
+	doneResp    chan struct{}       // Closed when the reader goroutine exited; returned by Done()
+	drain       time.Duration       // Set with WithDrainOnClose()
+	drained     chan struct{}       // Closed by the reader once it drained the events, for WithDrainOnClose()
+	drainUntil  time.Time           // Deadline to drain the events
 
-	mu       sync.Mutex // Protects access to watches, isClosed
-	watches  watchMap   // Map of watches (key: i-number)
-	isClosed bool       // Set to true when Close() is first called
+	// Events and errors from the reader; they're sent from another goroutine
+	// so that the reader can always handle Add() and Remove().
+	queue   syncQueue
+	queued  int32         // Number of items in queue that aren't sent yet; accessed atomically.
+	dequeue chan struct{} // Signals the sender that there are items in queue.
+	dropMu  sync.Mutex    // Protects dropped.
+	dropped gap           // Events dropped because the queue was full.
+
+	reopening map[string]*reopenWait // Removed watches that are added again once the directory is created; protected by mu.
+	reopenRun bool                   // The goroutine that checks the paths in reopening was started; protected by mu.
+	reopenSig chan struct{}          // Signals that goroutine that a path was added to reopening.
+	started   runState               // Set by Start()
+	opts      []watcherOpt           // Options passed to NewWatcherWith(), for Clone()
 }
 
 // NewWatcher establishes a new watcher with the underlying OS and begins waiting for events.
-func NewWatcher() (*Watcher, error) {
+func NewWatcher() (*Watcher, error) { return NewWatcherWith() }
+
+// NewWatcherWith is like NewWatcher, but allows adding options.
+//
+// Possible options are:
+//
+//   - WithErrorHandler  call a function for errors, rather than sending them
+//     on the Errors channel.
+//   - WithDrainOnClose  send all events that were read before closing the
+//     channels in Close().
+//   - WithNames         set how paths are reported in Event.Name.
+//   - WithPortable      send events in the same shape on all platforms.
+//   - WithoutStatChecks don't check if a directory still exists (kqueue).
+func NewWatcherWith(opts ...watcherOpt) (*Watcher, error) {
+	with := getWatcherOptions(opts...)
+	if err := checkBackend(with.backend); err != nil {
+		return nil, err
+	}
+	if with.synchronous {
+		return nil, ErrSynchronousNotSupported
+	}
 	port, err := windows.CreateIoCompletionPort(windows.InvalidHandle, 0, 0, 0)
 	if err != nil {
 		return nil, os.NewSyscallError("CreateIoCompletionPort", err)
 	}
 	w := &Watcher{
-		port:    port,
-		watches: make(watchMap),
-		input:   make(chan *input, 1),
-		Events:  make(chan Event, 50),
-		Errors:  make(chan error),
-		quit:    make(chan chan<- error, 1),
-	}
-	go w.readEvents()
+		port:        port,
+		watches:     make(watchMap),
+		userWatches: make(map[string]withOpts),
+		reopening:   make(map[string]*reopenWait),
+		reopenSig:   make(chan struct{}, 1),
+		input:       make(chan *input, 1),
+		Events:      make(chan Event, 50),
+		Errors:      make(chan error),
+		quit:        make(chan chan<- error, 1),
+		done:        make(chan struct{}),
+		doneResp:    make(chan struct{}),
+		onError:     with.onError,
+		opts:        append([]watcherOpt(nil), opts...),
+		drain:       with.drain,
+		drained:     make(chan struct{}),
+		dequeue:     make(chan struct{}, 1),
+	}
+	w.pipe = newPipeline(w.emit)
+	w.pipe.names = with.names
+	if with.portable {
+		w.pipe.portable = newPortableQueue(w.pipe.queue)
+	}
+	w.pipe.readd = w.readd
+	w.pipe.sendErr = w.sendError
+	w.pipe.labels, w.id = watcherLabels(backendName)
+	trackWatcher(w.id, backendName)
+	w.scans.labels = w.pipe.labels
+	goLabeled(w.pipe.labels, "reader", w.readEvents)
+	goLabeled(w.pipe.labels, "sender", w.sendQueued)
 	return w, nil
 }
 
+// sendEvent queues the event for name from the reader. Returns false if mask
+// is 0 and no event was queued.
+//
+// Must run within the I/O thread.
 func (w *Watcher) sendEvent(name string, mask uint64) bool {
 	if mask == 0 {
 		return false
 	}
+	w.enqueue(w.newEvent(name, uint32(mask)), nil)
+	return true
+}
+
+// queueError queues err from the reader.
+//
+// Must run within the I/O thread.
+func (w *Watcher) queueError(err error) { w.enqueue(Event{}, err) }
+
+// maxQueued is the number of events and errors that can be in the queue for
+// the sender; this is the default max_queued_events for inotify. Anything over
+// that is dropped, and a *GapError is queued once there is room again.
+const maxQueued = 16384
+
+func (w *Watcher) enqueue(e Event, err error) {
+	if atomic.LoadInt32(&w.queued) >= maxQueued {
+		var root string
+		if err == nil {
+			root = w.optsFor(e.Name).root
+		}
+		w.dropMu.Lock()
+		w.dropped.add(root)
+		w.dropMu.Unlock()
+		return
+	}
 
-	event := w.newEvent(name, uint32(mask))
+	w.dropMu.Lock()
+	gerr := w.dropped.take(ErrEventOverflow)
+	w.dropMu.Unlock()
+	if gerr != nil {
+		atomic.AddInt32(&w.queued, 1)
+		w.queue.push(Event{}, gerr)
+	}
+	atomic.AddInt32(&w.queued, 1)
+	w.queue.push(e, err)
 	select {
-	case ch := <-w.quit:
-		w.quit <- ch
-	case w.Events <- event:
+	case w.dequeue <- struct{}{}:
+	default:
+	}
+}
+
+// sendQueued sends the events and errors from the reader, until the watcher is
+// closed. Sending them from the reader would block it until the Events channel
+// is read, and Add() or Remove() called from the goroutine that reads it would
+// deadlock.
+func (w *Watcher) sendQueued() {
+	for {
+		select {
+		case <-w.dequeue:
+		case <-w.done:
+			return
+		}
+		for {
+			it, ok := w.queue.pop()
+			if !ok {
+				break
+			}
+			var sent bool
+			if it.err != nil {
+				sent = w.sendError(it.err)
+			} else {
+				w.scans.wait()
+				sent = w.sendSynthetic(it.e)
+			}
+			atomic.AddInt32(&w.queued, -1)
+			if !sent {
+				return
+			}
+		}
+	}
+}
+
+// flushQueue waits until the events and errors from the reader are sent, for
+// WithDrainOnClose().
+func (w *Watcher) flushQueue(deadline time.Time) {
+	for atomic.LoadInt32(&w.queued) > 0 && time.Now().Before(deadline) {
+		select {
+		case <-w.done:
+			return
+		case <-time.After(drainPoll):
+		}
+	}
+}
+
+// sendSynthetic sends an event that didn't come from ReadDirectoryChanges,
+// without waiting for scans to finish.
+// Returns true if the event was sent, or false if watcher is closed.
+func (w *Watcher) sendSynthetic(e Event) bool {
+	return w.pipe.send(e, w.optsFor(e.Name))
+}
+
+// emit sends the event on the Events channel, after all processing. This can
+// be called from any goroutine.
+// Returns true if the event was sent, or false if watcher is closed.
+func (w *Watcher) emit(e Event) bool {
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
+	select {
+	case <-w.done:
+		return false // The channels may be closed already.
+	default:
+	}
+	select {
+	case <-w.done:
+		return false
+	case w.Events <- e:
+		return true
 	}
-	return true
 }
 
 // Returns true if the error was sent, or false if watcher is closed.
 func (w *Watcher) sendError(err error) bool {
+	if w.onError != nil {
+		w.onError(newWatchError(err, ""))
+		return true
+	}
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
 	select {
-	case w.Errors <- err:
+	case <-w.done:
+		return false // The channels may be closed already.
+	default:
+	}
+	select {
+	case w.Errors <- newWatchError(err, ""):
 		return true
-	case <-w.quit:
+	case <-w.done:
 	}
 	return false
 }
 
+// foldName returns the name of a file in watch.names that is the same as name
+// except for the case, if it was added with WithCaseInsensitive(). It returns
+// name if there is no such file.
+func (w *Watcher) foldName(watch *watch, name string) string {
+	for n := range watch.names {
+		if strings.EqualFold(n, name) && w.optsFor(filepath.Join(watch.path, n)).foldCase {
+			return n
+		}
+	}
+	return name
+}
+
+// optsFor returns the options of the watch the path name belongs to.
+func (w *Watcher) optsFor(name string) withOpts {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return lookupOpts(w.userWatches, name)
+}
+
 // Close removes all watches and closes the events channel.
 func (w *Watcher) Close() error {
 	w.mu.Lock()
@@ -81,19 +293,99 @@ func (w *Watcher) Close() error {
 		return nil
 	}
 	w.isClosed = true
+	w.drainUntil = time.Now().Add(w.drain)
+	if w.drain == 0 {
+		close(w.done)
+	}
 	w.mu.Unlock()
+	untrackWatcher(w.id)
+	if w.drain == 0 {
+		w.pipe.close()
+	}
 
-	// Send "quit" message to the reader goroutine
+	// Send "quit" message to the reader goroutine. With WithDrainOnClose() it
+	// first sends the events that were already read; the quit message is
+	// queued after them.
 	ch := make(chan error)
 	w.quit <- ch
 	if err := w.wakeupReader(); err != nil {
 		return err
 	}
+	if w.drain > 0 {
+		t := time.NewTimer(w.drain)
+		select {
+		case <-w.drained:
+		case <-t.C:
+		}
+		t.Stop()
+		close(w.done)
+		w.pipe.close()
+	}
 	return <-ch
 }
 
 // Add starts watching the named file or directory (non-recursively).
-func (w *Watcher) Add(name string) error {
+func (w *Watcher) Add(name string) error { return w.AddWith(name) }
+
+// AddWith is like Add, but allows adding options. When using Add() the
+// defaults described below are used.
+//
+// A path ending in "\..." is watched recursively: all subdirectories are
+// watched as well, and directories created later on are added automatically.
+//
+// AddWith and Remove can be called from the goroutine that reads the Events
+// channel, for example to watch a directory from its Create event; they don't
+// wait for the events to be read.
+//
+// If a watched directory is removed a Remove event is sent, and the watch is
+// added again once a directory is created at the same path, with a Create
+// event for it. Use Remove() to stop waiting for this.
+//
+// Possible options are:
+//
+//   - WithInitialScan   send events for files that already exist.
+//   - WithCatchUp       send events for files changed since a point in time.
+//   - WithContentHash   drop Write events if the content didn't change.
+//   - WithIgnore        exclude paths matching gitignore rules.
+//   - WithIgnorePreset  exclude editor, OS, VCS, or build tool files.
+//   - WithInclude       only send events for paths matching glob patterns.
+//   - WithExclude       exclude paths matching glob patterns.
+//   - WithIncludeRegexp only send events for paths matching regular expressions.
+//   - WithExcludeRegexp exclude paths matching regular expressions.
+//   - WithMaxDepth      limit how deep a recursive watch descends.
+//   - WithSkipHidden    exclude hidden files and directories.
+//   - WithoutChmod      don't watch for Chmod events.
+//   - WithDedup         drop events identical to the previous event.
+//   - WithClock         use a fake clock for the time-based options, for tests.
+//   - WithFileID        follow moved directories (only on Linux).
+//   - WithMounts        watch filesystems mounted in a recursive watch (only on Linux).
+//   - WithoutFollow     watch a symbolic link itself, rather than its target.
+//   - WithHardlinks     send events for changes through other hard links.
+//   - WithCaseInsensitive
+//     match paths case-insensitively on case-insensitive filesystems.
+//   - WithNFC           convert names to Unicode NFC (only on macOS).
+//   - WithSpecialFiles  watch named pipes and devices (only needed on kqueue).
+//   - WithTruncate      set Truncate on Write events for files that became smaller.
+//   - WithSizes         set the file size before and after Write events.
+//   - WithAppendOnly    send merged events for files that grew, for following log files.
+//   - WithOverlayUpper  also watch the upper directory of overlayfs mounts (only on Linux).
+//   - WithOps           only send events with some operations.
+//   - WithDebounce      merge the events for a path until it stops changing.
+//   - WithSettle        send a Settled event once a watch stops changing.
+//   - WithCloseWrite    send CloseWrite events when files are closed (only on Linux).
+//   - WithCompleteCreate
+//     send Create events once files are done being copied.
+//   - WithReplace       send a Replaced event if the directory is replaced.
+//   - WithReplaceDiff   also send the differences after a Replaced event.
+//   - WithPriority      send events ahead of other watches if they're not read fast enough.
+//   - WithGroup         add the watch to a watch group; see Group().
+//   - WithRelativeNames set Event.Name relative to the watched path.
+//   - WithoutFUSE       return an error for paths on FUSE filesystems.
+//   - WithoutParentDuplicates
+//     send events once if both a file and its directory are watched.
+func (w *Watcher) AddWith(name string, opts ...addOpt) error {
+	with := getOptions(opts...)
+
 	w.mu.Lock()
 	if w.isClosed {
 		w.mu.Unlock()
@@ -101,34 +393,130 @@ func (w *Watcher) Add(name string) error {
 	}
 	w.mu.Unlock()
 
-	in := &input{
-		op:    opAddWatch,
-		path:  filepath.Clean(name),
-		flags: sysFSALLEVENTS,
-		reply: make(chan error),
+	name, err := with.expandPath(name)
+	if err != nil {
+		return err
 	}
-	w.input <- in
-	if err := w.wakeupReader(); err != nil {
+	name, recurse := recursivePath(name)
+	with.setRoot(name, recurse)
+	err = w.request(&input{
+		op:      opAddWatch,
+		path:    name,
+		flags:   watchFlags(with),
+		recurse: recurse,
+	})
+	if err != nil {
 		return err
 	}
-	return <-in.reply
+
+	w.mu.Lock()
+	w.userWatches[name] = with
+	w.mu.Unlock()
+	if with.group != "" {
+		if err := w.pipe.checkWatches(with.group, w.groupWatches, 0); err != nil {
+			w.Remove(name)
+			return err
+		}
+	}
+	if with.trackSizes() {
+		w.pipe.sizes.seed(name, with)
+	}
+	if with.replaceDiff {
+		w.pipe.replaces.seed(name, with)
+	}
+	if with.priority {
+		w.pipe.prioritize()
+	}
+
+	// The scan can only be registered after the watch was added, as the I/O
+	// thread that adds the watch also waits for scans before sending events.
+	if with.scanning() {
+		w.scans.start()
+		w.scans.run(name, with, w.sendSynthetic, w.sendError)
+	}
+	return nil
+}
+
+// AddFd is like AddWith, but for an already-open file. Windows watches the
+// parent directory of files, so this watches name and fd is not used.
+func (w *Watcher) AddFd(fd uintptr, name string, opts ...addOpt) error {
+	return w.AddWith(name, opts...)
+}
+
+// AddAt is like AddWith, but path is relative to the directory file
+// descriptor dirfd. This is not supported on Windows.
+func (w *Watcher) AddAt(dirfd uintptr, path string, opts ...addOpt) error {
+	return errors.New("fsnotify: AddAt is not supported on Windows")
 }
 
 // Remove stops watching the the named file or directory (non-recursively).
+//
+// Use a path ending in "\..." to remove a recursive watch.
 func (w *Watcher) Remove(name string) error {
-	in := &input{
-		op:    opRemoveWatch,
-		path:  filepath.Clean(name),
-		reply: make(chan error),
-	}
-	w.input <- in
-	if err := w.wakeupReader(); err != nil {
+	name, _ = recursivePath(name)
+
+	// Stop waiting for the directory to be created again if it was removed.
+	w.mu.Lock()
+	_, reopening := w.reopening[name]
+	delete(w.reopening, name)
+	w.mu.Unlock()
+
+	if err := w.request(&input{op: opRemoveWatch, path: name}); err != nil && !reopening {
 		return err
 	}
-	return <-in.reply
+
+	w.mu.Lock()
+	delete(w.userWatches, name)
+	w.mu.Unlock()
+	return nil
+}
+
+// Check verifies that the watches added with Add() or AddWith() are still
+// live, and adds watches that were lost again. A directory that's replaced,
+// for example by renaming another directory over it, is otherwise no longer
+// watched.
+//
+// Use CheckEvery() to check the watches periodically.
+func (w *Watcher) Check() ([]WatchHealth, error) {
+	w.mu.Lock()
+	if w.isClosed {
+		w.mu.Unlock()
+		return nil, errClosed
+	}
+	userWatches := make(map[string]withOpts, len(w.userWatches))
+	for name, with := range w.userWatches {
+		userWatches[name] = with
+	}
+	w.mu.Unlock()
+
+	health := make([]WatchHealth, 0, len(userWatches))
+	for name, with := range userWatches {
+		h := WatchHealth{Path: name, Status: WatchOK}
+		if with.recurse {
+			h.Path = filepath.Join(name, "...")
+		}
+		if w.request(&input{op: opCheckWatch, path: name}) != nil {
+			h.Status = WatchRestored
+			err := w.request(&input{
+				op:      opAddWatch,
+				path:    name,
+				flags:   watchFlags(with),
+				recurse: with.recurse,
+			})
+			if err != nil {
+				h.Status, h.Err = WatchBroken, err
+			}
+		}
+		health = append(health, h)
+	}
+	sortWatchHealth(health)
+	return health, nil
 }
 
 // WatchList returns the directories and files that are being monitered.
+//
+// Paths added WithExpand() are returned in the expanded form; Export() also
+// has the form they were added with.
 func (w *Watcher) WatchList() []string {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -136,13 +524,223 @@ func (w *Watcher) WatchList() []string {
 	entries := make([]string, 0, len(w.watches))
 	for _, entry := range w.watches {
 		for _, watchEntry := range entry {
-			entries = append(entries, watchEntry.path)
+			if watchEntry.recurse {
+				entries = append(entries, filepath.Join(watchEntry.path, "..."))
+			} else {
+				entries = append(entries, watchEntry.path)
+			}
 		}
 	}
 
 	return entries
 }
 
+// Export returns a description of all watches added with Add() or AddWith(),
+// which can be added to another watcher with Import().
+func (w *Watcher) Export() []WatchSpec {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	specs := make([]WatchSpec, 0, len(w.userWatches))
+	for pathname, with := range w.userWatches {
+		specs = append(specs, newWatchSpec(pathname, with))
+	}
+	sortWatchSpecs(specs)
+	return specs
+}
+
+// Clone creates a new watcher with the same options as w, and adds all watches
+// that were added to w with Add() or AddWith() with the same options. This can
+// be used to start over after an error the watcher can't recover from, such as
+// ErrEventOverflow, without keeping track of the watches.
+//
+// The new watcher has its own Events and Errors channels; w isn't closed.
+func (w *Watcher) Clone() (*Watcher, error) {
+	return cloneWatcher(w.opts, w.watchOpts())
+}
+
+// watchOpts returns a copy of the watches added with Add() or AddWith(), and
+// their options.
+func (w *Watcher) watchOpts() map[string]withOpts {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watches := make(map[string]withOpts, len(w.userWatches))
+	for name, with := range w.userWatches {
+		watches[name] = with
+	}
+	return watches
+}
+
+// Duplicates returns the number of events that were dropped by WithDedup().
+func (w *Watcher) Duplicates() uint64 {
+	return w.pipe.duplicates()
+}
+
+// Stats returns counters for the work the watcher did; this is always zero as
+// there is no stat cache.
+func (w *Watcher) Stats() Stats { return Stats{} }
+
+// goroutineLabels returns the pprof labels for goroutines of the watcher.
+func (w *Watcher) goroutineLabels() pprof.LabelSet { return w.pipe.labels }
+
+// ID returns the ID of the watcher, which is unique in the process. The
+// goroutines of the watcher have it as the "fsnotify.watcher" pprof label.
+func (w *Watcher) ID() uint64 { return w.id }
+
+// Done returns a channel that's closed once the watcher is closed and all
+// cleanup is finished: the reader goroutine exited, the kernel resources are
+// released, and the Events and Errors channels are closed.
+func (w *Watcher) Done() <-chan struct{} { return w.doneResp }
+
+// State returns StateRunning, StateClosing once Close() is called, or
+// StateClosed once Close() is finished and Done() is closed.
+func (w *Watcher) State() WatcherState {
+	w.mu.Lock()
+	closing := w.isClosed
+	w.mu.Unlock()
+	return watcherState(w.doneResp, closing)
+}
+
+// IsClosed reports if Close() was called; Add() returns an error after this.
+func (w *Watcher) IsClosed() bool { return w.State() != StateRunning }
+
+// BackendName returns the name of the backend the watcher uses: "windows".
+func (w *Watcher) BackendName() string { return backendName }
+
+// Supports reports if the platform supports the feature f. Options for
+// features that aren't supported are ignored or return an error, as documented
+// for every option.
+func (w *Watcher) Supports(f Feature) bool { return f == FeatureRecursive }
+
+// Next returns the next event or error for a watcher created with
+// WithSynchronous(). This is not supported on Windows.
+func (w *Watcher) Next(ctx context.Context) (Event, error) {
+	return Event{}, ErrSynchronousNotSupported
+}
+
+// SysFd returns the handle of the I/O completion port. It must not be used to
+// dequeue completion packets or closed, as the reader goroutine uses it.
+//
+// It returns ErrClosed after the watcher is closed.
+func (w *Watcher) SysFd() (uintptr, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.isClosed {
+		return 0, ErrClosed
+	}
+	return uintptr(w.port), nil
+}
+
+// TryRead is like Next, but doesn't block. This requires WithSynchronous(),
+// which isn't supported on Windows.
+func (w *Watcher) TryRead() (Event, bool, error) {
+	return Event{}, false, ErrSynchronousNotSupported
+}
+
+// DebugString returns a description of the internal state of the watcher, for
+// diagnosing missed events; see DebugHandler(). The format may change.
+func (w *Watcher) DebugString() string {
+	var b strings.Builder
+	w.mu.Lock()
+	fmt.Fprintf(&b, "watcher %d, backend: windows\n", w.id)
+	var watches []string
+	for _, index := range w.watches {
+		for _, watch := range index {
+			names := make([]string, 0, len(watch.names))
+			for name, mask := range watch.names {
+				names = append(names, fmt.Sprintf("%s=%#x", name, mask))
+			}
+			sort.Strings(names)
+			watches = append(watches, fmt.Sprintf("%s volume=%d index=%d mask=%#x recurse=%t names=%v",
+				watch.path, watch.ino.volume, watch.ino.index, watch.mask, watch.recurse, names))
+		}
+	}
+	debugSection(&b, "watches", watches)
+	debugUserWatches(&b, w.userWatches)
+	w.mu.Unlock()
+
+	w.pipe.debugString(&b)
+	return b.String()
+}
+
+// For WatchGroup.Pause() and WatchGroup.Paused().
+func (w *Watcher) pauseGroup(name string, paused bool) { w.pipe.pause(name, paused) }
+func (w *Watcher) groupPaused(name string) bool        { return w.pipe.isPaused(name) }
+
+// For WatchGroup.SetQuota().
+func (w *Watcher) setGroupQuota(name string, q GroupQuota) { w.pipe.setQuota(name, q) }
+
+// groupWatches returns the number of watches added for the group name.
+func (w *Watcher) groupWatches(name string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var n int
+	for _, with := range w.userWatches {
+		if with.group == name {
+			n++
+		}
+	}
+	return n
+}
+
+// OnBackpressure sets a function that's called when sending an event on the
+// Events channel has been blocked for longer than threshold, and again every
+// threshold while it stays blocked, so that programs can log or shed load
+// rather than stall silently. Events that are sent to a subscription aren't
+// tracked.
+//
+// fn is called from a separate goroutine; it must not block, as events
+// continue to be sent. Use a nil fn or a threshold of 0 to remove it. If fn
+// panics a *PanicError is sent on the Errors channel.
+func (w *Watcher) OnBackpressure(threshold time.Duration, fn func(Backpressure)) {
+	w.pipe.onBackpressure(threshold, fn)
+}
+
+// Subscribe returns a channel that receives all events for which filter
+// returns true, so that different parts of a program can each receive their
+// own events. A nil filter matches all events.
+//
+// Events that match one or more subscriptions are sent to all of them, and not
+// on the Events channel; other events are still sent on the Events channel.
+// Like the Events channel the subscription channels must be read, as the
+// watcher blocks until the event is received.
+//
+// The channel is closed when the returned function is called, or when the
+// watcher is closed.
+//
+// If filter panics the event isn't sent to the subscription, and a *PanicError
+// is sent on the Errors channel.
+func (w *Watcher) Subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	return w.pipe.subscribe(filter)
+}
+
+// SubscribeWith is like Subscribe, but returns a Subscription that only
+// receives the events that match all options, with its own buffer:
+//
+//	s := w.SubscribeWith(fsnotify.SubscribePatterns("*.go"), fsnotify.SubscribeOps(fsnotify.Write))
+//	defer s.Close()
+//
+// This allows several differently filtered views over the same watches.
+func (w *Watcher) SubscribeWith(opts ...SubscribeOption) *Subscription {
+	ch, cancel := w.pipe.subscribeWith(getSubscribeOptions(opts...))
+	return &Subscription{Events: ch, cancel: cancel}
+}
+
+// Use adds fn to the functions that are called for every event before it's
+// sent on the Events channel or to a subscription. fn can return a changed
+// event, for example to rewrite the path, or false to drop the event. The
+// functions are called in the order they were added, after all options of the
+// watch are applied.
+//
+// fn is called from the goroutine that sends events; sending blocks until it
+// returns. There is no way to remove a function once it's added.
+//
+// If fn panics the event is dropped, and a *PanicError is sent on the Errors
+// channel.
+func (w *Watcher) Use(fn func(Event) (Event, bool)) {
+	w.pipe.use(fn)
+}
+
 // These options are from the old golang.org/x/exp/winfsnotify, where you could
 // add various options to the watch. This has long since been removed.
 //
@@ -186,17 +784,28 @@ func (w *Watcher) newEvent(name string, mask uint32) Event {
 const (
 	opAddWatch = iota
 	opRemoveWatch
+	opCheckWatch
 )
 
+// watchFlags returns the notify flags for a watch with the options with.
+func watchFlags(with withOpts) uint32 {
+	flags := uint32(sysFSALLEVENTS)
+	if with.noChmod {
+		flags &^= sysFSATTRIB
+	}
+	return flags
+}
+
 const (
 	provisional uint64 = 1 << (32 + iota)
 )
 
 type input struct {
-	op    int
-	path  string
-	flags uint32
-	reply chan error
+	op      int
+	path    string
+	flags   uint32
+	recurse bool
+	reply   chan error
 }
 
 type inode struct {
@@ -206,13 +815,14 @@ type inode struct {
 }
 
 type watch struct {
-	ov     windows.Overlapped
-	ino    *inode            // i-number
-	path   string            // Directory path
-	mask   uint64            // Directory itself is being watched with these notify flags
-	names  map[string]uint64 // Map of names being watched and their notify flags
-	rename string            // Remembers the old name while renaming a file
-	buf    [65536]byte       // 64K buffer
+	ov      windows.Overlapped
+	ino     *inode            // i-number
+	path    string            // Directory path
+	recurse bool              // Recursive watch; also reports events in subdirectories
+	mask    uint64            // Directory itself is being watched with these notify flags
+	names   map[string]uint64 // Map of names being watched and their notify flags
+	rename  string            // Remembers the old name while renaming a file
+	buf     [65536]byte       // 64K buffer
 }
 
 type (
@@ -220,6 +830,16 @@ type (
 	watchMap map[uint32]indexMap
 )
 
+// request sends in to the I/O thread, and waits for the reply.
+func (w *Watcher) request(in *input) error {
+	in.reply = make(chan error)
+	w.input <- in
+	if err := w.wakeupReader(); err != nil {
+		return err
+	}
+	return <-in.reply
+}
+
 func (w *Watcher) wakeupReader() error {
 	err := windows.PostQueuedCompletionStatus(w.port, 0, 0, nil)
 	if err != nil {
@@ -285,11 +905,14 @@ func (m watchMap) set(ino *inode, watch *watch) {
 }
 
 // Must run within the I/O thread.
-func (w *Watcher) addWatch(pathname string, flags uint64) error {
+func (w *Watcher) addWatch(pathname string, flags uint64, recurse bool) error {
 	dir, err := w.getDir(pathname)
 	if err != nil {
 		return err
 	}
+	if recurse && dir != pathname {
+		return fmt.Errorf("fsnotify: not a directory: %q", pathname)
+	}
 
 	ino, err := w.getIno(dir)
 	if err != nil {
@@ -305,9 +928,10 @@ func (w *Watcher) addWatch(pathname string, flags uint64) error {
 			return os.NewSyscallError("CreateIoCompletionPort", err)
 		}
 		watchEntry = &watch{
-			ino:   ino,
-			path:  dir,
-			names: make(map[string]uint64),
+			ino:     ino,
+			path:    dir,
+			recurse: recurse,
+			names:   make(map[string]uint64),
 		}
 		w.mu.Lock()
 		w.watches.set(ino, watchEntry)
@@ -315,6 +939,7 @@ func (w *Watcher) addWatch(pathname string, flags uint64) error {
 		flags |= provisional
 	} else {
 		windows.CloseHandle(ino.handle)
+		watchEntry.recurse = watchEntry.recurse || recurse
 	}
 	if pathname == dir {
 		watchEntry.mask |= flags
@@ -352,7 +977,7 @@ func (w *Watcher) remWatch(pathname string) error {
 
 	err = windows.CloseHandle(ino.handle)
 	if err != nil {
-		w.sendError(os.NewSyscallError("CloseHandle", err))
+		w.queueError(os.NewSyscallError("CloseHandle", err))
 	}
 	if watch == nil {
 		return fmt.Errorf("%w: %s", ErrNonExistentWatch, pathname)
@@ -368,6 +993,31 @@ func (w *Watcher) remWatch(pathname string) error {
 	return w.startRead(watch)
 }
 
+// checkWatch returns an error if pathname isn't watched, or if it now refers
+// to another directory than the one that's watched.
+//
+// Must run within the I/O thread.
+func (w *Watcher) checkWatch(pathname string) error {
+	dir, err := w.getDir(pathname)
+	if err != nil {
+		return err
+	}
+	ino, err := w.getIno(dir)
+	if err != nil {
+		return err
+	}
+	windows.CloseHandle(ino.handle)
+
+	w.mu.Lock()
+	watch := w.watches.get(ino)
+	w.mu.Unlock()
+	if watch != nil && (pathname == dir && watch.mask != 0 ||
+		pathname != dir && watch.names[filepath.Base(pathname)] != 0) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNonExistentWatch, pathname)
+}
+
 // Must run within the I/O thread.
 func (w *Watcher) deleteWatch(watch *watch) {
 	for name, mask := range watch.names {
@@ -384,11 +1034,144 @@ func (w *Watcher) deleteWatch(watch *watch) {
 	}
 }
 
+// reopenWait is a path in Watcher.reopening.
+type reopenWait struct {
+	clock Clock     // Clock of the watch, set with WithClock().
+	due   time.Time // Check the path once the clock reaches this.
+}
+
+// reopenLater adds the watch for a directory that was removed again once a
+// directory is created at the same path, and sends a Create event for it.
+// Directories added with WithReplace() are handled by the pipeline instead.
+//
+// Must run within the I/O thread.
+func (w *Watcher) reopenLater(watch *watch) {
+	if watch.mask == 0 {
+		return // Only files in the directory were watched.
+	}
+	path := watch.path
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	with, ok := w.userWatches[path]
+	_, reopening := w.reopening[path]
+	if !ok || reopening || with.replace > 0 {
+		return
+	}
+	clock := clockOrSystem(with.clock)
+	w.reopening[path] = &reopenWait{clock: clock, due: clock.Now().Add(reopenPoll)}
+	if !w.reopenRun {
+		w.reopenRun = true
+		goLabeled(w.pipe.labels, "reopen", w.reopen)
+	}
+	select {
+	case w.reopenSig <- struct{}{}:
+	default:
+	}
+}
+
+// reopen checks the paths in w.reopening every reopenPoll, until they're all
+// added again or removed with Remove().
+func (w *Watcher) reopen() {
+	var t Timer
+	defer func() {
+		if t != nil {
+			t.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-w.reopenSig:
+		case <-timerC(t):
+		case <-w.done:
+			w.mu.Lock()
+			w.reopenRun = false
+			w.mu.Unlock()
+			return
+		}
+		if t != nil {
+			t.Stop()
+			t = nil
+		}
+
+		var (
+			due  []string
+			next *reopenWait
+			left time.Duration
+		)
+		w.mu.Lock()
+		for path, rw := range w.reopening {
+			now := rw.clock.Now()
+			if !rw.due.After(now) {
+				due = append(due, path)
+				rw.due = now.Add(reopenPoll)
+			}
+			if l := rw.due.Sub(now); next == nil || l < left {
+				next, left = rw, l
+			}
+		}
+		if next == nil {
+			w.reopenRun = false
+			w.mu.Unlock()
+			return
+		}
+		t = next.clock.NewTimer(left)
+		w.mu.Unlock()
+
+		for _, path := range due {
+			w.tryReopen(path)
+		}
+	}
+}
+
+// tryReopen adds the watch for path with the same options if it's a directory
+// again.
+func (w *Watcher) tryReopen(path string) {
+	w.mu.Lock()
+	with, ok := w.userWatches[path]
+	_, waiting := w.reopening[path]
+	closed := w.isClosed
+	w.mu.Unlock()
+	if !ok || !waiting || closed {
+		return // Removed with Remove(), or closed.
+	}
+	if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+		return
+	}
+
+	err := w.request(&input{op: opCheckWatch, path: path})
+	added := err == nil // Added again with Check().
+	if !added {
+		err = w.request(&input{
+			op:      opAddWatch,
+			path:    path,
+			flags:   watchFlags(with),
+			recurse: with.recurse,
+		})
+	}
+
+	w.mu.Lock()
+	_, waiting = w.reopening[path]
+	delete(w.reopening, path)
+	w.mu.Unlock()
+	switch {
+	case !waiting:
+		// Remove() was called while the watch was being added.
+		if err == nil && !added {
+			w.request(&input{op: opRemoveWatch, path: path})
+		}
+	case added:
+	case err != nil:
+		w.sendError(err)
+	default:
+		w.enqueue(Event{Name: path, Op: Create}, nil)
+	}
+}
+
 // Must run within the I/O thread.
 func (w *Watcher) startRead(watch *watch) error {
 	err := windows.CancelIo(watch.ino.handle)
 	if err != nil {
-		w.sendError(os.NewSyscallError("CancelIo", err))
+		w.queueError(os.NewSyscallError("CancelIo", err))
 		w.deleteWatch(watch)
 	}
 	mask := w.toWindowsFlags(watch.mask)
@@ -398,7 +1181,7 @@ func (w *Watcher) startRead(watch *watch) error {
 	if mask == 0 {
 		err := windows.CloseHandle(watch.ino.handle)
 		if err != nil {
-			w.sendError(os.NewSyscallError("CloseHandle", err))
+			w.queueError(os.NewSyscallError("CloseHandle", err))
 		}
 		w.mu.Lock()
 		delete(w.watches[watch.ino.volume], watch.ino.index)
@@ -407,11 +1190,12 @@ func (w *Watcher) startRead(watch *watch) error {
 	}
 
 	rdErr := windows.ReadDirectoryChanges(watch.ino.handle, &watch.buf[0],
-		uint32(unsafe.Sizeof(watch.buf)), false, mask, nil, &watch.ov, 0)
+		uint32(unsafe.Sizeof(watch.buf)), watch.recurse, mask, nil, &watch.ov, 0)
 	if rdErr != nil {
 		err := os.NewSyscallError("ReadDirectoryChanges", rdErr)
 		if rdErr == windows.ERROR_ACCESS_DENIED && watch.mask&provisional == 0 {
 			// Watched directory was probably removed
+			w.reopenLater(watch)
 			w.sendEvent(watch.path, watch.mask&sysFSDELETESELF)
 			err = nil
 		}
@@ -442,6 +1226,15 @@ func (w *Watcher) readEvents() {
 		if watch == nil {
 			select {
 			case ch := <-w.quit:
+				if w.drain > 0 {
+					w.mu.Lock()
+					deadline := w.drainUntil
+					w.mu.Unlock()
+					w.flushQueue(deadline)
+					w.pipe.flush(deadline)
+					close(w.drained)
+					<-w.done // emit() relies on this being closed before the channels.
+				}
 				w.mu.Lock()
 				var indexes []indexMap
 				for _, index := range w.watches {
@@ -459,16 +1252,22 @@ func (w *Watcher) readEvents() {
 				if err != nil {
 					err = os.NewSyscallError("CloseHandle", err)
 				}
+				// Wait for other goroutines that are sending.
+				w.sendMu.Lock()
 				close(w.Events)
 				close(w.Errors)
+				w.sendMu.Unlock()
+				close(w.doneResp)
 				ch <- err
 				return
 			case in := <-w.input:
 				switch in.op {
 				case opAddWatch:
-					in.reply <- w.addWatch(in.path, uint64(in.flags))
+					in.reply <- w.addWatch(in.path, uint64(in.flags), in.recurse)
 				case opRemoveWatch:
 					in.reply <- w.remWatch(in.path)
+				case opCheckWatch:
+					in.reply <- w.checkWatch(in.path)
 				}
 			default:
 			}
@@ -478,7 +1277,7 @@ func (w *Watcher) readEvents() {
 		switch qErr {
 		case windows.ERROR_MORE_DATA:
 			if watch == nil {
-				w.sendError(errors.New("ERROR_MORE_DATA has unexpectedly null lpOverlapped buffer"))
+				w.queueError(errors.New("ERROR_MORE_DATA has unexpectedly null lpOverlapped buffer"))
 			} else {
 				// The i/o succeeded but the buffer is full.
 				// In theory we should be building up a full packet.
@@ -487,6 +1286,7 @@ func (w *Watcher) readEvents() {
 			}
 		case windows.ERROR_ACCESS_DENIED:
 			// Watched directory was probably removed
+			w.reopenLater(watch)
 			w.sendEvent(watch.path, watch.mask&sysFSDELETESELF)
 			w.deleteWatch(watch)
 			w.startRead(watch)
@@ -495,7 +1295,7 @@ func (w *Watcher) readEvents() {
 			// CancelIo was called on this handle
 			continue
 		default:
-			w.sendError(os.NewSyscallError("GetQueuedCompletionPort", qErr))
+			w.queueError(os.NewSyscallError("GetQueuedCompletionPort", qErr))
 			continue
 		case nil:
 		}
@@ -503,7 +1303,8 @@ func (w *Watcher) readEvents() {
 		var offset uint32
 		for {
 			if n == 0 {
-				w.sendError(errors.New("short read in readEvents()"))
+				// The buffer overflowed, and all events in it were discarded.
+				w.queueError(&GapError{Roots: []string{watch.path}, Err: ErrEventOverflow})
 				break
 			}
 
@@ -519,6 +1320,11 @@ func (w *Watcher) readEvents() {
 			sh.Len = size
 			sh.Cap = size
 			name := windows.UTF16ToString(buf)
+			// A file watched with WithCaseInsensitive() may have been added
+			// with a different case than the name the system reports.
+			if _, ok := watch.names[name]; !ok {
+				name = w.foldName(watch, name)
+			}
 			fullname := filepath.Join(watch.path, name)
 
 			var mask uint64
@@ -549,8 +1355,9 @@ func (w *Watcher) readEvents() {
 				}
 			}
 
+			var sentName bool
 			sendNameEvent := func() {
-				w.sendEvent(fullname, watch.names[name]&mask)
+				sentName = w.sendEvent(fullname, watch.names[name]&mask)
 			}
 			if raw.Action != windows.FILE_ACTION_RENAMED_NEW_NAME {
 				sendNameEvent()
@@ -560,7 +1367,11 @@ func (w *Watcher) readEvents() {
 				delete(watch.names, name)
 			}
 
-			w.sendEvent(fullname, watch.mask&w.toFSnotifyFlags(raw.Action))
+			// Both the file and the directory are watched; the file's watch
+			// already sent the same event.
+			if !sentName || !w.optsFor(fullname).noParentDups {
+				w.sendEvent(fullname, watch.mask&w.toFSnotifyFlags(raw.Action))
+			}
 			if raw.Action == windows.FILE_ACTION_RENAMED_NEW_NAME {
 				fullname = filepath.Join(watch.path, watch.rename)
 				sendNameEvent()
@@ -574,14 +1385,14 @@ func (w *Watcher) readEvents() {
 
 			// Error!
 			if offset >= n {
-				w.sendError(errors.New(
+				w.queueError(errors.New(
 					"Windows system assumed buffer larger than it is, events have likely been missed."))
 				break
 			}
 		}
 
 		if err := w.startRead(watch); err != nil {
-			w.sendError(err)
+			w.queueError(err)
 		}
 	}
 }
@@ -0,0 +1,117 @@
+package fsnotify
+
+import (
+	"time"
+)
+
+// Backpressure describes events that are blocked on the Events channel, as
+// passed to the function set with Watcher.OnBackpressure().
+type Backpressure struct {
+	Pending int           // Number of events waiting to be sent.
+	Stalled time.Duration // How long the oldest of these has been waiting.
+}
+
+// onBackpressure sets the function that's called when sending on the Events
+// channel is blocked for longer than threshold; a nil fn or a threshold of 0
+// or less removes it.
+func (p *pipeline) onBackpressure(threshold time.Duration, fn func(Backpressure)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if threshold <= 0 {
+		fn = nil
+	}
+	p.stallAfter, p.onStall = threshold, fn
+	if p.waiting == nil {
+		p.waiting = make(map[uint64]time.Time)
+		p.stallWake = make(chan struct{}, 1)
+	}
+}
+
+// emitEvent sends e on the Events channel, and calls the backpressure function
+// every stallAfter while that's blocked.
+// Returns false if the watcher is closed.
+func (p *pipeline) emitEvent(e Event) bool {
+	p.mu.Lock()
+	if p.onStall == nil {
+		p.mu.Unlock()
+		return p.emit(e)
+	}
+	id := p.nextWait
+	p.nextWait++
+	p.waiting[id] = clockOrSystem(p.clock).Now()
+	if !p.stalls {
+		p.stalls = true
+		goLabeled(p.labels, "backpressure", p.reportStalls)
+	}
+	// Events that are added later are never older, so the goroutine only
+	// needs to know if there were none.
+	if len(p.waiting) == 1 {
+		select {
+		case p.stallWake <- struct{}{}:
+		default:
+		}
+	}
+	p.mu.Unlock()
+
+	ok := p.emit(e)
+
+	p.mu.Lock()
+	delete(p.waiting, id)
+	p.mu.Unlock()
+	return ok
+}
+
+// reportStalls calls the backpressure function every stallAfter while the
+// oldest waiting event is blocked, until the watcher is closed.
+//
+// Only the oldest event reports, so that the function isn't called once for
+// every event that's waiting.
+func (p *pipeline) reportStalls() {
+	clock := clockOrSystem(p.clock)
+	var t Timer
+	defer func() {
+		if t != nil {
+			t.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-p.stallWake:
+		case <-timerC(t):
+		case <-p.done:
+			return
+		}
+		if t != nil {
+			t.Stop()
+			t = nil
+		}
+
+		p.mu.Lock()
+		var (
+			start time.Time
+			found bool
+		)
+		for _, s := range p.waiting {
+			if !found || s.Before(start) {
+				start, found = s, true
+			}
+		}
+		if !found || p.onStall == nil {
+			p.mu.Unlock()
+			continue
+		}
+		stalled, fn := clock.Now().Sub(start), p.onStall
+		if stalled < p.stallAfter {
+			t = clock.NewTimer(p.stallAfter - stalled)
+			p.mu.Unlock()
+			continue
+		}
+		bp := Backpressure{Pending: len(p.waiting), Stalled: stalled}
+		if q := p.delivery; q != nil {
+			bp.Pending += len(q.high) + len(q.bulk)
+		}
+		t = clock.NewTimer(p.stallAfter)
+		p.mu.Unlock()
+		p.callHook("OnBackpressure", func() { fn(bp) })
+	}
+}
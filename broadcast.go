@@ -0,0 +1,315 @@
+package fsnotify
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// DropPolicy describes what a Consumer does when its buffer is full.
+type DropPolicy uint8
+
+// The drop policies.
+const (
+	// Block until the consumer reads the event; a slow consumer slows down all
+	// other consumers, and eventually the watcher.
+	Block DropPolicy = iota
+
+	// DropNewest drops the new event.
+	DropNewest
+
+	// DropOldest drops the oldest event in the buffer to make room for the
+	// new one.
+	DropOldest
+)
+
+func (p DropPolicy) String() string {
+	switch p {
+	case Block:
+		return "Block"
+	case DropNewest:
+		return "DropNewest"
+	case DropOldest:
+		return "DropOldest"
+	}
+	return fmt.Sprintf("DropPolicy(%d)", uint8(p))
+}
+
+// Broadcaster sends all events and errors of a watcher to several independent
+// consumers; for example to feed an indexer, a logger, and a UI from a single
+// set of watches.
+type Broadcaster struct {
+	w         *Watcher
+	mu        sync.Mutex // Protects consumers and closed.
+	consumers map[*Consumer]struct{}
+	closed    bool
+	done      chan struct{}
+	doneResp  chan struct{}
+}
+
+// Consumer receives events from a Broadcaster.
+type Consumer struct {
+	dropped uint64 // Accessed atomically; must be first for 64-bit alignment on 32-bit platforms.
+
+	// Events sends the events of the watcher.
+	Events <-chan Event
+
+	// Errors sends the errors of the watcher.
+	Errors <-chan error
+
+	b      *Broadcaster
+	policy DropPolicy
+	events chan Event
+	errors chan error
+	once   sync.Once
+	done   chan struct{} // Closed on Close().
+	mu     sync.RWMutex  // Read-locked while sending; locked to close the channels.
+	gapMu  sync.Mutex    // Protects gap.
+	gap    gap           // Events dropped since the last *GapError was sent.
+}
+
+// NewBroadcaster starts reading the Events and Errors of the watcher w, and
+// sends them to all consumers added with Consumer().
+//
+// The watcher shouldn't be read from directly after this. Events that arrive
+// while there are no consumers are dropped.
+func NewBroadcaster(w *Watcher) *Broadcaster {
+	b := &Broadcaster{
+		w:         w,
+		consumers: make(map[*Consumer]struct{}),
+		done:      make(chan struct{}),
+		doneResp:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Consumer adds a new consumer with a buffer of size events, which uses the
+// drop policy once the buffer is full. After events were dropped a *GapError
+// is sent on the Errors channel of the consumer, once there is room for it.
+//
+// DropOldest with a size of 0 behaves like DropNewest, as there is never an
+// event in the buffer that can be dropped.
+//
+// The channels of the consumer are closed when Consumer.Close() is called, or
+// when the watcher is closed.
+func (b *Broadcaster) Consumer(size int, policy DropPolicy) *Consumer {
+	if size < 1 && policy == DropOldest {
+		policy = DropNewest
+	}
+	events, errors := make(chan Event, size), make(chan error, size)
+	c := &Consumer{
+		Events: events,
+		Errors: errors,
+		b:      b,
+		policy: policy,
+		events: events,
+		errors: errors,
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		c.close()
+		return c
+	}
+	b.consumers[c] = struct{}{}
+	return c
+}
+
+// Close closes the watcher and the channels of all consumers.
+func (b *Broadcaster) Close() error {
+	b.mu.Lock()
+	select {
+	case <-b.done:
+		b.mu.Unlock()
+		return nil
+	default:
+	}
+	close(b.done)
+	b.mu.Unlock()
+
+	err := b.w.Close()
+	<-b.doneResp
+	return err
+}
+
+func (b *Broadcaster) run() {
+	defer close(b.doneResp)
+	defer func() {
+		b.mu.Lock()
+		b.closed = true
+		consumers := b.consumers
+		b.consumers = nil
+		b.mu.Unlock()
+		for c := range consumers {
+			c.close()
+		}
+	}()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case err, ok := <-b.w.Errors:
+			if !ok {
+				return
+			}
+			for _, c := range b.snapshot() {
+				c.sendError(err)
+			}
+		case e, ok := <-b.w.Events:
+			if !ok {
+				return
+			}
+			for _, c := range b.snapshot() {
+				c.send(e)
+			}
+		}
+	}
+}
+
+func (b *Broadcaster) snapshot() []*Consumer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	consumers := make([]*Consumer, 0, len(b.consumers))
+	for c := range b.consumers {
+		consumers = append(consumers, c)
+	}
+	return consumers
+}
+
+// Close removes the consumer from the broadcaster, and closes its channels.
+func (c *Consumer) Close() {
+	c.b.mu.Lock()
+	delete(c.b.consumers, c)
+	c.b.mu.Unlock()
+	c.close()
+}
+
+// Dropped returns the number of events and errors that were dropped because
+// the buffer was full.
+func (c *Consumer) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+func (c *Consumer) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		close(c.events)
+		close(c.errors)
+		c.mu.Unlock()
+	})
+}
+
+// send sends the event e according to the drop policy.
+func (c *Consumer) send(e Event) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for {
+		// Check on every iteration: close() waits for the lock, so this
+		// can't keep looping once the consumer or broadcaster is closed.
+		if c.closed() {
+			return
+		}
+		select {
+		case c.events <- e:
+			c.sendGap()
+			return
+		default:
+		}
+		switch c.policy {
+		case DropNewest:
+			c.drop(e)
+			return
+		case DropOldest:
+			select {
+			case old := <-c.events:
+				c.drop(old)
+			default:
+			}
+		default:
+			select {
+			case c.events <- e:
+			case <-c.done:
+			case <-c.b.done:
+			}
+			return
+		}
+	}
+}
+
+// sendError sends the error err according to the drop policy.
+func (c *Consumer) sendError(err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for {
+		if c.closed() {
+			return
+		}
+		select {
+		case c.errors <- err:
+			return
+		default:
+		}
+		switch c.policy {
+		case DropNewest:
+			atomic.AddUint64(&c.dropped, 1)
+			return
+		case DropOldest:
+			select {
+			case <-c.errors:
+				atomic.AddUint64(&c.dropped, 1)
+			default:
+			}
+		default:
+			select {
+			case c.errors <- err:
+			case <-c.done:
+			case <-c.b.done:
+			}
+			return
+		}
+	}
+}
+
+// drop records that the event e was dropped.
+func (c *Consumer) drop(e Event) {
+	atomic.AddUint64(&c.dropped, 1)
+	c.gapMu.Lock()
+	c.gap.add(filepath.Dir(e.Name))
+	c.gapMu.Unlock()
+}
+
+// sendGap sends a *GapError for the events that were dropped, if there is room
+// for it; it's sent with a later event otherwise.
+func (c *Consumer) sendGap() {
+	c.gapMu.Lock()
+	defer c.gapMu.Unlock()
+	if c.gap.dropped == 0 {
+		return
+	}
+	g := c.gap // take() resets the copy; c.gap is only reset once it's sent.
+	select {
+	case c.errors <- g.take(ErrEventOverflow):
+		c.gap = gap{}
+	default:
+	}
+}
+
+// closed reports if the consumer or broadcaster was closed.
+func (c *Consumer) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	case <-c.b.done:
+		return true
+	default:
+		return false
+	}
+}
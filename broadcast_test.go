@@ -0,0 +1,124 @@
+package fsnotify
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBroadcaster(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	b := NewBroadcaster(newWatcher(t, tmp))
+	defer b.Close()
+
+	all := b.Consumer(10, Block)
+	newest := b.Consumer(1, DropNewest)
+	oldest := b.Consumer(1, DropOldest)
+
+	touch(t, tmp, "one")
+	touch(t, tmp, "two")
+	touch(t, tmp, "three")
+
+	for _, want := range []string{"one", "two", "three"} {
+		select {
+		case e := <-all.Events:
+			if have := filepath.Base(e.Name); have != want {
+				t.Errorf("have %q; want %q", have, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+
+	for _, tt := range []struct {
+		c    *Consumer
+		want string
+	}{
+		{newest, "one"},
+		{oldest, "three"},
+	} {
+		if e := <-tt.c.Events; filepath.Base(e.Name) != tt.want {
+			t.Errorf("%s: have %q; want %q", tt.c.policy, filepath.Base(e.Name), tt.want)
+		}
+		if d := tt.c.Dropped(); d != 2 {
+			t.Errorf("%s: Dropped() = %d; want 2", tt.c.policy, d)
+		}
+	}
+
+	// Closing a consumer doesn't affect the others.
+	newest.Close()
+	if _, ok := <-newest.Events; ok {
+		t.Error("Events not closed")
+	}
+	touch(t, tmp, "four")
+	if e := <-all.Events; filepath.Base(e.Name) != "four" {
+		t.Errorf("have %q; want %q", e.Name, "four")
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-all.Events; ok {
+		t.Error("Events not closed")
+	}
+}
+
+func TestConsumerGap(t *testing.T) {
+	t.Parallel()
+
+	b := &Broadcaster{done: make(chan struct{})}
+	c := &Consumer{b: b, policy: DropNewest, done: make(chan struct{})}
+	events, errs := make(chan Event, 1), make(chan error, 1)
+	c.Events, c.Errors, c.events, c.errors = events, errs, events, errs
+
+	dir := filepath.Join(string(filepath.Separator), "dir")
+	for _, name := range []string{"a", "b", "c"} {
+		c.send(Event{Name: filepath.Join(dir, name), Op: Create})
+	}
+	select {
+	case err := <-c.Errors:
+		t.Fatalf("error before the gap ended: %v", err)
+	default:
+	}
+
+	<-c.Events
+	c.send(Event{Name: filepath.Join(dir, "d"), Op: Create})
+	err := <-c.Errors
+	var gerr *GapError
+	if !errors.As(err, &gerr) || !errors.Is(err, ErrEventOverflow) {
+		t.Fatalf("not a *GapError: %#v", err)
+	}
+	if gerr.Dropped != 2 || !reflect.DeepEqual(gerr.Roots, []string{dir}) {
+		t.Errorf("wrong gap: %v", gerr)
+	}
+}
+
+func TestConsumerUnbuffered(t *testing.T) {
+	t.Parallel()
+
+	b := &Broadcaster{done: make(chan struct{}), consumers: make(map[*Consumer]struct{})}
+	c := b.Consumer(0, DropOldest)
+	if c.policy != DropNewest {
+		t.Fatalf("policy = %s; want DropNewest", c.policy)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.send(Event{Name: "/file", Op: Create})
+		c.sendError(errors.New("oops"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("send() blocked")
+	}
+	if c.Dropped() != 2 {
+		t.Errorf("Dropped() = %d; want 2", c.Dropped())
+	}
+	c.Close()
+}
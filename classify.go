@@ -0,0 +1,53 @@
+package fsnotify
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// EventClass is what kind of file an event is for, as returned by Classify().
+type EventClass uint8
+
+// The event classes.
+const (
+	// ClassContent is an event for a regular file, which may be a real
+	// change to its content.
+	ClassContent EventClass = iota
+
+	// ClassEditorArtifact is an event for a temporary, swap, or backup file
+	// of an editor, such as a Vim .swp file, an Emacs #autosave#, or the
+	// temporary file of an atomic save.
+	ClassEditorArtifact
+)
+
+func (c EventClass) String() string {
+	switch c {
+	case ClassContent:
+		return "content"
+	case ClassEditorArtifact:
+		return "editor artifact"
+	}
+	return fmt.Sprintf("EventClass(%d)", uint8(c))
+}
+
+// editorRules are the rules of IgnoreEditors, for Classify().
+var editorRules = parseIgnore(IgnoreEditors.rules...)
+
+// Classify reports if e is for a file an editor creates while saving, rather
+// than a real change, so that for example a program that reloads on changes
+// doesn't reload for every change to a swap file. Files are matched by name,
+// with the rules of the IgnoreEditors preset; use
+// WithIgnorePreset(IgnoreEditors) to not get events for them at all:
+//
+//	for e := range w.Events {
+//		if fsnotify.Classify(e) == fsnotify.ClassEditorArtifact {
+//			continue
+//		}
+//		rebuild()
+//	}
+func Classify(e Event) EventClass {
+	if editorRules.match([]string{filepath.Base(e.Name)}, false) {
+		return ClassEditorArtifact
+	}
+	return ClassContent
+}
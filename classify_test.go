@@ -0,0 +1,31 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		want EventClass
+	}{
+		{"main.go", ClassContent},
+		{"README", ClassContent},
+		{".main.go.swp", ClassEditorArtifact},
+		{"main.go~", ClassEditorArtifact},
+		{"4913", ClassEditorArtifact},
+		{"#main.go#", ClassEditorArtifact},
+		{".#main.go", ClassEditorArtifact},
+		{"main.go___jb_tmp___", ClassEditorArtifact},
+		{".goutputstream-ABC123", ClassEditorArtifact},
+	}
+	for _, tt := range tests {
+		e := Event{Name: filepath.Join("dir", tt.name), Op: Write}
+		if have := Classify(e); have != tt.want {
+			t.Errorf("%s: have %s; want %s", tt.name, have, tt.want)
+		}
+	}
+}
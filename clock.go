@@ -0,0 +1,60 @@
+package fsnotify
+
+import "time"
+
+// Clock provides the current time and timers for the components that depend
+// on time, such as the debounce in OnChange() and WithDedup().
+//
+// The default is SystemClock; tests can use a fake clock (such as the one in
+// the fsnotifytest package) to control the time without sleeping.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a new timer that fires once after d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by Clock.NewTimer(); it behaves like time.Timer.
+type Timer interface {
+	// C returns the channel the time is sent on when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing; it returns false if the timer
+	// already fired or was stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after d; it returns false if the timer
+	// already fired or was stopped.
+	Reset(d time.Duration) bool
+}
+
+// SystemClock is the Clock that uses the system time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                 { return time.Now() }
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+type systemTimer struct{ t *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time        { return t.t.C }
+func (t systemTimer) Stop() bool                 { return t.t.Stop() }
+func (t systemTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+// clockOrSystem returns c, or SystemClock if c is nil.
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// timerC returns the channel of t, or nil if t is nil.
+func timerC(t Timer) <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.C()
+}
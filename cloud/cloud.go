@@ -0,0 +1,320 @@
+// Package cloud watches object storage buckets, such as Amazon S3 or Google
+// Cloud Storage, with the same API as fsnotify.Watcher.
+//
+// Object storage doesn't have change notifications that work the same
+// everywhere, so the bucket is listed periodically and every listing is
+// compared to the previous one: a Create event is sent for new objects, Write
+// for objects with a different version (the ETag on S3, or the generation on
+// GCS), and Remove for objects that are gone. Event.Name is the object key.
+//
+// This package doesn't depend on any SDK; the bucket is listed with a Lister,
+// which is usually a few lines with the SDK that's already used:
+//
+//	lister := cloud.ListerFunc(func(ctx context.Context, prefix string) ([]cloud.Object, error) {
+//		var objs []cloud.Object
+//		p := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+//			Bucket: aws.String("my-bucket"),
+//			Prefix: aws.String(prefix),
+//		})
+//		for p.HasMorePages() {
+//			page, err := p.NextPage(ctx)
+//			if err != nil {
+//				return nil, err
+//			}
+//			for _, o := range page.Contents {
+//				objs = append(objs, cloud.Object{Key: *o.Key, Version: *o.ETag, Size: o.Size})
+//			}
+//		}
+//		return objs, nil
+//	})
+//
+//	w := cloud.NewWatcher(lister, cloud.Options{Interval: time.Minute})
+//	defer w.Close()
+//	err := w.Add("logs/")
+//
+// Changes between two listings are merged: an object that's written twice
+// sends one Write, and an object that's created and removed again sends
+// nothing.
+package cloud
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrClosed is returned from Add() after the watcher is closed; this is
+// fsnotify.ErrClosed, so errors.Is() works the same for all watchers.
+var ErrClosed = fsnotify.ErrClosed
+
+var _ fsnotify.Notifier = (*Watcher)(nil)
+
+// Object is an object in a bucket, as returned by a Lister.
+type Object struct {
+	// Key of the object; this is used as Event.Name.
+	Key string
+
+	// Anything that changes when the object is written, such as the ETag on
+	// S3 or the generation on GCS.
+	Version string
+
+	// Size in bytes; this is used as Event.Size.
+	Size int64
+}
+
+// Lister lists the objects in a bucket.
+type Lister interface {
+	// List returns all objects with a key that starts with prefix. The order
+	// doesn't matter.
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// ListerFunc is a function that implements Lister.
+type ListerFunc func(ctx context.Context, prefix string) ([]Object, error)
+
+// List calls f.
+func (f ListerFunc) List(ctx context.Context, prefix string) ([]Object, error) {
+	return f(ctx, prefix)
+}
+
+// Options are the options for NewWatcher().
+type Options struct {
+	// How often the watched prefixes are listed; the default is 30 seconds.
+	// Listing a bucket is usually billed per request, so keep this as long
+	// as possible.
+	Interval time.Duration
+
+	// Timeout for a single List() call; the default is the Interval.
+	Timeout time.Duration
+}
+
+// Watcher watches a set of prefixes in a bucket, delivering events to a
+// channel.
+type Watcher struct {
+	// Events sends the changes to objects.
+	Events chan fsnotify.Event
+
+	// Errors sends the errors from listing the bucket. The previous listing
+	// is kept, so that nothing is sent for a listing that failed.
+	Errors chan error
+
+	lister Lister
+	opts   Options
+
+	mu       sync.Mutex                   // Protects everything below.
+	watches  map[string]map[string]Object // Objects in the last listing; key: prefix, then object key.
+	done     chan struct{}                // Closed on Close().
+	doneResp chan struct{}
+}
+
+// NewWatcher creates a new watcher that lists the bucket with lister.
+func NewWatcher(lister Lister, opts Options) *Watcher {
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = opts.Interval
+	}
+	w := &Watcher{
+		Events:   make(chan fsnotify.Event),
+		Errors:   make(chan error),
+		lister:   lister,
+		opts:     opts,
+		watches:  make(map[string]map[string]Object),
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	go w.poll()
+	return w
+}
+
+// Close stops watching, and closes the Events and Errors channels.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	select {
+	case <-w.done:
+		w.mu.Unlock()
+		return nil
+	default:
+	}
+	close(w.done)
+	w.mu.Unlock()
+
+	<-w.doneResp
+	return nil
+}
+
+// Add starts watching all objects with a key that starts with prefix. The
+// bucket is listed right away, to know which objects exist already; no events
+// are sent for them.
+//
+// A prefix ending in "/..." is the same as the prefix ending in "/", as
+// listings always include everything below a prefix.
+func (w *Watcher) Add(prefix string) error { return w.AddWith(prefix) }
+
+// AddWith is like Add. The options are ignored.
+func (w *Watcher) AddWith(prefix string, opts ...fsnotify.AddOption) error {
+	select {
+	case <-w.done:
+		return ErrClosed
+	default:
+	}
+	prefix = strings.TrimSuffix(prefix, "...")
+	objs, err := w.list(prefix)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done:
+		return ErrClosed
+	default:
+	}
+	w.watches[prefix] = objs
+	return nil
+}
+
+// Remove stops watching prefix.
+func (w *Watcher) Remove(prefix string) error {
+	prefix = strings.TrimSuffix(prefix, "...")
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.watches[prefix]; !ok {
+		return fsnotify.ErrNonExistentWatch
+	}
+	delete(w.watches, prefix)
+	return nil
+}
+
+// WatchList returns all prefixes added with Add() (and are not yet removed).
+func (w *Watcher) WatchList() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := make([]string, 0, len(w.watches))
+	for prefix := range w.watches {
+		list = append(list, prefix)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// EventsChan returns the Events channel, to implement fsnotify.Notifier.
+func (w *Watcher) EventsChan() <-chan fsnotify.Event { return w.Events }
+
+// ErrorsChan returns the Errors channel, to implement fsnotify.Notifier.
+func (w *Watcher) ErrorsChan() <-chan error { return w.Errors }
+
+// list lists the objects for prefix, with the timeout.
+func (w *Watcher) list(prefix string) (map[string]Object, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.opts.Timeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-w.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	list, err := w.lister.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	objs := make(map[string]Object, len(list))
+	for _, o := range list {
+		objs[o.Key] = o
+	}
+	return objs, nil
+}
+
+// poll lists the watched prefixes every Interval, and sends the differences,
+// until the watcher is closed.
+func (w *Watcher) poll() {
+	defer func() {
+		close(w.Events)
+		close(w.Errors)
+		close(w.doneResp)
+	}()
+
+	t := time.NewTicker(w.opts.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-t.C:
+		}
+
+		for _, prefix := range w.WatchList() {
+			objs, err := w.list(prefix)
+			if err != nil {
+				if !w.sendError(err) {
+					return
+				}
+				continue
+			}
+
+			w.mu.Lock()
+			old, ok := w.watches[prefix]
+			if ok {
+				w.watches[prefix] = objs
+			}
+			w.mu.Unlock()
+			if !ok {
+				continue // Removed while listing.
+			}
+			for _, e := range diff(old, objs) {
+				if !w.sendEvent(e) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// diff returns the events for the changes from old to cur, sorted by key.
+func diff(old, cur map[string]Object) []fsnotify.Event {
+	var events []fsnotify.Event
+	for key, o := range cur {
+		prev, ok := old[key]
+		switch {
+		case !ok:
+			events = append(events, fsnotify.Event{Name: key, Op: fsnotify.Create, Size: o.Size})
+		case prev.Version != o.Version:
+			events = append(events, fsnotify.Event{Name: key, Op: fsnotify.Write, Size: o.Size, PrevSize: prev.Size})
+		}
+	}
+	for key, o := range old {
+		if _, ok := cur[key]; !ok {
+			events = append(events, fsnotify.Event{Name: key, Op: fsnotify.Remove, PrevSize: o.Size})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
+}
+
+// sendEvent returns false if the watcher is closed.
+func (w *Watcher) sendEvent(e fsnotify.Event) bool {
+	select {
+	case w.Events <- e:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// sendError returns false if the watcher is closed.
+func (w *Watcher) sendError(err error) bool {
+	select {
+	case w.Errors <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
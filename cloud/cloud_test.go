@@ -0,0 +1,141 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// bucket is a fake bucket.
+type bucket struct {
+	mu   sync.Mutex
+	objs map[string]Object
+	err  error
+}
+
+func (b *bucket) List(ctx context.Context, prefix string) ([]Object, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	var list []Object
+	for _, o := range b.objs {
+		if strings.HasPrefix(o.Key, prefix) {
+			list = append(list, o)
+		}
+	}
+	return list, nil
+}
+
+func (b *bucket) put(key, version string, size int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objs[key] = Object{Key: key, Version: version, Size: size}
+}
+
+func TestWatcher(t *testing.T) {
+	b := &bucket{objs: make(map[string]Object)}
+	b.put("logs/a", "1", 10)
+	b.put("logs/b", "1", 20)
+	b.put("other/c", "1", 30)
+
+	w := NewWatcher(b, Options{Interval: 10 * time.Millisecond})
+	defer w.Close()
+	if err := w.Add("logs/"); err != nil {
+		t.Fatal(err)
+	}
+
+	b.mu.Lock()
+	b.objs["logs/a"] = Object{Key: "logs/a", Version: "2", Size: 11}
+	delete(b.objs, "logs/b")
+	b.objs["logs/new"] = Object{Key: "logs/new", Version: "1", Size: 5}
+	b.objs["other/d"] = Object{Key: "other/d", Version: "1"}
+	b.mu.Unlock()
+
+	var have []fsnotify.Event
+	for len(have) < 3 {
+		select {
+		case e := <-w.Events:
+			have = append(have, e)
+		case err := <-w.Errors:
+			t.Fatal(err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout; have %v", have)
+		}
+	}
+	want := []fsnotify.Event{
+		{Name: "logs/a", Op: fsnotify.Write, Size: 11, PrevSize: 10},
+		{Name: "logs/b", Op: fsnotify.Remove, PrevSize: 20},
+		{Name: "logs/new", Op: fsnotify.Create, Size: 5},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+
+	// Nothing is sent for a listing that failed.
+	errList := errors.New("list failed")
+	b.mu.Lock()
+	b.err = errList
+	b.mu.Unlock()
+	select {
+	case err := <-w.Errors:
+		if !errors.Is(err, errList) {
+			t.Fatalf("wrong error: %v", err)
+		}
+	case e := <-w.Events:
+		t.Fatalf("unexpected event: %v", e)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+	b.mu.Lock()
+	b.err = nil
+	b.mu.Unlock()
+	b.put("logs/a", "3", 12)
+	select {
+	case e := <-w.Events:
+		if e.Name != "logs/a" || e.Op != fsnotify.Write {
+			t.Fatalf("unexpected event: %v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestWatcherAdd(t *testing.T) {
+	b := &bucket{objs: make(map[string]Object)}
+	w := NewWatcher(b, Options{Interval: time.Hour})
+
+	if err := w.Add("logs/..."); err != nil {
+		t.Fatal(err)
+	}
+	if have := w.WatchList(); !reflect.DeepEqual(have, []string{"logs/"}) {
+		t.Errorf("WatchList: %q", have)
+	}
+	if err := w.Remove("other/"); !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+		t.Errorf("wrong error: %v", err)
+	}
+	if err := w.Remove("logs/"); err != nil {
+		t.Fatal(err)
+	}
+
+	b.err = errors.New("list failed")
+	if err := w.Add("logs/"); err != b.err {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	b.err = nil
+	w.Close()
+	if err := w.Add("logs/"); !errors.Is(err, fsnotify.ErrClosed) {
+		t.Errorf("wrong error: %v", err)
+	}
+	if _, ok := <-w.Events; ok {
+		t.Error("Events not closed")
+	}
+}
@@ -0,0 +1,210 @@
+package fsnotify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is a declarative description of the watches of a watcher, for
+// NewWatcherFromConfig(). This allows programs to let users configure what's
+// watched, for example in a configuration file:
+//
+//	{"watches": [
+//		{"path": "/srv/app", "recursive": true, "include": ["**/*.go"],
+//		 "exclude": ["vendor/"], "ops": "create|write|remove", "debounce": "100ms"},
+//		{"path": "/etc/app.conf", "ops": ["write"]}
+//	]}
+//
+// Every entry is a WatchSpec; see there for all fields. A Config can also be
+// filled in directly, or decoded from another format such as YAML into the same
+// struct.
+type Config struct {
+	Watches []WatchSpec `json:"watches"`
+}
+
+// ParseConfig parses a Config from JSON.
+//
+// Durations (such as "debounce" and "dedup") can be given as a string for
+// time.ParseDuration(), such as "100ms", or as a number of nanoseconds.
+// Operations (such as "ops" and "initialScan") can be given as a string such
+// as "create|write", a list of strings, or a number. Unknown fields are an
+// error, to catch typos.
+func ParseConfig(data []byte) (Config, error) {
+	// WatchSpec.UnmarshalJSON() doesn't know about DisallowUnknownFields(), so
+	// check the fields of the watches first.
+	var raw struct {
+		Watches []map[string]json.RawMessage `json:"watches"`
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&raw); err != nil {
+		return Config{}, fmt.Errorf("fsnotify: parsing config: %w", err)
+	}
+	fields := specFields()
+	for i, w := range raw.Watches {
+		for f := range w {
+			if !fields[f] {
+				return Config{}, fmt.Errorf("fsnotify: parsing config: watch %d: unknown field %q", i, f)
+			}
+		}
+	}
+
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Config{}, fmt.Errorf("fsnotify: parsing config: %w", err)
+	}
+	for i, s := range c.Watches {
+		if s.Path == "" {
+			return Config{}, fmt.Errorf("fsnotify: parsing config: watch %d has no path", i)
+		}
+	}
+	return c, nil
+}
+
+// specFields returns the JSON names of the fields of WatchSpec.
+func specFields() map[string]bool {
+	t := reflect.TypeOf(WatchSpec{})
+	fields := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// NewWatcherFromConfig creates a new watcher with the options opts, and adds
+// the watches in c.
+//
+// If a watch can't be added the watcher is closed, and the error for it is
+// returned.
+func NewWatcherFromConfig(c Config, opts ...WatcherOption) (*Watcher, error) {
+	w, err := NewWatcherWith(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Import(c.Watches); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// UnmarshalJSON decodes a WatchSpec, also allowing durations and operations
+// in the formats described in ParseConfig().
+func (s *WatchSpec) UnmarshalJSON(data []byte) error {
+	type spec WatchSpec // Without the UnmarshalJSON method.
+	aux := struct {
+		*spec
+		InitialScan  json.RawMessage `json:"initialScan,omitempty"`
+		Ops          json.RawMessage `json:"ops,omitempty"`
+		Dedup        json.RawMessage `json:"dedup,omitempty"`
+		AppendWindow json.RawMessage `json:"appendWindow,omitempty"`
+		Debounce     json.RawMessage `json:"debounce,omitempty"`
+		Settle       json.RawMessage `json:"settle,omitempty"`
+
+		CompleteCreate json.RawMessage `json:"completeCreate,omitempty"`
+		Replace        json.RawMessage `json:"replace,omitempty"`
+	}{spec: (*spec)(s)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var err error
+	if s.InitialScan, err = unmarshalOp("initialScan", aux.InitialScan); err != nil {
+		return err
+	}
+	if s.Ops, err = unmarshalOp("ops", aux.Ops); err != nil {
+		return err
+	}
+	if s.Dedup, err = unmarshalDuration("dedup", aux.Dedup); err != nil {
+		return err
+	}
+	if s.AppendWindow, err = unmarshalDuration("appendWindow", aux.AppendWindow); err != nil {
+		return err
+	}
+	if s.Debounce, err = unmarshalDuration("debounce", aux.Debounce); err != nil {
+		return err
+	}
+	if s.Settle, err = unmarshalDuration("settle", aux.Settle); err != nil {
+		return err
+	}
+	if s.CompleteCreate, err = unmarshalDuration("completeCreate", aux.CompleteCreate); err != nil {
+		return err
+	}
+	if s.Replace, err = unmarshalDuration("replace", aux.Replace); err != nil {
+		return err
+	}
+	return nil
+}
+
+// unmarshalOp decodes an Op from a number, a string such as "create|write",
+// or a list of strings.
+func unmarshalOp(field string, raw json.RawMessage) (Op, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	var (
+		n    uint32
+		str  string
+		list []string
+	)
+	switch {
+	case json.Unmarshal(raw, &n) == nil:
+		return Op(n), nil
+	case json.Unmarshal(raw, &str) == nil:
+		list = strings.Split(str, "|")
+	case json.Unmarshal(raw, &list) == nil:
+	default:
+		return 0, fmt.Errorf("%s: not a number, string, or list of strings: %s", field, raw)
+	}
+
+	var op Op
+	for _, o := range list {
+		p, ok := opNames[strings.ToLower(strings.TrimSpace(o))]
+		if !ok {
+			return 0, fmt.Errorf("%s: unknown operation %q", field, o)
+		}
+		op |= p
+	}
+	return op, nil
+}
+
+var opNames = map[string]Op{
+	"create":      Create,
+	"write":       Write,
+	"remove":      Remove,
+	"rename":      Rename,
+	"chmod":       Chmod,
+	"truncate":    Truncate,
+	"settled":     Settled,
+	"close_write": CloseWrite,
+	"replaced":    Replaced,
+}
+
+// unmarshalDuration decodes a duration from a number of nanoseconds, or a
+// string for time.ParseDuration().
+func unmarshalDuration(field string, raw json.RawMessage) (time.Duration, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", field, err)
+		}
+		return d, nil
+	}
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: not a duration: %s", field, raw)
+	}
+	return time.Duration(n), nil
+}
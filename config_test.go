@@ -0,0 +1,125 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	have, err := ParseConfig([]byte(`{"watches": [
+		{"path": "/srv/app", "recursive": true, "include": ["**/*.go"],
+		 "ops": "create|WRITE", "debounce": "100ms", "initialScan": 1},
+		{"path": "/etc/app.conf", "ops": ["remove", "rename"], "dedup": 1000}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{Watches: []WatchSpec{
+		{Path: "/srv/app", Recursive: true, Include: []string{"**/*.go"},
+			Ops: Create | Write, Debounce: 100 * time.Millisecond, InitialScan: Create},
+		{Path: "/etc/app.conf", Ops: Remove | Rename, Dedup: time.Microsecond},
+	}}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	tests := []struct {
+		in, err string
+	}{
+		{`{"watches": [{"path": "/x"}], "other": 1}`, `unknown field "other"`},
+		{`{"watches": [{"path": "/x", "recursve": true}]}`, `watch 0: unknown field "recursve"`},
+		{`{"watches": [{"recursive": true}]}`, `watch 0 has no path`},
+		{`{"watches": [{"path": "/x", "ops": "write|modify"}]}`, `ops: unknown operation "modify"`},
+		{`{"watches": [{"path": "/x", "ops": true}]}`, `ops: not a number, string, or list of strings`},
+		{`{"watches": [{"path": "/x", "debounce": "1 second"}]}`, `debounce: time: unknown unit`},
+		{`{"watches": [{"path": "/x", "dedup": 1.5}]}`, `dedup: not a duration`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("\nhave: %v\nwant: %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewWatcherFromConfig(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "dir")
+
+	c, err := ParseConfig([]byte(`{"watches": [{"path": ` + quote(tmp) + `, "ops": "create"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcherFromConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	cat(t, "data", tmp, "file")
+	rm(t, tmp, "file")
+	touch(t, tmp, "other")
+
+	for _, want := range []string{"file", "other"} {
+		select {
+		case e := <-w.Events:
+			if want := filepath.Join(tmp, want); e.Name != want || e.Op != Create {
+				t.Errorf("have %s; want CREATE %q", e, want)
+			}
+		case err := <-w.Errors:
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", want)
+		}
+	}
+
+	c.Watches = append(c.Watches, WatchSpec{Path: filepath.Join(tmp, "nonexistent")})
+	if _, err := NewWatcherFromConfig(c); err == nil {
+		t.Error("no error for nonexistent path")
+	}
+}
+
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `\`, `\\`) + `"`
+}
+
+func TestConfigExclude(t *testing.T) {
+	c, err := ParseConfig([]byte(`{"watches": [
+		{"path": "/srv/app", "recursive": true, "exclude": ["vendor/"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, opts, err := c.Watches[0].options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.FromSlash("/srv/app")
+	with := getOptions(opts...)
+	with.setRoot(root, true)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		skip  bool
+	}{
+		{"main.go", false, false},
+		{"vendor", true, true},
+		{"vendor/lib/lib.go", false, true},
+		{"pkg/vendor", true, true},
+		{"pkg/vendor.go", false, false},
+		{"vendor", false, false}, // Only directories.
+	}
+	for _, tt := range tests {
+		if have := with.skip(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir); have != tt.skip {
+			t.Errorf("skip(%q, %t) = %t; want %t", tt.path, tt.isDir, have, tt.skip)
+		}
+	}
+}
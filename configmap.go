@@ -0,0 +1,172 @@
+package fsnotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ConfigMapWatcher watches a directory with a Kubernetes ConfigMap, Secret, or
+// other volume that the kubelet updates atomically, and sends one ConfigUpdate
+// for every update.
+//
+// The kubelet writes the files for an update to a new directory such as
+// "..2022_01_01_00_00_00.123", and then replaces the "..data" symlink to point
+// to it; the files in the volume are symlinks to "..data/file". Watching the
+// directory with a regular watcher sends a number of Create, Rename, and Remove
+// events for the symlinks and directories that are hard to make sense of;
+// ConfigMapWatcher sends a single ConfigUpdate once "..data" is replaced.
+type ConfigMapWatcher struct {
+	// Updates sends an update every time "..data" points to a new directory.
+	Updates chan ConfigUpdate
+
+	// Errors sends any errors.
+	Errors chan error
+
+	dir      string
+	w        *Watcher
+	target   string // Current target of ..data; "" if it doesn't exist.
+	mu       sync.Mutex
+	done     chan struct{}
+	doneResp chan struct{}
+}
+
+// ConfigUpdate is sent by ConfigMapWatcher when the volume is updated.
+type ConfigUpdate struct {
+	Dir    string // The watched directory.
+	Target string // New target of "..data", such as "..2022_01_01_00_00_00.123".
+	Prev   string // Previous target; "" if "..data" didn't exist.
+}
+
+// configMapData is the name of the symlink that the kubelet replaces.
+const configMapData = "..data"
+
+// NewConfigMapWatcher starts watching the volume mounted at dir.
+//
+// The directory doesn't need to contain "..data" yet; an update is sent once
+// it's created.
+func NewConfigMapWatcher(dir string) (*ConfigMapWatcher, error) {
+	dir = filepath.Clean(dir)
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(dir); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, configMapData))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		w.Close()
+		return nil, err
+	}
+
+	c := &ConfigMapWatcher{
+		Updates:  make(chan ConfigUpdate),
+		Errors:   make(chan error),
+		dir:      dir,
+		w:        w,
+		target:   target,
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+// Target returns the current target of "..data"; this is "" if it doesn't
+// exist.
+func (c *ConfigMapWatcher) Target() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.target
+}
+
+// Close stops watching and closes the Updates and Errors channels.
+func (c *ConfigMapWatcher) Close() error {
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil
+	default:
+	}
+	close(c.done)
+	c.mu.Unlock()
+
+	err := c.w.Close()
+	<-c.doneResp
+	return err
+}
+
+func (c *ConfigMapWatcher) run() {
+	defer close(c.doneResp)
+	defer close(c.Errors)
+	defer close(c.Updates)
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case err, ok := <-c.w.Errors:
+			if !ok {
+				return
+			}
+			if !c.sendError(err) {
+				return
+			}
+			// Events may have been lost, so check if ..data changed.
+			if !c.check() {
+				return
+			}
+		case _, ok := <-c.w.Events:
+			if !ok {
+				return
+			}
+			// Not all backends send an event for ..data itself when it's
+			// replaced by a rename, so check it on every event.
+			if !c.check() {
+				return
+			}
+		}
+	}
+}
+
+// check sends an update if the target of ..data changed.
+func (c *ConfigMapWatcher) check() bool {
+	target, err := os.Readlink(filepath.Join(c.dir, configMapData))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return c.sendError(err)
+		}
+		// Removed; the next update sets it again. Keep the old target, so
+		// an update is only sent if it points somewhere else.
+		return true
+	}
+
+	c.mu.Lock()
+	prev := c.target
+	c.target = target
+	c.mu.Unlock()
+	if target == prev {
+		return true
+	}
+
+	select {
+	case c.Updates <- ConfigUpdate{Dir: c.dir, Target: target, Prev: prev}:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *ConfigMapWatcher) sendError(err error) bool {
+	select {
+	case c.Errors <- err:
+		return true
+	case <-c.done:
+		return false
+	}
+}
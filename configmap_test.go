@@ -0,0 +1,77 @@
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// kubeletUpdate writes data to key in dir the way the kubelet updates a
+// ConfigMap volume.
+func kubeletUpdate(t *testing.T, dir, version, key, data string) {
+	t.Helper()
+	mkdir(t, dir, version)
+	cat(t, data, dir, version, key)
+	symlink(t, version, dir, "..data_tmp")
+	mv(t, filepath.Join(dir, "..data_tmp"), dir, configMapData)
+	if _, err := os.Lstat(filepath.Join(dir, key)); os.IsNotExist(err) {
+		symlink(t, filepath.Join(configMapData, key), dir, key)
+	}
+}
+
+func TestConfigMapWatcher(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs privileges on Windows")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	kubeletUpdate(t, tmp, "..v1", "config", "one")
+
+	c, err := NewConfigMapWatcher(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if have := c.Target(); have != "..v1" {
+		t.Fatalf("Target() = %q", have)
+	}
+
+	wait := func(want ConfigUpdate) {
+		t.Helper()
+		select {
+		case have := <-c.Updates:
+			if have != want {
+				t.Fatalf("\nhave: %+v\nwant: %+v", have, want)
+			}
+		case err := <-c.Errors:
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %+v", want)
+		}
+	}
+
+	kubeletUpdate(t, tmp, "..v2", "config", "two")
+	rmAll(t, tmp, "..v1")
+	wait(ConfigUpdate{Dir: tmp, Target: "..v2", Prev: "..v1"})
+
+	kubeletUpdate(t, tmp, "..v3", "config", "three")
+	rmAll(t, tmp, "..v2")
+	wait(ConfigUpdate{Dir: tmp, Target: "..v3", Prev: "..v2"})
+
+	// Only one update per rotation.
+	select {
+	case u := <-c.Updates:
+		t.Fatalf("unexpected update: %+v", u)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-c.Updates; ok {
+		t.Error("Updates not closed")
+	}
+}
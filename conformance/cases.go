@@ -0,0 +1,334 @@
+package conformance
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Cases are the standard tests for the basic operations of a watcher; these
+// are the same tests that are run for the fsnotify backends.
+var Cases = []TestCase{
+	// Basic operations.
+	{Name: "multiple creates", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		file := filepath.Join(tmp, "file")
+		AddWatch(t, w, tmp)
+
+		Cat(t, "data", file)
+		Rm(t, file)
+
+		Touch(t, file)       // Recreate the file
+		Cat(t, "data", file) // Modify
+		Cat(t, "data", file) // Modify
+	}, Want: `
+			create  /file
+			write   /file
+			remove  /file
+			create  /file
+			write   /file
+			write   /file
+		`},
+
+	{Name: "dir only", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		beforeWatch := filepath.Join(tmp, "beforewatch")
+		file := filepath.Join(tmp, "file")
+
+		Touch(t, beforeWatch)
+		AddWatch(t, w, tmp)
+
+		Cat(t, "data", file)
+		Rm(t, file)
+		Rm(t, beforeWatch)
+	}, Want: `
+			create /file
+			write  /file
+			remove /file
+			remove /beforewatch
+		`},
+
+	{Name: "subdir", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		AddWatch(t, w, tmp)
+
+		file := filepath.Join(tmp, "file")
+		dir := filepath.Join(tmp, "sub")
+		dirfile := filepath.Join(tmp, "sub/file2")
+
+		Mkdir(t, dir)     // Create sub-directory
+		Touch(t, file)    // Create a file
+		Touch(t, dirfile) // Create a file (Should not see this! we are not watching subdir)
+		time.Sleep(200 * time.Millisecond)
+		RmAll(t, dir) // Make sure receive deletes for both file and sub-directory
+		Rm(t, file)
+	}, Want: `
+			create /sub
+			create /file
+			remove /sub
+			remove /file
+
+			# Windows includes a write for the /sub dir too, two of them even(?)
+			windows:
+				create /sub
+				create /file
+				write  /sub
+				write  /sub
+				remove /sub
+				remove /file
+		`},
+
+	{Name: "file in directory is not readable", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		if runtime.GOOS == "windows" {
+			t.Skip("attributes don't work on Windows")
+		}
+
+		Touch(t, tmp, "file-unreadable")
+		Chmod(t, 0, tmp, "file-unreadable")
+		Touch(t, tmp, "file")
+		AddWatch(t, w, tmp)
+
+		Cat(t, "hello", tmp, "file")
+		Rm(t, tmp, "file")
+		Rm(t, tmp, "file-unreadable")
+	}, Want: `
+			WRITE     "/file"
+			REMOVE    "/file"
+			REMOVE    "/file-unreadable"
+
+			# We never set up a watcher on the unreadable file, so we don't get
+			# the REMOVE.
+			kqueue:
+                WRITE    "/file"
+                REMOVE   "/file"
+		`},
+
+	// Renames.
+	{Name: "rename file", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		file := filepath.Join(tmp, "file")
+
+		AddWatch(t, w, tmp)
+		Cat(t, "asd", file)
+		Mv(t, file, tmp, "renamed")
+	}, Want: `
+			create /file
+			write  /file
+			rename /file
+			create /renamed
+		`},
+
+	{Name: "rename from unwatched directory", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		unwatched := t.TempDir()
+
+		AddWatch(t, w, tmp)
+		Touch(t, unwatched, "file")
+		Mv(t, filepath.Join(unwatched, "file"), tmp, "file")
+	}, Want: `
+			create /file
+		`},
+
+	{Name: "rename to unwatched directory", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		if runtime.GOOS == "netbsd" && isCI() {
+			t.Skip("fails in CI; see #488")
+		}
+
+		unwatched := t.TempDir()
+		file := filepath.Join(tmp, "file")
+		renamed := filepath.Join(unwatched, "renamed")
+
+		AddWatch(t, w, tmp)
+
+		Cat(t, "data", file)
+		Mv(t, file, renamed)
+		Cat(t, "data", renamed) // Modify the file outside of the watched dir
+		Touch(t, file)          // Recreate the file that was moved
+	}, Want: `
+			create /file # cat data >file
+			write  /file # ^
+			rename /file # mv file ../renamed
+			create /file # touch file
+
+			# Windows has REMOVE /file, rather than CREATE /file
+			windows:
+				create   /file
+				write    /file
+				remove   /file
+				create   /file
+		`},
+
+	{Name: "rename overwriting existing file", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		Touch(t, tmp, "renamed")
+		AddWatch(t, w, tmp)
+
+		unwatched := t.TempDir()
+		file := filepath.Join(unwatched, "file")
+		Touch(t, file)
+		Mv(t, file, tmp, "renamed")
+	}, Want: `
+			remove /renamed
+			create /renamed
+
+			# No remove event for inotify; inotify just sends MOVE_SELF.
+			linux:
+				create /renamed
+		`},
+
+	{Name: "rename watched directory", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		AddWatch(t, w, tmp)
+
+		dir := filepath.Join(tmp, "dir")
+		Mkdir(t, dir)
+		AddWatch(t, w, dir)
+
+		Mv(t, dir, tmp, "dir-renamed")
+		Touch(t, tmp, "dir-renamed/file")
+	}, Want: `
+			CREATE   "/dir"           # mkdir
+			RENAME   "/dir"           # mv
+			CREATE   "/dir-renamed"
+			RENAME   "/dir"
+			CREATE   "/dir/file"      # touch
+
+			windows:
+				CREATE       "/dir"                 # mkdir
+				RENAME       "/dir"                 # mv
+				CREATE       "/dir-renamed"
+				CREATE       "/dir-renamed/file"    # touch
+
+			# TODO: no results for the touch; this is probably a bug; windows
+			# was fixed in #370.
+			kqueue:
+				CREATE               "/dir"           # mkdir
+				CREATE               "/dir-renamed"   # mv
+				REMOVE|RENAME        "/dir"
+		`},
+
+	// Attribute changes.
+	{Name: "chmod", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		skipAttrib(t)
+		file := filepath.Join(tmp, "file")
+
+		Cat(t, "data", file)
+		AddWatch(t, w, file)
+		Chmod(t, 0o700, file)
+	}, Want: `
+			CHMOD   "/file"
+		`},
+
+	{Name: "write does not trigger CHMOD", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		skipAttrib(t)
+		file := filepath.Join(tmp, "file")
+
+		Cat(t, "data", file)
+		AddWatch(t, w, file)
+		Chmod(t, 0o700, file)
+
+		Cat(t, "more data", file)
+	}, Want: `
+			CHMOD   "/file"
+			WRITE   "/file"
+		`},
+
+	{Name: "chmod after write", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		skipAttrib(t)
+		file := filepath.Join(tmp, "file")
+
+		Cat(t, "data", file)
+		AddWatch(t, w, file)
+		Chmod(t, 0o700, file)
+		Cat(t, "more data", file)
+		Chmod(t, 0o600, file)
+	}, Want: `
+			CHMOD   "/file"
+			WRITE   "/file"
+			CHMOD   "/file"
+		`},
+
+	// Symlinks.
+	{Name: "create unresolvable symlink", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		AddWatch(t, w, tmp)
+
+		Symlink(t, filepath.Join(tmp, "target"), tmp, "link")
+	}, Want: `
+			create /link
+
+			windows:
+                create    /link
+                write     /link
+		`},
+
+	{Name: "cyclic symlink", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		if runtime.GOOS == "darwin" {
+			// This test is borked on macOS; it reports events outside the
+			// watched directory:
+			//
+			//   create "/private/.../testwatchsymlinkcyclic_symlink3681444267/001/link"
+			//   create "/link"
+			//   write  "/link"
+			//   write  "/private/.../testwatchsymlinkcyclic_symlink3681444267/001/link"
+			//
+			// kqueue.go does a lot of weird things with symlinks that I
+			// don't think are necessarily correct, but need to test a bit
+			// more.
+			t.Skip()
+		}
+
+		Symlink(t, ".", tmp, "link")
+		AddWatch(t, w, tmp)
+		Rm(t, tmp, "link")
+		Cat(t, "foo", tmp, "link")
+
+	}, Want: `
+			write  /link
+			create /link
+
+			linux, windows:
+				remove    /link
+				create    /link
+				write     /link
+		`},
+
+	// Removing the watched path.
+	{Name: "remove watched directory", Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+		if runtime.GOOS == "openbsd" || runtime.GOOS == "netbsd" {
+			t.Skip("behaviour is inconsistent on OpenBSD and NetBSD, and this test is flaky")
+		}
+
+		file := filepath.Join(tmp, "file")
+
+		Touch(t, file)
+		AddWatch(t, w, tmp)
+		RmAll(t, tmp)
+	}, Want: `
+			# OpenBSD, NetBSD
+			remove             /file
+			remove|write       /
+
+			freebsd:
+				remove|write   "/"
+				remove         ""
+				create         "."
+
+			darwin:
+				remove         /file
+				remove|write   /
+			linux:
+				remove         /file
+				remove         /
+			windows:
+				remove         /file
+				remove         /
+		`},
+}
+
+func isCI() bool {
+	_, ok := os.LookupEnv("CI")
+	return ok
+}
+
+func skipAttrib(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("attributes don't work on Windows")
+	}
+}
@@ -0,0 +1,322 @@
+// Package conformance tests if a watcher sends the expected events, so that
+// other implementations of fsnotify.Notifier (e.g. a new backend) can be
+// checked against the same behaviour as the fsnotify backends.
+//
+// Every TestCase does some operations on a temporary directory, and lists the
+// expected events:
+//
+//	conformance.TestCase{
+//		Name: "create",
+//		Ops: func(t *testing.T, w fsnotify.Notifier, tmp string) {
+//			conformance.AddWatch(t, w, tmp)
+//			conformance.Touch(t, tmp, "file")
+//		},
+//		Want: `
+//			create /file
+//		`,
+//	}
+//
+// Every event in Want is one line, with any whitespace between the event and
+// path ignored; the path can optionally be surrounded in ", and is relative to
+// the temporary directory. Anything after a "#" is ignored.
+//
+// Platform-specific expectations can be added after a line with the platform
+// name(s) and a colon:
+//
+//	# Used if nothing else matches.
+//	create /file
+//
+//	# Used on Windows and Linux.
+//	windows, linux:
+//		create /file
+//		write  /file
+//
+// The platform is the Suite.Platform, which defaults to runtime.GOOS; "kqueue"
+// is a shortcut for all kqueue systems (BSD, macOS).
+//
+// Run all the cases in Cases with:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Suite{New: newMyWatcher}.Run(t, conformance.Cases)
+//	}
+package conformance
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Suite runs test cases for a watcher implementation.
+type Suite struct {
+	// New creates a new watcher; every test gets a new watcher.
+	New func() (fsnotify.Notifier, error)
+
+	// Platform to use for the platform-specific expectations; the default is
+	// runtime.GOOS.
+	Platform string
+}
+
+// TestCase is a single test.
+type TestCase struct {
+	// Name of the test, for t.Run().
+	Name string
+
+	// Ops runs the operations to test for the watcher w, in the temporary
+	// directory tmp.
+	Ops func(t *testing.T, w fsnotify.Notifier, tmp string)
+
+	// Want is the list of expected events, in the format described in the
+	// package documentation.
+	Want string
+}
+
+// Run runs all tests in cases as parallel subtests of t.
+func (s Suite) Run(t *testing.T, cases []TestCase) {
+	t.Helper()
+	for _, tt := range cases {
+		s.RunCase(t, tt)
+	}
+}
+
+// RunCase runs a single test as a parallel subtest of t.
+func (s Suite) RunCase(t *testing.T, tt TestCase) {
+	t.Helper()
+	t.Run(tt.Name, func(t *testing.T) {
+		t.Helper()
+		t.Parallel()
+		tmp := t.TempDir()
+
+		w, err := s.New()
+		if err != nil {
+			t.Fatalf("creating watcher: %s", err)
+		}
+		c := newCollector(w)
+		c.collect(t)
+
+		tt.Ops(t, w, tmp)
+
+		CompareEvents(t, tmp, c.stop(t), ParseEvents(t, s.platform(), tt.Want))
+	})
+}
+
+func (s Suite) platform() string {
+	if s.Platform != "" {
+		return s.Platform
+	}
+	return runtime.GOOS
+}
+
+// Events is a list of events.
+type Events []fsnotify.Event
+
+func (e Events) String() string {
+	b := new(strings.Builder)
+	for i, ee := range e {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(b, "%-20s %q", ee.Op.String(), filepath.ToSlash(ee.Name))
+	}
+	return b.String()
+}
+
+// TrimPrefix removes prefix from the names of all events; an event for prefix
+// itself gets the name "/".
+func (e Events) TrimPrefix(prefix string) Events {
+	for i := range e {
+		if e[i].Name == prefix {
+			e[i].Name = "/"
+		} else {
+			e[i].Name = strings.TrimPrefix(e[i].Name, prefix)
+		}
+	}
+	return e
+}
+
+func (e Events) copy() Events {
+	cp := make(Events, len(e))
+	copy(cp, e)
+	return cp
+}
+
+// ParseEvents parses the list of events in s, in the format described in the
+// package documentation, and returns the events for platform.
+func ParseEvents(t testing.TB, platform, s string) Events {
+	t.Helper()
+
+	var (
+		lines  = strings.Split(s, "\n")
+		groups = []string{""}
+		events = make(map[string]Events)
+	)
+	for no, line := range lines {
+		if i := strings.IndexByte(line, '#'); i > -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasSuffix(line, ":") {
+			groups = strings.Split(strings.TrimRight(line, ":"), ",")
+			for i := range groups {
+				groups[i] = strings.TrimSpace(groups[i])
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			t.Fatalf("ParseEvents: line %d has less than 2 fields: %s", no, line)
+		}
+
+		path := strings.Trim(fields[len(fields)-1], `"`)
+
+		var op fsnotify.Op
+		for _, e := range fields[:len(fields)-1] {
+			if e == "|" {
+				continue
+			}
+			for _, ee := range strings.Split(e, "|") {
+				switch strings.ToUpper(ee) {
+				case "CREATE":
+					op |= fsnotify.Create
+				case "WRITE":
+					op |= fsnotify.Write
+				case "REMOVE":
+					op |= fsnotify.Remove
+				case "RENAME":
+					op |= fsnotify.Rename
+				case "CHMOD":
+					op |= fsnotify.Chmod
+				case "TRUNCATE":
+					op |= fsnotify.Truncate
+				case "SETTLED":
+					op |= fsnotify.Settled
+				case "CLOSE_WRITE":
+					op |= fsnotify.CloseWrite
+				case "REPLACED":
+					op |= fsnotify.Replaced
+				default:
+					t.Fatalf("ParseEvents: line %d has unknown event %q: %s", no, ee, line)
+				}
+			}
+		}
+
+		for _, g := range groups {
+			events[g] = append(events[g], fsnotify.Event{Name: path, Op: op})
+		}
+	}
+
+	if e, ok := events[platform]; ok {
+		return e
+	}
+	switch platform {
+	// kqueue shortcut
+	case "freebsd", "netbsd", "openbsd", "dragonfly", "darwin":
+		if e, ok := events["kqueue"]; ok {
+			return e
+		}
+	// Fall back to solaris for illumos, and vice versa.
+	case "solaris":
+		if e, ok := events["illumos"]; ok {
+			return e
+		}
+	case "illumos":
+		if e, ok := events["solaris"]; ok {
+			return e
+		}
+	}
+	return events[""]
+}
+
+// CompareEvents reports an error if the events in have (with tmp removed from
+// the names) aren't the same as want. The order of events isn't compared.
+func CompareEvents(t testing.TB, tmp string, have, want Events) {
+	t.Helper()
+
+	have = have.TrimPrefix(tmp)
+
+	haveSort, wantSort := have.copy(), want.copy()
+	sort.Slice(haveSort, func(i, j int) bool {
+		return haveSort[i].String() > haveSort[j].String()
+	})
+	sort.Slice(wantSort, func(i, j int) bool {
+		return wantSort[i].String() > wantSort[j].String()
+	})
+
+	if haveSort.String() != wantSort.String() {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", indent(have), indent(want))
+	}
+}
+
+func indent(s fmt.Stringer) string {
+	return "\t" + strings.ReplaceAll(s.String(), "\n", "\n\t")
+}
+
+// collector collects all events of a watcher.
+type collector struct {
+	w      fsnotify.Notifier
+	events Events
+	mu     sync.Mutex
+	done   chan struct{}
+}
+
+func newCollector(w fsnotify.Notifier) *collector {
+	return &collector{w: w, done: make(chan struct{})}
+}
+
+func (c *collector) stop(t *testing.T) Events {
+	t.Helper()
+	WaitForEvents()
+
+	go func() {
+		err := c.w.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	select {
+	case <-time.After(1 * time.Second):
+		t.Fatal("event stream was not closed after 1 second")
+	case <-c.done:
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.events
+}
+
+func (c *collector) collect(t *testing.T) {
+	events, errors := c.w.EventsChan(), c.w.ErrorsChan()
+	go func() {
+		for {
+			select {
+			case e, ok := <-errors:
+				if !ok {
+					c.done <- struct{}{}
+					return
+				}
+				t.Error(e)
+				return
+			case e, ok := <-events:
+				if !ok {
+					c.done <- struct{}{}
+					return
+				}
+				c.mu.Lock()
+				c.events = append(c.events, e)
+				c.mu.Unlock()
+			}
+		}
+	}()
+}
@@ -0,0 +1,46 @@
+//go:build !plan9 && !solaris
+// +build !plan9,!solaris
+
+package conformance_test
+
+import (
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/fsnotify/fsnotify/conformance"
+)
+
+func TestCases(t *testing.T) {
+	conformance.Suite{
+		New: func() (fsnotify.Notifier, error) { return fsnotify.NewWatcher() },
+	}.Run(t, conformance.Cases)
+}
+
+func TestParseEvents(t *testing.T) {
+	in := `
+		create /file   # Comment
+		write  "/file"
+
+		kqueue:
+			create|write /file
+		linux, windows:
+			remove /file
+	`
+	tests := []struct {
+		platform string
+		want     conformance.Events
+	}{
+		{"darwin", conformance.Events{{Name: "/file", Op: fsnotify.Create | fsnotify.Write}}},
+		{"linux", conformance.Events{{Name: "/file", Op: fsnotify.Remove}}},
+		{"windows", conformance.Events{{Name: "/file", Op: fsnotify.Remove}}},
+		{"polling", conformance.Events{{Name: "/file", Op: fsnotify.Create}, {Name: "/file", Op: fsnotify.Write}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			have := conformance.ParseEvents(t, tt.platform, in)
+			if have.String() != tt.want.String() {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, tt.want)
+			}
+		})
+	}
+}
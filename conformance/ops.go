@@ -0,0 +1,187 @@
+package conformance
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// The helpers below wait a little bit after most operations; this gives the
+// system some time to sync things and makes things more consistent across
+// platforms. Use an empty string as one of the path elements to skip this;
+// filepath.Join skips empty elements.
+
+// EventSeparator waits a little bit between operations.
+func EventSeparator() { time.Sleep(50 * time.Millisecond) }
+
+// WaitForEvents waits for all events to arrive.
+func WaitForEvents() { time.Sleep(500 * time.Millisecond) }
+
+func shouldWait(path ...string) bool {
+	for _, p := range path {
+		if p == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// AddWatch adds a watch for the path.
+func AddWatch(t testing.TB, w fsnotify.Notifier, path ...string) {
+	t.Helper()
+	if len(path) < 1 {
+		t.Fatalf("AddWatch: path must have at least one element: %s", path)
+	}
+	err := w.Add(filepath.Join(path...))
+	if err != nil {
+		t.Fatalf("AddWatch(%q): %s", filepath.Join(path...), err)
+	}
+}
+
+// Mkdir creates a directory.
+func Mkdir(t testing.TB, path ...string) {
+	t.Helper()
+	if len(path) < 1 {
+		t.Fatalf("Mkdir: path must have at least one element: %s", path)
+	}
+	err := os.Mkdir(filepath.Join(path...), 0o0755)
+	if err != nil {
+		t.Fatalf("Mkdir(%q): %s", filepath.Join(path...), err)
+	}
+	if shouldWait(path...) {
+		EventSeparator()
+	}
+}
+
+// Symlink creates a symbolic link to target.
+func Symlink(t testing.TB, target string, link ...string) {
+	t.Helper()
+	if len(link) < 1 {
+		t.Fatalf("Symlink: link must have at least one element: %s", link)
+	}
+	err := os.Symlink(target, filepath.Join(link...))
+	if err != nil {
+		t.Fatalf("Symlink(%q, %q): %s", target, filepath.Join(link...), err)
+	}
+	if shouldWait(link...) {
+		EventSeparator()
+	}
+}
+
+// Cat appends data to a file, creating it if it doesn't exist.
+func Cat(t testing.TB, data string, path ...string) {
+	t.Helper()
+	if len(path) < 1 {
+		t.Fatalf("Cat: path must have at least one element: %s", path)
+	}
+
+	err := func() error {
+		fp, err := os.OpenFile(filepath.Join(path...), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return err
+		}
+		if err := fp.Sync(); err != nil {
+			return err
+		}
+		if shouldWait(path...) {
+			EventSeparator()
+		}
+		if _, err := fp.WriteString(data); err != nil {
+			return err
+		}
+		if err := fp.Sync(); err != nil {
+			return err
+		}
+		if shouldWait(path...) {
+			EventSeparator()
+		}
+		return fp.Close()
+	}()
+	if err != nil {
+		t.Fatalf("Cat(%q): %s", filepath.Join(path...), err)
+	}
+}
+
+// Touch creates an empty file, or truncates an existing file.
+func Touch(t testing.TB, path ...string) {
+	t.Helper()
+	if len(path) < 1 {
+		t.Fatalf("Touch: path must have at least one element: %s", path)
+	}
+	fp, err := os.Create(filepath.Join(path...))
+	if err != nil {
+		t.Fatalf("Touch(%q): %s", filepath.Join(path...), err)
+	}
+	err = fp.Close()
+	if err != nil {
+		t.Fatalf("Touch(%q): %s", filepath.Join(path...), err)
+	}
+	if shouldWait(path...) {
+		EventSeparator()
+	}
+}
+
+// Mv renames src to dst.
+func Mv(t testing.TB, src string, dst ...string) {
+	t.Helper()
+	if len(dst) < 1 {
+		t.Fatalf("Mv: dst must have at least one element: %s", dst)
+	}
+
+	err := os.Rename(src, filepath.Join(dst...))
+	if err != nil {
+		t.Fatalf("Mv(%q, %q): %s", src, filepath.Join(dst...), err)
+	}
+	if shouldWait(dst...) {
+		EventSeparator()
+	}
+}
+
+// Rm removes a file or empty directory.
+func Rm(t testing.TB, path ...string) {
+	t.Helper()
+	if len(path) < 1 {
+		t.Fatalf("Rm: path must have at least one element: %s", path)
+	}
+	err := os.Remove(filepath.Join(path...))
+	if err != nil {
+		t.Fatalf("Rm(%q): %s", filepath.Join(path...), err)
+	}
+	if shouldWait(path...) {
+		EventSeparator()
+	}
+}
+
+// RmAll removes a path and everything it contains.
+func RmAll(t testing.TB, path ...string) {
+	t.Helper()
+	if len(path) < 1 {
+		t.Fatalf("RmAll: path must have at least one element: %s", path)
+	}
+	err := os.RemoveAll(filepath.Join(path...))
+	if err != nil {
+		t.Fatalf("RmAll(%q): %s", filepath.Join(path...), err)
+	}
+	if shouldWait(path...) {
+		EventSeparator()
+	}
+}
+
+// Chmod changes the mode of a file.
+func Chmod(t testing.TB, mode fs.FileMode, path ...string) {
+	t.Helper()
+	if len(path) < 1 {
+		t.Fatalf("Chmod: path must have at least one element: %s", path)
+	}
+	err := os.Chmod(filepath.Join(path...), mode)
+	if err != nil {
+		t.Fatalf("Chmod(%q): %s", filepath.Join(path...), err)
+	}
+	if shouldWait(path...) {
+		EventSeparator()
+	}
+}
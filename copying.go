@@ -0,0 +1,132 @@
+package fsnotify
+
+import (
+	"os"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// Copying reports if the file at path is still being copied or written: it's
+// open for writing by some process, or its size or modification time changed
+// within interval.
+//
+// Open files are only detected on Linux, and only for processes that the
+// current user can inspect; on other platforms only the growth is checked.
+// Copying blocks for interval.
+func Copying(path string, interval time.Duration) (bool, error) {
+	before, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if !before.Mode().IsRegular() {
+		return false, nil
+	}
+	if open, ok := openForWrite(path); ok && open {
+		return true, nil
+	}
+	time.Sleep(interval)
+	after, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return changed(before, after), nil
+}
+
+// changed reports if the size or modification time is different.
+func changed(a, b os.FileInfo) bool {
+	return a.Size() != b.Size() || !a.ModTime().Equal(b.ModTime())
+}
+
+// createQueue holds back Create events for files that are still being
+// copied, for WithCompleteCreate().
+type createQueue struct {
+	mu      sync.Mutex
+	pending map[string]*createEvent // key: path
+}
+
+type createEvent struct {
+	e    Event
+	last os.FileInfo
+	gone chan struct{} // Closed if the file is removed or renamed first.
+}
+
+func newCreateQueue() *createQueue {
+	return &createQueue{pending: make(map[string]*createEvent)}
+}
+
+// len returns the number of queued events.
+func (q *createQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// send sends e with deliver, or holds it back if it's a Create event for a
+// file that's still being copied. It's sent once the file didn't change for
+// interval and isn't open for writing anymore.
+//
+// Other events for a held back file are dropped: the Create event is sent
+// after them. If the file is removed or renamed before it's complete then
+// neither the Create event nor the Remove or Rename event are sent.
+// Returns false if the watcher is closed.
+func (q *createQueue) send(e Event, interval time.Duration, clock Clock, deliver func(Event) bool, done <-chan struct{}, labels pprof.LabelSet) bool {
+	q.mu.Lock()
+	if pe, ok := q.pending[e.Name]; ok {
+		if e.Has(Remove) || e.Has(Rename) {
+			delete(q.pending, e.Name)
+			close(pe.gone)
+		}
+		q.mu.Unlock()
+		return true
+	}
+	q.mu.Unlock()
+
+	if !e.Has(Create) {
+		return deliver(e)
+	}
+	st, err := os.Stat(e.Name)
+	if err != nil || !st.Mode().IsRegular() {
+		return deliver(e)
+	}
+
+	pe := &createEvent{e: e, last: st, gone: make(chan struct{})}
+	q.mu.Lock()
+	q.pending[e.Name] = pe
+	q.mu.Unlock()
+
+	goLabeled(labels, "copying", func() {
+		t := clock.NewTimer(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C():
+			case <-pe.gone:
+				return
+			case <-done:
+				return
+			}
+
+			st, err := os.Stat(e.Name)
+			if err == nil {
+				open, _ := openForWrite(e.Name)
+				if open || changed(pe.last, st) {
+					pe.last = st
+					t.Reset(interval)
+					continue
+				}
+			}
+
+			q.mu.Lock()
+			if q.pending[e.Name] != pe {
+				q.mu.Unlock()
+				return
+			}
+			delete(q.pending, e.Name)
+			q.mu.Unlock()
+			deliver(e)
+			return
+		}
+	})
+	return true
+}
@@ -0,0 +1,46 @@
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCopying(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "file")
+	fp, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+
+	// Growing.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		fp.WriteString("data")
+	}()
+	if c, err := Copying(file, 100*time.Millisecond); err != nil || !c {
+		t.Errorf("growing file: %t, %v; want true", c, err)
+	}
+
+	// Open for writing, but not growing.
+	if runtime.GOOS == "linux" {
+		if c, err := Copying(file, 10*time.Millisecond); err != nil || !c {
+			t.Errorf("open file: %t, %v; want true", c, err)
+		}
+	}
+
+	fp.Close()
+	if c, err := Copying(file, 10*time.Millisecond); err != nil || c {
+		t.Errorf("closed file: %t, %v; want false", c, err)
+	}
+
+	if _, err := Copying(filepath.Join(tmp, "nonexistent"), 0); !os.IsNotExist(err) {
+		t.Errorf("wrong error for nonexistent file: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package fsnotify
+
+import (
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+)
+
+// debounceQueue merges all events for a path into one event that's sent once
+// there were no new events for the path for a while, for WithDebounce().
+//
+// The events are sent from a single goroutine for the queue, which waits for
+// the event that's due first.
+type debounceQueue struct {
+	mu      sync.Mutex
+	pending map[string]*debounceEvent // key: path
+	running bool                      // The goroutine that sends the events was started.
+	wake    chan struct{}             // Signals the goroutine that an event was queued.
+}
+
+type debounceEvent struct {
+	e       Event
+	due     time.Time // Send once the clock reaches this.
+	clock   Clock
+	deliver func(Event) bool
+}
+
+func newDebounceQueue() *debounceQueue {
+	return &debounceQueue{
+		pending: make(map[string]*debounceEvent),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// len returns the number of queued events.
+func (q *debounceQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// send queues e, or merges it with the queued event for the same path. It's
+// sent with deliver after there were no new events for the path for wait.
+// Returns false if the watcher is closed.
+func (q *debounceQueue) send(e Event, wait time.Duration, clock Clock, deliver func(Event) bool, done <-chan struct{}, labels pprof.LabelSet) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if pe, ok := q.pending[e.Name]; ok {
+		// Only Write events have a size; keep the size from before the first
+		// Write, and after the last one.
+		if e.Has(Write) {
+			if !pe.e.Has(Write) {
+				pe.e.PrevSize = e.PrevSize
+			}
+			pe.e.Size = e.Size
+		}
+		pe.e.Op |= e.Op
+		// Only moves it later, so the goroutine doesn't need to know.
+		pe.due = clock.Now().Add(wait)
+		return true
+	}
+
+	q.pending[e.Name] = &debounceEvent{e: e, due: clock.Now().Add(wait), clock: clock, deliver: deliver}
+	if !q.running {
+		q.running = true
+		goLabeled(labels, "debounce", func() { q.run(done) })
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// run sends the queued events once they're due, until done is closed.
+func (q *debounceQueue) run(done <-chan struct{}) {
+	var t Timer
+	defer func() {
+		if t != nil {
+			t.Stop()
+		}
+	}()
+	for {
+		var fired <-chan time.Time
+		if t != nil {
+			fired = t.C()
+		}
+		select {
+		case <-q.wake:
+		case <-fired:
+		case <-done:
+			return
+		}
+		if t != nil {
+			t.Stop()
+			t = nil
+		}
+
+		var (
+			due  []*debounceEvent
+			next *debounceEvent
+			left time.Duration
+		)
+		q.mu.Lock()
+		for name, pe := range q.pending {
+			l := pe.due.Sub(pe.clock.Now())
+			if l <= 0 {
+				due = append(due, pe)
+				delete(q.pending, name)
+				continue
+			}
+			if next == nil || l < left {
+				next, left = pe, l
+			}
+		}
+		if next != nil {
+			t = next.clock.NewTimer(left)
+		}
+		q.mu.Unlock()
+
+		sort.Slice(due, func(i, j int) bool {
+			if !due[i].due.Equal(due[j].due) {
+				return due[i].due.Before(due[j].due)
+			}
+			return due[i].e.Name < due[j].e.Name
+		})
+		for _, pe := range due {
+			pe.deliver(pe.e)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package fsnotify
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DebugHandler returns a http.Handler that shows w.DebugString(), for
+// diagnosing missed events in a running program. Don't expose it publicly: it
+// shows all watched paths.
+func DebugHandler(w *Watcher) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprint(rw, w.DebugString())
+	})
+}
+
+// debugSection writes a section of DebugString() with a title and the lines in
+// sorted order.
+func debugSection(b *strings.Builder, title string, lines []string) {
+	sort.Strings(lines)
+	fmt.Fprintf(b, "%s (%d):\n", title, len(lines))
+	for _, l := range lines {
+		b.WriteString("  ")
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+}
+
+// debugUserWatches writes the watches added with AddWith() and their options,
+// as the fields of WatchSpec that are set.
+func debugUserWatches(b *strings.Builder, watches map[string]withOpts) {
+	lines := make([]string, 0, len(watches))
+	for path, with := range watches {
+		line := []string{path}
+		v := reflect.ValueOf(newWatchSpec(path, with))
+		for i := 0; i < v.NumField(); i++ {
+			name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+			if f := v.Field(i); name != "path" && !f.IsZero() {
+				line = append(line, fmt.Sprintf("%s=%v", name, f.Interface()))
+			}
+		}
+		lines = append(lines, strings.Join(line, " "))
+	}
+	debugSection(b, "user watches", lines)
+}
+
+// debugString writes the number of events waiting in the pipeline.
+func (p *pipeline) debugString(b *strings.Builder) {
+	b.WriteString("queues:\n")
+	fmt.Fprintf(b, "  append-only: %d\n", p.appends.len())
+	fmt.Fprintf(b, "  debounce: %d\n", p.waits.len())
+	fmt.Fprintf(b, "  settle: %d\n", p.settles.len())
+	fmt.Fprintf(b, "  complete create: %d\n", p.creates.len())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if q := p.delivery; q != nil {
+		fmt.Fprintf(b, "  delivery: %d priority, %d bulk\n", len(q.high), len(q.bulk))
+	}
+	fmt.Fprintf(b, "  blocked on Events: %d\n", len(p.waiting))
+	fmt.Fprintf(b, "subscriptions: %d\n", len(p.subs))
+	fmt.Fprintf(b, "duplicates dropped: %d\n", p.dupes)
+	if len(p.paused) > 0 {
+		groups := make([]string, 0, len(p.paused))
+		for g := range p.paused {
+			groups = append(groups, g)
+		}
+		debugSection(b, "paused groups", groups)
+	}
+	if len(p.quotas) > 0 {
+		lines := make([]string, 0, len(p.quotas))
+		for g, q := range p.quotas {
+			lines = append(lines, fmt.Sprintf("%s MaxWatches=%d MaxEvents=%g dropping=%t full=%t",
+				g, q.MaxWatches, q.MaxEvents, q.dropping, q.full))
+		}
+		debugSection(b, "quotas", lines)
+	}
+}
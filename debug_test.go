@@ -0,0 +1,40 @@
+package fsnotify
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugString(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w := newWatcher(t)
+	defer w.Close()
+	if err := w.AddWith(tmp, WithDebounce(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	have := w.DebugString()
+	for _, want := range []string{
+		"user watches (1):\n  " + tmp + " debounce=1ns\n",
+		"  debounce: 0\n",
+		"duplicates dropped: 0\n",
+	} {
+		if !strings.Contains(have, want) {
+			t.Errorf("%q not in:\n%s", want, have)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	DebugHandler(w).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/fsnotify", nil))
+	body, _ := io.ReadAll(rec.Result().Body)
+	if string(body) != have {
+		t.Errorf("\nhave: %s\nwant: %s", body, have)
+	}
+	if ct := rec.Result().Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("wrong Content-Type: %q", ct)
+	}
+}
@@ -0,0 +1,100 @@
+package fsnotify
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime"
+	"sync"
+)
+
+// DispatchOptions are the options for Dispatch().
+type DispatchOptions struct {
+	// Number of workers that call the handler. The default is
+	// runtime.GOMAXPROCS(0).
+	Workers int
+
+	// Number of events that can be queued for every worker before Dispatch()
+	// stops reading events. The default is 64.
+	Queue int
+
+	// Called for the errors from the watcher. If this is nil then Dispatch()
+	// returns the first error.
+	OnError func(error)
+}
+
+// Dispatch reads the events from n and calls handle for them from a pool of
+// workers, until ctx is cancelled or the Events channel is closed.
+//
+// Events for the same path are always handled by the same worker, in the order
+// they were sent, so the handler doesn't have to worry about seeing the Remove
+// for a file before the Create. Events for different paths are handled
+// concurrently and may be handled in any order; this includes the paths of a
+// directory and the files in it, and the old and new path of a rename.
+//
+// It returns ctx.Err() once ctx is cancelled, or nil when the Events channel is
+// closed, after waiting for the handlers to finish. Events that are still
+// queued when ctx is cancelled are dropped.
+func Dispatch(ctx context.Context, n Notifier, handle func(Event), opts DispatchOptions) error {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.Queue <= 0 {
+		opts.Queue = 64
+	}
+
+	var (
+		wg     sync.WaitGroup
+		queues = make([]chan Event, opts.Workers)
+	)
+	for i := range queues {
+		queues[i] = make(chan Event, opts.Queue)
+		wg.Add(1)
+		go func(q <-chan Event) {
+			defer wg.Done()
+			for e := range q {
+				if ctx.Err() == nil {
+					handle(e)
+				}
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+	}()
+
+	events, errs := n.EventsChan(), n.ErrorsChan()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if opts.OnError == nil {
+				return err
+			}
+			opts.OnError(err)
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			select {
+			case queues[worker(e.Name, len(queues))] <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// worker returns the worker for events for path.
+func worker(path string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return int(h.Sum32() % uint32(workers))
+}
@@ -0,0 +1,103 @@
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chanNotifier is a Notifier that sends the events written to its channels.
+type chanNotifier struct {
+	events chan Event
+	errors chan error
+}
+
+func (n chanNotifier) Add(string) error                   { return nil }
+func (n chanNotifier) AddWith(string, ...AddOption) error { return nil }
+func (n chanNotifier) Remove(string) error                { return nil }
+func (n chanNotifier) Close() error                       { close(n.events); return nil }
+func (n chanNotifier) EventsChan() <-chan Event           { return n.events }
+func (n chanNotifier) ErrorsChan() <-chan error           { return n.errors }
+
+func TestDispatch(t *testing.T) {
+	t.Parallel()
+
+	n := chanNotifier{events: make(chan Event), errors: make(chan error)}
+	var (
+		mu      sync.Mutex
+		have    = make(map[string][]int64)
+		running int
+		most    int
+	)
+	handle := func(e Event) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		have[e.Name] = append(have[e.Name], e.Size)
+		mu.Unlock()
+	}
+
+	done := make(chan error)
+	go func() { done <- Dispatch(context.Background(), n, handle, DispatchOptions{Workers: 4}) }()
+	for i := int64(0); i < 20; i++ {
+		for p := 0; p < 10; p++ {
+			n.events <- Event{Name: fmt.Sprintf("/file%d", p), Op: Write, Size: i}
+		}
+	}
+	n.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(have) != 10 {
+		t.Fatalf("wrong number of paths: %d", len(have))
+	}
+	for name, sizes := range have {
+		for i, s := range sizes {
+			if s != int64(i) {
+				t.Fatalf("%s: out of order: %v", name, sizes)
+			}
+		}
+		if len(sizes) != 20 {
+			t.Errorf("%s: %d events; want 20", name, len(sizes))
+		}
+	}
+	if most < 2 {
+		t.Errorf("events weren't handled concurrently")
+	}
+}
+
+func TestDispatchError(t *testing.T) {
+	t.Parallel()
+
+	n := chanNotifier{events: make(chan Event), errors: make(chan error, 1)}
+	n.errors <- ErrEventOverflow
+	err := Dispatch(context.Background(), n, func(Event) {}, DispatchOptions{})
+	if !errors.Is(err, ErrEventOverflow) {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.errors <- ErrEventOverflow
+	var have []error
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	err = Dispatch(ctx, n, func(Event) {}, DispatchOptions{OnError: func(err error) { have = append(have, err) }})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error: %v", err)
+	}
+	if len(have) != 1 || have[0] != ErrEventOverflow {
+		t.Errorf("wrong errors: %v", have)
+	}
+}
@@ -0,0 +1,39 @@
+package fsnotify
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// drainPoll is how often flush() checks if all events were sent.
+const drainPoll = 5 * time.Millisecond
+
+// pending returns the number of events in the pipeline that aren't sent yet.
+func (p *pipeline) pending() int {
+	return int(atomic.LoadInt32(&p.inflight)) + p.appends.len() + p.waits.len() +
+		p.settles.len() + p.creates.len() + p.portable.len()
+}
+
+// flush waits until all events in the pipeline are sent, for
+// WithDrainOnClose(). Events that are held back, for example by WithDebounce(),
+// are sent once their timer fires. Returns false if the deadline passed or the
+// watcher was closed first.
+func (p *pipeline) flush(deadline time.Time) bool {
+	for p.pending() > 0 {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return false
+		}
+		if wait > drainPoll {
+			wait = drainPoll
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-p.done:
+			t.Stop()
+			return false
+		case <-t.C:
+		}
+	}
+	return true
+}
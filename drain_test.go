@@ -0,0 +1,82 @@
+package fsnotify
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWithDrainOnClose(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "windows", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+	default:
+		t.Skip("no backend")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w, err := NewWatcherWith(WithDrainOnClose(5 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddWith(tmp, WithOps(Create)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing reads the events yet, so they're all still queued when Close()
+	// is called.
+	const n = 50
+	for i := 0; i < n; i++ {
+		touch(t, filepath.Join(tmp, fmt.Sprintf("file-%02d", i)), noWait)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan error)
+	go func() { closed <- w.Close() }()
+	time.Sleep(50 * time.Millisecond) // Make sure Close() is called first.
+
+	have := make(map[string]bool)
+	for e := range w.Events {
+		have[e.Name] = true
+	}
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if name := filepath.Join(tmp, fmt.Sprintf("file-%02d", i)); !have[name] {
+			t.Errorf("no event for %s", name)
+		}
+	}
+}
+
+func TestWithDrainOnCloseTimeout(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "windows", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+	default:
+		t.Skip("no backend")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w, err := NewWatcherWith(WithDrainOnClose(100 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addWatch(t, w, tmp)
+	touch(t, tmp, "file", noWait)
+	time.Sleep(50 * time.Millisecond)
+
+	// Events are never read; Close() gives up after the timeout.
+	closed := make(chan error)
+	go func() { closed <- w.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close() didn't return after the timeout")
+	}
+}
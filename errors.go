@@ -0,0 +1,147 @@
+package fsnotify
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// ErrorKind is the category of an error sent on the Errors channel, to decide
+// how to handle it.
+type ErrorKind uint8
+
+// The kinds of errors.
+const (
+	// Any other error, such as a failed read. Usually there's nothing to do
+	// except aborting or re-creating the watcher.
+	KindIO ErrorKind = iota
+
+	// Not allowed to read a file or directory; it can be re-added once the
+	// permissions are fixed.
+	KindPermissionDenied
+
+	// The path no longer exists; it can be re-added once it exists again.
+	KindNotFound
+
+	// Events were lost because the queue overflowed (ErrEventOverflow); the
+	// watched paths should be re-scanned.
+	KindOverflow
+
+	// The system removed a watch, for example because the filesystem was
+	// unmounted (ErrWatchLost); the path can be re-added.
+	KindWatchLost
+
+	// The operation is not supported on this platform or filesystem.
+	KindUnsupported
+
+	// A system limit was reached (ErrWatchLimit), or the quota of a watch group
+	// (ErrQuota); watches need to be removed, or the limit raised.
+	KindLimit
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindPermissionDenied:
+		return "permission denied"
+	case KindNotFound:
+		return "not found"
+	case KindOverflow:
+		return "overflow"
+	case KindWatchLost:
+		return "watch lost"
+	case KindUnsupported:
+		return "unsupported"
+	case KindLimit:
+		return "limit reached"
+	default:
+		return "I/O error"
+	}
+}
+
+// WatchError is the type of all errors sent on the Errors channel of Watcher.
+//
+// The original error can be retrieved with errors.Unwrap(), and errors.Is()
+// works as before: errors.Is(err, ErrEventOverflow) still reports if events
+// were lost. Comparing with == doesn't work, as the error is wrapped.
+type WatchError struct {
+	Kind ErrorKind
+	Path string // Path the error is about; may be empty.
+	Err  error
+}
+
+func (e *WatchError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *WatchError) Unwrap() error { return e.Err }
+
+// newWatchError returns err as a *WatchError. The path is taken from err if
+// it's empty.
+func newWatchError(err error, path string) error {
+	var we *WatchError
+	if errors.As(err, &we) {
+		return err
+	}
+	if path == "" {
+		var (
+			pathErr *fs.PathError
+			linkErr *os.LinkError
+		)
+		switch {
+		case errors.As(err, &pathErr):
+			path = pathErr.Path
+		case errors.As(err, &linkErr):
+			path = linkErr.Old
+		}
+	}
+	return &WatchError{Kind: ErrorKindOf(err), Path: path, Err: err}
+}
+
+// ErrorKindOf returns the kind of err, which doesn't need to be a *WatchError.
+func ErrorKindOf(err error) ErrorKind {
+	var we *WatchError
+	if errors.As(err, &we) {
+		return we.Kind
+	}
+	switch {
+	case errors.Is(err, ErrEventOverflow):
+		return KindOverflow
+	case errors.Is(err, ErrWatchLost):
+		return KindWatchLost
+	case errors.Is(err, fs.ErrPermission):
+		return KindPermissionDenied
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, ErrNonExistentWatch):
+		return KindNotFound
+	case errors.Is(err, ErrNotWatchable), errors.Is(err, ErrMountsNotSupported),
+		errors.Is(err, ErrUnsupportedFileType), errors.Is(err, ErrSynchronousNotSupported),
+		errors.Is(err, ErrBackendNotAvailable), errors.Is(err, ErrFUSE):
+		return KindUnsupported
+	case errors.Is(err, ErrWatchLimit), errors.Is(err, ErrQuota):
+		return KindLimit
+	}
+	for _, u := range unsupportedErrors {
+		if errors.Is(err, u) {
+			return KindUnsupported
+		}
+	}
+	return KindIO
+}
+
+// limitError is returned when a system limit is reached; errors.Is() matches
+// both ErrWatchLimit and the original error.
+type limitError struct {
+	limit string // Name of the limit, as in Limit.Name.
+	err   error
+}
+
+func (e *limitError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", ErrWatchLimit, e.limit, e.err)
+}
+
+func (e *limitError) Unwrap() error { return e.err }
+
+func (e *limitError) Is(target error) bool { return target == ErrWatchLimit }
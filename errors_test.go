@@ -0,0 +1,56 @@
+package fsnotify
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestErrorKindOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorKind
+	}{
+		{errors.New("x"), KindIO},
+		{ErrEventOverflow, KindOverflow},
+		{fmt.Errorf("wrapped: %w", ErrEventOverflow), KindOverflow},
+		{ErrWatchLost, KindWatchLost},
+		{&fs.PathError{Op: "open", Path: "/x", Err: fs.ErrPermission}, KindPermissionDenied},
+		{&fs.PathError{Op: "open", Path: "/x", Err: fs.ErrNotExist}, KindNotFound},
+		{ErrNonExistentWatch, KindNotFound},
+		{ErrNotWatchable, KindUnsupported},
+		{fmt.Errorf("%w: socket", ErrUnsupportedFileType), KindUnsupported},
+		{syscall.ENOSYS, KindUnsupported},
+		{&limitError{limit: "max", err: errors.New("no space")}, KindLimit},
+		{&WatchError{Kind: KindNotFound, Err: errors.New("x")}, KindNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if have := ErrorKindOf(tt.err); have != tt.want {
+				t.Errorf("have %s; want %s", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWatchError(t *testing.T) {
+	_, err := os.Stat("/non-existent")
+	err = newWatchError(err, "")
+
+	var we *WatchError
+	if !errors.As(err, &we) {
+		t.Fatalf("not a *WatchError: %T", err)
+	}
+	if we.Kind != KindNotFound || we.Path != "/non-existent" {
+		t.Errorf("wrong kind or path: %s %q", we.Kind, we.Path)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("errors.Is(err, fs.ErrNotExist) is false")
+	}
+	if newWatchError(err, "") != err {
+		t.Error("wrapped twice")
+	}
+}
@@ -0,0 +1,48 @@
+package fsnotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandPath expands a leading "~" in path to the home directory of the
+// current user, and $VAR or ${VAR} to the value of the environment variable
+// VAR, as a shell would. It's an error if the home directory isn't known or a
+// variable isn't set, rather than silently watching the wrong path.
+//
+// "~user" is not expanded.
+func ExpandPath(path string) (string, error) {
+	expanded := path
+	if expanded == "~" || strings.HasPrefix(expanded, "~/") ||
+		strings.HasPrefix(expanded, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("fsnotify: expanding %q: %w", path, err)
+		}
+		expanded = home + expanded[1:]
+	}
+
+	var unset string
+	expanded = os.Expand(expanded, func(name string) string {
+		v, ok := os.LookupEnv(name)
+		if !ok && unset == "" {
+			unset = name
+		}
+		return v
+	})
+	if unset != "" {
+		return "", fmt.Errorf("fsnotify: expanding %q: environment variable %s is not set", path, unset)
+	}
+	return expanded, nil
+}
+
+// expandPath expands name for WithExpand(), and records the original path.
+func (o *withOpts) expandPath(name string) (string, error) {
+	if !o.expand {
+		return name, nil
+	}
+	o.unexpanded, _ = recursivePath(name)
+	return ExpandPath(name)
+}
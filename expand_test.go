@@ -0,0 +1,78 @@
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	os.Setenv("FSNOTIFY_TEST_EXPAND", "value")
+	defer os.Unsetenv("FSNOTIFY_TEST_EXPAND")
+
+	tests := []struct {
+		in, want, wantErr string
+	}{
+		{"", "", ""},
+		{"/a/b", "/a/b", ""},
+		{"~", home, ""},
+		{"~/a", home + "/a", ""},
+		{"~user/a", "~user/a", ""},
+		{"a/~", "a/~", ""},
+		{"/a/$FSNOTIFY_TEST_EXPAND/b", "/a/value/b", ""},
+		{"/a/${FSNOTIFY_TEST_EXPAND}b", "/a/valueb", ""},
+		{"~/$FSNOTIFY_TEST_EXPAND", home + "/value", ""},
+		{"/a/$FSNOTIFY_TEST_UNSET", "", "FSNOTIFY_TEST_UNSET is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			have, err := ExpandPath(tt.in)
+			if (err == nil) != (tt.wantErr == "") || err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithExpand(t *testing.T) {
+	tmp := t.TempDir()
+	mkdir(t, tmp, "dir")
+	os.Setenv("FSNOTIFY_TEST_DIR", tmp)
+	defer os.Unsetenv("FSNOTIFY_TEST_DIR")
+
+	w := newWatcher(t)
+	defer w.Close()
+	if err := w.AddWith(filepath.Join("$FSNOTIFY_TEST_DIR", "dir", "..."), WithExpand()); err != nil {
+		t.Fatal(err)
+	}
+	want := []WatchSpec{{
+		Path:       filepath.Join(tmp, "dir"),
+		Recursive:  true,
+		Unexpanded: filepath.Join("$FSNOTIFY_TEST_DIR", "dir"),
+	}}
+	if have := w.Export(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	w2 := newWatcher(t)
+	defer w2.Close()
+	if err := w2.Import(want); err != nil {
+		t.Fatal(err)
+	}
+	if have := w2.Export(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	if err := w.AddWith("$FSNOTIFY_TEST_UNSET", WithExpand()); err == nil {
+		t.Error("no error for unset variable")
+	}
+}
@@ -0,0 +1,391 @@
+package fsnotify
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// WatchSpec is a serializable description of a watch, as returned by
+// Watcher.Export().
+//
+// This can be stored (e.g. as JSON) and passed to Watcher.Import() to add the
+// same watches to a new watcher; for example after the configuration was
+// reloaded, or the watcher had to be re-created after a fatal error.
+type WatchSpec struct {
+	// Path to watch.
+	Path string `json:"path"`
+
+	// Watch Path recursively; this is the same as adding "Path/...".
+	Recursive bool `json:"recursive,omitempty"`
+
+	// The op for WithInitialScan(), or 0 to not scan.
+	InitialScan Op `json:"initialScan,omitempty"`
+
+	// The time for WithCatchUp(), or the zero time to not catch up.
+	CatchUp time.Time `json:"catchUp"`
+
+	// The maximum size for WithContentHash(), or 0 to not hash files.
+	ContentHash int64 `json:"contentHash,omitempty"`
+
+	// The rules for WithIgnore().
+	Ignore []string `json:"ignore,omitempty"`
+
+	// The patterns for WithInclude() and WithExclude().
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	// The regular expressions for WithIncludeRegexp() and WithExcludeRegexp().
+	IncludeRegexp []string `json:"includeRegexp,omitempty"`
+	ExcludeRegexp []string `json:"excludeRegexp,omitempty"`
+
+	// The depth for WithMaxDepth(), or 0 for no limit.
+	MaxDepth int `json:"maxDepth,omitempty"`
+
+	// Set WithSkipHidden().
+	SkipHidden bool `json:"skipHidden,omitempty"`
+
+	// Set WithoutChmod().
+	NoChmod bool `json:"noChmod,omitempty"`
+
+	// The window for WithDedup(), or 0 to not drop duplicates.
+	Dedup time.Duration `json:"dedup,omitempty"`
+
+	// Set WithoutParentDuplicates().
+	NoParentDuplicates bool `json:"noParentDuplicates,omitempty"`
+
+	// Set WithFileID().
+	FileID bool `json:"fileID,omitempty"`
+
+	// Set WithMounts().
+	Mounts bool `json:"mounts,omitempty"`
+
+	// Set WithoutFollow().
+	NoFollow bool `json:"noFollow,omitempty"`
+
+	// Set WithHardlinks().
+	Hardlinks bool `json:"hardlinks,omitempty"`
+
+	// Set WithCaseInsensitive().
+	CaseInsensitive bool `json:"caseInsensitive,omitempty"`
+
+	// Set WithNFC().
+	NFC bool `json:"nfc,omitempty"`
+
+	// Set WithSpecialFiles().
+	SpecialFiles bool `json:"specialFiles,omitempty"`
+
+	// Set WithTruncate().
+	Truncate bool `json:"truncate,omitempty"`
+
+	// Set WithSizes().
+	Sizes bool `json:"sizes,omitempty"`
+
+	// Set WithAppendOnly(); AppendWindow is the window.
+	AppendOnly   bool          `json:"appendOnly,omitempty"`
+	AppendWindow time.Duration `json:"appendWindow,omitempty"`
+
+	// Set WithOverlayUpper().
+	OverlayUpper bool `json:"overlayUpper,omitempty"`
+
+	// The operations for WithOps(), or 0 to send all events.
+	Ops Op `json:"ops,omitempty"`
+
+	// The wait for WithDebounce(), or 0 to not merge events.
+	Debounce time.Duration `json:"debounce,omitempty"`
+
+	// The quiet period for WithSettle(), or 0 to not send Settled events.
+	Settle time.Duration `json:"settle,omitempty"`
+
+	// Set WithCloseWrite().
+	CloseWrite bool `json:"closeWrite,omitempty"`
+
+	// The interval for WithCompleteCreate(), or 0 to send Create events
+	// right away.
+	CompleteCreate time.Duration `json:"completeCreate,omitempty"`
+
+	// The wait for WithReplace(), or 0 to not detect replaced directories;
+	// ReplaceDiff sets WithReplaceDiff().
+	Replace     time.Duration `json:"replace,omitempty"`
+	ReplaceDiff bool          `json:"replaceDiff,omitempty"`
+
+	// Set WithPriority().
+	Priority bool `json:"priority,omitempty"`
+
+	// The watch group, set with WithGroup() or Watcher.Group().
+	Group string `json:"group,omitempty"`
+
+	// Set WithRelativeNames().
+	RelativeNames bool `json:"relativeNames,omitempty"`
+
+	// Set WithoutFUSE().
+	NoFUSE bool `json:"noFUSE,omitempty"`
+
+	// Path as it was passed to AddWith() with WithExpand(), before it was
+	// expanded to Path. Import() expands it again.
+	Unexpanded string `json:"unexpanded,omitempty"`
+}
+
+func newWatchSpec(path string, with withOpts) WatchSpec {
+	return WatchSpec{
+		Path:        path,
+		Recursive:   with.recurse,
+		InitialScan: with.initialScan,
+		CatchUp:     with.catchUp,
+		ContentHash: with.hashSize,
+		Ignore:      with.ignore.lines(),
+		Include:     with.include.lines(),
+		Exclude:     with.exclude.lines(),
+
+		IncludeRegexp: regexpStrings(with.includeRe),
+		ExcludeRegexp: regexpStrings(with.excludeRe),
+		MaxDepth:      with.maxDepth,
+		SkipHidden:    with.skipHidden,
+		NoChmod:       with.noChmod,
+		Dedup:         with.dedup,
+
+		NoParentDuplicates: with.noParentDups,
+		FileID:             with.fileID,
+		Mounts:             with.mounts,
+		NoFollow:           with.noFollow,
+		Hardlinks:          with.hardlinks,
+		CaseInsensitive:    with.caseInsensitive,
+		NFC:                with.nfc,
+		SpecialFiles:       with.specialFiles,
+		Truncate:           with.truncate,
+		Sizes:              with.sizes,
+		AppendOnly:         with.appendOnly,
+		AppendWindow:       with.appendWindow,
+		OverlayUpper:       with.overlayUpper,
+		Ops:                with.ops,
+		Debounce:           with.debounce,
+		Settle:             with.settle,
+		CloseWrite:         with.closeWrite,
+		CompleteCreate:     with.completeCreate,
+		Replace:            with.replace,
+		ReplaceDiff:        with.replaceDiff,
+		Priority:           with.priority,
+		Group:              with.group,
+		RelativeNames:      with.relativeNames,
+		NoFUSE:             with.noFUSE,
+		Unexpanded:         with.unexpanded,
+	}
+}
+
+// NewWatchSpec returns the WatchSpec for adding name with the options opts. A
+// name ending in "/..." sets Recursive.
+func NewWatchSpec(name string, opts ...AddOption) WatchSpec {
+	with := getOptions(opts...)
+	name, with.recurse = recursivePath(name)
+	return newWatchSpec(name, with)
+}
+
+// options returns the path and options to use with AddWith().
+func (s WatchSpec) options() (string, []addOpt, error) {
+	path := s.Path
+	var opts []addOpt
+	if s.Unexpanded != "" {
+		path = s.Unexpanded
+		opts = append(opts, WithExpand())
+	}
+	if s.Recursive {
+		path = filepath.Join(path, "...")
+	}
+
+	if s.InitialScan != 0 {
+		opts = append(opts, WithInitialScan(s.InitialScan))
+	}
+	if !s.CatchUp.IsZero() {
+		opts = append(opts, WithCatchUp(s.CatchUp))
+	}
+	if s.ContentHash > 0 {
+		opts = append(opts, WithContentHash(s.ContentHash))
+	}
+	if len(s.Ignore) > 0 {
+		opts = append(opts, WithIgnore(s.Ignore...))
+	}
+	if len(s.Include) > 0 {
+		opts = append(opts, WithInclude(s.Include...))
+	}
+	if len(s.Exclude) > 0 {
+		opts = append(opts, WithExclude(s.Exclude...))
+	}
+	if s.MaxDepth > 0 {
+		opts = append(opts, WithMaxDepth(s.MaxDepth))
+	}
+	if s.SkipHidden {
+		opts = append(opts, WithSkipHidden())
+	}
+	if s.NoChmod {
+		opts = append(opts, WithoutChmod())
+	}
+	if s.Dedup > 0 {
+		opts = append(opts, WithDedup(s.Dedup))
+	}
+	if s.NoParentDuplicates {
+		opts = append(opts, WithoutParentDuplicates())
+	}
+	if s.FileID {
+		opts = append(opts, WithFileID())
+	}
+	if s.Mounts {
+		opts = append(opts, WithMounts())
+	}
+	if s.NoFollow {
+		opts = append(opts, WithoutFollow())
+	}
+	if s.Hardlinks {
+		opts = append(opts, WithHardlinks())
+	}
+	if s.CaseInsensitive {
+		opts = append(opts, WithCaseInsensitive())
+	}
+	if s.NFC {
+		opts = append(opts, WithNFC())
+	}
+	if s.SpecialFiles {
+		opts = append(opts, WithSpecialFiles())
+	}
+	if s.Truncate {
+		opts = append(opts, WithTruncate())
+	}
+	if s.Sizes {
+		opts = append(opts, WithSizes())
+	}
+	if s.AppendOnly {
+		opts = append(opts, WithAppendOnly(s.AppendWindow))
+	}
+	if s.OverlayUpper {
+		opts = append(opts, WithOverlayUpper())
+	}
+	if s.Ops != 0 {
+		opts = append(opts, WithOps(s.Ops))
+	}
+	if s.Debounce > 0 {
+		opts = append(opts, WithDebounce(s.Debounce))
+	}
+	if s.Settle > 0 {
+		opts = append(opts, WithSettle(s.Settle))
+	}
+	if s.CloseWrite {
+		opts = append(opts, WithCloseWrite())
+	}
+	if s.CompleteCreate > 0 {
+		opts = append(opts, WithCompleteCreate(s.CompleteCreate))
+	}
+	if s.Replace > 0 {
+		opts = append(opts, WithReplace(s.Replace))
+	}
+	if s.ReplaceDiff {
+		opts = append(opts, WithReplaceDiff())
+	}
+	if s.Priority {
+		opts = append(opts, WithPriority())
+	}
+	if s.Group != "" {
+		opts = append(opts, WithGroup(s.Group))
+	}
+	if s.RelativeNames {
+		opts = append(opts, WithRelativeNames())
+	}
+	if s.NoFUSE {
+		opts = append(opts, WithoutFUSE())
+	}
+	if len(s.IncludeRegexp) > 0 {
+		res, err := compileRegexps(s.IncludeRegexp)
+		if err != nil {
+			return "", nil, err
+		}
+		opts = append(opts, WithIncludeRegexp(res...))
+	}
+	if len(s.ExcludeRegexp) > 0 {
+		res, err := compileRegexps(s.ExcludeRegexp)
+		if err != nil {
+			return "", nil, err
+		}
+		opts = append(opts, WithExcludeRegexp(res...))
+	}
+	return path, opts, nil
+}
+
+func sortWatchSpecs(specs []WatchSpec) {
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Path < specs[j].Path })
+}
+
+// Import adds all watches in specs, as returned by Export().
+//
+// It stops at the first watch that can't be added, and returns the error for
+// it; watches that were added before that are not removed.
+func (w *Watcher) Import(specs []WatchSpec) error {
+	for _, s := range specs {
+		path, opts, err := s.options()
+		if err == nil {
+			err = w.AddWith(path, opts...)
+		}
+		if err != nil {
+			return fmt.Errorf("%q: %w", s.Path, err)
+		}
+	}
+	return nil
+}
+
+// withCopy sets all options to with, for Clone() and Adopt().
+func withCopy(with withOpts) addOpt {
+	return func(opt *withOpts) { *opt = with }
+}
+
+// cloneWatcher creates a new watcher with the options opts, and adds all
+// watches, for Watcher.Clone().
+func cloneWatcher(opts []watcherOpt, watches map[string]withOpts) (*Watcher, error) {
+	w, err := NewWatcherWith(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.addWatches(watches); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Adopt adds all watches that were added to other with Add() or AddWith() to
+// w, with the same options, and then closes other. This can be used to move
+// the watches to a watcher with different options or another backend, without
+// keeping track of them.
+//
+// It stops at the first watch that can't be added, and returns the error for
+// it; other isn't closed in that case, and watches that were added to w before
+// that are not removed.
+func (w *Watcher) Adopt(other *Watcher) error {
+	if other == w {
+		return nil
+	}
+	if err := w.addWatches(other.watchOpts()); err != nil {
+		return err
+	}
+	return other.Close()
+}
+
+// addWatches adds all watches with their options, sorted by path.
+func (w *Watcher) addWatches(watches map[string]withOpts) error {
+	names := make([]string, 0, len(watches))
+	for name := range watches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		with := watches[name]
+		path := name
+		if with.unexpanded != "" {
+			path = with.unexpanded
+		}
+		if with.recurse {
+			path = filepath.Join(path, "...")
+		}
+		if err := w.AddWith(path, withCopy(with)); err != nil {
+			return fmt.Errorf("%q: %w", name, err)
+		}
+	}
+	return nil
+}
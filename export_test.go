@@ -0,0 +1,116 @@
+package fsnotify
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "dir")
+	touch(t, tmp, "file")
+
+	w := newWatcher(t)
+	defer w.Close()
+	addWatch(t, w, tmp, "dir", "...")
+	if err := w.AddWith(filepath.Join(tmp, "file"), WithInitialScan(Create|Write)); err != nil {
+		t.Fatal(err)
+	}
+	addWatch(t, w, tmp)
+	if err := w.Remove(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []WatchSpec{
+		{Path: filepath.Join(tmp, "dir"), Recursive: true},
+		{Path: filepath.Join(tmp, "file"), InitialScan: Create | Write},
+	}
+	have := w.Export()
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	j, err := json.Marshal(have)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var specs []WatchSpec
+	if err := json.Unmarshal(j, &specs); err != nil {
+		t.Fatal(err)
+	}
+
+	w2 := newWatcher(t)
+	defer w2.Close()
+	if err := w2.Import(specs); err != nil {
+		t.Fatal(err)
+	}
+	if have := w2.Export(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestClone(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "dir")
+	touch(t, tmp, "file")
+
+	w, err := NewWatcherWith(WithNames(NamesClean))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	addWatch(t, w, tmp, "dir", "...")
+	if err := w.AddWith(filepath.Join(tmp, "file"), WithOps(Write), WithMaxDepth(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := w.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if have, want := c.Export(), w.Export(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "dir")
+	touch(t, tmp, "file")
+
+	other := newWatcher(t)
+	addWatch(t, other, tmp, "dir", "...")
+	if err := other.AddWith(filepath.Join(tmp, "file"), WithMaxDepth(2)); err != nil {
+		t.Fatal(err)
+	}
+	want := other.Export()
+
+	w := newWatcher(t)
+	defer w.Close()
+	if err := w.Adopt(other); err != nil {
+		t.Fatal(err)
+	}
+	if have := w.Export(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("\nhave: %#v\nwant: %#v", have, want)
+	}
+	if !other.IsClosed() {
+		t.Fatal("other not closed")
+	}
+}
+
+func TestNewWatchSpec(t *testing.T) {
+	have := NewWatchSpec(filepath.Join("dir", "..."), WithMaxDepth(2), WithSkipHidden())
+	want := WatchSpec{Path: "dir", Recursive: true, MaxDepth: 2, SkipHidden: true}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	}
+}
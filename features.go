@@ -0,0 +1,84 @@
+package fsnotify
+
+import (
+	"fmt"
+	"os"
+)
+
+// Feature is something that only some platforms support; see
+// Watcher.Supports().
+type Feature uint8
+
+const (
+	// Recursive watches, with a path ending in "/...".
+	FeatureRecursive Feature = iota + 1
+
+	// CloseWrite events, with WithCloseWrite().
+	FeatureCloseWrite
+
+	// Watches for filesystems mounted inside a watch, with WithMounts(), and
+	// NewMountWatcher().
+	FeatureMounts
+
+	// Watching a file descriptor with AddFd() and AddAt(), rather than the
+	// path.
+	FeatureAddFd
+
+	// Watching a symbolic link itself, with WithoutFollow().
+	FeatureNoFollow
+
+	// Reading events with Next(), with WithSynchronous().
+	FeatureSynchronous
+)
+
+func (f Feature) String() string {
+	switch f {
+	case FeatureRecursive:
+		return "recursive"
+	case FeatureCloseWrite:
+		return "CloseWrite"
+	case FeatureMounts:
+		return "mounts"
+	case FeatureAddFd:
+		return "AddFd"
+	case FeatureNoFollow:
+		return "WithoutFollow"
+	case FeatureSynchronous:
+		return "synchronous"
+	}
+	return fmt.Sprintf("Feature(%d)", f)
+}
+
+// Backends returns the names of the backends that are available on this
+// platform, as returned by Watcher.BackendName(). It's empty if fsnotify isn't
+// supported on this platform.
+func Backends() []string {
+	if backendName == "" {
+		return nil
+	}
+	return []string{backendName}
+}
+
+// NewWatcherWithBackend is like NewWatcherWith, but uses the backend name
+// rather than the default for the platform. It returns ErrBackendNotAvailable
+// if the backend isn't in Backends().
+//
+// If name is empty, the FSNOTIFY_BACKEND environment variable is used; this is
+// also checked by NewWatcher() and NewWatcherWith(), so that the backend can be
+// forced without changing the program.
+func NewWatcherWithBackend(name string, opts ...WatcherOption) (*Watcher, error) {
+	opts = append(opts[:len(opts):len(opts)], func(opt *watcherOpts) { opt.backend = name })
+	return NewWatcherWith(opts...)
+}
+
+// checkBackend returns an error if the backend name, or the one in the
+// FSNOTIFY_BACKEND environment variable if name is empty, isn't available.
+func checkBackend(name string) error {
+	if name == "" {
+		name = os.Getenv("FSNOTIFY_BACKEND")
+	}
+	if name == "" || name == backendName && backendName != "" {
+		return nil
+	}
+	return fmt.Errorf("%w: %q; available: %q", ErrBackendNotAvailable, name, Backends())
+}
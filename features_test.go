@@ -0,0 +1,101 @@
+package fsnotify
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestSupports(t *testing.T) {
+	var want []Feature
+	switch runtime.GOOS {
+	case "linux":
+		want = []Feature{FeatureRecursive, FeatureCloseWrite, FeatureMounts, FeatureAddFd, FeatureNoFollow, FeatureSynchronous}
+	case "darwin":
+		want = []Feature{FeatureRecursive, FeatureAddFd, FeatureNoFollow, FeatureSynchronous}
+	case "freebsd", "openbsd", "netbsd", "dragonfly":
+		want = []Feature{FeatureRecursive, FeatureAddFd, FeatureSynchronous}
+	case "windows":
+		want = []Feature{FeatureRecursive}
+	default:
+		t.Skip("no backend")
+	}
+
+	w := newWatcher(t)
+	defer w.Close()
+	have := make(map[Feature]bool)
+	for f := FeatureRecursive; f <= FeatureSynchronous; f++ {
+		have[f] = w.Supports(f)
+	}
+	for _, f := range want {
+		if !have[f] {
+			t.Errorf("%s not supported", f)
+		}
+		delete(have, f)
+	}
+	for f, ok := range have {
+		if ok {
+			t.Errorf("%s supported", f)
+		}
+	}
+	if w.Supports(Feature(0)) {
+		t.Error("Feature(0) supported")
+	}
+}
+
+func TestBackendName(t *testing.T) {
+	var want string
+	switch runtime.GOOS {
+	case "linux":
+		want = "inotify"
+	case "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+		want = "kqueue"
+	case "windows":
+		want = "windows"
+	default:
+		if b := Backends(); len(b) != 0 {
+			t.Errorf("Backends() = %q; want none", b)
+		}
+		t.Skip("no backend")
+	}
+
+	w := newWatcher(t)
+	defer w.Close()
+	if have := w.BackendName(); have != want {
+		t.Errorf("BackendName() = %q; want %q", have, want)
+	}
+	if have := Backends(); len(have) != 1 || have[0] != want {
+		t.Errorf("Backends() = %q; want [%q]", have, want)
+	}
+}
+
+func TestNewWatcherWithBackend(t *testing.T) {
+	b := Backends()
+	if len(b) == 0 {
+		t.Skip("no backend")
+	}
+
+	w, err := NewWatcherWithBackend(b[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	_, err = NewWatcherWithBackend("no-such-backend")
+	if !errors.Is(err, ErrBackendNotAvailable) {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	os.Setenv("FSNOTIFY_BACKEND", "no-such-backend")
+	defer os.Unsetenv("FSNOTIFY_BACKEND")
+	_, err = NewWatcher()
+	if !errors.Is(err, ErrBackendNotAvailable) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	w, err = NewWatcherWithBackend(b[0]) // Explicit name overrides the environment.
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+}
@@ -0,0 +1,196 @@
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// setRoot sets the path of the watch, and enables case-insensitive matching if
+// WithCaseInsensitive() is used and the filesystem is case-insensitive.
+func (o *withOpts) setRoot(root string, recurse bool) {
+	o.root, o.recurse = root, recurse
+	o.foldCase = o.caseInsensitive && isCaseInsensitive(root)
+	if o.foldCase {
+		o.ignore, o.include, o.exclude = o.ignore.lower(), o.include.lower(), o.exclude.lower()
+	}
+}
+
+// fold returns the path elements in lower case for case-insensitive matching.
+func (o withOpts) fold(parts []string) []string {
+	if !o.foldCase {
+		return parts
+	}
+	lower := make([]string, len(parts))
+	for i, p := range parts {
+		lower[i] = strings.ToLower(p)
+	}
+	return lower
+}
+
+// isCaseInsensitive reports if the filesystem that path is on is
+// case-insensitive, by looking up the path with the case of the letters in its
+// last element swapped (or the closest parent with letters). It returns the
+// platform's default if that can't be determined.
+func isCaseInsensitive(path string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return defaultCaseInsensitive()
+	}
+	for p := path; filepath.Dir(p) != p; p = filepath.Dir(p) {
+		base := filepath.Base(p)
+		swapped := strings.Map(func(r rune) rune {
+			if unicode.IsUpper(r) {
+				return unicode.ToLower(r)
+			}
+			return unicode.ToUpper(r)
+		}, base)
+		if swapped == base {
+			continue
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			break
+		}
+		fi2, err := os.Stat(filepath.Join(filepath.Dir(p), swapped))
+		return err == nil && os.SameFile(fi, fi2)
+	}
+	return defaultCaseInsensitive()
+}
+
+func defaultCaseInsensitive() bool {
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
+
+// filtering reports if the options exclude any paths from the watch.
+func (o withOpts) filtering() bool {
+	return len(o.ignore) > 0 || len(o.include) > 0 || len(o.exclude) > 0 ||
+		len(o.includeRe) > 0 || len(o.excludeRe) > 0 || o.maxDepth > 0 ||
+		o.skipHidden
+}
+
+// relParts returns path relative to the root of the watch, with "/" as the
+// separator, and split on "/". It returns false if path is the root or not
+// below it.
+func (o withOpts) relParts(path string) (string, []string, bool) {
+	if o.foldCase && len(path) >= len(o.root) && strings.EqualFold(path[:len(o.root)], o.root) {
+		path = o.root + path[len(o.root):]
+	}
+	rel, err := filepath.Rel(o.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", nil, false
+	}
+	rel = filepath.ToSlash(rel)
+	return rel, strings.Split(rel, "/"), true
+}
+
+// tooDeep reports if the directory dir is deeper than WithMaxDepth() allows;
+// events are sent for the directory itself, but it's not watched or scanned.
+func (o withOpts) tooDeep(dir string) bool {
+	if o.maxDepth <= 0 {
+		return false
+	}
+	_, parts, ok := o.relParts(dir)
+	return ok && len(parts) > o.maxDepth
+}
+
+// skip reports if path is excluded from the watch; excluded directories aren't
+// watched or scanned, and no events are sent for anything in them.
+func (o withOpts) skip(path string, isDir bool) bool {
+	if !o.filtering() {
+		return false
+	}
+	rel, parts, ok := o.relParts(path)
+	if !ok {
+		return false
+	}
+	if o.maxDepth > 0 && len(parts) > o.maxDepth+1 {
+		return true
+	}
+	if o.skipHidden {
+		p := o.root
+		for _, part := range parts {
+			p = filepath.Join(p, part)
+			if isHidden(p) {
+				return true
+			}
+		}
+	}
+
+	for i := 1; i < len(parts); i++ {
+		if o.excluded(parts[:i], true) {
+			return true
+		}
+	}
+	if o.excluded(parts, isDir) {
+		return true
+	}
+
+	// Directories are always included, as there may be files in them that
+	// match.
+	if isDir {
+		return false
+	}
+	if len(o.include) > 0 && !o.include.match(o.fold(parts), false) {
+		return true
+	}
+	return len(o.includeRe) > 0 && !matchAnyRegexp(o.includeRe, rel)
+}
+
+// excluded reports if the path, split on "/", is excluded by WithIgnore(),
+// WithExclude(), or WithExcludeRegexp().
+func (o withOpts) excluded(parts []string, isDir bool) bool {
+	globParts := o.fold(parts)
+	return o.ignore.match(globParts, isDir) || o.exclude.match(globParts, isDir) ||
+		matchAnyRegexp(o.excludeRe, strings.Join(parts, "/"))
+}
+
+func matchAnyRegexp(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func regexpStrings(res []*regexp.Regexp) []string {
+	if len(res) == 0 {
+		return nil
+	}
+	s := make([]string, 0, len(res))
+	for _, re := range res {
+		s = append(s, re.String())
+	}
+	return s
+}
+
+func compileRegexps(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, e := range exprs {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// skipEvent reports if the event e is excluded from the watch.
+//
+// The path no longer exists for Remove and Rename events, so we can't know if
+// it was a directory; it's skipped if it would be excluded as either.
+func (o withOpts) skipEvent(e Event) bool {
+	if !o.filtering() {
+		return false
+	}
+	fi, err := os.Lstat(e.Name)
+	if err != nil {
+		return o.skip(e.Name, false) || o.skip(e.Name, true)
+	}
+	return o.skip(e.Name, fi.IsDir())
+}
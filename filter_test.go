@@ -0,0 +1,51 @@
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithCaseInsensitive(t *testing.T) {
+	t.Run("detect", func(t *testing.T) {
+		tmp := t.TempDir()
+		mkdir(t, tmp, "CaseTest")
+		_, err := os.Stat(filepath.Join(tmp, "cASEtEST"))
+		want := err == nil
+
+		if have := isCaseInsensitive(filepath.Join(tmp, "CaseTest")); have != want {
+			t.Errorf("isCaseInsensitive = %t; want %t", have, want)
+		}
+	})
+
+	t.Run("match", func(t *testing.T) {
+		root := filepath.FromSlash("/Users/Me/Dir")
+		with := getOptions(WithCaseInsensitive(), WithInclude("*.JPG"), WithIgnore("Build/"))
+		with.root, with.foldCase = root, true
+		with.ignore, with.include = with.ignore.lower(), with.include.lower()
+
+		tests := []struct {
+			path  string
+			isDir bool
+			skip  bool
+		}{
+			{"/users/me/dir/photo.jpg", false, false},
+			{"/Users/Me/Dir/photo.Jpg", false, false},
+			{"/users/me/dir/notes.txt", false, true},
+			{"/users/me/dir/build", true, true},
+			{"/users/me/dir/BUILD/photo.jpg", false, true},
+		}
+		for _, tt := range tests {
+			if have := with.skip(filepath.FromSlash(tt.path), tt.isDir); have != tt.skip {
+				t.Errorf("skip(%q) = %t; want %t", tt.path, have, tt.skip)
+			}
+		}
+
+		// Case-sensitive without foldCase.
+		with = getOptions(WithInclude("*.JPG"))
+		with.root = root
+		if !with.skip(filepath.FromSlash("/Users/Me/Dir/photo.jpg"), false) {
+			t.Error("photo.jpg not skipped without WithCaseInsensitive()")
+		}
+	})
+}
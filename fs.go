@@ -0,0 +1,149 @@
+package fsnotify
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNotWatchable is returned by WatchFS() for a fs.FS that doesn't implement
+// WatchableFS.
+var ErrNotWatchable = errors.New("fsnotify: filesystem can't be watched")
+
+// WatchableFS is a fs.FS that can be watched.
+//
+// Use DirFS() for a directory on disk; test filesystems can implement this to
+// send events without touching the disk.
+type WatchableFS interface {
+	fs.FS
+
+	// Watch returns a new watcher for the filesystem.
+	Watch() (FSWatcher, error)
+}
+
+// FSWatcher watches files in a WatchableFS.
+//
+// All names are slash-separated paths relative to the root of the filesystem,
+// as with fs.FS; the root itself is ".". A name ending with "/..." is watched
+// recursively.
+type FSWatcher interface {
+	// Add starts watching the named file or directory.
+	Add(name string) error
+
+	// Remove stops watching the named file or directory.
+	Remove(name string) error
+
+	// Close removes all watches and closes the Events() and Errors() channels.
+	Close() error
+
+	// Events returns the channel the events are sent on.
+	Events() <-chan Event
+
+	// Errors returns the channel the errors are sent on.
+	Errors() <-chan error
+}
+
+// WatchFS returns a new watcher for fsys, or ErrNotWatchable if fsys doesn't
+// implement WatchableFS.
+func WatchFS(fsys fs.FS) (FSWatcher, error) {
+	wfs, ok := fsys.(WatchableFS)
+	if !ok {
+		return nil, ErrNotWatchable
+	}
+	return wfs.Watch()
+}
+
+// DirFS returns a filesystem for the directory dir, like os.DirFS(), which can
+// also be watched.
+func DirFS(dir string) WatchableFS {
+	return dirFS{FS: os.DirFS(dir), dir: filepath.Clean(dir)}
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (d dirFS) Watch() (FSWatcher, error) {
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	fw := &dirFSWatcher{
+		w:      w,
+		dir:    d.dir,
+		events: make(chan Event),
+		done:   make(chan struct{}),
+	}
+	go fw.translate()
+	return fw, nil
+}
+
+// dirFSWatcher is the FSWatcher for DirFS.
+type dirFSWatcher struct {
+	w      *Watcher
+	dir    string
+	events chan Event
+	once   sync.Once
+	done   chan struct{} // Closed on Close().
+}
+
+func (fw *dirFSWatcher) Events() <-chan Event { return fw.events }
+func (fw *dirFSWatcher) Errors() <-chan error { return fw.w.Errors }
+
+func (fw *dirFSWatcher) Close() error {
+	fw.once.Do(func() { close(fw.done) })
+	return fw.w.Close()
+}
+
+func (fw *dirFSWatcher) Add(name string) error {
+	path, err := fw.path("watch", name)
+	if err != nil {
+		return err
+	}
+	return fw.w.Add(path)
+}
+
+func (fw *dirFSWatcher) Remove(name string) error {
+	path, err := fw.path("unwatch", name)
+	if err != nil {
+		return err
+	}
+	return fw.w.Remove(path)
+}
+
+// path returns the path on disk for the fs name.
+func (fw *dirFSWatcher) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(fw.dir, filepath.FromSlash(name)), nil
+}
+
+// name returns the fs name for the path on disk.
+func (fw *dirFSWatcher) name(path string) string {
+	if path == fw.dir {
+		return "."
+	}
+	prefix := fw.dir
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	return filepath.ToSlash(strings.TrimPrefix(path, prefix))
+}
+
+// translate sends all events of the watcher with fs names, until it's closed.
+func (fw *dirFSWatcher) translate() {
+	defer close(fw.events)
+	for e := range fw.w.Events {
+		e.Name = fw.name(e.Name)
+		select {
+		case fw.events <- e:
+		case <-fw.done:
+			return
+		}
+	}
+}
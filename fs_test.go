@@ -0,0 +1,61 @@
+package fsnotify
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDirFS(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "dir")
+	fsys := DirFS(tmp)
+	if _, err := fs.Stat(fsys, "dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := WatchFS(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("../dir"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("wrong error for invalid path: %v", err)
+	}
+
+	touch(t, tmp, "dir", "file")
+	select {
+	case e := <-w.Events():
+		if e.Name != "dir/file" || !e.Has(Create) {
+			t.Errorf("wrong event: %s", e)
+		}
+	case err := <-w.Errors():
+		t.Fatal(err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-w.Events(); ok {
+		t.Error("Events not closed")
+	}
+}
+
+func TestWatchFSNotWatchable(t *testing.T) {
+	if _, err := WatchFS(fstest.MapFS{}); err != ErrNotWatchable {
+		t.Errorf("wrong error: %v", err)
+	}
+	if _, err := WatchFS(os.DirFS(".")); err != ErrNotWatchable {
+		t.Errorf("wrong error: %v", err)
+	}
+}
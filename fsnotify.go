@@ -1,6 +1,3 @@
-//go:build !plan9
-// +build !plan9
-
 // Package fsnotify provides a cross-platform interface for file system
 // notifications.
 package fsnotify
@@ -8,7 +5,11 @@ package fsnotify
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 )
 
 // Event represents a single file system notification.
@@ -25,6 +26,15 @@ type Event struct {
 	// This is a bitmask as some systems may send multiple operations at once.
 	// Use the Op.Has() or Event.Has() method instead of comparing with ==.
 	Op Op
+
+	// Size of the file after a Write event, and the size before it, for
+	// watches added with WithSizes(); they're 0 otherwise. PrevSize is -1 if
+	// the size before the event isn't known.
+	Size, PrevSize int64
+
+	// Name of the watch group for watches added to a WatchGroup or with
+	// WithGroup(); it's empty otherwise.
+	Group string
 }
 
 // Op describes a set of file operations.
@@ -37,12 +47,59 @@ const (
 	Remove
 	Rename
 	Chmod
+
+	// Truncate is set together with Write if the file became smaller, for
+	// example because it was truncated to be rewritten. This is only set for
+	// watches added with WithTruncate().
+	Truncate
+
+	// Settled is sent for a watch added with WithSettle() once there were no
+	// events for it for a while. The Name is the path of the watch, and no
+	// other operations are set.
+	Settled
+
+	// CloseWrite is sent when a file that was opened for writing is closed.
+	// This is only sent for watches added with WithCloseWrite(), and only on
+	// Linux.
+	CloseWrite
+
+	// Replaced is sent for a watch added with WithReplace() when the watched
+	// directory was replaced by another one, for example by renaming a new
+	// directory over it. The Name is the path of the watch, and no other
+	// operations are set.
+	Replaced
 )
 
 // Common errors that can be reported by a watcher
 var (
 	ErrNonExistentWatch = errors.New("can't remove non-existent watcher")
 	ErrEventOverflow    = errors.New("fsnotify queue overflow")
+	ErrWatchLost        = errors.New("fsnotify: watch removed by the system")
+
+	// ErrUnsupportedFileType is returned when adding a watch for a file that
+	// can't be watched, such as a socket on kqueue.
+	ErrUnsupportedFileType = errors.New("fsnotify: can't watch this type of file")
+
+	// ErrWatchLimit is returned when a watch can't be added because a system
+	// limit was reached, such as fs.inotify.max_user_watches on Linux or the
+	// number of open files with kqueue. errors.Is() also matches the original
+	// error (e.g. ENOSPC). See Preflight() for the limits.
+	ErrWatchLimit = errors.New("fsnotify: watch limit reached")
+
+	// ErrQuota is returned when a watch group exceeds its quota; see
+	// WatchGroup.SetQuota() and QuotaError.
+	ErrQuota = errors.New("fsnotify: watch group quota exceeded")
+
+	// ErrClosed is returned by Next() after the watcher is closed.
+	ErrClosed = errors.New("fsnotify: watcher closed")
+
+	// ErrSynchronousNotSupported is returned by NewWatcherWith() for
+	// WithSynchronous() on platforms where it can't be used (Windows).
+	ErrSynchronousNotSupported = errors.New("fsnotify: synchronous mode is not supported on this platform")
+
+	// ErrBackendNotAvailable is returned by NewWatcherWithBackend() for a
+	// backend that isn't available on this platform; see Backends().
+	ErrBackendNotAvailable = errors.New("fsnotify: backend not available")
 )
 
 func (op Op) String() string {
@@ -62,6 +119,18 @@ func (op Op) String() string {
 	if op.Has(Chmod) {
 		b.WriteString("|CHMOD")
 	}
+	if op.Has(Truncate) {
+		b.WriteString("|TRUNCATE")
+	}
+	if op.Has(Settled) {
+		b.WriteString("|SETTLED")
+	}
+	if op.Has(CloseWrite) {
+		b.WriteString("|CLOSE_WRITE")
+	}
+	if op.Has(Replaced) {
+		b.WriteString("|REPLACED")
+	}
 	if b.Len() == 0 {
 		return ""
 	}
@@ -79,3 +148,685 @@ func (e Event) Has(op Op) bool { return e.Op.Has(op) }
 func (e Event) String() string {
 	return fmt.Sprintf("%q: %s", e.Name, e.Op.String())
 }
+
+// errClosed is used internally to stop walking a directory tree once the
+// watcher is closed.
+var errClosed = ErrClosed
+
+// AddFile is like AddWith, but watches the already-open file f, using
+// f.Name() as the name. See AddFd() for details.
+func (w *Watcher) AddFile(f *os.File, opts ...addOpt) error {
+	return w.AddFd(f.Fd(), f.Name(), opts...)
+}
+
+// Check if this path is recursive (ends with "/..." or "\..."), and return the
+// path with the /... stripped.
+func recursivePath(path string) (string, bool) {
+	path = filepath.Clean(path)
+	if filepath.Base(path) == "..." {
+		return filepath.Dir(path), true
+	}
+	return path, false
+}
+
+// lookupOpts finds the options for the watch that name belongs to: either
+// name itself, its parent directory, or a recursive watch above that.
+func lookupOpts(watches map[string]withOpts, name string) withOpts {
+	if with, ok := watches[name]; ok {
+		return with
+	}
+	dir := filepath.Dir(name)
+	if with, ok := watches[dir]; ok {
+		return with
+	}
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return defaultOpts
+		}
+		dir = parent
+		if with, ok := watches[dir]; ok && with.recurse {
+			return with
+		}
+	}
+}
+
+type (
+	addOpt   func(opt *withOpts)
+	withOpts struct {
+		root         string // Path of the watch, rather than an option.
+		recurse      bool   // Set from the "/..." suffix, rather than an option.
+		initialScan  Op
+		catchUp      time.Time
+		hashSize     int64
+		ignore       ignoreRules
+		include      ignoreRules
+		exclude      ignoreRules
+		includeRe    []*regexp.Regexp
+		excludeRe    []*regexp.Regexp
+		maxDepth     int
+		skipHidden   bool
+		noChmod      bool
+		dedup        time.Duration
+		clock        Clock
+		noParentDups bool
+		fileID       bool
+		mounts       bool
+		noFollow     bool
+		hardlinks    bool
+
+		caseInsensitive bool
+		foldCase        bool // Set from caseInsensitive if the filesystem is case-insensitive.
+		nfc             bool
+		specialFiles    bool
+		truncate        bool
+		sizes           bool
+		appendOnly      bool
+		appendWindow    time.Duration
+		overlayUpper    bool
+		ops             Op
+		debounce        time.Duration
+		settle          time.Duration
+		closeWrite      bool
+		completeCreate  time.Duration
+		replace         time.Duration
+		replaceDiff     bool
+		priority        bool
+		group           string
+		expand          bool
+		relativeNames   bool
+		noFUSE          bool
+		unexpanded      string      // Path before WithExpand() expanded it; set by AddWith().
+		mountList       []mountInfo // All mounts for overlayUpper; read by AddWith().
+	}
+)
+
+type (
+	watcherOpt  func(*watcherOpts)
+	watcherOpts struct {
+		onError     func(error)
+		synchronous bool
+		drain       time.Duration
+		names       NamePolicy
+		portable    bool
+		noStat      bool
+		backend     string // Set by NewWatcherWithBackend().
+	}
+)
+
+// WatcherOption is an option for NewWatcherWith(), such as WithErrorHandler().
+type WatcherOption = watcherOpt
+
+func getWatcherOptions(opts ...watcherOpt) watcherOpts {
+	var with watcherOpts
+	for _, o := range opts {
+		o(&with)
+	}
+	return with
+}
+
+// WithErrorHandler calls fn for every error, rather than sending it on the
+// Errors channel. The Errors channel isn't used, but is still closed when the
+// watcher is closed.
+//
+// A watcher blocks until errors on the Errors channel are read, so a program
+// that only reads Events will stop receiving them after the first error; with
+// an error handler this can't happen.
+//
+// fn is called from the goroutine that reads the events, which waits for it
+// to return; it must not call Close().
+func WithErrorHandler(fn func(error)) watcherOpt {
+	return func(opt *watcherOpts) { opt.onError = fn }
+}
+
+// WithSynchronous doesn't start a goroutine to read events; instead they're
+// read from the kernel when calling Watcher.Next(), for programs that run the
+// watcher from their own event loop. The Events and Errors channels aren't
+// used, but are still closed when the watcher is closed.
+//
+// To use an external poller, add Watcher.SysFd() to it and call
+// Watcher.TryRead() once it's readable, which never blocks.
+//
+// Options that hold back events, such as WithDebounce(), and WithInitialScan()
+// still use goroutines; their events are returned by a later call to Next().
+//
+// This is not supported on Windows, where NewWatcherWith() returns
+// ErrSynchronousNotSupported.
+func WithSynchronous() watcherOpt {
+	return func(opt *watcherOpts) { opt.synchronous = true }
+}
+
+// WithDrainOnClose makes Close() send the events and errors that are already
+// queued in the kernel or held in the watcher before it closes the Events and
+// Errors channels, rather than dropping them. Close() blocks until they're all
+// read, or until timeout has passed; after that the rest is dropped.
+//
+// Events that are held back by WithDebounce(), WithSettle(), and similar
+// options are sent once their timer fires, as long as that's before timeout.
+// Events are sent in the same order as they would have been otherwise.
+//
+// This has no effect with WithSynchronous(): Next() returns the events that
+// were already read before it returns ErrClosed.
+func WithDrainOnClose(timeout time.Duration) watcherOpt {
+	return func(opt *watcherOpts) { opt.drain = timeout }
+}
+
+// WithNames sets how paths are reported in Event.Name. The default of
+// NamesAsGiven differs a bit between platforms; use NamesClean, NamesAbsolute,
+// or NamesResolved to get the same paths everywhere.
+//
+// The policy is applied before WithRelativeNames(), which then makes the path
+// relative to the watched path with the same policy applied.
+func WithNames(policy NamePolicy) watcherOpt {
+	return func(opt *watcherOpts) { opt.names = policy }
+}
+
+// WithPortable sends events in the same shape on all platforms, at the cost of
+// delaying every event by up to 50ms:
+//
+//   - Files moved into a watched directory are always sent as Create.
+//   - A Create is sent once, even if the platform reports it more than once.
+//   - Consecutive Write events for a path are merged into one.
+//   - The Remove events for the files in a directory are sent before the
+//     Remove for the directory itself.
+//
+// This only merges and reorders events that arrive within 50ms of each other;
+// it doesn't add events that a platform doesn't report, such as the Remove
+// events for files in a directory that wasn't watched recursively.
+func WithPortable() watcherOpt {
+	return func(opt *watcherOpts) { opt.portable = true }
+}
+
+// WithoutStatChecks trusts the events from the kernel, rather than checking if
+// a directory still exists when it's changed, for more throughput. This can
+// send a Write event for a directory that was already removed, before its
+// Remove event, where this would otherwise be sent as a Remove. It's still
+// checked if a removed directory that's watched again exists before reading
+// it.
+//
+// This only makes a difference with kqueue (macOS, BSD); other platforms don't
+// make these checks.
+func WithoutStatChecks() watcherOpt {
+	return func(opt *watcherOpts) { opt.noStat = true }
+}
+
+// AddOption is an option for Watcher.AddWith(), such as WithInitialScan().
+//
+// This allows other implementations of Notifier to accept the same options;
+// use NewWatchSpec() to get their values.
+type AddOption = addOpt
+
+var defaultOpts = withOpts{}
+
+func getOptions(opts ...addOpt) withOpts {
+	with := defaultOpts
+	for _, o := range opts {
+		o(&with)
+	}
+	return with
+}
+
+// WithInitialScan sends synthetic events for everything that already exists
+// in the watched path, right after the watch is established.
+//
+// For a directory an event is sent for every entry in it (and everything
+// below it for recursive watches); for a file an event is sent for the file
+// itself. The events are sent from a new goroutine, so it's safe to call
+// AddWith() from the goroutine reading the Events channel. New events are held
+// back until the scan is finished.
+//
+// The op defaults to Create; use WithInitialScan(Create|Write) to also set
+// Write for regular files. Because the watch is added before the scan starts
+// nothing will be missed, but a file created at the same time may be reported
+// twice.
+func WithInitialScan(op ...Op) addOpt {
+	return func(opt *withOpts) {
+		opt.initialScan = Create
+		for _, o := range op {
+			opt.initialScan |= o
+		}
+	}
+}
+
+// WithCatchUp sends a synthetic Write event for every file in the watched path
+// that was modified (or had its metadata changed, where the platform records
+// this) after since, right after the watch is established.
+//
+// This is intended for services that restart and need to process what they
+// missed while they weren't running. Like WithInitialScan() the events are
+// sent before any new events. Files removed while the program wasn't running
+// can't be detected.
+func WithCatchUp(since time.Time) addOpt {
+	return func(opt *withOpts) { opt.catchUp = since }
+}
+
+// WithContentHash drops Write events for files of up to maxSize bytes if the
+// content is identical to the previous time it was written; for example when a
+// program rewrites a configuration file without changing it.
+//
+// Files are hashed in the background with a limited number of goroutines, so
+// this doesn't block reading new events. The first Write for a file is always
+// sent, as there is nothing to compare it to. Files larger than maxSize are
+// never hashed, and all their Write events are sent.
+func WithContentHash(maxSize int64) addOpt {
+	return func(opt *withOpts) { opt.hashSize = maxSize }
+}
+
+// WithIgnore excludes paths matching rules in the gitignore format from the
+// watch: excluded directories in a recursive watch aren't watched at all, so
+// they don't use up any watches or file descriptors, and no events are sent
+// for excluded paths.
+//
+// Every rule may contain several lines, so the contents of a .gitignore file
+// can be passed as-is. Patterns are matched relative to the watched path.
+// Unlike git, only the rules passed here are used: .gitignore files in the
+// tree are not read. Pass the same option to every AddWith() call to use the
+// rules for the whole watcher.
+//
+//	w.AddWith("dir/...", fsnotify.WithIgnore("node_modules/", ".git/", "*.tmp"))
+func WithIgnore(rules ...string) addOpt {
+	return func(opt *withOpts) { opt.ignore = append(opt.ignore, parseIgnore(rules...)...) }
+}
+
+// WithInclude only sends events for files matching one of the glob patterns.
+//
+// A pattern without a "/" is matched against the filename, at any depth; a
+// pattern with a "/" is matched against the path relative to the watched
+// path, where "**" matches any number of directories:
+//
+//	w.AddWith("dir/...", fsnotify.WithInclude("*.go", "docs/**/*.md"))
+//
+// Directories are always included, so that a recursive watch can find files
+// in them; use WithExclude() to skip directories. See path.Match() for the
+// pattern syntax; invalid patterns never match.
+func WithInclude(patterns ...string) addOpt {
+	return func(opt *withOpts) { opt.include = append(opt.include, parseGlobs(patterns...)...) }
+}
+
+// WithExclude doesn't send events for paths matching one of the glob patterns;
+// excluded directories of a recursive watch aren't watched at all.
+//
+// The patterns are matched like WithInclude(); excludes take precedence over
+// includes. A pattern that ends with a "/" only matches directories, as in
+// gitignore.
+//
+//	w.AddWith("dir/...", fsnotify.WithExclude("*_test.go", "vendor/"))
+//
+// Note that "vendor/**" matches everything inside vendor, but not vendor
+// itself: the directory is still watched (but nothing in it), and its own
+// Create and Remove events are still sent. Use "vendor/" to exclude the
+// directory entirely.
+func WithExclude(patterns ...string) addOpt {
+	return func(opt *withOpts) { opt.exclude = append(opt.exclude, parseGlobs(patterns...)...) }
+}
+
+// WithIncludeRegexp only sends events for files where one of the regular
+// expressions matches the path, for rules that can't be expressed as a glob
+// pattern with WithInclude().
+//
+// The path is relative to the watched path, and always uses "/" as the
+// separator. Directories are always included; use WithExcludeRegexp() to skip
+// directories.
+//
+//	w.AddWith("logs/...", fsnotify.WithIncludeRegexp(regexp.MustCompile(`-\d{8}\.log$`)))
+func WithIncludeRegexp(res ...*regexp.Regexp) addOpt {
+	return func(opt *withOpts) { opt.includeRe = append(opt.includeRe, res...) }
+}
+
+// WithExcludeRegexp doesn't send events for paths where one of the regular
+// expressions matches the path; excluded directories of a recursive watch
+// aren't watched at all.
+//
+// The regular expressions are matched like WithIncludeRegexp(); excludes take
+// precedence over includes.
+func WithExcludeRegexp(res ...*regexp.Regexp) addOpt {
+	return func(opt *withOpts) { opt.excludeRe = append(opt.excludeRe, res...) }
+}
+
+// WithMaxDepth limits how deep a recursive watch descends: directories up to
+// n levels below the watched path are watched, so events are sent for
+// everything up to n+1 levels deep. For example with WithMaxDepth(1) the
+// watched directory and its subdirectories are watched, and an event is sent
+// when a directory is created in a subdirectory, but not for files inside it.
+//
+// This limits the number of watches or file descriptors used on very deep
+// trees. The default of 0 means there is no limit.
+func WithMaxDepth(n int) addOpt {
+	return func(opt *withOpts) { opt.maxDepth = n }
+}
+
+// WithSkipHidden doesn't send events for hidden files and directories, or
+// anything in a hidden directory; hidden directories of a recursive watch
+// aren't watched at all.
+//
+// On Windows files with the "hidden" attribute are hidden, and on all other
+// platforms files starting with a ".". The watched path itself is never
+// skipped.
+func WithSkipHidden() addOpt {
+	return func(opt *withOpts) { opt.skipHidden = true }
+}
+
+// WithoutChmod doesn't watch for Chmod events: the kernel is asked to not
+// report attribute changes at all, rather than filtering them after they're
+// read. This avoids the large number of Chmod events that indexers and virus
+// scanners can cause.
+//
+// This applies to everything watched by this watch; on Linux the kernel keeps
+// one set of flags for every file, so if a path is already watched without
+// this option Chmod events will still be sent.
+func WithoutChmod() addOpt {
+	return func(opt *withOpts) { opt.noChmod = true }
+}
+
+// WithDedup drops events that are identical (same Name and Op) to the event
+// sent right before it, if that was less than window ago. Some platforms send
+// the same event several times for a single change; for example Windows often
+// sends multiple Write events for a directory. A window of a few milliseconds
+// is usually enough.
+//
+// Watcher.Duplicates() returns the number of events that were dropped.
+func WithDedup(window time.Duration) addOpt {
+	return func(opt *withOpts) { opt.dedup = window }
+}
+
+// WithClock uses the clock c for WithDedup(), WithDebounce(), and
+// WithAppendOnly(), for holding the events of this watch with WithPortable(),
+// and on Windows for checking if a watched directory that was removed is
+// created again, instead of the system clock.
+//
+// This is intended for tests. The clock is not included in Watcher.Export().
+func WithClock(c Clock) addOpt {
+	return func(opt *withOpts) { opt.clock = c }
+}
+
+// WithoutParentDuplicates sends events only once if both a file and the
+// directory it's in are watched; without this option inotify and Windows send
+// most events twice: once for the file's watch, and once for the directory's
+// watch. Both events have the same Name, so it doesn't matter which one is
+// sent.
+//
+// This needs to be set on the watch for the file.
+func WithoutParentDuplicates() addOpt {
+	return func(opt *withOpts) { opt.noParentDups = true }
+}
+
+// WithFileID keeps track of watched directories by their file ID (device and
+// inode number), rather than by path. When a watched directory is moved to
+// another location inside a watched directory, the watch follows it and events
+// for files in it are sent with the new path. Without this option events keep
+// using the path the directory was added as.
+//
+// This is only supported on Linux, and is ignored on other platforms.
+func WithFileID() addOpt {
+	return func(opt *withOpts) { opt.fileID = true }
+}
+
+// WithMounts adds watches for filesystems that are mounted inside a recursive
+// watch. Without this option the watch stays on the directory that was mounted
+// over, and changes in the mounted filesystem aren't seen. When a filesystem is
+// mounted or unmounted, Create events are sent for the files that appeared.
+//
+// This is only supported on Linux, and is ignored on other platforms. See
+// MountWatcher to get the mount events themselves.
+func WithMounts() addOpt {
+	return func(opt *withOpts) { opt.mounts = true }
+}
+
+// WithoutFollow watches a symbolic link itself, rather than the file or
+// directory it points to. Events are sent when the link is changed, for
+// example a Remove event when "ln -sfn" replaces it with a link to a new
+// target; the watch is removed after this, and needs to be added again to
+// watch the new link.
+//
+// This only applies to the watched path itself, not to links inside a watched
+// directory. On Linux this uses IN_DONT_FOLLOW and on macOS O_SYMLINK; other
+// BSD systems return an error for symbolic links. On Windows links are always
+// watched through the directory they're in, so this is ignored.
+func WithoutFollow() addOpt {
+	return func(opt *withOpts) { opt.noFollow = true }
+}
+
+// WithHardlinks sends Write and Chmod events for files in a watched directory
+// that are changed through a hard link outside of the directory. Without this
+// option only changes made through the path in the watched directory are seen.
+// Use LinkCount() to find out if a file has other hard links.
+//
+// On Linux this adds a watch for every file with more than one link. kqueue
+// already watches every file, so this option doesn't change anything there.
+// This is not supported on Windows and ignored.
+func WithHardlinks() addOpt {
+	return func(opt *withOpts) { opt.hardlinks = true }
+}
+
+// WithCaseInsensitive matches paths case-insensitively if the watched path is
+// on a case-insensitive filesystem, as is the default on macOS and Windows. The
+// patterns of WithIgnore(), WithInclude(), and WithExclude() then match any
+// case, and on Windows a watched file is found if it's added with a different
+// case than the name the system reports; events use the name as it was added.
+//
+// This is detected by looking up the watched path with the case of its letters
+// swapped, so a filesystem that's case-sensitive for some directories is
+// handled correctly. Regular expressions aren't affected; use (?i) in them.
+func WithCaseInsensitive() addOpt {
+	return func(opt *withOpts) { opt.caseInsensitive = true }
+}
+
+// WithNFC converts the names in events to Unicode normalization form C (NFC)
+// on macOS. HFS+ stores names in the decomposed form (NFD), so a file created
+// as "café" is reported as "cafe\u0301"; with this option the names compare
+// equal to the paths used in Add() and by most other programs. APFS keeps the
+// name as it was created, and both forms refer to the same file.
+//
+// This is ignored on other platforms, where the two forms are different names.
+func WithNFC() addOpt {
+	return func(opt *withOpts) { opt.nfc = true }
+}
+
+// WithSpecialFiles watches named pipes (FIFOs) and device files.
+//
+// kqueue needs to open a file to watch it, which can have side effects for
+// these files, so they're only watched with this option; without it adding a
+// watch for them returns ErrUnsupportedFileType, and they're skipped in
+// watched directories. Sockets can't be opened, and always return
+// ErrUnsupportedFileType.
+//
+// inotify and Windows always watch these files.
+func WithSpecialFiles() addOpt {
+	return func(opt *withOpts) { opt.specialFiles = true }
+}
+
+// WithTruncate sets Truncate on Write events for files that became smaller
+// than they were, so that programs that follow a file (such as log tailers)
+// know to read it again from the start.
+//
+// The sizes of the files are recorded when the watch is added, and updated on
+// every event. The size is read after the event, so a file that is truncated
+// and then written to again before the event is processed may not be detected.
+// A file that's empty after a Write is always reported as truncated.
+func WithTruncate() addOpt {
+	return func(opt *withOpts) { opt.truncate = true }
+}
+
+// WithSizes sets Size and PrevSize on Write events for regular files, so that
+// programs can use how much a file grew or shrank without calling stat
+// themselves.
+//
+// The sizes are recorded in the same way as with WithTruncate(), with the
+// same limitations: the size is read after the event, so multiple writes in
+// quick succession may all report the final size.
+func WithSizes() addOpt {
+	return func(opt *withOpts) { opt.sizes = true }
+}
+
+// WithAppendOnly sends events in a form that's suited to following files that
+// are only appended to, such as log files.
+//
+// Write events are only sent for regular files that grew, with Size and
+// PrevSize set as with WithSizes(), or that became smaller, with Truncate set
+// as with WithTruncate(). The Write events for a file that grew within window
+// are merged into one event that's sent at the end of the window, with the
+// PrevSize of the first and the Size of the last event. Chmod events are
+// dropped, and other events are sent as usual (after a pending Write for the
+// same file).
+//
+// Use a window of 0 to send every Write without merging them. This can be
+// combined with WithDebounce() and WithContentHash(), which see the events
+// before they're merged.
+func WithAppendOnly(window time.Duration) addOpt {
+	return func(opt *withOpts) { opt.appendOnly, opt.appendWindow = true, window }
+}
+
+// WithOverlayUpper also watches the upper directory of an overlayfs mount, such
+// as the root filesystem of a container, for paths on overlayfs.
+//
+// inotify on the merged directory of an overlay only sees changes made through
+// the overlay; changes made directly in the upper directory (for example by
+// the container runtime, or from the host) aren't seen. With this option the
+// events from the upper directory are sent as well, with the path in the
+// merged directory. A change made through the overlay is still sent only
+// once.
+//
+// Only directories that exist in the upper directory when they're watched are
+// watched there. Whiteouts (the markers overlayfs creates for files removed
+// from a lower layer) are ignored. The first change through the overlay to a
+// file from a lower layer copies it to the upper directory, which is sent as a
+// Create event before the Write or Chmod.
+//
+// This is only supported on Linux, and is ignored on other platforms.
+func WithOverlayUpper() addOpt {
+	return func(opt *withOpts) { opt.overlayUpper = true }
+}
+
+// WithOps only sends events that have at least one of the operations in ops,
+// for example Create|Remove to only get events for new and removed files.
+//
+// The events are filtered after they're read, so this doesn't change what's
+// watched; use WithoutChmod() to not watch for Chmod events at all.
+func WithOps(ops Op) addOpt {
+	return func(opt *withOpts) { opt.ops = ops }
+}
+
+// WithDebounce merges all events for a path into one event, which is sent once
+// there were no new events for the path for wait. The Op of the event has all
+// operations of the merged events; e.g. a file that was created and written
+// to is sent as Create|Write.
+//
+// This is useful for programs that act on changes to files, such as rebuilding
+// when a source file changes: editors often write a file in several steps.
+// Events for different paths are not merged; see OnChange() for running a
+// command once after a burst of events.
+func WithDebounce(wait time.Duration) addOpt {
+	return func(opt *withOpts) { opt.debounce = wait }
+}
+
+// WithSettle sends an event with the Settled operation once there were no
+// events for the watch for quiet, for programs that want to know when a tree
+// stopped changing rather than about every change, such as build systems.
+//
+// The Settled event is sent once after every burst of events, after the last
+// event of the burst. Its Name is the path of the watch, without "/..." for
+// recursive watches.
+func WithSettle(quiet time.Duration) addOpt {
+	return func(opt *withOpts) { opt.settle = quiet }
+}
+
+// WithCloseWrite sends events with the CloseWrite operation when a file that
+// was opened for writing is closed, which usually means the program writing it
+// is done. See WriteComplete for a detector that also works on other
+// platforms.
+//
+// This is only supported on Linux, and is ignored on other platforms.
+func WithCloseWrite() addOpt {
+	return func(opt *withOpts) { opt.closeWrite = true }
+}
+
+// WithCompleteCreate holds back Create events for files that are still being
+// copied or written until they're complete: the file is no longer open for
+// writing (only detected on Linux) and its size and modification time didn't
+// change for interval.
+//
+// The Write and Chmod events for the file before that are dropped; if the file
+// is removed or renamed before it's complete then no events are sent for it at
+// all. This is useful for programs that process files copied to a directory,
+// such as large uploads. See Copying() to check a single file.
+func WithCompleteCreate(interval time.Duration) addOpt {
+	return func(opt *withOpts) { opt.completeCreate = interval }
+}
+
+// WithReplace detects the watched directory being replaced by another one, for
+// example by renaming a new directory over it or with renameat2()'s
+// RENAME_EXCHANGE, which is often done to update a directory atomically.
+//
+// When the directory is removed or renamed the path is checked for a new
+// directory until wait has passed. If one appears the watch is added to it with
+// the same options, and an event with the Replaced operation is sent for the
+// path of the watch instead of the Remove or Rename event. Otherwise the Remove
+// or Rename event is sent after wait.
+//
+// Options that can't be exported with Export(), such as WithClock(), aren't
+// used for the new watch.
+func WithReplace(wait time.Duration) addOpt {
+	return func(opt *withOpts) { opt.replace = wait }
+}
+
+// WithReplaceDiff sends events for the differences after a Replaced event from
+// WithReplace(): Remove for files and directories that are no longer there,
+// Create for new ones, and Write for files with a different size or
+// modification time.
+//
+// The contents of the watched directory are recorded when the watch is added,
+// and updated for every event. This is only used together with WithReplace().
+func WithReplaceDiff() addOpt {
+	return func(opt *withOpts) { opt.replaceDiff = true }
+}
+
+// WithPriority sends the events for this watch ahead of the events for watches
+// without it when the Events channel isn't read fast enough, for example to
+// see changes to a configuration file right away while a busy data directory
+// is also watched.
+//
+// Once a watch is added with this option, events are queued in the watcher
+// (up to a few thousand) rather than waiting to be sent; events for the same
+// watch are still sent in order.
+func WithPriority() addOpt {
+	return func(opt *withOpts) { opt.priority = true }
+}
+
+// WithGroup adds the watch to the watch group name; see Watcher.Group().
+func WithGroup(name string) addOpt {
+	return func(opt *withOpts) { opt.group = name }
+}
+
+// WithExpand expands a leading "~" and environment variables in the path
+// passed to AddWith(), as described in ExpandPath().
+//
+// The watch uses the expanded path; use that with Remove(). Export() has the
+// path as it was passed in WatchSpec.Unexpanded, and Import() expands it
+// again.
+func WithExpand() addOpt {
+	return func(opt *withOpts) { opt.expand = true }
+}
+
+// WithRelativeNames sets Event.Name to the path relative to the watched path,
+// for example "sub/file" rather than "/path/to/dir/sub/file" for
+// AddWith("/path/to/dir/...", WithRelativeNames()). Events for the watched
+// path itself have the name ".".
+//
+// The names are relative to the watch that the event is for; use this with
+// Subscribe() or WithGroup() to tell the watches apart if there is more than
+// one.
+func WithRelativeNames() addOpt {
+	return func(opt *withOpts) { opt.relativeNames = true }
+}
+
+// WithoutFUSE makes AddWith() return a *FUSEError if the path is on a FUSE
+// filesystem, such as sshfs or rclone, rather than adding a watch that only
+// sees the changes made through the local mount. Use errors.Is(err, ErrFUSE)
+// to check for it, and poll these paths instead.
+//
+// Only the watched path is checked, not FUSE filesystems mounted in a
+// directory that's watched recursively. This is supported on Linux, macOS, and
+// FreeBSD, and is ignored on other platforms.
+func WithoutFUSE() addOpt {
+	return func(opt *withOpts) { opt.noFUSE = true }
+}
@@ -6,7 +6,10 @@ package fsnotify
 import (
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync/atomic"
@@ -115,6 +118,591 @@ func TestWatch(t *testing.T) {
 	}
 }
 
+func TestWithInitialScan(t *testing.T) {
+	tests := []testCase{
+		{"dir", func(t *testing.T, w *Watcher, tmp string) {
+			touch(t, tmp, "file")
+			mkdir(t, tmp, "sub")
+			touch(t, tmp, "sub", "file") // Not reported; not recursive.
+
+			if err := w.AddWith(tmp, WithInitialScan()); err != nil {
+				t.Fatal(err)
+			}
+			eventSeparator()
+			touch(t, tmp, "new")
+		}, `
+			create /file
+			create /sub
+			create /new
+		`},
+
+		{"file with write", func(t *testing.T, w *Watcher, tmp string) {
+			file := filepath.Join(tmp, "file")
+			cat(t, "data", file)
+
+			if err := w.AddWith(file, WithInitialScan(Create|Write)); err != nil {
+				t.Fatal(err)
+			}
+		}, `
+			create|write /file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithCatchUp(t *testing.T) {
+	tests := []testCase{
+		{"dir", func(t *testing.T, w *Watcher, tmp string) {
+			touch(t, tmp, "old")
+			mkdir(t, tmp, "sub")
+			touch(t, tmp, "sub", "old")
+			old := time.Now().Add(-time.Hour)
+			for _, f := range []string{"old", "sub", "sub/old"} {
+				if err := os.Chtimes(filepath.Join(tmp, f), old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			since := time.Now()
+			time.Sleep(10 * time.Millisecond)
+			touch(t, tmp, "sub", "new")
+
+			if err := w.AddWith(filepath.Join(tmp, "..."), WithCatchUp(since)); err != nil {
+				t.Fatal(err)
+			}
+			eventSeparator()
+			touch(t, tmp, "live")
+		}, `
+			write  /sub/new
+			create /live
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithContentHash(t *testing.T) {
+	// Overwrite the start of the file without truncating it, so there's just
+	// one Write event.
+	overwrite := func(t *testing.T, data string, path ...string) {
+		t.Helper()
+		fp, err := os.OpenFile(filepath.Join(path...), os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fp.Close()
+		if _, err := fp.WriteAt([]byte(data), 0); err != nil {
+			t.Fatal(err)
+		}
+		eventSeparator()
+	}
+
+	tests := []testCase{
+		{"same content", func(t *testing.T, w *Watcher, tmp string) {
+			if err := w.AddWith(tmp, WithContentHash(1024)); err != nil {
+				t.Fatal(err)
+			}
+
+			touch(t, tmp, "file")
+			overwrite(t, "hello", tmp, "file")
+			overwrite(t, "hello", tmp, "file")
+			overwrite(t, "world", tmp, "file")
+		}, `
+			create /file
+			write  /file
+			write  /file
+		`},
+
+		{"too large", func(t *testing.T, w *Watcher, tmp string) {
+			if err := w.AddWith(tmp, WithContentHash(2)); err != nil {
+				t.Fatal(err)
+			}
+
+			touch(t, tmp, "file")
+			overwrite(t, "hello", tmp, "file")
+			overwrite(t, "hello", tmp, "file")
+		}, `
+			create /file
+			write  /file
+			write  /file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithIgnore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows reports a WRITE for the directories")
+	}
+
+	tests := []testCase{
+		{"recursive", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "node_modules")
+			mkdir(t, tmp, "src")
+			if err := w.AddWith(filepath.Join(tmp, "..."), WithIgnore("node_modules/", "*.tmp")); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range w.WatchList() {
+				if strings.Contains(p, "node_modules") {
+					t.Errorf("node_modules is watched: %q", p)
+				}
+			}
+
+			touch(t, tmp, "file.tmp")
+			touch(t, tmp, "src", "file.tmp")
+			touch(t, tmp, "src", "file")
+			touch(t, tmp, "node_modules", "file")
+			mkdir(t, tmp, "src", "node_modules")
+			touch(t, tmp, "src", "node_modules", "file")
+		}, `
+			create /src/file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithIncludeExclude(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows reports a WRITE for the directories")
+	}
+
+	tests := []testCase{
+		{"include and exclude", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "vendor")
+			mkdir(t, tmp, "vendor", "pkg")
+			err := w.AddWith(filepath.Join(tmp, "..."),
+				WithInclude("*.go"), WithExclude("*_test.go", "vendor/**"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			touch(t, tmp, "main.go")
+			touch(t, tmp, "main_test.go")
+			touch(t, tmp, "README")
+			touch(t, tmp, "vendor", "pkg", "pkg.go")
+			mkdir(t, tmp, "sub")
+			touch(t, tmp, "sub", "sub.go")
+		}, `
+			create /main.go
+			create /sub
+			create /sub/sub.go
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithRegexp(t *testing.T) {
+	tests := []testCase{
+		{"include and exclude", func(t *testing.T, w *Watcher, tmp string) {
+			err := w.AddWith(tmp,
+				WithIncludeRegexp(regexp.MustCompile(`^app-\d{8}\.log$`)),
+				WithExcludeRegexp(regexp.MustCompile(`^app-1999`)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			touch(t, tmp, "app-20240101.log")
+			touch(t, tmp, "app-19990101.log")
+			touch(t, tmp, "app.log")
+		}, `
+			create /app-20240101.log
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows reports a WRITE for the directories")
+	}
+
+	tests := []testCase{
+		{"depth 1", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "one")
+			mkdir(t, tmp, "one", "two")
+			if err := w.AddWith(filepath.Join(tmp, "..."), WithMaxDepth(1)); err != nil {
+				t.Fatal(err)
+			}
+
+			touch(t, tmp, "one", "file")
+			touch(t, tmp, "one", "two", "file")
+			mkdir(t, tmp, "one", "new")
+			touch(t, tmp, "one", "new", "file")
+		}, `
+			create /one/file
+			create /one/new
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithSkipHidden(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("dotfiles aren't hidden on Windows")
+	}
+
+	tests := []testCase{
+		{"recursive", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, ".git")
+			if err := w.AddWith(filepath.Join(tmp, "..."), WithSkipHidden()); err != nil {
+				t.Fatal(err)
+			}
+
+			touch(t, tmp, ".hidden")
+			touch(t, tmp, ".git", "file")
+			touch(t, tmp, "file")
+		}, `
+			create /file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithoutChmod(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("attributes don't work on Windows")
+	}
+
+	tests := []testCase{
+		{"chmod", func(t *testing.T, w *Watcher, tmp string) {
+			touch(t, tmp, "file")
+			if err := w.AddWith(tmp, WithoutChmod()); err != nil {
+				t.Fatal(err)
+			}
+
+			chmod(t, 0o700, tmp, "file")
+			cat(t, "data", tmp, "file")
+		}, `
+			write /file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithoutParentDuplicates(t *testing.T) {
+	tests := []testCase{
+		{"file and dir", func(t *testing.T, w *Watcher, tmp string) {
+			touch(t, tmp, "file")
+			addWatch(t, w, tmp)
+			if err := w.AddWith(filepath.Join(tmp, "file"), WithoutParentDuplicates()); err != nil {
+				t.Fatal(err)
+			}
+
+			cat(t, "data", tmp, "file")
+			rm(t, tmp, "file")
+		}, `
+			write  /file
+			remove /file
+
+			# The link count changes before the file is removed.
+			linux:
+				write  /file
+				chmod  /file
+				remove /file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithReplace(t *testing.T) {
+	tests := []testCase{
+		{"replaced", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "dir")
+			cat(t, "data", tmp, "dir", "a")
+			cat(t, "data", tmp, "dir", "b")
+			if err := w.AddWith(filepath.Join(tmp, "dir"), WithReplace(500*time.Millisecond), WithReplaceDiff()); err != nil {
+				t.Fatal(err)
+			}
+
+			mkdir(t, tmp, "staged")
+			cat(t, "changed", tmp, "staged", "a")
+			cat(t, "data", tmp, "staged", "c")
+			mv(t, filepath.Join(tmp, "dir"), tmp, "old")
+			mv(t, filepath.Join(tmp, "staged"), tmp, "dir")
+			time.Sleep(100 * time.Millisecond)
+			touch(t, tmp, "dir", "d")
+		}, `
+			replaced /dir
+			remove   /dir/b
+			create   /dir/c
+			write    /dir/a
+			create   /dir/d
+		`},
+
+		{"removed", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "dir")
+			if err := w.AddWith(filepath.Join(tmp, "dir"), WithReplace(100*time.Millisecond)); err != nil {
+				t.Fatal(err)
+			}
+
+			rmAll(t, tmp, "dir")
+			time.Sleep(200 * time.Millisecond)
+		}, `
+			remove /dir
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestAddFile(t *testing.T) {
+	tests := []testCase{
+		{"dir", func(t *testing.T, w *Watcher, tmp string) {
+			f, err := os.Open(tmp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = w.AddFile(f)
+			f.Close() // The watch should stay after closing the file.
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			touch(t, tmp, "file")
+			rm(t, tmp, "file")
+		}, `
+			create /file
+			remove /file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestAddAt(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows":
+		t.Skip("no directory file descriptors on Windows")
+	case "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+		t.Skip("kqueue reads directories by name")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "a")
+	mkdir(t, tmp, "a", "sub")
+	dir, err := os.Open(filepath.Join(tmp, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+
+	w := newCollector(t)
+	w.collect(t)
+	if err := w.w.AddAt(dir.Fd(), "../a"); err == nil {
+		t.Error("no error for path outside of dirfd")
+	}
+	if err := w.w.AddAt(dir.Fd(), "sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The watch should follow the directory when the parent is renamed.
+	mv(t, filepath.Join(tmp, "a"), tmp, "b")
+	touch(t, tmp, "b", "sub", "file")
+
+	have := w.stop(t)
+	want := Events{{Name: "sub/file", Op: Create}}
+	if have.String() != want.String() {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestWithoutFollow(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows":
+		t.Skip("links are watched through the directory on Windows")
+	case "freebsd", "openbsd", "netbsd", "dragonfly":
+		t.Skip("can't open symlinks")
+	}
+
+	tests := []testCase{
+		{"replace link", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "v1")
+			mkdir(t, tmp, "v2")
+			symlink(t, "v1", tmp, "current")
+			if err := w.AddWith(filepath.Join(tmp, "current"), WithoutFollow()); err != nil {
+				t.Fatal(err)
+			}
+
+			touch(t, tmp, "v1", "file") // Not watched.
+			symlink(t, "v2", tmp, "new")
+			mv(t, filepath.Join(tmp, "new"), tmp, "current")
+		}, `
+			remove /current
+
+			# The link count changes before the link is removed.
+			linux:
+				chmod  /current
+				remove /current
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWithHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("not supported on Windows")
+	}
+
+	link := func(t *testing.T, oldname, newname string) {
+		t.Helper()
+		if err := os.Link(oldname, newname); err != nil {
+			t.Fatal(err)
+		}
+		eventSeparator()
+	}
+
+	tests := []testCase{
+		{"existing link", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "dir")
+			touch(t, tmp, "other")
+			link(t, filepath.Join(tmp, "other"), filepath.Join(tmp, "dir", "file"))
+			if err := w.AddWith(filepath.Join(tmp, "dir"), WithHardlinks()); err != nil {
+				t.Fatal(err)
+			}
+
+			cat(t, "data", tmp, "other")
+			cat(t, "data", tmp, "dir", "file")
+		}, `
+			write /dir/file
+			write /dir/file
+		`},
+		{"new link", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "dir")
+			touch(t, tmp, "other")
+			if err := w.AddWith(filepath.Join(tmp, "dir"), WithHardlinks()); err != nil {
+				t.Fatal(err)
+			}
+
+			link(t, filepath.Join(tmp, "other"), filepath.Join(tmp, "dir", "file"))
+			cat(t, "data", tmp, "other")
+			rm(t, tmp, "dir", "file")
+			cat(t, "data", tmp, "other")
+		}, `
+			create /dir/file
+			write  /dir/file
+			remove /dir/file
+
+			# The link count changes before the file is removed.
+			linux:
+				create /dir/file
+				write  /dir/file
+				chmod  /dir/file
+				remove /dir/file
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+
+	t.Run("link count", func(t *testing.T) {
+		tmp := t.TempDir()
+		touch(t, tmp, "file")
+		link(t, filepath.Join(tmp, "file"), filepath.Join(tmp, "link"))
+		n, err := LinkCount(filepath.Join(tmp, "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Errorf("LinkCount = %d; want 2", n)
+		}
+	})
+}
+
+func TestWatchRecursive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows reports a WRITE for the directories")
+	}
+
+	tests := []testCase{
+		{"create in subdirectories", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "one")
+			mkdir(t, tmp, "one", "two")
+			addWatch(t, w, tmp, "...")
+
+			touch(t, tmp, "file")
+			touch(t, tmp, "one", "two", "file")
+			mkdir(t, tmp, "one", "two", "three")
+			touch(t, tmp, "one", "two", "three", "file")
+		}, `
+			create /file
+			create /one/two/file
+			create /one/two/three
+			create /one/two/three/file
+		`},
+
+		{"remove", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "sub")
+			addWatch(t, w, tmp, "...")
+			if err := w.Remove(filepath.Join(tmp, "...")); err != nil {
+				t.Fatal(err)
+			}
+			if l := w.WatchList(); len(l) != 0 {
+				t.Errorf("WatchList not empty: %s", l)
+			}
+
+			touch(t, tmp, "file")
+			touch(t, tmp, "sub", "file")
+		}, `
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
 func TestWatchRename(t *testing.T) {
 	tests := []testCase{
 		{"rename file", func(t *testing.T, w *Watcher, tmp string) {
@@ -390,6 +978,25 @@ func TestClose(t *testing.T) {
 		}
 	})
 
+	t.Run("state", func(t *testing.T) {
+		t.Parallel()
+
+		w := newWatcher(t)
+		if s := w.State(); s != StateRunning || w.IsClosed() {
+			t.Fatalf("wrong state before Close(): %s", s)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !w.IsClosed() {
+			t.Fatal("IsClosed() false after Close()")
+		}
+		<-w.Done()
+		if s := w.State(); s != StateClosed || !w.IsClosed() {
+			t.Fatalf("wrong state after Close(): %s", s)
+		}
+	})
+
 	// Make sure that Close() works even when the Events channel isn't being
 	// read.
 	t.Run("events not read", func(t *testing.T) {
@@ -471,6 +1078,27 @@ func TestClose(t *testing.T) {
 			go w.Close()
 		}
 	})
+
+	t.Run("done", func(t *testing.T) {
+		t.Parallel()
+
+		w := newWatcher(t, t.TempDir())
+		select {
+		case <-w.Done():
+			t.Fatal("Done() closed before Close()")
+		default:
+		}
+
+		go w.Close()
+		select {
+		case <-w.Done():
+		case <-time.After(time.Second):
+			t.Fatal("Done() not closed after Close()")
+		}
+		if _, ok := <-w.Events; ok {
+			t.Fatal("Events not closed when Done() is closed")
+		}
+	})
 }
 
 func TestAdd(t *testing.T) {
@@ -583,16 +1211,24 @@ func TestEventString(t *testing.T) {
 		want string
 	}{
 		{Event{}, `"": `},
-		{Event{"/file", 0}, `"/file": `},
+		{Event{Name: "/file", Op: 0}, `"/file": `},
 
-		{Event{"/file", Chmod | Create},
+		{Event{Name: "/file", Op: Chmod | Create},
 			`"/file": CREATE|CHMOD`},
-		{Event{"/file", Rename},
+		{Event{Name: "/file", Op: Rename},
 			`"/file": RENAME`},
-		{Event{"/file", Remove},
+		{Event{Name: "/file", Op: Remove},
 			`"/file": REMOVE`},
-		{Event{"/file", Write | Chmod},
+		{Event{Name: "/file", Op: Write | Chmod},
 			`"/file": WRITE|CHMOD`},
+		{Event{Name: "/file", Op: Write | Truncate},
+			`"/file": WRITE|TRUNCATE`},
+		{Event{Name: "/dir", Op: Settled},
+			`"/dir": SETTLED`},
+		{Event{Name: "/file", Op: CloseWrite},
+			`"/file": CLOSE_WRITE`},
+		{Event{Name: "/dir", Op: Replaced},
+			`"/dir": REPLACED`},
 	}
 
 	for _, tt := range tests {
@@ -604,3 +1240,168 @@ func TestEventString(t *testing.T) {
 		})
 	}
 }
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "dir")
+	touch(t, tmp, "file")
+	w := newWatcher(t)
+	addWatch(t, w, tmp, "dir", "...")
+	addWatch(t, w, tmp, "file")
+
+	health, err := w.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []WatchHealth{
+		{Path: filepath.Join(tmp, "dir", "..."), Status: WatchOK},
+		{Path: filepath.Join(tmp, "file"), Status: WatchOK},
+	}
+	if !reflect.DeepEqual(health, want) {
+		t.Errorf("\nhave: %v\nwant: %v", health, want)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Check(); err == nil {
+		t.Error("no error after Close()")
+	}
+}
+
+func TestWithErrorHandler(t *testing.T) {
+	t.Parallel()
+
+	var have []error
+	w, err := NewWatcherWith(WithErrorHandler(func(err error) { have = append(have, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Nothing reads the Errors channel, so this would block without the
+	// handler.
+	sendErr := errors.New("oops")
+	if !w.sendError(sendErr) {
+		t.Fatal("sendError returned false")
+	}
+	if len(have) != 1 || !errors.Is(have[0], sendErr) {
+		t.Errorf("wrong errors: %v", have)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-w.Errors; ok {
+		t.Error("Errors channel not closed")
+	}
+}
+
+// Add() and Remove() called from the goroutine that reads Events shouldn't
+// wait for the events to be read.
+func TestAddFromEventHandler(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w := newWatcher(t, tmp)
+	defer w.Close()
+
+	// Enough events that the watcher is blocked on sending them.
+	for i := 0; i < 200; i++ {
+		mkdir(t, tmp, fmt.Sprintf("dir-%03d", i), noWait)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for added := 0; added < 200; {
+			select {
+			case e := <-w.Events:
+				if !e.Has(Create) {
+					continue
+				}
+				if err := w.Add(e.Name); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := w.Remove(e.Name); err != nil {
+					t.Error(err)
+					return
+				}
+				added++
+			case err := <-w.Errors:
+				t.Error(err)
+				return
+			case <-time.After(5 * time.Second):
+				t.Error("timeout waiting for events")
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("Add() or Remove() from the event handler deadlocked")
+	}
+}
+
+// A watched directory that's removed and created again is watched again on
+// Windows.
+func TestReopenRemovedDir(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("only on Windows")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "dir")
+	mkdir(t, dir, noWait)
+	w := newWatcher(t, dir)
+	defer w.Close()
+
+	wait := func(name string, op Op) {
+		t.Helper()
+		for {
+			select {
+			case e := <-w.Events:
+				if e.Name == name && e.Has(op) {
+					return
+				}
+			case err := <-w.Errors:
+				t.Fatal(err)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for %s %s", op, name)
+			}
+		}
+	}
+
+	rmAll(t, dir, noWait)
+	wait(dir, Remove)
+	mkdir(t, dir, noWait)
+	wait(dir, Create)
+	touch(t, dir, "file", noWait)
+	wait(filepath.Join(dir, "file"), Create)
+
+	// Remove() stops waiting for the directory to be created.
+	rmAll(t, dir, noWait)
+	wait(dir, Remove)
+	if err := w.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	mkdir(t, dir, noWait)
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-w.Events:
+			if e.Name == dir && e.Has(Create) {
+				t.Fatalf("watched again after Remove(): %s", e)
+			}
+		case err := <-w.Errors:
+			t.Fatal(err)
+		case <-timeout:
+			return
+		}
+	}
+}
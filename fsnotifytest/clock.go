@@ -0,0 +1,110 @@
+package fsnotifytest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Clock is a fake fsnotify.Clock; the time only changes when Advance() is
+// called.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+}
+
+var _ fsnotify.Clock = (*Clock)(nil)
+
+// NewClock creates a new fake clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current fake time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer creates a new timer that fires once the clock is advanced by d.
+func (c *Clock) NewTimer(d time.Duration) fsnotify.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &timer{c: c, ch: make(chan time.Time, 1), when: c.now.Add(d), active: true}
+	c.timers = append(c.timers, t)
+	c.fire()
+	return t
+}
+
+// Advance moves the clock forward by d, and fires all timers that expire.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.fire()
+}
+
+// Timers returns the number of timers that haven't fired or been stopped yet;
+// this can be used to wait until the code under test started a timer.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if t.active {
+			n++
+		}
+	}
+	return n
+}
+
+// fire fires all expired timers, and removes inactive timers.
+func (c *Clock) fire() {
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.active && !t.when.After(c.now) {
+			t.active = false
+			select {
+			case t.ch <- c.now:
+			default:
+			}
+		}
+		if t.active {
+			timers = append(timers, t)
+		}
+	}
+	c.timers = timers
+}
+
+type timer struct {
+	c      *Clock
+	ch     chan time.Time
+	when   time.Time
+	active bool // Protected by c.mu.
+}
+
+func (t *timer) C() <-chan time.Time { return t.ch }
+
+func (t *timer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	wasActive := t.active
+	t.active = false
+	t.c.fire() // Remove from the list.
+	return wasActive
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	wasActive := t.active
+	t.when, t.active = t.c.now.Add(d), true
+	if !wasActive {
+		t.c.timers = append(t.c.timers, t)
+	}
+	t.c.fire()
+	return wasActive
+}
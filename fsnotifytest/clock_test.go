@@ -0,0 +1,247 @@
+package fsnotifytest
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+
+	tm := c.NewTimer(time.Second)
+	if n := c.Timers(); n != 1 {
+		t.Fatalf("Timers() = %d", n)
+	}
+	c.Advance(999 * time.Millisecond)
+	select {
+	case <-tm.C():
+		t.Fatal("fired too early")
+	default:
+	}
+
+	c.Advance(time.Millisecond)
+	select {
+	case now := <-tm.C():
+		if want := start.Add(time.Second); !now.Equal(want) {
+			t.Errorf("have %s; want %s", now, want)
+		}
+	default:
+		t.Fatal("didn't fire")
+	}
+	if tm.Stop() {
+		t.Error("Stop() returned true after firing")
+	}
+
+	if tm.Reset(time.Second) {
+		t.Error("Reset() returned true after firing")
+	}
+	if !tm.Stop() {
+		t.Error("Stop() returned false for active timer")
+	}
+	c.Advance(time.Hour)
+	select {
+	case <-tm.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+	if n := c.Timers(); n != 0 {
+		t.Errorf("Timers() = %d", n)
+	}
+}
+
+func TestClockWithDedup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("attributes don't work on Windows")
+	}
+
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClock(time.Now())
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	go func() {
+		for range w.Events {
+		}
+	}()
+	if err := w.AddWith(file, fsnotify.WithDedup(time.Second), fsnotify.WithClock(c)); err != nil {
+		t.Fatal(err)
+	}
+
+	chmod := func(mode os.FileMode) {
+		t.Helper()
+		if err := os.Chmod(file, mode); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	chmod(0o600)
+	chmod(0o644) // Dropped: the clock didn't move.
+	c.Advance(2 * time.Second)
+	chmod(0o600)
+	time.Sleep(200 * time.Millisecond)
+
+	if n := w.Duplicates(); n != 1 {
+		t.Errorf("Duplicates() = %d; want 1", n)
+	}
+}
+
+func TestClockWatchConfig(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "app.conf")
+	if err := os.WriteFile(file, []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewClock(time.Now())
+	reloads := make(chan struct{}, 10)
+	go fsnotify.WatchConfigWith(ctx, file, func() error {
+		reloads <- struct{}{}
+		return nil
+	}, fsnotify.WatchConfigOptions{Clock: c})
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(file, []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloads:
+		t.Fatal("reloaded before the clock moved")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	c.Advance(time.Second)
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reloaded after the clock moved")
+	}
+}
+
+func TestClockSSEHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClock(time.Now())
+	h := fsnotify.NewSSEHandler(w, 10)
+	h.Heartbeat, h.Clock = 10*time.Second, c
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	defer h.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := make(chan string, 100)
+	go func() {
+		r := bufio.NewReader(resp.Body)
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- l
+		}
+	}()
+	// next returns the next line that's not empty, or "" if there is none.
+	next := func() string {
+		for {
+			select {
+			case l := <-lines:
+				if l != "\n" {
+					return l
+				}
+			case <-time.After(500 * time.Millisecond):
+				return ""
+			}
+		}
+	}
+
+	for c.Timers() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Advance(6 * time.Second)
+	if err := os.WriteFile(filepath.Join(tmp, "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if l := next(); l != "id: 1\n" {
+		t.Fatalf("want the event; have %q", l)
+	}
+	for next() != "" {
+	}
+
+	// 12 seconds since the start, but only 6 since the event.
+	c.Advance(6 * time.Second)
+	if l := next(); l != "" {
+		t.Fatalf("heartbeat right after an event: %q", l)
+	}
+	c.Advance(4 * time.Second)
+	if l := next(); l != ": heartbeat\n" {
+		t.Fatalf("want a heartbeat; have %q", l)
+	}
+}
+
+func TestClockPortable(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w, err := fsnotify.NewWatcherWith(fsnotify.WithPortable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	c := NewClock(time.Now())
+	if err := w.AddWith(tmp, fsnotify.WithClock(c)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmp, "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-w.Events:
+		t.Fatalf("sent before the clock moved: %s", e)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	c.Advance(time.Second)
+	select {
+	case e := <-w.Events:
+		if !e.Has(fsnotify.Create) {
+			t.Errorf("wrong event: %s", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not sent after the clock moved")
+	}
+}
@@ -0,0 +1,236 @@
+// Package fsnotifytest provides a fake watcher for testing code that uses
+// fsnotify, without touching the filesystem or waiting for events.
+//
+// The fake Watcher has the same fields and methods as fsnotify.Watcher, and
+// the test controls which events and errors are sent:
+//
+//	w := fsnotifytest.NewWatcher()
+//	go handleEvents(w) // Code under test.
+//	w.SendEvent(fsnotify.Event{Name: "/file", Op: fsnotify.Write})
+//
+// SendEvent() and SendError() return once the event is read, so there is no
+// need to sleep.
+package fsnotifytest
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrClosed is returned from Add() and Remove() after the watcher is closed.
+var ErrClosed = errors.New("fsnotifytest: watcher closed")
+
+// Call is a call to one of the methods of the Watcher.
+type Call struct {
+	Method string             // "Add", "AddWith", "Remove", or "Close"
+	Name   string             // Argument for Add(), AddWith(), and Remove().
+	Spec   fsnotify.WatchSpec // Options for AddWith().
+}
+
+func (c Call) String() string {
+	if c.Method == "Close" {
+		return "Close()"
+	}
+	return fmt.Sprintf("%s(%q)", c.Method, c.Name)
+}
+
+// Watcher is a fake fsnotify.Watcher.
+type Watcher struct {
+	// Events sends the events from SendEvent().
+	Events chan fsnotify.Event
+
+	// Errors sends the errors from SendError().
+	Errors chan error
+
+	mu      sync.Mutex // Protects everything below.
+	watches []string
+	calls   []Call
+	addErr  map[string]error
+	done    chan struct{} // Closed on Close().
+	sendMu  sync.RWMutex  // Read-locked while sending; locked to close the channels.
+}
+
+// NewWatcher creates a new fake watcher.
+func NewWatcher() *Watcher {
+	return &Watcher{
+		Events: make(chan fsnotify.Event),
+		Errors: make(chan error),
+		addErr: make(map[string]error),
+		done:   make(chan struct{}),
+	}
+}
+
+var _ fsnotify.Notifier = (*Watcher)(nil)
+
+// Add records the call, and starts "watching" name. It returns the error set
+// with FailAdd(), if any.
+func (w *Watcher) Add(name string) error {
+	return w.add(Call{Method: "Add", Name: name})
+}
+
+// AddWith is like Add(), but the call also records the options.
+func (w *Watcher) AddWith(name string, opts ...fsnotify.AddOption) error {
+	return w.add(Call{Method: "AddWith", Name: name, Spec: fsnotify.NewWatchSpec(name, opts...)})
+}
+
+func (w *Watcher) add(c Call) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls = append(w.calls, c)
+	name := c.Name
+	if w.closed() {
+		return ErrClosed
+	}
+	if err := w.addErr[filepath.Clean(name)]; err != nil {
+		return err
+	}
+	name = filepath.Clean(name)
+	for _, n := range w.watches {
+		if n == name {
+			return nil
+		}
+	}
+	w.watches = append(w.watches, name)
+	return nil
+}
+
+// Remove records the call, and stops "watching" name. It returns
+// fsnotify.ErrNonExistentWatch if name isn't watched.
+func (w *Watcher) Remove(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls = append(w.calls, Call{Method: "Remove", Name: name})
+	if w.closed() {
+		return ErrClosed
+	}
+	name = filepath.Clean(name)
+	for i, n := range w.watches {
+		if n == name {
+			w.watches = append(w.watches[:i], w.watches[i+1:]...)
+			return nil
+		}
+	}
+	return fsnotify.ErrNonExistentWatch
+}
+
+// EventsChan returns the Events channel, to implement fsnotify.Notifier.
+func (w *Watcher) EventsChan() <-chan fsnotify.Event { return w.Events }
+
+// ErrorsChan returns the Errors channel, to implement fsnotify.Notifier.
+func (w *Watcher) ErrorsChan() <-chan error { return w.Errors }
+
+// WatchList returns all paths added with Add() (and are not yet removed), in
+// the order they were added.
+func (w *Watcher) WatchList() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.watches...)
+}
+
+// Close records the call, and closes the Events and Errors channels.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	w.calls = append(w.calls, Call{Method: "Close"})
+	if w.closed() {
+		w.mu.Unlock()
+		return nil
+	}
+	close(w.done)
+	w.watches = nil
+	w.mu.Unlock()
+
+	w.sendMu.Lock()
+	close(w.Events)
+	close(w.Errors)
+	w.sendMu.Unlock()
+	return nil
+}
+
+func (w *Watcher) closed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// FailAdd makes Add() return err for name; a nil error removes it.
+func (w *Watcher) FailAdd(name string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		delete(w.addErr, filepath.Clean(name))
+	} else {
+		w.addErr[filepath.Clean(name)] = err
+	}
+}
+
+// SendEvent sends e on the Events channel, and waits until it's read.
+//
+// It returns false if the watcher was closed before the event was read.
+func (w *Watcher) SendEvent(e fsnotify.Event) bool {
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+	select {
+	case w.Events <- e:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// SendError sends err on the Errors channel, and waits until it's read.
+//
+// It returns false if the watcher was closed before the error was read.
+func (w *Watcher) SendError(err error) bool {
+	w.sendMu.RLock()
+	defer w.sendMu.RUnlock()
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+	select {
+	case w.Errors <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// Watching reports if name is currently watched.
+func (w *Watcher) Watching(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	name = filepath.Clean(name)
+	for _, n := range w.watches {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Calls returns all calls to Add(), Remove(), and Close(), in order.
+func (w *Watcher) Calls() []Call {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Call{}, w.calls...)
+}
+
+// Closed reports if Close() was called.
+func (w *Watcher) Closed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed()
+}
@@ -0,0 +1,77 @@
+package fsnotifytest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatcher(t *testing.T) {
+	w := NewWatcher()
+
+	errDenied := errors.New("denied")
+	w.FailAdd("/denied", errDenied)
+	if err := w.Add("/denied"); err != errDenied {
+		t.Errorf("wrong error: %v", err)
+	}
+	if err := w.AddWith("/dir/", fsnotify.WithSkipHidden()); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Watching("/dir") {
+		t.Error("not watching /dir")
+	}
+
+	got := make(chan fsnotify.Event, 1)
+	go func() { got <- <-w.Events }()
+	want := fsnotify.Event{Name: "/dir/file", Op: fsnotify.Write}
+	if !w.SendEvent(want) {
+		t.Fatal("SendEvent returned false")
+	}
+	if have := <-got; have != want {
+		t.Errorf("have %s; want %s", have, want)
+	}
+
+	if err := w.Remove("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Remove("/dir"); err != fsnotify.ErrNonExistentWatch {
+		t.Errorf("wrong error removing twice: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-w.Events; ok {
+		t.Error("Events not closed")
+	}
+	if w.SendEvent(want) || w.SendError(errDenied) {
+		t.Error("sent after Close()")
+	}
+	if err := w.Add("/dir"); err != ErrClosed {
+		t.Errorf("wrong error after Close(): %v", err)
+	}
+
+	wantCalls := []Call{
+		{Method: "Add", Name: "/denied"},
+		{Method: "AddWith", Name: "/dir/", Spec: fsnotify.WatchSpec{Path: "/dir", SkipHidden: true}},
+		{Method: "Remove", Name: "/dir"},
+		{Method: "Remove", Name: "/dir"},
+		{Method: "Close"},
+		{Method: "Add", Name: "/dir"},
+	}
+	if have := w.Calls(); !reflect.DeepEqual(have, wantCalls) {
+		t.Errorf("\nhave: %s\nwant: %s", have, wantCalls)
+	}
+}
+
+func TestSendBlocksUntilClose(t *testing.T) {
+	w := NewWatcher()
+	done := make(chan bool)
+	go func() { done <- w.SendError(errors.New("oops")) }()
+	w.Close()
+	if <-done {
+		t.Error("SendError returned true")
+	}
+}
@@ -0,0 +1,219 @@
+package fsnotifytest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// record is a single line in a recording.
+type record struct {
+	Time  time.Duration `json:"t"` // Since the start of the recording.
+	Name  string        `json:"name,omitempty"`
+	Op    string        `json:"op,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// Recorder records the events and errors of a watcher, and passes them on.
+//
+// It implements fsnotify.Notifier, so it can be used in place of the watcher;
+// for example to record the events a user sees to reproduce a bug report.
+// Every event and error is written as a line of JSON with the time since the
+// recorder was created:
+//
+//	{"t":1200000,"name":"/dir/file","op":"CREATE"}
+//	{"t":1250000,"name":"/dir/file","op":"WRITE"}
+//
+// Use Replay() to send the recorded events on a fake Watcher.
+type Recorder struct {
+	// Events sends the events of the watcher.
+	Events chan fsnotify.Event
+
+	// Errors sends the errors of the watcher, and errors from writing the
+	// recording.
+	Errors chan error
+
+	w        fsnotify.Notifier
+	start    time.Time
+	enc      *json.Encoder
+	once     sync.Once
+	done     chan struct{}
+	doneResp chan struct{}
+}
+
+var _ fsnotify.Notifier = (*Recorder)(nil)
+
+// NewRecorder starts recording the events and errors of w to out.
+//
+// The watcher shouldn't be read from directly after this.
+func NewRecorder(w fsnotify.Notifier, out io.Writer) *Recorder {
+	r := &Recorder{
+		Events:   make(chan fsnotify.Event),
+		Errors:   make(chan error),
+		w:        w,
+		start:    time.Now(),
+		enc:      json.NewEncoder(out),
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Add calls Add() on the watcher.
+func (r *Recorder) Add(name string) error { return r.w.Add(name) }
+
+// AddWith calls AddWith() on the watcher.
+func (r *Recorder) AddWith(name string, opts ...fsnotify.AddOption) error {
+	return r.w.AddWith(name, opts...)
+}
+
+// Remove calls Remove() on the watcher.
+func (r *Recorder) Remove(name string) error { return r.w.Remove(name) }
+
+// EventsChan returns the Events channel, to implement fsnotify.Notifier.
+func (r *Recorder) EventsChan() <-chan fsnotify.Event { return r.Events }
+
+// ErrorsChan returns the Errors channel, to implement fsnotify.Notifier.
+func (r *Recorder) ErrorsChan() <-chan error { return r.Errors }
+
+// Close closes the watcher, and the Events and Errors channels.
+func (r *Recorder) Close() error {
+	r.once.Do(func() { close(r.done) })
+	err := r.w.Close()
+	<-r.doneResp
+	return err
+}
+
+func (r *Recorder) run() {
+	defer func() {
+		close(r.Events)
+		close(r.Errors)
+		close(r.doneResp)
+	}()
+
+	events, errs := r.w.EventsChan(), r.w.ErrorsChan()
+	for {
+		select {
+		case <-r.done:
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if !r.write(record{Time: time.Since(r.start), Name: e.Name, Op: e.Op.String()}) {
+				return
+			}
+			select {
+			case r.Events <- e:
+			case <-r.done:
+				return
+			}
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			if !r.write(record{Time: time.Since(r.start), Error: err.Error()}) {
+				return
+			}
+			select {
+			case r.Errors <- err:
+			case <-r.done:
+				return
+			}
+		}
+	}
+}
+
+// write writes the record; errors are sent on the Errors channel. Returns
+// false if the recorder was closed.
+func (r *Recorder) write(rec record) bool {
+	err := r.enc.Encode(rec)
+	if err == nil {
+		return true
+	}
+	select {
+	case r.Errors <- fmt.Errorf("fsnotifytest: writing recording: %w", err):
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// Replay sends the events and errors recorded by a Recorder on the fake
+// watcher w.
+//
+// The events are sent with the same delays as they were recorded, multiplied
+// by speed; for example 0.5 replays at double speed. A speed of 0 sends
+// everything as fast as it's read, which is usually what you want in tests.
+//
+// It returns once everything is sent, or when w is closed.
+func Replay(in io.Reader, w *Watcher, speed float64) error {
+	var (
+		scan  = bufio.NewScanner(in)
+		start = time.Now()
+		line  int
+	)
+	for scan.Scan() {
+		line++
+		if len(strings.TrimSpace(scan.Text())) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(scan.Bytes(), &rec); err != nil {
+			return fmt.Errorf("fsnotifytest: line %d: %w", line, err)
+		}
+
+		if speed > 0 {
+			if d := time.Duration(float64(rec.Time)*speed) - time.Since(start); d > 0 {
+				time.Sleep(d)
+			}
+		}
+
+		var sent bool
+		if rec.Error != "" {
+			sent = w.SendError(parseError(rec.Error))
+		} else {
+			sent = w.SendEvent(fsnotify.Event{Name: rec.Name, Op: parseOp(rec.Op)})
+		}
+		if !sent {
+			return nil
+		}
+	}
+	return scan.Err()
+}
+
+func parseError(msg string) error {
+	if msg == fsnotify.ErrEventOverflow.Error() {
+		return fsnotify.ErrEventOverflow
+	}
+	return errors.New(msg)
+}
+
+var ops = map[string]fsnotify.Op{
+	"CREATE":      fsnotify.Create,
+	"WRITE":       fsnotify.Write,
+	"REMOVE":      fsnotify.Remove,
+	"RENAME":      fsnotify.Rename,
+	"CHMOD":       fsnotify.Chmod,
+	"TRUNCATE":    fsnotify.Truncate,
+	"SETTLED":     fsnotify.Settled,
+	"CLOSE_WRITE": fsnotify.CloseWrite,
+	"REPLACED":    fsnotify.Replaced,
+}
+
+// parseOp parses the output of Op.String(); unknown operations are ignored.
+func parseOp(s string) fsnotify.Op {
+	var op fsnotify.Op
+	for _, o := range strings.Split(s, "|") {
+		op |= ops[o]
+	}
+	return op
+}
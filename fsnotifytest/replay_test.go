@@ -0,0 +1,93 @@
+package fsnotifytest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestRecordReplay(t *testing.T) {
+	want := []interface{}{
+		fsnotify.Event{Name: "/file", Op: fsnotify.Create},
+		fsnotify.ErrEventOverflow,
+		fsnotify.Event{Name: "/file", Op: fsnotify.Write | fsnotify.Chmod},
+	}
+
+	// Record events from a fake watcher.
+	var (
+		buf  bytes.Buffer
+		fake = NewWatcher()
+		rec  = NewRecorder(fake, &buf)
+	)
+	if err := rec.Add("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if !fake.Watching("/dir") {
+		t.Error("Add() not passed on")
+	}
+	go func() {
+		for _, w := range want {
+			switch w := w.(type) {
+			case fsnotify.Event:
+				fake.SendEvent(w)
+			case error:
+				fake.SendError(w)
+			}
+		}
+	}()
+	var have []interface{}
+	for len(have) < len(want) {
+		select {
+		case e := <-rec.Events:
+			have = append(have, e)
+		case err := <-rec.Errors:
+			have = append(have, err)
+		}
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("recorder:\nhave: %v\nwant: %v", have, want)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != len(want) {
+		t.Fatalf("recorded %d lines:\n%s", n, buf.String())
+	}
+
+	// Replay them.
+	replay := NewWatcher()
+	errCh := make(chan error, 1)
+	go func() { errCh <- Replay(&buf, replay, 0) }()
+	have = nil
+	for len(have) < len(want) {
+		select {
+		case e := <-replay.Events:
+			have = append(have, e)
+		case err := <-replay.Errors:
+			have = append(have, err)
+		}
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("replay:\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestReplayInvalid(t *testing.T) {
+	w := NewWatcher()
+	defer w.Close()
+	go func() {
+		for range w.Events {
+		}
+	}()
+
+	err := Replay(strings.NewReader("{}\n\nnot json\n"), w, 0)
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
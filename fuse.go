@@ -0,0 +1,33 @@
+package fsnotify
+
+import (
+	"errors"
+)
+
+// ErrFUSE is matched by errors.Is() for a FUSEError.
+var ErrFUSE = errors.New("fsnotify: path is on a FUSE filesystem")
+
+// FUSEError is returned by AddWith() with WithoutFUSE() for a path on a FUSE
+// filesystem, such as sshfs or rclone. The kernel only sends events for
+// changes made through the local mount; changes made on the other side (for
+// example on the SSH server) are never seen.
+type FUSEError struct {
+	Path   string // Path that was added.
+	FSType string // Filesystem type, such as "fuse.sshfs" or "macfuse".
+}
+
+func (e *FUSEError) Error() string {
+	return "fsnotify: " + e.Path + " is on a FUSE filesystem (" + e.FSType + "); changes made elsewhere aren't seen"
+}
+
+// Is reports if target is ErrFUSE.
+func (e *FUSEError) Is(target error) bool { return target == ErrFUSE }
+
+// checkFUSE returns a *FUSEError if path is on a FUSE filesystem, for
+// WithoutFUSE().
+func checkFUSE(path string) error {
+	if fsType, ok := fuseType(path); ok {
+		return &FUSEError{Path: path, FSType: fsType}
+	}
+	return nil
+}
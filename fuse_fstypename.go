@@ -0,0 +1,21 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package fsnotify
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// fuseType returns the filesystem type if path is on a FUSE filesystem:
+// "macfuse" or "osxfuse" on macOS, and "fusefs" on FreeBSD.
+func fuseType(path string) (string, bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	name := unix.ByteSliceToString(st.Fstypename[:])
+	return name, strings.Contains(name, "fuse")
+}
@@ -0,0 +1,27 @@
+package fsnotify
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// fuseType returns the filesystem type if path is on a FUSE filesystem.
+func fuseType(path string) (string, bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil || st.Type != unix.FUSE_SUPER_MAGIC {
+		return "", false
+	}
+	// The name of the filesystem is only in the mount list; statfs() only has
+	// the magic number for FUSE.
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "fuse", true
+	}
+	if mounts, err := readMountList(); err == nil {
+		if m := mountOn(mounts, abs); m != nil {
+			return m.fsType, true
+		}
+	}
+	return "fuse", true
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package fsnotify
+
+// fuseType always returns false, as FUSE filesystems can't be detected on this
+// platform.
+func fuseType(path string) (string, bool) { return "", false }
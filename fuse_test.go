@@ -0,0 +1,46 @@
+package fsnotify
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestFUSEError(t *testing.T) {
+	var err error = &FUSEError{Path: "/mnt/remote", FSType: "fuse.sshfs"}
+	err = fmt.Errorf("add: %w", err)
+	if !errors.Is(err, ErrFUSE) {
+		t.Error("not ErrFUSE")
+	}
+	var fe *FUSEError
+	if !errors.As(err, &fe) || fe.FSType != "fuse.sshfs" {
+		t.Errorf("errors.As: %v", fe)
+	}
+	if k := ErrorKindOf(err); k != KindUnsupported {
+		t.Errorf("kind: %s", k)
+	}
+}
+
+func TestWithoutFUSE(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "windows", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+	default:
+		t.Skip("no backend")
+	}
+
+	tmp := t.TempDir()
+	if _, ok := fuseType(tmp); ok {
+		t.Skip("temporary directory is on FUSE")
+	}
+	w := newWatcher(t)
+	defer w.Close()
+	if err := w.AddWith(tmp, WithoutFUSE()); err != nil {
+		t.Fatal(err)
+	}
+	want := []WatchSpec{{Path: tmp, NoFUSE: true}}
+	if have := w.Export(); !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	}
+}
@@ -0,0 +1,83 @@
+package fsnotify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GapError is sent on the Errors channel when events were dropped, so that the
+// program can re-scan the affected paths to find what it missed.
+//
+// errors.Is() reports why they were dropped: ErrEventOverflow if the kernel
+// queue, the queue of the Windows watcher, or the buffer of a Broadcaster
+// consumer was full, or ErrQuota if a watch group exceeded its MaxEvents.
+type GapError struct {
+	// Number of events that were dropped, or 0 if this isn't known.
+	Dropped int
+
+	// Watched paths events were dropped for, or the directories of the
+	// dropped events for a Broadcaster consumer; empty if this isn't known.
+	Roots []string
+
+	// Reason the events were dropped.
+	Err error
+}
+
+func (e *GapError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Err.Error())
+	if e.Dropped > 0 {
+		fmt.Fprintf(&b, ": %d events dropped", e.Dropped)
+	} else {
+		b.WriteString(": events dropped")
+	}
+	if len(e.Roots) > 0 {
+		b.WriteString(" for ")
+		b.WriteString(strings.Join(e.Roots, ", "))
+	}
+	return b.String()
+}
+
+func (e *GapError) Unwrap() error { return e.Err }
+
+// gap counts dropped events until they're reported with a *GapError.
+type gap struct {
+	dropped int
+	roots   map[string]struct{}
+}
+
+// add records a dropped event for root, which may be empty if it's not known.
+func (g *gap) add(root string) {
+	g.dropped++
+	if root == "" {
+		return
+	}
+	if g.roots == nil {
+		g.roots = make(map[string]struct{})
+	}
+	g.roots[root] = struct{}{}
+}
+
+// take returns a *GapError for the dropped events and resets the count, or nil
+// if nothing was dropped.
+func (g *gap) take(err error) error {
+	if g.dropped == 0 {
+		return nil
+	}
+	gerr := &GapError{Dropped: g.dropped, Err: err}
+	if len(g.roots) > 0 {
+		gerr.Roots = sortedRoots(g.roots)
+	}
+	*g = gap{}
+	return gerr
+}
+
+func sortedRoots(roots map[string]struct{}) []string {
+	l := make([]string, 0, len(roots))
+	for r := range roots {
+		l = append(l, r)
+	}
+	sort.Strings(l)
+	return l
+}
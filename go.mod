@@ -2,7 +2,10 @@ module github.com/fsnotify/fsnotify
 
 go 1.16
 
-require golang.org/x/sys v0.0.0-20220731174439-a90be440212d
+require (
+	golang.org/x/sys v0.0.0-20220731174439-a90be440212d
+	golang.org/x/text v0.3.8
+)
 
 retract (
 	v1.5.3 // Published an incorrect branch accidentally https://github.com/fsnotify/fsnotify/issues/445
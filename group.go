@@ -0,0 +1,112 @@
+package fsnotify
+
+import (
+	"path/filepath"
+)
+
+// WatchGroup is a named set of watches, which can be added, removed, paused,
+// and listed together; for example all watches for one tenant of a server.
+//
+// The Group field is set to the name of the group for the events of these
+// watches. A WatchGroup is only a handle: the group consists of all watches
+// that were added with its name, either through the group or with
+// WithGroup().
+type WatchGroup struct {
+	w    *Watcher
+	name string
+}
+
+// Group returns the watch group name. It's safe to call this more than once
+// for the same name.
+func (w *Watcher) Group(name string) *WatchGroup {
+	return &WatchGroup{w: w, name: name}
+}
+
+// Name returns the name of the group.
+func (g *WatchGroup) Name() string { return g.name }
+
+// Add starts watching the named file or directory as part of the group.
+func (g *WatchGroup) Add(name string) error { return g.AddWith(name) }
+
+// AddWith is like Add, but allows adding options.
+func (g *WatchGroup) AddWith(name string, opts ...AddOption) error {
+	return g.w.AddWith(name, append(opts, WithGroup(g.name))...)
+}
+
+// WatchList returns the paths of the watches in the group, in the form they
+// can be passed to Watcher.Remove(): recursive watches end in "/...".
+func (g *WatchGroup) WatchList() []string {
+	var paths []string
+	for _, s := range g.w.Export() {
+		if s.Group != g.name {
+			continue
+		}
+		if s.Recursive {
+			paths = append(paths, filepath.Join(s.Path, "..."))
+		} else {
+			paths = append(paths, s.Path)
+		}
+	}
+	return paths
+}
+
+// RemoveAll removes all watches in the group. It tries to remove all of them
+// even if one fails, and returns the first error.
+func (g *WatchGroup) RemoveAll() error {
+	var err error
+	for _, p := range g.WatchList() {
+		if rmErr := g.w.Remove(p); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
+
+// Pause drops all events for the watches in the group until Resume() is called.
+// This includes watches that are added to the group while it's paused. Events
+// that happen while the group is paused are not sent later.
+func (g *WatchGroup) Pause() { g.w.pauseGroup(g.name, true) }
+
+// Resume sends events for the watches in the group again after Pause().
+func (g *WatchGroup) Resume() { g.w.pauseGroup(g.name, false) }
+
+// Paused reports if the group is paused.
+func (g *WatchGroup) Paused() bool { return g.w.groupPaused(g.name) }
+
+// SetQuota limits the number of watches and events for the group; a zero
+// GroupQuota removes the limits.
+//
+// Adding a watch that would exceed MaxWatches fails with a *QuotaError, and
+// new directories in recursive watches (and new files with kqueue) aren't
+// watched once the group is at MaxWatches; a *QuotaError is sent on the Errors
+// channel the first time that happens. Events over MaxEvents are dropped, and
+// a *QuotaError is sent the first time one is dropped.
+//
+// Watches that already exist when the quota is set are not removed.
+func (g *WatchGroup) SetQuota(q GroupQuota) { g.w.setGroupQuota(g.name, q) }
+
+// Watches returns the number of watches the system uses for the group, as
+// counted for GroupQuota.MaxWatches.
+func (g *WatchGroup) Watches() int { return g.w.groupWatches(g.name) }
+
+// pause pauses or resumes the group name.
+func (p *pipeline) pause(name string, paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !paused {
+		delete(p.paused, name)
+		return
+	}
+	if p.paused == nil {
+		p.paused = make(map[string]struct{})
+	}
+	p.paused[name] = struct{}{}
+}
+
+// isPaused reports if the group name is paused.
+func (p *pipeline) isPaused(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.paused[name]
+	return ok
+}
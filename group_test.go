@@ -0,0 +1,77 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchGroup(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "a")
+	mkdir(t, tmp, "b")
+	mkdir(t, tmp, "c")
+
+	w := newWatcher(t)
+	defer w.Close()
+	g := w.Group("tenant-42")
+	if err := g.Add(filepath.Join(tmp, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddWith(filepath.Join(tmp, "b", "...")); err != nil {
+		t.Fatal(err)
+	}
+	addWatch(t, w, tmp, "c")
+
+	next := func() (Event, bool) {
+		select {
+		case e := <-w.Events:
+			return e, true
+		case err := <-w.Errors:
+			t.Fatal(err)
+		case <-time.After(200 * time.Millisecond):
+		}
+		return Event{}, false
+	}
+
+	want := []string{filepath.Join(tmp, "a"), filepath.Join(tmp, "b", "...")}
+	if have := g.WatchList(); !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+
+	touch(t, tmp, "a", "file")
+	if e, ok := next(); !ok || e.Group != "tenant-42" {
+		t.Errorf("wrong event: %#v", e)
+	}
+	touch(t, tmp, "c", "file")
+	if e, ok := next(); !ok || e.Group != "" {
+		t.Errorf("wrong event: %#v", e)
+	}
+
+	g.Pause()
+	if !g.Paused() || !w.Group("tenant-42").Paused() {
+		t.Error("not paused")
+	}
+	touch(t, tmp, "b", "file")
+	if e, ok := next(); ok {
+		t.Errorf("event for paused group: %v", e)
+	}
+	g.Resume()
+	touch(t, tmp, "b", "file2")
+	if e, ok := next(); !ok || e.Name != filepath.Join(tmp, "b", "file2") || e.Group != "tenant-42" {
+		t.Errorf("wrong event: %#v", e)
+	}
+
+	if err := g.RemoveAll(); err != nil {
+		t.Fatal(err)
+	}
+	if have := g.WatchList(); len(have) != 0 {
+		t.Errorf("not removed: %v", have)
+	}
+	if have, want := w.Export(), []WatchSpec{{Path: filepath.Join(tmp, "c")}}; !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+}
@@ -0,0 +1,128 @@
+package fsnotify
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"runtime/pprof"
+	"sync"
+)
+
+// hashWorkers is the maximum number of files that are hashed at the same time
+// for WithContentHash().
+const hashWorkers = 4
+
+// hashCache drops Write events for files whose content didn't change, for
+// WithContentHash().
+//
+// Files are hashed in a new goroutine, so that reading large or slow files
+// doesn't block reading events from the kernel. Any events for a file that
+// arrive while it's being hashed are queued, so the order of events for a
+// single file is preserved.
+type hashCache struct {
+	sem     chan struct{} // Limits the number of files hashed at the same time.
+	mu      sync.Mutex    // Protects sums and pending.
+	sums    map[string][sha256.Size]byte
+	pending map[string][]Event // Events queued while a file is hashed (key: path).
+}
+
+func newHashCache() *hashCache {
+	return &hashCache{
+		sem:     make(chan struct{}, hashWorkers),
+		sums:    make(map[string][sha256.Size]byte),
+		pending: make(map[string][]Event),
+	}
+}
+
+// send sends the event e with emit, unless it's a Write for a file that has
+// the same content as the last time it was hashed.
+// Returns false if the watcher is closed.
+func (h *hashCache) send(e Event, maxSize int64, emit func(Event) bool, labels pprof.LabelSet) bool {
+	h.mu.Lock()
+	if q, ok := h.pending[e.Name]; ok {
+		h.pending[e.Name] = append(q, e)
+		h.mu.Unlock()
+		return true
+	}
+	if !e.Has(Write) {
+		h.forget(e)
+		h.mu.Unlock()
+		return emit(e)
+	}
+	h.pending[e.Name] = nil
+	h.mu.Unlock()
+
+	h.sem <- struct{}{}
+	goLabeled(labels, "hash", func() {
+		defer func() { <-h.sem }()
+		h.drain(e, maxSize, emit)
+	})
+	return true
+}
+
+// drain sends e if it changed the file, and then everything that was queued
+// for the same file.
+func (h *hashCache) drain(e Event, maxSize int64, emit func(Event) bool) {
+	for {
+		if !e.Has(Write) || h.changed(e.Name, maxSize) {
+			if !emit(e) {
+				h.mu.Lock()
+				delete(h.pending, e.Name)
+				h.mu.Unlock()
+				return
+			}
+		}
+
+		h.mu.Lock()
+		q := h.pending[e.Name]
+		if len(q) == 0 {
+			delete(h.pending, e.Name)
+			h.mu.Unlock()
+			return
+		}
+		e, h.pending[e.Name] = q[0], q[1:]
+		h.forget(e)
+		h.mu.Unlock()
+	}
+}
+
+// forget removes the stored hash if e creates, removes, or renames the file.
+//
+// Must be called with h.mu locked.
+func (h *hashCache) forget(e Event) {
+	if e.Op&(Create|Remove|Rename) != 0 {
+		delete(h.sums, e.Name)
+	}
+}
+
+// changed hashes the file, and reports if the hash is different from the
+// previous time. Files larger than maxSize, or that can't be read, are always
+// reported as changed.
+func (h *hashCache) changed(path string, maxSize int64) bool {
+	fp, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer fp.Close()
+
+	fi, err := fp.Stat()
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() > maxSize {
+		h.mu.Lock()
+		delete(h.sums, path)
+		h.mu.Unlock()
+		return true
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.LimitReader(fp, maxSize+1)); err != nil {
+		return true
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prev, ok := h.sums[path]
+	h.sums[path] = sum
+	return !ok || prev != sum
+}
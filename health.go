@@ -0,0 +1,94 @@
+package fsnotify
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WatchStatus is the state of a watch, as reported by Watcher.Check().
+type WatchStatus uint8
+
+const (
+	// WatchOK is a watch that is still live.
+	WatchOK WatchStatus = iota
+
+	// WatchRestored is a watch that was lost and has been added again; for
+	// example because the directory was replaced, or the filesystem it was
+	// on was unmounted. Events from before the watch was restored are lost.
+	WatchRestored
+
+	// WatchBroken is a watch that was lost and couldn't be added again; for
+	// example because the path no longer exists. The watch is kept, and a
+	// later check restores it if it can.
+	WatchBroken
+)
+
+func (s WatchStatus) String() string {
+	switch s {
+	case WatchOK:
+		return "ok"
+	case WatchRestored:
+		return "restored"
+	case WatchBroken:
+		return "broken"
+	}
+	return fmt.Sprintf("WatchStatus(%d)", s)
+}
+
+// WatchHealth is the state of a watch added with Add() or AddWith().
+type WatchHealth struct {
+	Path   string // As passed to Add(), with "/..." for recursive watches.
+	Status WatchStatus
+	Err    error // Why the watch couldn't be added again; only set for WatchBroken.
+}
+
+func (h WatchHealth) String() string {
+	if h.Err != nil {
+		return fmt.Sprintf("%s: %s: %s", h.Path, h.Status, h.Err)
+	}
+	return fmt.Sprintf("%s: %s", h.Path, h.Status)
+}
+
+func sortWatchHealth(health []WatchHealth) {
+	sort.Slice(health, func(i, j int) bool { return health[i].Path < health[j].Path })
+}
+
+// CheckEvery runs Check() every interval in the background, until the
+// returned function is called or the watcher is closed.
+//
+// report is called with the watches that were restored or are broken, if any.
+// It's called from the background goroutine, and may be nil.
+func (w *Watcher) CheckEvery(interval time.Duration, report func([]WatchHealth)) (stop func()) {
+	var (
+		done = make(chan struct{})
+		once sync.Once
+	)
+	goLabeled(w.goroutineLabels(), "health", func() {
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+			}
+
+			health, err := w.Check()
+			if err != nil {
+				return
+			}
+			var lost []WatchHealth
+			for _, h := range health {
+				if h.Status != WatchOK {
+					lost = append(lost, h)
+				}
+			}
+			if len(lost) > 0 && report != nil {
+				report(lost)
+			}
+		}
+	})
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -239,6 +239,25 @@ func chmod(t *testing.T, mode fs.FileMode, path ...string) {
 	}
 }
 
+// chdir changes the working directory to path until the test ends. Tests that
+// use this can't be parallel, as the working directory is for the entire
+// process.
+func chdir(t *testing.T, path ...string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("chdir: %s", err)
+	}
+	if err := os.Chdir(filepath.Join(path...)); err != nil {
+		t.Fatalf("chdir(%q): %s", filepath.Join(path...), err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatalf("chdir(%q): %s", wd, err)
+		}
+	})
+}
+
 // Collect all events in an array.
 //
 // w := newCollector(t)
@@ -401,6 +420,14 @@ func newEvents(t *testing.T, s string) Events {
 					op |= Rename
 				case "CHMOD":
 					op |= Chmod
+				case "TRUNCATE":
+					op |= Truncate
+				case "SETTLED":
+					op |= Settled
+				case "CLOSE_WRITE":
+					op |= CloseWrite
+				case "REPLACED":
+					op |= Replaced
 				default:
 					t.Fatalf("newEvents: line %d has unknown event %q: %s", no, ee, line)
 				}
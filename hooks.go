@@ -0,0 +1,39 @@
+package fsnotify
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// PanicError is sent on the Errors channel when a function passed to
+// Watcher.Use(), Watcher.Subscribe(), or Watcher.OnBackpressure() panics,
+// rather than crashing the program or stopping all events. The event the
+// function was called for is dropped (Use), or not sent to the subscription
+// (Subscribe).
+type PanicError struct {
+	Func  string      // "Use", "Subscribe", or "OnBackpressure".
+	Value interface{} // Value passed to panic().
+	Stack string      // Stack trace of the panic.
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("fsnotify: function passed to %s() panicked: %v", e.Func, e.Value)
+}
+
+// callHook calls f, which calls a function passed to the method name. It
+// returns false if that panicked, after sending a *PanicError.
+func (p *pipeline) callHook(name string, f func()) (ok bool) {
+	defer func() {
+		if ok {
+			return
+		}
+		r := recover()
+		buf := make([]byte, 8192)
+		err := &PanicError{Func: name, Value: r, Stack: string(buf[:runtime.Stack(buf, false)])}
+		if p.sendErr != nil {
+			p.sendErr(err)
+		}
+	}()
+	f()
+	return true
+}
@@ -0,0 +1,168 @@
+package fsnotify
+
+import (
+	"path"
+	"strings"
+)
+
+// ignoreRule is a single line from a gitignore file.
+type ignoreRule struct {
+	line     string   // Original line, for Export().
+	pattern  []string // Pattern, split on "/".
+	negate   bool     // Starts with "!": re-include paths excluded by earlier rules.
+	dirOnly  bool     // Ends with "/": match only directories.
+	anchored bool     // Contains a "/": match relative to the root, rather than any name.
+}
+
+// ignoreRules is a list of rules in the gitignore format; later rules take
+// precedence over earlier ones.
+type ignoreRules []ignoreRule
+
+// parseIgnore parses lines in the gitignore format; blank lines and comments
+// are skipped. Every line may contain several rules separated by newlines.
+func parseIgnore(lines ...string) ignoreRules {
+	var rules ignoreRules
+	for _, l := range lines {
+		for _, line := range strings.Split(l, "\n") {
+			if r, ok := parseIgnoreRule(line); ok {
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	// Trailing spaces are ignored unless they're escaped with a backslash.
+	p := strings.TrimRight(line, " ")
+	if strings.HasSuffix(p, `\`) && len(p) < len(line) {
+		p += " "
+	}
+	if p == "" || p[0] == '#' {
+		return ignoreRule{}, false
+	}
+
+	r := ignoreRule{line: line}
+	switch {
+	case p[0] == '!':
+		r.negate, p = true, p[1:]
+	case strings.HasPrefix(p, `\#`), strings.HasPrefix(p, `\!`):
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly, p = true, strings.TrimRight(p, "/")
+	}
+	if strings.Contains(p, "/") {
+		r.anchored, p = true, strings.TrimLeft(p, "/")
+	}
+	if p == "" {
+		return ignoreRule{}, false
+	}
+	r.pattern = strings.Split(p, "/")
+	return r, true
+}
+
+// parseGlobs parses the patterns for WithInclude() and WithExclude(). These
+// are matched like gitignore rules, but "!" and "#" have no special meaning.
+func parseGlobs(patterns ...string) ignoreRules {
+	rules := make(ignoreRules, 0, len(patterns))
+	for _, p := range patterns {
+		r := ignoreRule{line: p}
+		if strings.HasSuffix(p, "/") {
+			r.dirOnly, p = true, strings.TrimRight(p, "/")
+		}
+		if strings.Contains(p, "/") {
+			r.anchored, p = true, strings.TrimLeft(p, "/")
+		}
+		if p == "" {
+			continue
+		}
+		r.pattern = strings.Split(p, "/")
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// match reports if the path, split on "/" and relative to the root of the
+// watch, is ignored. Only the last element is matched; the caller must check
+// the parent directories, as nothing in an ignored directory can be
+// re-included.
+func (rules ignoreRules) match(parts []string, isDir bool) bool {
+	ignored := false
+	for _, r := range rules {
+		if r.negate != ignored {
+			continue // Can't change the result.
+		}
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.anchored {
+			if matchSegments(r.pattern, parts) {
+				ignored = !r.negate
+			}
+			continue
+		}
+		if ok, _ := path.Match(r.pattern[0], parts[len(parts)-1]); ok {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// lower returns a copy of the rules with the patterns in lower case, for
+// case-insensitive matching.
+func (rules ignoreRules) lower() ignoreRules {
+	if len(rules) == 0 {
+		return rules
+	}
+	l := make(ignoreRules, len(rules))
+	for i, r := range rules {
+		r.pattern = append([]string(nil), r.pattern...)
+		for j := range r.pattern {
+			r.pattern[j] = strings.ToLower(r.pattern[j])
+		}
+		l[i] = r
+	}
+	return l
+}
+
+// lines returns the original lines of all rules.
+func (rules ignoreRules) lines() []string {
+	if len(rules) == 0 {
+		return nil
+	}
+	l := make([]string, 0, len(rules))
+	for _, r := range rules {
+		l = append(l, r.line)
+	}
+	return l
+}
+
+// matchSegments matches a pattern split on "/" against a path split on "/",
+// where a "**" element matches zero or more path elements.
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				// "dir/**" matches everything inside dir, but not dir itself.
+				return len(parts) > 0
+			}
+			for i := range parts {
+				if matchSegments(pattern, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
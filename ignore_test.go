@@ -0,0 +1,103 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		rules string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"*.tmp", "file.tmp", false, true},
+		{"*.tmp", "sub/file.tmp", false, true},
+		{"*.tmp", "file.go", false, false},
+		{"# *.tmp", "file.tmp", false, false},
+		{`\#file`, "#file", false, true},
+
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "sub/build", true, true},
+
+		{"/build", "build", true, true},
+		{"/build", "sub/build", true, false},
+		{"sub/build", "sub/build", false, true},
+		{"sub/build", "x/sub/build", false, false},
+
+		{"**/build", "build", true, true},
+		{"**/build", "a/b/build", true, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**", "a", true, false},
+		{"a/**", "a/x", false, true},
+
+		{"*.log\n!keep.log", "keep.log", false, false},
+		{"*.log\n!keep.log", "other.log", false, true},
+		{"!keep.log\n*.log", "keep.log", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rules+"/"+tt.path, func(t *testing.T) {
+			have := parseIgnore(tt.rules).match(strings.Split(tt.path, "/"), tt.isDir)
+			if have != tt.want {
+				t.Errorf("have %t; want %t", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnorePresets(t *testing.T) {
+	t.Parallel()
+
+	rules := parseIgnore(append(append(append(
+		IgnoreEditors.Rules(), IgnoreOS.Rules()...), IgnoreVCS.Rules()...), IgnoreBuildDirs.Rules()...)...)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{".file.go.swp", false, true},
+		{"#file.go#", false, true},
+		{"file.go___jb_tmp___", false, true},
+		{"sub/.DS_Store", false, true},
+		{".git", true, true},
+		{"node_modules", true, true},
+		{"target", false, false},
+		{"file.go", false, false},
+		{"#file.go", false, false},
+	}
+
+	for _, tt := range tests {
+		have := rules.match(strings.Split(tt.path, "/"), tt.isDir)
+		if have != tt.want {
+			t.Errorf("%s: have %t; want %t", tt.path, have, tt.want)
+		}
+	}
+}
+
+func TestExcludeDir(t *testing.T) {
+	root := filepath.FromSlash("/root")
+	for _, tt := range []struct {
+		pattern string
+		skip    bool // For the directory itself.
+	}{
+		{"vendor/", true},
+		{"vendor/**", false},
+	} {
+		with := getOptions(WithExclude(tt.pattern))
+		with.setRoot(root, true)
+		if have := with.skip(filepath.Join(root, "vendor"), true); have != tt.skip {
+			t.Errorf("%q: skip(vendor) = %t; want %t", tt.pattern, have, tt.skip)
+		}
+		if !with.skip(filepath.Join(root, "vendor", "lib.go"), false) {
+			t.Errorf("%q: vendor/lib.go not skipped", tt.pattern)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package fsnotify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Journal is a write-ahead log of events on disk.
+//
+// Every event gets a sequence number and is synced to disk before it's
+// delivered; a consumer acknowledges the events it processed with Ack(). After
+// a crash or restart the consumer can get everything it didn't acknowledge
+// with Since(Acked()), turning the watcher into a reliable change feed.
+//
+// The journal is stored in the file passed to OpenJournal(), and the last
+// acknowledged sequence number in the same file with ".ack" appended.
+type Journal struct {
+	// Entries sends the journaled events after Run() is called.
+	Entries chan JournalEntry
+
+	// Errors sends errors from the watcher and from writing the journal after
+	// Run() is called.
+	Errors chan error
+
+	mu    sync.Mutex // Protects everything below.
+	path  string
+	fp    *os.File
+	seq   uint64 // Last written sequence number.
+	acked uint64 // Last acknowledged sequence number.
+}
+
+// JournalEntry is a single event in a Journal.
+type JournalEntry struct {
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Event Event     `json:"-"`
+}
+
+type journalLine struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Name string    `json:"name"`
+	Op   Op        `json:"op"`
+}
+
+// OpenJournal opens the journal at path, creating it if it doesn't exist yet.
+//
+// An incomplete entry at the end of the file (e.g. from a crash while writing
+// it) is discarded.
+func OpenJournal(path string) (*Journal, error) {
+	fp, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		Entries: make(chan JournalEntry),
+		Errors:  make(chan error),
+		path:    path,
+		fp:      fp,
+	}
+
+	// Find the last sequence number, and the end of the last complete line.
+	var (
+		r    = bufio.NewReader(fp)
+		size int64
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fp.Close()
+			return nil, err
+		}
+
+		var l journalLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			fp.Close()
+			return nil, fmt.Errorf("fsnotify: corrupt journal %q at offset %d: %w", path, size, err)
+		}
+		j.seq = l.Seq
+		size += int64(len(line))
+	}
+	if err := fp.Truncate(size); err != nil {
+		fp.Close()
+		return nil, err
+	}
+	if _, err := fp.Seek(size, io.SeekStart); err != nil {
+		fp.Close()
+		return nil, err
+	}
+
+	ack, err := os.ReadFile(path + ".ack")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fp.Close()
+		return nil, err
+	}
+	if len(ack) > 0 {
+		j.acked, err = strconv.ParseUint(strings.TrimSpace(string(ack)), 10, 64)
+		if err != nil {
+			fp.Close()
+			return nil, fmt.Errorf("fsnotify: corrupt journal ack file %q: %w", path+".ack", err)
+		}
+	}
+	// Compact() may have removed all entries, so continue from the last
+	// acknowledged entry if that's higher.
+	if j.acked > j.seq {
+		j.seq = j.acked
+	}
+	return j, nil
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.fp.Close()
+}
+
+// Append writes the event e to the journal and syncs it to disk, returning
+// the entry that was written.
+func (j *Journal) Append(e Event) (JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	l := journalLine{Seq: j.seq + 1, Time: time.Now(), Name: e.Name, Op: e.Op}
+	line, err := json.Marshal(l)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	if _, err := j.fp.Write(append(line, '\n')); err != nil {
+		return JournalEntry{}, err
+	}
+	if err := j.fp.Sync(); err != nil {
+		return JournalEntry{}, err
+	}
+	j.seq = l.Seq
+	return JournalEntry{Seq: l.Seq, Time: l.Time, Event: e}, nil
+}
+
+// Ack marks all entries up to and including seq as processed.
+func (j *Journal) Ack(seq uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if seq <= j.acked {
+		return nil
+	}
+	if seq > j.seq {
+		return fmt.Errorf("fsnotify: can't acknowledge %d: last sequence number is %d", seq, j.seq)
+	}
+
+	tmp := j.path + ".ack.tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(seq, 10)+"\n"), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path+".ack"); err != nil {
+		return err
+	}
+	j.acked = seq
+	return nil
+}
+
+// Acked returns the last acknowledged sequence number.
+func (j *Journal) Acked() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.acked
+}
+
+// Since returns all entries with a sequence number higher than seq.
+func (j *Journal) Since(seq uint64) ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.since(seq)
+}
+
+// since implements Since(); j.mu must be held.
+func (j *Journal) since(seq uint64) ([]JournalEntry, error) {
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []JournalEntry
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var l journalLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			return nil, err
+		}
+		if l.Seq > seq {
+			entries = append(entries, JournalEntry{Seq: l.Seq, Time: l.Time, Event: Event{Name: l.Name, Op: l.Op}})
+		}
+	}
+	return entries, nil
+}
+
+// Compact removes all acknowledged entries from the journal file.
+func (j *Journal) Compact() error {
+	// Hold the lock for the entire compaction, so that nothing can be
+	// appended between reading and replacing the file.
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.since(j.acked)
+	if err != nil {
+		return err
+	}
+
+	tmp := j.path + ".tmp"
+	fp, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		line, err := json.Marshal(journalLine{Seq: e.Seq, Time: e.Time, Name: e.Event.Name, Op: e.Event.Op})
+		if err != nil {
+			fp.Close()
+			return err
+		}
+		if _, err := fp.Write(append(line, '\n')); err != nil {
+			fp.Close()
+			return err
+		}
+	}
+	if err := fp.Sync(); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		fp.Close()
+		return err
+	}
+	j.fp.Close()
+	j.fp = fp
+	return nil
+}
+
+// Run journals all events from the watcher w and sends them on the Entries
+// channel, until the watcher is closed or ctx is cancelled. Entries and Errors
+// are closed when Run returns.
+//
+// Events are written to the journal before they're sent on Entries, so if the
+// program crashes any event it didn't acknowledge can be retrieved with
+// Since(Acked()) on the next start.
+func (j *Journal) Run(ctx context.Context, w *Watcher) {
+	defer close(j.Errors)
+	defer close(j.Entries)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			select {
+			case j.Errors <- err:
+			case <-ctx.Done():
+				return
+			}
+		case e, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			entry, err := j.Append(e)
+			if err != nil {
+				select {
+				case j.Errors <- err:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			select {
+			case j.Entries <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package fsnotify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "journal")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Event{{Name: "/a", Op: Create}, {Name: "/a", Op: Write}, {Name: "/b", Op: Remove}} {
+		if _, err := j.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Ack(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Ack(4); err == nil {
+		t.Error("no error acknowledging unwritten entry")
+	}
+	j.Close()
+
+	// Simulate a crash while writing an entry.
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp.WriteString(`{"seq":4,"na`)
+	fp.Close()
+
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if j.Acked() != 1 {
+		t.Fatalf("Acked() = %d; want 1", j.Acked())
+	}
+	entries, err := j.Since(j.Acked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Seq != 2 || entries[0].Event.String() != `"/a": WRITE` ||
+		entries[1].Seq != 3 || entries[1].Event.String() != `"/b": REMOVE` {
+		t.Fatalf("wrong entries: %v", entries)
+	}
+
+	e, err := j.Append(Event{Name: "/c", Op: Create})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Seq != 4 {
+		t.Fatalf("seq = %d; want 4", e.Seq)
+	}
+
+	if err := j.Ack(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = j.Since(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Seq != 4 {
+		t.Fatalf("wrong entries after Compact(): %v", entries)
+	}
+
+	// Sequence numbers continue after compacting away all entries.
+	if err := j.Ack(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	e, err = j.Append(Event{Name: "/d", Op: Create})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Seq != 5 {
+		t.Fatalf("seq after reopen = %d; want 5", e.Seq)
+	}
+}
+
+func TestJournalRun(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	j, err := OpenJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	w := newWatcher(t, tmp)
+	go j.Run(context.Background(), w)
+
+	touch(t, tmp, "file")
+	e := <-j.Entries
+	if e.Seq != 1 || e.Event.Name != filepath.Join(tmp, "file") || !e.Event.Has(Create) {
+		t.Fatalf("wrong entry: %v", e)
+	}
+	w.Close()
+	for range j.Entries {
+	}
+
+	entries, err := j.Since(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("wrong entries: %v", entries)
+	}
+
+	// Return when the context is cancelled, even if nothing reads the
+	// channels.
+	j2, err := OpenJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j2.Close()
+	w2 := newWatcher(t, tmp)
+	defer w2.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		j2.Run(ctx, w2)
+		close(done)
+	}()
+	touch(t, tmp, "file2")
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't return after the context was cancelled")
+	}
+}
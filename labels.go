@@ -0,0 +1,30 @@
+package fsnotify
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+)
+
+// lastWatcherID is the ID of the last watcher that was created; accessed
+// atomically.
+var lastWatcherID uint64
+
+// watcherLabels returns the pprof labels for the goroutines of a new watcher,
+// and its ID.
+//
+// The goroutines of a watcher have the labels "fsnotify.watcher" (the ID),
+// "fsnotify.backend", and "fsnotify.goroutine" (what the goroutine does), so
+// that goroutine dumps and profiles can be attributed to a watcher.
+func watcherLabels(backend string) (pprof.LabelSet, uint64) {
+	id := atomic.AddUint64(&lastWatcherID, 1)
+	return pprof.Labels("fsnotify.watcher", strconv.FormatUint(id, 10), "fsnotify.backend", backend), id
+}
+
+// goLabeled runs f in a new goroutine with the labels, and name as the
+// "fsnotify.goroutine" label. Goroutines that f starts get the same labels.
+func goLabeled(labels pprof.LabelSet, name string, f func()) {
+	ctx := pprof.WithLabels(context.Background(), labels)
+	go pprof.Do(ctx, pprof.Labels("fsnotify.goroutine", name), func(context.Context) { f() })
+}
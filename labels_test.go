@@ -0,0 +1,56 @@
+package fsnotify
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcherLabels(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "windows", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+	default:
+		t.Skip("no backend")
+	}
+	t.Parallel()
+
+	w, w2 := newWatcher(t), newWatcher(t)
+	defer w.Close()
+	defer w2.Close()
+	if w.ID() == 0 || w.ID() == w2.ID() {
+		t.Fatalf("IDs not unique: %d, %d", w.ID(), w2.ID())
+	}
+
+	want := []string{
+		fmt.Sprintf(`"fsnotify.watcher":"%d"`, w.ID()),
+		fmt.Sprintf(`"fsnotify.watcher":"%d"`, w2.ID()),
+		`"fsnotify.goroutine":"reader"`,
+	}
+	missing := func(profile string) []string {
+		var m []string
+		for _, l := range want {
+			if !strings.Contains(profile, l) {
+				m = append(m, l)
+			}
+		}
+		return m
+	}
+
+	// The goroutines may not have started yet.
+	var buf bytes.Buffer
+	for i := 0; i < 100; i++ {
+		buf.Reset()
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+			t.Fatal(err)
+		}
+		if len(missing(buf.String())) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("%s not in goroutine profile:\n%s", missing(buf.String()), buf.String())
+}
@@ -0,0 +1,86 @@
+package fsnotify
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OpenWatcher describes a watcher that was created but not yet closed; see
+// OpenWatchers().
+type OpenWatcher struct {
+	ID      uint64    // Watcher.ID()
+	Backend string    // Watcher.BackendName()
+	Created time.Time // When NewWatcher() was called.
+	Stack   string    // Stack trace of the NewWatcher() call; only set with TrackWatchers(true).
+}
+
+var openWatchers struct {
+	mu     sync.Mutex
+	stacks bool
+	open   map[uint64]OpenWatcher
+}
+
+// TrackWatchers sets if the stack trace of where watchers are created is
+// recorded, so OpenWatchers() can show where a watcher that was never closed
+// came from. This is off by default, as it makes NewWatcher() slower.
+//
+// It only affects watchers created after it's called.
+func TrackWatchers(stacks bool) {
+	openWatchers.mu.Lock()
+	defer openWatchers.mu.Unlock()
+	openWatchers.stacks = stacks
+}
+
+// LiveWatchers returns the number of watchers that were created and not yet
+// closed.
+func LiveWatchers() int {
+	openWatchers.mu.Lock()
+	defer openWatchers.mu.Unlock()
+	return len(openWatchers.open)
+}
+
+// OpenWatchers returns the watchers that were created and not yet closed,
+// oldest first. This can be used to find leaked watchers, for example by
+// checking it's empty at the end of a test.
+//
+// A watcher that isn't closed is never garbage collected, as its goroutines
+// still refer to it; it keeps using a file descriptor (inotify, kqueue) or
+// handle (Windows) until the program exits.
+func OpenWatchers() []OpenWatcher {
+	openWatchers.mu.Lock()
+	defer openWatchers.mu.Unlock()
+	open := make([]OpenWatcher, 0, len(openWatchers.open))
+	for _, o := range openWatchers.open {
+		open = append(open, o)
+	}
+	sort.Slice(open, func(i, j int) bool { return open[i].ID < open[j].ID })
+	return open
+}
+
+// trackWatcher records that the watcher id was created.
+func trackWatcher(id uint64, backend string) {
+	o := OpenWatcher{ID: id, Backend: backend, Created: time.Now()}
+	openWatchers.mu.Lock()
+	stacks := openWatchers.stacks
+	openWatchers.mu.Unlock()
+	if stacks {
+		buf := make([]byte, 8192)
+		o.Stack = string(buf[:runtime.Stack(buf, false)])
+	}
+
+	openWatchers.mu.Lock()
+	defer openWatchers.mu.Unlock()
+	if openWatchers.open == nil {
+		openWatchers.open = make(map[uint64]OpenWatcher)
+	}
+	openWatchers.open[id] = o
+}
+
+// untrackWatcher records that the watcher id was closed.
+func untrackWatcher(id uint64) {
+	openWatchers.mu.Lock()
+	defer openWatchers.mu.Unlock()
+	delete(openWatchers.open, id)
+}
@@ -0,0 +1,51 @@
+package fsnotify
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestOpenWatchers(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "windows", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+	default:
+		t.Skip("no backend")
+	}
+
+	find := func(id uint64) (OpenWatcher, bool) {
+		for _, o := range OpenWatchers() {
+			if o.ID == id {
+				return o, true
+			}
+		}
+		return OpenWatcher{}, false
+	}
+
+	TrackWatchers(true)
+	w := newWatcher(t)
+	TrackWatchers(false)
+	w2 := newWatcher(t)
+	defer w2.Close()
+
+	if n := LiveWatchers(); n < 2 {
+		t.Errorf("LiveWatchers() = %d, want at least 2", n)
+	}
+	o, ok := find(w.ID())
+	if !ok {
+		t.Fatalf("watcher %d not in OpenWatchers()", w.ID())
+	}
+	if !strings.Contains(o.Stack, "TestOpenWatchers") {
+		t.Errorf("stack doesn't have the caller:\n%s", o.Stack)
+	}
+	if o2, _ := find(w2.ID()); o2.Stack != "" {
+		t.Errorf("stack recorded with TrackWatchers(false):\n%s", o2.Stack)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := find(w.ID()); ok {
+		t.Errorf("closed watcher %d still in OpenWatchers()", w.ID())
+	}
+}
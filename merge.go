@@ -0,0 +1,105 @@
+package fsnotify
+
+import (
+	"sync"
+)
+
+// MultiWatcher combines the Events and Errors of several watchers into one
+// stream.
+type MultiWatcher struct {
+	// Events sends the events from all watchers.
+	Events chan Event
+
+	// Errors sends the errors from all watchers.
+	Errors chan error
+
+	watchers []*Watcher
+	wg       sync.WaitGroup
+	mu       sync.Mutex // Protects closing done.
+	done     chan struct{}
+	doneResp chan struct{}
+}
+
+// Merge combines the events and errors of watchers. The order of events from
+// a single watcher is preserved, but events from different watchers may be
+// interleaved in any order.
+//
+// The watchers shouldn't be read from directly after this. The Events and
+// Errors channels are closed once Close() is called, or all watchers are
+// closed.
+func Merge(watchers ...*Watcher) *MultiWatcher {
+	m := &MultiWatcher{
+		Events:   make(chan Event),
+		Errors:   make(chan error),
+		watchers: watchers,
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	m.wg.Add(len(watchers))
+	for _, w := range watchers {
+		go m.forward(w)
+	}
+	go func() {
+		defer close(m.doneResp)
+		m.wg.Wait()
+		close(m.Events)
+		close(m.Errors)
+	}()
+	return m
+}
+
+// Close closes all watchers, and waits for the Events and Errors channels to
+// be closed. It returns the first error from closing a watcher.
+func (m *MultiWatcher) Close() error {
+	m.mu.Lock()
+	select {
+	case <-m.done:
+		m.mu.Unlock()
+		return nil
+	default:
+	}
+	close(m.done)
+	m.mu.Unlock()
+
+	var err error
+	for _, w := range m.watchers {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	<-m.doneResp
+	return err
+}
+
+// forward sends all events and errors of w until it's closed.
+func (m *MultiWatcher) forward(w *Watcher) {
+	defer m.wg.Done()
+
+	events, errors := w.Events, w.Errors
+	for events != nil || errors != nil {
+		select {
+		case <-m.done:
+			return
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			select {
+			case m.Events <- e:
+			case <-m.done:
+				return
+			}
+		case err, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			select {
+			case m.Errors <- err:
+			case <-m.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	tmp1, tmp2 := t.TempDir(), t.TempDir()
+	m := Merge(newWatcher(t, tmp1), newWatcher(t, tmp2))
+
+	touch(t, tmp1, "file")
+	touch(t, tmp2, "file")
+
+	var have []string
+	for len(have) < 2 {
+		select {
+		case e := <-m.Events:
+			have = append(have, e.Name)
+		case err := <-m.Errors:
+			t.Fatal(err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout; have %q", have)
+		}
+	}
+	sort.Strings(have)
+	want := []string{filepath.Join(tmp1, "file"), filepath.Join(tmp2, "file")}
+	sort.Strings(want)
+	if have[0] != want[0] || have[1] != want[1] {
+		t.Errorf("\nhave: %q\nwant: %q", have, want)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-m.Events; ok {
+		t.Error("Events not closed")
+	}
+	if _, ok := <-m.Errors; ok {
+		t.Error("Errors not closed")
+	}
+}
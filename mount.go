@@ -0,0 +1,178 @@
+package fsnotify
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrMountsNotSupported is returned by NewMountWatcher() on platforms other
+// than Linux.
+var ErrMountsNotSupported = errors.New("fsnotify: watching mounts is not supported on this platform")
+
+// MountEvent is sent by MountWatcher when a filesystem is mounted or
+// unmounted.
+type MountEvent struct {
+	// Path of the mount point.
+	Path string
+
+	// Source of the mount, such as "/dev/sda1" or "tmpfs".
+	Source string
+
+	// Filesystem type, such as "ext4" or "tmpfs".
+	FSType string
+
+	// Set if the filesystem was unmounted, rather than mounted.
+	Unmounted bool
+}
+
+func (e MountEvent) String() string {
+	op := "MOUNT"
+	if e.Unmounted {
+		op = "UNMOUNT"
+	}
+	return op + " " + e.FSType + " " + e.Source + " on " + e.Path
+}
+
+// mountInfo is a single entry of /proc/self/mountinfo.
+type mountInfo struct {
+	id     string
+	path   string
+	source string
+	fsType string
+	opts   string // Super options, such as "rw,lowerdir=/l,upperdir=/u,workdir=/w".
+}
+
+// parseMountInfo parses the contents of /proc/self/mountinfo; see proc(5) for
+// the format. The result is keyed by mount ID.
+func parseMountInfo(data string) map[string]mountInfo {
+	mounts := make(map[string]mountInfo)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		m := mountInfo{id: fields[0], path: unescapeMountPath(fields[4])}
+		for i, f := range fields {
+			if f == "-" && i+2 < len(fields) {
+				m.fsType, m.source = fields[i+1], fields[i+2]
+				if i+3 < len(fields) {
+					m.opts = fields[i+3]
+				}
+				break
+			}
+		}
+		mounts[m.id] = m
+	}
+	return mounts
+}
+
+// overlayUpper returns the path in the upper directory of the overlayfs mount
+// for path, for WithOverlayUpper(). It returns false if path isn't on an
+// overlayfs mount from mounts, or the mount has no upper directory.
+func overlayUpper(mounts []mountInfo, path string) (string, bool) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	on := mountOn(mounts, path)
+	if on == nil || on.fsType != "overlay" {
+		return "", false
+	}
+	for _, o := range strings.Split(on.opts, ",") {
+		if strings.HasPrefix(o, "upperdir=") {
+			rel, err := filepath.Rel(on.path, path)
+			if err != nil {
+				return "", false
+			}
+			return filepath.Join(unescapeMountPath(strings.TrimPrefix(o, "upperdir=")), rel), true
+		}
+	}
+	return "", false
+}
+
+// mountOn returns the mount from mounts that the absolute path is on, or nil
+// if there is none.
+func mountOn(mounts []mountInfo, path string) *mountInfo {
+	// The mount with the longest path is the one path is on.
+	var on *mountInfo
+	for i, m := range mounts {
+		if isUnder(path, m.path) && (on == nil || len(m.path) > len(on.path)) {
+			on = &mounts[i]
+		}
+	}
+	return on
+}
+
+// unescapeMountPath decodes the octal escapes (such as "\040" for a space)
+// used in mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			b = append(b, (s[i+1]-'0')<<6|(s[i+2]-'0')<<3|(s[i+3]-'0'))
+			i += 3
+			continue
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+func isOctal(c byte) bool { return c >= '0' && c <= '7' }
+
+// diffMounts returns the events for the changes from old to new, for mount
+// points in or below one of paths (or all mount points if paths is empty).
+func diffMounts(old, new map[string]mountInfo, paths []string) []MountEvent {
+	var events []MountEvent
+	for id, m := range old {
+		if _, ok := new[id]; !ok && underAny(m.path, paths) {
+			events = append(events, MountEvent{Path: m.path, Source: m.source, FSType: m.fsType, Unmounted: true})
+		}
+	}
+	for id, m := range new {
+		if _, ok := old[id]; !ok && underAny(m.path, paths) {
+			events = append(events, MountEvent{Path: m.path, Source: m.source, FSType: m.fsType})
+		}
+	}
+	// Unmounts are sent first, children before parents; mounts are sent
+	// parents before children.
+	sort.Slice(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a.Unmounted != b.Unmounted {
+			return a.Unmounted
+		}
+		if a.Unmounted {
+			return a.Path > b.Path
+		}
+		return a.Path < b.Path
+	})
+	return events
+}
+
+// underAny reports if path is equal to or below one of dirs, or if dirs is
+// empty.
+func underAny(path string, dirs []string) bool {
+	if len(dirs) == 0 {
+		return true
+	}
+	for _, d := range dirs {
+		if isUnder(path, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnder reports if path is equal to or below dir.
+func isUnder(path, dir string) bool {
+	dir = filepath.Clean(dir)
+	if path == dir || dir == string(filepath.Separator) {
+		return true
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
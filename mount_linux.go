@@ -0,0 +1,190 @@
+//go:build linux
+// +build linux
+
+package fsnotify
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// MountWatcher watches for filesystems being mounted and unmounted.
+//
+// On Linux this waits for changes to /proc/self/mountinfo, so it sees the
+// mounts in the mount namespace of the process.
+type MountWatcher struct {
+	// Events sends the mount and unmount events.
+	Events chan MountEvent
+
+	// Errors sends any errors.
+	Errors chan error
+
+	paths    []string
+	fd       int    // /proc/self/mountinfo
+	wakeup   [2]int // Pipe to wake up the poll() on Close().
+	mu       sync.Mutex
+	done     chan struct{} // Closed on Close().
+	doneResp chan struct{}
+}
+
+// NewMountWatcher starts watching for mounts and unmounts on or below any of
+// paths, or for all mount points if no paths are given.
+func NewMountWatcher(paths ...string) (*MountWatcher, error) {
+	abs := make([]string, len(paths))
+	for i, p := range paths {
+		var err error
+		abs[i], err = filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fd, err := unix.Open("/proc/self/mountinfo", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	m := &MountWatcher{
+		Events:   make(chan MountEvent),
+		Errors:   make(chan error),
+		paths:    abs,
+		fd:       fd,
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	if err := unix.Pipe2(m.wakeup[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	mounts, err := m.read()
+	if err != nil {
+		m.closeFds()
+		return nil, err
+	}
+
+	go m.readEvents(mounts)
+	return m, nil
+}
+
+// Close stops watching and closes the Events and Errors channels.
+func (m *MountWatcher) Close() error {
+	m.mu.Lock()
+	select {
+	case <-m.done:
+		m.mu.Unlock()
+		return nil
+	default:
+	}
+	close(m.done)
+	m.mu.Unlock()
+
+	unix.Write(m.wakeup[1], []byte{0})
+	<-m.doneResp
+	return nil
+}
+
+func (m *MountWatcher) closeFds() {
+	unix.Close(m.fd)
+	unix.Close(m.wakeup[0])
+	unix.Close(m.wakeup[1])
+}
+
+// read reads and parses all of mountinfo.
+func (m *MountWatcher) read() (map[string]mountInfo, error) {
+	if _, err := unix.Seek(m.fd, 0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var (
+		data []byte
+		buf  = make([]byte, 64*1024)
+	)
+	for {
+		n, err := unix.Read(m.fd, buf)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return parseMountInfo(string(data)), nil
+		}
+		data = append(data, buf[:n]...)
+	}
+}
+
+// readEvents waits for changes to mountinfo, and sends the events for them
+// until the watcher is closed.
+func (m *MountWatcher) readEvents(mounts map[string]mountInfo) {
+	defer func() {
+		m.closeFds()
+		close(m.Events)
+		close(m.Errors)
+		close(m.doneResp)
+	}()
+
+	for {
+		// mountinfo reports POLLPRI (and POLLERR) when the mounts changed.
+		fds := []unix.PollFd{
+			{Fd: int32(m.fd), Events: unix.POLLPRI},
+			{Fd: int32(m.wakeup[0]), Events: unix.POLLIN},
+		}
+		_, err := unix.Poll(fds, -1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			m.sendError(err)
+			return
+		}
+		if fds[1].Revents != 0 {
+			return
+		}
+		if fds[0].Revents&(unix.POLLPRI|unix.POLLERR) == 0 {
+			continue
+		}
+
+		newMounts, err := m.read()
+		if err != nil {
+			if !m.sendError(err) {
+				return
+			}
+			continue
+		}
+		for _, e := range diffMounts(mounts, newMounts, m.paths) {
+			select {
+			case m.Events <- e:
+			case <-m.done:
+				return
+			}
+		}
+		mounts = newMounts
+	}
+}
+
+// Returns true if the error was sent, or false if watcher is closed.
+func (m *MountWatcher) sendError(err error) bool {
+	select {
+	case m.Errors <- newWatchError(err, ""):
+		return true
+	case <-m.done:
+		return false
+	}
+}
+
+// readMountList returns all mounts, for WithOverlayUpper().
+func readMountList() ([]mountInfo, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	var list []mountInfo
+	for _, m := range parseMountInfo(string(data)) {
+		list = append(list, m)
+	}
+	return list, nil
+}
@@ -0,0 +1,226 @@
+package fsnotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// mountTmpfs mounts a tmpfs on dir, skipping the test if that's not allowed.
+func mountTmpfs(t *testing.T, dir string) {
+	t.Helper()
+	err := unix.Mount("fsnotify-test", dir, "tmpfs", 0, "")
+	if err != nil {
+		t.Skipf("can't mount: %s", err)
+	}
+	t.Cleanup(func() { unix.Unmount(dir, unix.MNT_DETACH) })
+}
+
+func TestMountWatcher(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "mnt")
+	mkdir(t, dir)
+
+	m, err := NewMountWatcher(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	next := func(t *testing.T) MountEvent {
+		t.Helper()
+		select {
+		case e := <-m.Events:
+			return e
+		case err := <-m.Errors:
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		return MountEvent{}
+	}
+
+	mountTmpfs(t, dir)
+	want := MountEvent{Path: dir, Source: "fsnotify-test", FSType: "tmpfs"}
+	if have := next(t); have != want {
+		t.Errorf("\nhave: %s\nwant: %s", have, want)
+	}
+
+	if err := unix.Unmount(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	want.Unmounted = true
+	if have := next(t); have != want {
+		t.Errorf("\nhave: %s\nwant: %s", have, want)
+	}
+}
+
+func TestWithMounts(t *testing.T) {
+	tests := []testCase{
+		{"mount", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "mnt")
+			if err := w.AddWith(filepath.Join(tmp, "..."), WithMounts()); err != nil {
+				t.Fatal(err)
+			}
+
+			mountTmpfs(t, filepath.Join(tmp, "mnt"))
+			waitForEvents()
+			touch(t, tmp, "mnt", "file")
+		}, `
+			create /mnt/file
+		`},
+		{"without option", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "mnt")
+			addWatch(t, w, tmp, "...")
+
+			mountTmpfs(t, filepath.Join(tmp, "mnt"))
+			waitForEvents()
+			touch(t, tmp, "mnt", "file")
+		}, `
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
+
+func TestWatchLost(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mountTmpfs(t, tmp)
+	w := newWatcher(t, tmp)
+	defer w.Close()
+
+	if err := unix.Unmount(tmp, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-w.Errors:
+		var we *WatchError
+		if !errors.As(err, &we) || we.Kind != KindWatchLost || we.Path != tmp {
+			t.Errorf("wrong error: %#v", err)
+		}
+		if !errors.Is(err, ErrWatchLost) {
+			t.Error("errors.Is(err, ErrWatchLost) is false")
+		}
+	case e := <-w.Events:
+		t.Errorf("unexpected event: %s", e)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestCheckUnmounted(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mountTmpfs(t, tmp)
+	w := newWatcher(t, tmp)
+	defer w.Close()
+
+	if err := unix.Unmount(tmp, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-w.Errors:
+		if !errors.Is(err, ErrWatchLost) {
+			t.Fatalf("wrong error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	health, err := w.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(health) != 1 || health[0].Status != WatchRestored {
+		t.Fatalf("wrong health: %v", health)
+	}
+
+	touch(t, tmp, "file")
+	select {
+	case e := <-w.Events:
+		if want := (Event{Name: filepath.Join(tmp, "file"), Op: Create}); e != want {
+			t.Errorf("\nhave: %s\nwant: %s", e, want)
+		}
+	case err := <-w.Errors:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+// mountOverlay mounts an overlayfs on tmp/merged with the lower directory
+// tmp/lower and upper directory tmp/upper, skipping the test if that's not
+// allowed. tmp/lower may already exist.
+func mountOverlay(t *testing.T, tmp string) {
+	t.Helper()
+	for _, d := range []string{"lower", "upper", "work", "merged"} {
+		if err := os.MkdirAll(filepath.Join(tmp, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := unix.Mount("fsnotify-test", filepath.Join(tmp, "merged"), "overlay", 0, fmt.Sprintf(
+		"lowerdir=%s,upperdir=%s,workdir=%s",
+		filepath.Join(tmp, "lower"), filepath.Join(tmp, "upper"), filepath.Join(tmp, "work")))
+	if err != nil {
+		t.Skipf("can't mount: %s", err)
+	}
+	t.Cleanup(func() { unix.Unmount(filepath.Join(tmp, "merged"), unix.MNT_DETACH) })
+}
+
+func TestWithOverlayUpper(t *testing.T) {
+	tests := []testCase{
+		{"upper", func(t *testing.T, w *Watcher, tmp string) {
+			mountOverlay(t, tmp)
+			if err := w.AddWith(filepath.Join(tmp, "merged"), WithOverlayUpper()); err != nil {
+				t.Fatal(err)
+			}
+
+			touch(t, tmp, "merged", "file")      // Through the overlay.
+			cat(t, "data", tmp, "upper", "file") // In the upper directory.
+			touch(t, tmp, "upper", "new")
+			rm(t, tmp, "merged", "file")
+		}, `
+			create /merged/file
+			write  /merged/file
+			create /merged/new
+			remove /merged/file
+		`},
+		{"whiteout", func(t *testing.T, w *Watcher, tmp string) {
+			mkdir(t, tmp, "lower")
+			touch(t, tmp, "lower", "file")
+			mountOverlay(t, tmp)
+			if err := w.AddWith(filepath.Join(tmp, "merged"), WithOverlayUpper()); err != nil {
+				t.Fatal(err)
+			}
+
+			rm(t, tmp, "merged", "file")
+		}, `
+			remove /merged/file
+		`},
+		{"without option", func(t *testing.T, w *Watcher, tmp string) {
+			mountOverlay(t, tmp)
+			addWatch(t, w, tmp, "merged")
+
+			touch(t, tmp, "upper", "new")
+		}, `
+		`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.run(t)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package fsnotify
+
+// MountWatcher watches for filesystems being mounted and unmounted.
+//
+// This is only supported on Linux.
+type MountWatcher struct {
+	// Events sends the mount and unmount events.
+	Events chan MountEvent
+
+	// Errors sends any errors.
+	Errors chan error
+}
+
+// NewMountWatcher starts watching for mounts and unmounts on or below any of
+// paths. This always returns ErrMountsNotSupported on this platform.
+func NewMountWatcher(paths ...string) (*MountWatcher, error) {
+	return nil, ErrMountsNotSupported
+}
+
+// Close stops watching and closes the Events and Errors channels.
+func (m *MountWatcher) Close() error {
+	return nil
+}
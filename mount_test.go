@@ -0,0 +1,88 @@
+package fsnotify
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	mounts := parseMountInfo(`
+23 28 0:22 / /proc rw,relatime - proc proc rw
+36 35 98:0 /mnt1 /mnt/with\040space rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+`)
+	want := map[string]mountInfo{
+		"23": {id: "23", path: "/proc", source: "proc", fsType: "proc", opts: "rw"},
+		"36": {id: "36", path: "/mnt/with space", source: "/dev/root", fsType: "ext3", opts: "rw,errors=continue"},
+	}
+	if fmt.Sprint(mounts) != fmt.Sprint(want) {
+		t.Errorf("\nhave: %v\nwant: %v", mounts, want)
+	}
+}
+
+func TestOverlayUpper(t *testing.T) {
+	var mounts []mountInfo
+	for _, m := range parseMountInfo(`
+1 0 0:1 / / rw - ext4 /dev/sda1 rw
+2 1 0:2 / /merged rw - overlay overlay rw,lowerdir=/lower,upperdir=/up\040per,workdir=/work
+3 2 0:3 / /merged/tmp rw - tmpfs tmpfs rw
+4 1 0:4 / /ro rw - overlay overlay ro,lowerdir=/a:/b
+`) {
+		mounts = append(mounts, m)
+	}
+
+	tests := []struct {
+		path, want string
+		ok         bool
+	}{
+		{"/merged", "/up per", true},
+		{"/merged/dir/file", "/up per/dir/file", true},
+		{"/merged/tmp/dir", "", false},
+		{"/mergedx", "", false},
+		{"/ro/dir", "", false},
+		{"/other", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			have, ok := overlayUpper(mounts, tt.path)
+			if have != tt.want || ok != tt.ok {
+				t.Errorf("have %q, %t; want %q, %t", have, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDiffMounts(t *testing.T) {
+	old := parseMountInfo(`
+1 0 0:1 / / rw - ext4 /dev/sda1 rw
+2 1 0:2 / /data rw - ext4 /dev/sdb1 rw
+3 2 0:3 / /data/a rw - tmpfs tmpfs rw
+`)
+	new := parseMountInfo(`
+1 0 0:1 / / rw - ext4 /dev/sda1 rw
+4 1 0:4 / /data rw - xfs /dev/sdc1 rw
+5 4 0:5 / /data/b rw - tmpfs tmpfs rw
+6 1 0:6 / /other rw - tmpfs tmpfs rw
+`)
+
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{nil, "[" +
+			"UNMOUNT tmpfs tmpfs on /data/a " +
+			"UNMOUNT ext4 /dev/sdb1 on /data " +
+			"MOUNT xfs /dev/sdc1 on /data " +
+			"MOUNT tmpfs tmpfs on /data/b " +
+			"MOUNT tmpfs tmpfs on /other]"},
+		{[]string{"/data/b"}, "[MOUNT tmpfs tmpfs on /data/b]"},
+		{[]string{"/dat"}, "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.paths), func(t *testing.T) {
+			have := fmt.Sprint(diffMounts(old, new, tt.paths))
+			if have != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.want)
+			}
+		})
+	}
+}
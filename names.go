@@ -0,0 +1,81 @@
+package fsnotify
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// NamePolicy sets how paths are reported in Event.Name; see WithNames().
+type NamePolicy uint8
+
+const (
+	// NamesAsGiven reports paths the way the backend sees them; this is the
+	// default. On most platforms this is the path as it was passed to Add(),
+	// but kqueue reports the target for watched symlinks.
+	NamesAsGiven NamePolicy = iota
+
+	// NamesClean reports paths cleaned with filepath.Clean().
+	NamesClean
+
+	// NamesAbsolute reports absolute paths, with filepath.Abs().
+	NamesAbsolute
+
+	// NamesResolved reports absolute paths with all symlinks resolved, with
+	// filepath.EvalSymlinks(). For paths that no longer exist, such as the
+	// path of a Remove event, only the directory is resolved.
+	//
+	// This needs a few system calls for every event.
+	NamesResolved
+)
+
+func (n NamePolicy) String() string {
+	switch n {
+	case NamesAsGiven:
+		return "as-given"
+	case NamesClean:
+		return "clean"
+	case NamesAbsolute:
+		return "absolute"
+	case NamesResolved:
+		return "resolved"
+	}
+	return fmt.Sprintf("NamePolicy(%d)", n)
+}
+
+// apply returns name according to the policy n. The name is returned
+// unchanged if it can't be made absolute.
+func (n NamePolicy) apply(name string) string {
+	switch n {
+	case NamesClean:
+		return filepath.Clean(name)
+	case NamesAbsolute:
+		if abs, err := filepath.Abs(name); err == nil {
+			return abs
+		}
+	case NamesResolved:
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return name
+		}
+		if r, err := filepath.EvalSymlinks(abs); err == nil {
+			return r
+		}
+		if r, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+			return filepath.Join(r, filepath.Base(abs))
+		}
+		return abs
+	}
+	return name
+}
+
+// rename applies the NamePolicy set with WithNames() and WithRelativeNames()
+// to the name of e.
+func (p *pipeline) rename(e Event, with withOpts) Event {
+	if p.names != NamesAsGiven {
+		e.Name = p.names.apply(e.Name)
+		if with.relativeNames {
+			with.root = p.names.apply(with.root)
+		}
+	}
+	return with.relativeName(e)
+}
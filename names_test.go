@@ -0,0 +1,101 @@
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNamePolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra permissions on Windows")
+	}
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mkdir(t, tmp, "dir", noWait)
+	touch(t, tmp, "dir", "file", noWait)
+	symlink(t, "dir", tmp, "link", noWait)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, filepath.Join(tmp, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy   NamePolicy
+		in, want string
+	}{
+		{NamesAsGiven, rel + "/./file", rel + "/./file"},
+		{NamesClean, rel + "/./file", filepath.Join(rel, "file")},
+		{NamesAbsolute, rel + "/./file", filepath.Join(tmp, "link", "file")},
+		{NamesResolved, rel + "/./file", filepath.Join(tmp, "dir", "file")},
+		{NamesResolved, filepath.Join(tmp, "link", "gone"), filepath.Join(tmp, "dir", "gone")},
+		{NamesResolved, filepath.Join(tmp, "gone", "gone"), filepath.Join(tmp, "gone", "gone")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			if have := tt.policy.apply(tt.in); have != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithNames(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+	default:
+		t.Skip("no backend or no symlinks")
+	}
+	t.Parallel()
+
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mkdir(t, tmp, "dir", noWait)
+	symlink(t, "dir", tmp, "link", noWait)
+
+	tests := []struct {
+		name string
+		opts []addOpt
+		want string
+	}{
+		{"absolute", nil, filepath.Join(tmp, "dir", "file")},
+		{"relative", []addOpt{WithRelativeNames()}, "file"},
+	}
+	var ws []*Watcher
+	for _, tt := range tests {
+		w, err := NewWatcherWith(WithNames(NamesResolved))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		if err := w.AddWith(filepath.Join(tmp, "link"), append(tt.opts, WithOps(Create))...); err != nil {
+			t.Fatal(err)
+		}
+		ws = append(ws, w)
+	}
+	touch(t, tmp, "dir", "file", noWait)
+
+	for i, tt := range tests {
+		select {
+		case e := <-ws[i].Events:
+			if e.Name != tt.want {
+				t.Errorf("%s: wrong name\nhave: %s\nwant: %s", tt.name, e.Name, tt.want)
+			}
+		case err := <-ws[i].Errors:
+			t.Fatal(err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: timeout", tt.name)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package fsnotify
+
+// Notifier is the interface of a Watcher, for code that only needs to add
+// watches and read events.
+//
+// Accept a Notifier rather than a *Watcher to allow replacing it with a fake
+// watcher in tests (see the fsnotifytest package), a watcher on another host
+// (see the remote package), or a wrapper that adds logging or metrics.
+type Notifier interface {
+	// Add starts watching the named file or directory (non-recursively).
+	Add(name string) error
+
+	// AddWith is like Add, but allows adding options.
+	AddWith(name string, opts ...AddOption) error
+
+	// Remove stops watching the named file or directory.
+	Remove(name string) error
+
+	// Close removes all watches and closes the events and errors channels.
+	Close() error
+
+	// EventsChan returns the channel the events are sent on.
+	EventsChan() <-chan Event
+
+	// ErrorsChan returns the channel the errors are sent on.
+	ErrorsChan() <-chan error
+}
+
+var _ Notifier = (*Watcher)(nil)
+
+// EventsChan returns the Events channel, to implement Notifier.
+func (w *Watcher) EventsChan() <-chan Event { return w.Events }
+
+// ErrorsChan returns the Errors channel, to implement Notifier.
+func (w *Watcher) ErrorsChan() <-chan error { return w.Errors }
@@ -0,0 +1,198 @@
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// OnChangeOptions are the options for OnChange().
+type OnChangeOptions struct {
+	// Wait until there were no events for this long before running the
+	// command, so that a burst of events (e.g. from a "git checkout") runs the
+	// command only once. The default is 100ms.
+	Debounce time.Duration
+
+	// Restart the command if it's still running when there are new events,
+	// rather than waiting for it to finish and then running it again. Use this
+	// for long-running processes such as servers.
+	Restart bool
+
+	// How long to wait for the command to exit after sending it an interrupt
+	// signal, before killing it. The default is 5 seconds. On Windows the
+	// command is always killed right away.
+	KillTimeout time.Duration
+
+	// Only run the command for events for which Filter returns true. The
+	// default is to use all events.
+	Filter func(Event) bool
+
+	// Run the command once when OnChange() starts, before there are any
+	// events.
+	RunOnStart bool
+
+	// Stdout and Stderr of the command; the default is to discard the output.
+	Stdout, Stderr io.Writer
+
+	// Clock to use for Debounce and KillTimeout; the default is SystemClock.
+	Clock Clock
+}
+
+// OnChange watches paths and runs cmd when any of them change, until ctx is
+// cancelled. cmd[0] is the program to run and cmd[1:] its arguments.
+//
+// Paths ending with "/..." are watched recursively. At most one instance of
+// the command is running at any time; see OnChangeOptions.Restart for what
+// happens if there are events while it's still running.
+//
+// It returns ctx.Err() once ctx is cancelled, after stopping the command. It
+// returns early if a path can't be watched, the command can't be started, or
+// the watcher sends an error other than ErrEventOverflow. The exit status of
+// the command is ignored.
+func OnChange(ctx context.Context, paths []string, cmd []string, opts OnChangeOptions) error {
+	if len(cmd) == 0 {
+		return errors.New("fsnotify: OnChange: no command")
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 100 * time.Millisecond
+	}
+	if opts.KillTimeout <= 0 {
+		opts.KillTimeout = 5 * time.Second
+	}
+	opts.Clock = clockOrSystem(opts.Clock)
+
+	w, err := NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	for _, p := range paths {
+		if err := w.Add(p); err != nil {
+			return err
+		}
+	}
+
+	r := &runner{cmd: cmd, opts: opts}
+	defer r.stop()
+	if opts.RunOnStart {
+		if err := r.start(); err != nil {
+			return err
+		}
+	}
+
+	debounce := opts.Clock.NewTimer(opts.Debounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	reset := func() {
+		if !debounce.Stop() {
+			select {
+			case <-debounce.C():
+			default:
+			}
+		}
+		debounce.Reset(opts.Debounce)
+	}
+
+	pending := false // There were events while the command was running.
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if opts.Filter == nil || opts.Filter(e) {
+				reset()
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			// Some events were lost, so just assume something changed.
+			if !errors.Is(err, ErrEventOverflow) {
+				return err
+			}
+			reset()
+		case <-debounce.C():
+			if r.running() && !opts.Restart {
+				pending = true
+				continue
+			}
+			r.stop()
+			if err := r.start(); err != nil {
+				return err
+			}
+		case <-r.exited:
+			r.wait()
+			if pending {
+				pending = false
+				if err := r.start(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// runner runs a single instance of a command.
+type runner struct {
+	cmd    []string
+	opts   OnChangeOptions
+	proc   *exec.Cmd
+	exited chan struct{} // Closed when proc exits; nil if nothing is running.
+}
+
+func (r *runner) running() bool { return r.proc != nil }
+
+func (r *runner) start() error {
+	r.proc = exec.Command(r.cmd[0], r.cmd[1:]...)
+	r.proc.Stdout, r.proc.Stderr = r.opts.Stdout, r.opts.Stderr
+	setProcessGroup(r.proc)
+	if err := r.proc.Start(); err != nil {
+		r.proc = nil
+		return err
+	}
+
+	exited, proc := make(chan struct{}), r.proc
+	go func() {
+		proc.Wait()
+		close(exited)
+	}()
+	r.exited = exited
+	return nil
+}
+
+// wait resets the state after the command exited.
+func (r *runner) wait() {
+	<-r.exited
+	r.proc, r.exited = nil, nil
+}
+
+// stop stops the command if it's running, and waits for it to exit.
+//
+// The command runs in its own process group (except on Windows), and the
+// signals are sent to the whole group so that processes it started are
+// stopped too; anything that's still running in the group once the command
+// itself exited is killed.
+func (r *runner) stop() {
+	if !r.running() {
+		return
+	}
+	p := r.proc.Process
+	if signalGroup(p, os.Interrupt) != nil {
+		signalGroup(p, os.Kill)
+	}
+	kill := r.opts.Clock.NewTimer(r.opts.KillTimeout)
+	defer kill.Stop()
+	select {
+	case <-r.exited:
+	case <-kill.C():
+		signalGroup(p, os.Kill)
+	}
+	r.wait()
+	signalGroup(p, os.Kill)
+}
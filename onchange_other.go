@@ -0,0 +1,15 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package fsnotify
+
+import (
+	"os"
+	"os/exec"
+)
+
+// There are no process groups here, so only the command itself is signalled.
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func signalGroup(p *os.Process, sig os.Signal) error { return p.Signal(sig) }
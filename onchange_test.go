@@ -0,0 +1,125 @@
+package fsnotify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnChange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	t.Parallel()
+
+	tmp, out := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- OnChange(ctx, []string{tmp}, []string{"sh", "-c", "echo run >>" + out},
+			OnChangeOptions{Debounce: 200 * time.Millisecond, RunOnStart: true})
+	}()
+	runs := func() int {
+		data, _ := os.ReadFile(out)
+		return strings.Count(string(data), "run")
+	}
+
+	waitForEvents()
+	if n := runs(); n != 1 {
+		t.Fatalf("ran %d times on start; want 1", n)
+	}
+
+	// A burst of events runs the command once.
+	touch(t, tmp, "one")
+	touch(t, tmp, "two")
+	touch(t, tmp, "three")
+	waitForEvents()
+	if n := runs(); n != 2 {
+		t.Errorf("ran %d times; want 2", n)
+	}
+
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestOnChangeRestart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	t.Parallel()
+
+	tmp, out := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- OnChange(ctx, []string{tmp}, []string{"sh", "-c", "echo start >>" + out + "; exec sleep 60"},
+			OnChangeOptions{Debounce: 50 * time.Millisecond, Restart: true, RunOnStart: true})
+	}()
+
+	waitForEvents()
+	touch(t, tmp, "file")
+	waitForEvents()
+	if data, _ := os.ReadFile(out); strings.Count(string(data), "start") != 2 {
+		t.Errorf("not restarted; output:\n%s", data)
+	}
+
+	start := time.Now()
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("wrong error: %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("took %s to stop the command", d)
+	}
+}
+
+func TestOnChangeStopGroup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	t.Parallel()
+
+	tmp, out := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The loop runs in the background, which ignores SIGINT, so it's only
+	// stopped if it's killed along with the shell.
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- OnChange(ctx, []string{tmp},
+			[]string{"sh", "-c", "while :; do echo x >>" + out + "; sleep 0.05; done & wait"},
+			OnChangeOptions{Debounce: 50 * time.Millisecond, Restart: true, RunOnStart: true})
+	}()
+
+	waitForEvents()
+	touch(t, tmp, "file")
+	waitForEvents()
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	size := func() int64 {
+		fi, err := os.Stat(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	before := size()
+	time.Sleep(300 * time.Millisecond)
+	if after := size(); after != before {
+		t.Errorf("background process still running after stop: size %d -> %d", before, after)
+	}
+}
@@ -0,0 +1,69 @@
+//go:build linux
+// +build linux
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// openForWrite reports if any process has path open for writing, by looking
+// at the file descriptors in /proc. Processes that can't be inspected are
+// skipped. The second return value is false if /proc can't be read.
+func openForWrite(path string) (bool, bool) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false, false
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return false, false
+	}
+	for _, p := range procs {
+		if _, err := strconv.Atoi(p.Name()); err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", p.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || target != path {
+				continue
+			}
+			if fdWritable(filepath.Join(dir, "fdinfo", fd.Name())) {
+				return true, true
+			}
+		}
+	}
+	return false, true
+}
+
+// fdWritable reports if the "flags" in the fdinfo file have O_WRONLY or
+// O_RDWR.
+func fdWritable(fdinfo string) bool {
+	data, err := os.ReadFile(fdinfo)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		v := strings.TrimPrefix(line, "flags:")
+		if v == line {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimSpace(v), 8, 64)
+		if err != nil {
+			return false
+		}
+		mode := flags & unix.O_ACCMODE
+		return mode == unix.O_WRONLY || mode == unix.O_RDWR
+	}
+	return false
+}
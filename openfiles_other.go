@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package fsnotify
+
+// openForWrite reports if any process has path open for writing. This isn't
+// supported, so the second return value is always false.
+func openForWrite(path string) (bool, bool) { return false, false }
@@ -0,0 +1,193 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pipeline processes events in userspace after they're read from the kernel,
+// before they're sent on the Events channel. It's shared by all backends.
+type pipeline struct {
+	emit     func(Event) bool // Send on the Events channel; returns false if the watcher is closed.
+	hashes   *hashCache
+	sizes    *sizeCache
+	appends  *appendQueue
+	waits    *debounceQueue
+	settles  *debounceQueue
+	creates  *createQueue
+	replaces *replaceCache
+	readd    func(name string, with withOpts) error // Adds a watch again, for WithReplace().
+	sendErr  func(error) bool                       // Sends on the Errors channel, for GroupQuota.
+	labels   pprof.LabelSet                         // pprof labels of the watcher.
+	delivery *deliveryQueue                         // Set once a watch is added WithPriority().
+	inflight int32                                  // Events passed to queue() that aren't sent yet; accessed atomically.
+	names    NamePolicy                             // Set with WithNames().
+	portable *portableQueue                         // Set with WithPortable().
+	clock    Clock                                  // For OnBackpressure(); nil is SystemClock.
+
+	mu       sync.Mutex // Protects everything below.
+	last     Event      // Last event that was sent or dropped as a duplicate.
+	lastTime time.Time
+	dupes    uint64                      // Number of events dropped by WithDedup().
+	subs     []*subscription             // Added with Watcher.Subscribe().
+	uses     []func(Event) (Event, bool) // Added with Watcher.Use(); never modified in place.
+	closed   bool
+	paused   map[string]struct{}    // Watch groups paused with WatchGroup.Pause().
+	quotas   map[string]*groupQuota // Set with WatchGroup.SetQuota().
+	done     chan struct{}          // Closed when the watcher is closed.
+
+	stallAfter time.Duration        // Set with Watcher.OnBackpressure().
+	onStall    func(Backpressure)   // Set with Watcher.OnBackpressure().
+	waiting    map[uint64]time.Time // Events blocked on the Events channel, and since when.
+	nextWait   uint64               // Key for the next entry in waiting.
+	stalls     bool                 // The goroutine that reports backpressure was started.
+	stallWake  chan struct{}        // Signals that goroutine that an event is waiting.
+}
+
+func newPipeline(emit func(Event) bool) *pipeline {
+	return &pipeline{
+		emit:     emit,
+		hashes:   newHashCache(),
+		sizes:    newSizeCache(),
+		appends:  newAppendQueue(),
+		waits:    newDebounceQueue(),
+		settles:  newDebounceQueue(),
+		creates:  newCreateQueue(),
+		replaces: newReplaceCache(),
+		done:     make(chan struct{}),
+	}
+}
+
+// send processes the event e for a watch with the options in with, and sends
+// it unless it's dropped.
+// Returns false if the watcher is closed.
+func (p *pipeline) send(e Event, with withOpts) bool {
+	if with.group != "" {
+		if p.isPaused(with.group) {
+			return true
+		}
+		e.Group = with.group
+	}
+	if with.nfc {
+		e.Name = normalizeName(e.Name)
+	}
+	if !with.closeWrite && e.Has(CloseWrite) {
+		// Another watch for the same file or directory asked for it.
+		if e.Op &^= CloseWrite; e.Op == 0 {
+			return true
+		}
+	}
+	if with.skipEvent(e) {
+		return true
+	}
+	if with.group != "" {
+		ok, err := p.allowEvent(with.group, with.root, clockOrSystem(with.clock))
+		if err != nil && p.sendErr != nil && !p.sendErr(err) {
+			return false
+		}
+		if !ok {
+			return true
+		}
+	}
+	if with.replace > 0 && e.Name == with.root && e.Op&(Remove|Rename) != 0 {
+		goLabeled(p.labels, "replace", func() { p.replace(e, with, clockOrSystem(with.clock)) })
+		return true
+	}
+	if with.replaceDiff {
+		p.replaces.update(e, with)
+	}
+	if with.trackSizes() {
+		e = p.sizes.update(e, with)
+	}
+	if with.ops != 0 && e.Op&with.ops == 0 {
+		return true
+	}
+
+	clock := clockOrSystem(with.clock)
+	deliver := func(e Event) bool { return p.deliver(e, with, clock) }
+	if with.dedup > 0 {
+		deliver = func(e Event) bool { return p.deliverDedup(e, with, clock) }
+	}
+	if with.settle > 0 {
+		next := deliver
+		deliver = func(e Event) bool { return next(e) && p.settle(with, clock) }
+	}
+	if with.completeCreate > 0 {
+		next := deliver
+		deliver = func(e Event) bool { return p.creates.send(e, with.completeCreate, clock, next, p.done, p.labels) }
+	}
+	if with.appendOnly {
+		next := deliver
+		deliver = func(e Event) bool { return p.appends.send(e, with.appendWindow, clock, next, p.done, p.labels) }
+	}
+	if with.hashSize > 0 {
+		next := deliver
+		deliver = func(e Event) bool { return p.hashes.send(e, with.hashSize, next, p.labels) }
+	}
+	if with.debounce > 0 {
+		return p.waits.send(e, with.debounce, clock, deliver, p.done, p.labels)
+	}
+	return deliver(e)
+}
+
+// settle (re)starts the timer to send a Settled event for the watch, for
+// WithSettle().
+func (p *pipeline) settle(with withOpts, clock Clock) bool {
+	e := Event{Name: with.root, Op: Settled}
+	return p.settles.send(e, with.settle, clock, func(e Event) bool { return p.deliver(e, with, clock) }, p.done, p.labels)
+}
+
+// deliver sends e on the Events channel, and records it as the last event.
+func (p *pipeline) deliver(e Event, with withOpts, clock Clock) bool {
+	e = p.rename(e, with)
+	p.mu.Lock()
+	p.last, p.lastTime = e, clock.Now()
+	p.mu.Unlock()
+	if p.portable != nil {
+		return p.portable.send(e, with.priority, clock, p.done, p.labels)
+	}
+	return p.queue(e, with.priority)
+}
+
+// deliverDedup is like deliver, but drops e if it's identical to the last
+// event and that was less than with.dedup ago.
+func (p *pipeline) deliverDedup(e Event, with withOpts, clock Clock) bool {
+	e = p.rename(e, with)
+	p.mu.Lock()
+	now := clock.Now()
+	if e.Name == p.last.Name && e.Op == p.last.Op && now.Sub(p.lastTime) < with.dedup {
+		p.lastTime = now
+		p.dupes++
+		p.mu.Unlock()
+		return true
+	}
+	p.last, p.lastTime = e, now
+	p.mu.Unlock()
+	if p.portable != nil {
+		return p.portable.send(e, with.priority, clock, p.done, p.labels)
+	}
+	return p.queue(e, with.priority)
+}
+
+// duplicates returns the number of events dropped by WithDedup().
+func (p *pipeline) duplicates() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dupes
+}
+
+// relativeName makes the name of e relative to the watched path, for
+// WithRelativeNames().
+func (o withOpts) relativeName(e Event) Event {
+	if !o.relativeNames {
+		return e
+	}
+	rel, err := filepath.Rel(o.root, e.Name)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		e.Name = rel
+	}
+	return e
+}
@@ -0,0 +1,771 @@
+package fsnotify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPipelineDedup(t *testing.T) {
+	t.Parallel()
+
+	var have []Event
+	p := newPipeline(func(e Event) bool {
+		have = append(have, e)
+		return true
+	})
+	with := withOpts{dedup: time.Minute}
+
+	for _, e := range []Event{
+		{Name: "/a", Op: Write},
+		{Name: "/a", Op: Write},
+		{Name: "/a", Op: Write},
+		{Name: "/a", Op: Chmod},
+		{Name: "/b", Op: Write},
+		{Name: "/a", Op: Write},
+	} {
+		p.send(e, with)
+	}
+
+	want := []Event{
+		{Name: "/a", Op: Write},
+		{Name: "/a", Op: Chmod},
+		{Name: "/b", Op: Write},
+		{Name: "/a", Op: Write},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %s\nwant: %s", have, want)
+	}
+	if d := p.duplicates(); d != 2 {
+		t.Errorf("duplicates: %d; want 2", d)
+	}
+}
+
+func TestPipelineSubscribe(t *testing.T) {
+	t.Parallel()
+
+	var events []Event
+	p := newPipeline(func(e Event) bool {
+		events = append(events, e)
+		return true
+	})
+
+	creates, cancel := p.subscribe(func(e Event) bool { return e.Has(Create) })
+	var (
+		have []Event
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for e := range creates {
+			have = append(have, e)
+		}
+	}()
+
+	p.send(Event{Name: "/a", Op: Create}, withOpts{})
+	p.send(Event{Name: "/a", Op: Write}, withOpts{})
+	cancel()
+	<-done
+	p.send(Event{Name: "/b", Op: Create}, withOpts{})
+
+	if want := []Event{{Name: "/a", Op: Create}}; !reflect.DeepEqual(have, want) {
+		t.Errorf("subscription:\nhave: %s\nwant: %s", have, want)
+	}
+	want := []Event{{Name: "/a", Op: Write}, {Name: "/b", Op: Create}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("Events:\nhave: %s\nwant: %s", events, want)
+	}
+
+	// Closing the watcher closes the subscriptions.
+	all, _ := p.subscribe(nil)
+	p.close()
+	if _, ok := <-all; ok {
+		t.Error("subscription not closed")
+	}
+}
+
+func TestPipelineSubscribeWith(t *testing.T) {
+	t.Parallel()
+
+	var events []Event
+	p := newPipeline(func(e Event) bool {
+		events = append(events, e)
+		return true
+	})
+
+	var (
+		root  = filepath.Join(string(filepath.Separator), "data")
+		a     = filepath.Join(root, "a.go")
+		b     = filepath.Join(root, "sub", "b.txt")
+		other = filepath.Join(string(filepath.Separator), "other.go")
+	)
+	sub, _ := p.subscribeWith(getSubscribeOptions(SubscribePaths(root+string(filepath.Separator)), SubscribeBuffer(10)))
+	goWrites, _ := p.subscribeWith(getSubscribeOptions(SubscribePatterns("*.go"), SubscribeOps(Write), SubscribeBuffer(10)))
+
+	for _, e := range []Event{
+		{Name: a, Op: Create},
+		{Name: a, Op: Write},
+		{Name: b, Op: Write},
+		{Name: other, Op: Write},
+		{Name: other, Op: Remove},
+	} {
+		p.send(e, withOpts{})
+	}
+	p.close()
+
+	read := func(ch <-chan Event) []Event {
+		var have []Event
+		for e := range ch {
+			have = append(have, e)
+		}
+		return have
+	}
+	tests := []struct {
+		name string
+		have []Event
+		want []Event
+	}{
+		{"paths", read(sub), []Event{{Name: a, Op: Create}, {Name: a, Op: Write}, {Name: b, Op: Write}}},
+		{"patterns", read(goWrites), []Event{{Name: a, Op: Write}, {Name: other, Op: Write}}},
+		{"Events", events, []Event{{Name: other, Op: Remove}}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.have, tt.want) {
+			t.Errorf("%s:\nhave: %s\nwant: %s", tt.name, tt.have, tt.want)
+		}
+	}
+}
+
+func TestPipelineBackpressure(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	p := newPipeline(func(e Event) bool {
+		<-release
+		return true
+	})
+	reports := make(chan Backpressure, 100)
+	p.onBackpressure(10*time.Millisecond, func(bp Backpressure) { reports <- bp })
+
+	sent := make(chan bool, 2)
+	for _, name := range []string{"/a", "/b"} {
+		name := name
+		go func() { sent <- p.send(Event{Name: name, Op: Create}, withOpts{}) }()
+	}
+
+	// Wait until both events are reported as waiting.
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case bp := <-reports:
+			if bp.Stalled < 10*time.Millisecond {
+				t.Errorf("stalled for %s; want at least 10ms", bp.Stalled)
+			}
+			done = bp.Pending == 2
+		case <-timeout:
+			t.Fatal("timeout")
+		}
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if !<-sent {
+			t.Error("send returned false")
+		}
+	}
+
+	// There should be no more reports once the events are sent.
+	time.Sleep(30 * time.Millisecond)
+	for len(reports) > 0 {
+		<-reports
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := len(reports); n > 0 {
+		t.Errorf("%d reports after the events were sent", n)
+	}
+}
+
+// offsetClock is the system clock, but the time can be moved ahead.
+type offsetClock struct {
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+func (c *offsetClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Add(c.offset)
+}
+
+func (c *offsetClock) NewTimer(d time.Duration) Timer { return SystemClock.NewTimer(d) }
+
+func (c *offsetClock) add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset += d
+}
+
+func TestPipelineBackpressureClock(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	p := newPipeline(func(e Event) bool {
+		<-release
+		return true
+	})
+	clock := new(offsetClock)
+	p.clock = clock
+	reports := make(chan Backpressure, 100)
+	p.onBackpressure(10*time.Millisecond, func(bp Backpressure) { reports <- bp })
+
+	sent := make(chan bool, 1)
+	go func() { sent <- p.send(Event{Name: "/a", Op: Create}, withOpts{}) }()
+
+	timeout := time.After(5 * time.Second)
+	select {
+	case <-reports:
+	case <-timeout:
+		t.Fatal("timeout")
+	}
+	clock.add(time.Hour)
+	for done := false; !done; {
+		select {
+		case bp := <-reports:
+			done = bp.Stalled >= time.Hour
+		case <-timeout:
+			t.Fatal("the stall time doesn't use the clock")
+		}
+	}
+
+	close(release)
+	if !<-sent {
+		t.Error("send returned false")
+	}
+}
+
+func TestPipelineTruncate(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "file")
+	cat(t, "hello, world", file)
+
+	var have []Event
+	p := newPipeline(func(e Event) bool {
+		have = append(have, e)
+		return true
+	})
+	with := getOptions(WithTruncate())
+	with.setRoot(tmp, false)
+	p.sizes.seed(tmp, with)
+
+	truncate := func(size int64) {
+		t.Helper()
+		if err := os.Truncate(file, size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	truncate(5)
+	p.send(Event{Name: file, Op: Write}, with)
+	cat(t, "!!", file)
+	p.send(Event{Name: file, Op: Write}, with)
+	p.send(Event{Name: file, Op: Chmod}, with)
+	truncate(0)
+	p.send(Event{Name: file, Op: Write}, with)
+	p.send(Event{Name: file, Op: Remove}, with)
+	cat(t, "new", file)
+	p.send(Event{Name: file, Op: Create}, with)
+	truncate(1)
+	p.send(Event{Name: file, Op: Write}, with)
+
+	want := []Event{
+		{Name: file, Op: Write | Truncate},
+		{Name: file, Op: Write},
+		{Name: file, Op: Chmod},
+		{Name: file, Op: Write | Truncate},
+		{Name: file, Op: Remove},
+		{Name: file, Op: Create},
+		{Name: file, Op: Write | Truncate},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %s\nwant: %s", have, want)
+	}
+}
+
+func TestPipelineSizes(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file, other := filepath.Join(tmp, "file"), filepath.Join(tmp, "other")
+	cat(t, "hello", file)
+
+	var have []Event
+	p := newPipeline(func(e Event) bool {
+		have = append(have, e)
+		return true
+	})
+	with := getOptions(WithSizes())
+	with.setRoot(tmp, false)
+	p.sizes.seed(tmp, with)
+
+	cat(t, ", world", file)
+	p.send(Event{Name: file, Op: Write}, with)
+	p.send(Event{Name: file, Op: Chmod}, with)
+	cat(t, "data", other) // Created before the watch knows about it.
+	p.send(Event{Name: other, Op: Write}, with)
+	cat(t, "!", other)
+	p.send(Event{Name: other, Op: Write}, with)
+
+	want := []Event{
+		{Name: file, Op: Write, Size: 12, PrevSize: 5},
+		{Name: file, Op: Chmod},
+		{Name: other, Op: Write, Size: 4, PrevSize: -1},
+		{Name: other, Op: Write, Size: 5, PrevSize: 4},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestPipelineAppendOnly(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file, other := filepath.Join(tmp, "file"), filepath.Join(tmp, "other")
+	appendFile := func(path, data string) {
+		fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fp.Close()
+		if _, err := fp.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendFile(file, "hello")
+	appendFile(other, "data")
+
+	var (
+		mu   sync.Mutex
+		have []Event
+	)
+	p := newPipeline(func(e Event) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		have = append(have, e)
+		return true
+	})
+	defer p.close()
+	with := getOptions(WithAppendOnly(200 * time.Millisecond))
+	with.setRoot(tmp, false)
+	p.sizes.seed(tmp, with)
+
+	appendFile(file, ", world")
+	p.send(Event{Name: file, Op: Write}, with)
+	p.send(Event{Name: file, Op: Chmod}, with)
+	p.send(Event{Name: file, Op: Write}, with) // Didn't grow.
+	appendFile(file, "!")
+	p.send(Event{Name: file, Op: Write}, with)
+
+	appendFile(other, "more")
+	p.send(Event{Name: other, Op: Write}, with)
+	p.send(Event{Name: other, Op: Remove}, with) // Sends the pending Write first.
+
+	time.Sleep(500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	want := []Event{
+		{Name: other, Op: Write, Size: 8, PrevSize: 4},
+		{Name: other, Op: Remove},
+		{Name: file, Op: Write, Size: 13, PrevSize: 5},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+}
+
+func TestPipelineAppendOnlyDebounce(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "file")
+	if err := os.WriteFile(file, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu   sync.Mutex
+		have []Event
+	)
+	p := newPipeline(func(e Event) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		have = append(have, e)
+		return true
+	})
+	defer p.close()
+	with := getOptions(WithAppendOnly(50*time.Millisecond), WithDebounce(100*time.Millisecond))
+	with.setRoot(tmp, false)
+	p.sizes.seed(tmp, with)
+
+	// The Writes are merged by WithDebounce() before WithAppendOnly() sees
+	// them.
+	if err := os.WriteFile(file, []byte("hello, world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p.send(Event{Name: file, Op: Write}, with)
+	p.send(Event{Name: file, Op: Chmod}, with)
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if len(have) != 0 {
+		t.Errorf("sent before the debounce: %v", have)
+	}
+	mu.Unlock()
+
+	time.Sleep(300 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	want := []Event{{Name: file, Op: Write, Size: 12, PrevSize: 5}}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+}
+
+func TestPipelineDebounce(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		have []Event
+	)
+	p := newPipeline(func(e Event) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		have = append(have, e)
+		return true
+	})
+	defer p.close()
+	with := getOptions(WithDebounce(200*time.Millisecond), WithOps(Create|Write))
+
+	p.send(Event{Name: "/a", Op: Create}, with)
+	p.send(Event{Name: "/a", Op: Chmod}, with) // Dropped by WithOps().
+	p.send(Event{Name: "/b", Op: Write}, with)
+	time.Sleep(100 * time.Millisecond)
+	p.send(Event{Name: "/a", Op: Write}, with)
+
+	time.Sleep(150 * time.Millisecond) // /b is sent after 200ms, and /a after 300ms.
+	mu.Lock()
+	if want := []Event{{Name: "/b", Op: Write}}; !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+	mu.Unlock()
+
+	time.Sleep(250 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	want := []Event{
+		{Name: "/b", Op: Write},
+		{Name: "/a", Op: Create | Write},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestPipelineDebounceGoroutines(t *testing.T) {
+	t.Parallel()
+
+	p := newPipeline(func(Event) bool { return true })
+	defer p.close()
+	p.labels = pprof.Labels("fsnotify.test", "TestPipelineDebounceGoroutines")
+	with := getOptions(WithDebounce(time.Minute))
+	for i := 0; i < 100; i++ {
+		p.send(Event{Name: fmt.Sprintf("/file%d", i), Op: Write}, with)
+	}
+
+	// There is one goroutine for all pending paths; it may not have started
+	// yet.
+	var n int
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+			t.Fatal(err)
+		}
+		n = 0
+		for _, stack := range strings.Split(buf.String(), "\n\n") {
+			if strings.Contains(stack, `"fsnotify.test":"TestPipelineDebounceGoroutines"`) {
+				c, _ := strconv.Atoi(strings.Fields(stack)[0])
+				n += c
+			}
+		}
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n != 1 {
+		t.Errorf("%d goroutines; want 1", n)
+	}
+}
+
+func TestPipelineSettle(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		have []Event
+	)
+	p := newPipeline(func(e Event) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		have = append(have, e)
+		return true
+	})
+	defer p.close()
+	with := getOptions(WithSettle(100 * time.Millisecond))
+	with.setRoot("/tree", true)
+
+	p.send(Event{Name: "/tree/a", Op: Create}, with)
+	time.Sleep(50 * time.Millisecond)
+	p.send(Event{Name: "/tree/b", Op: Write}, with)
+	time.Sleep(250 * time.Millisecond)
+	p.send(Event{Name: "/tree/a", Op: Remove}, with)
+	time.Sleep(250 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []Event{
+		{Name: "/tree/a", Op: Create},
+		{Name: "/tree/b", Op: Write},
+		{Name: "/tree", Op: Settled},
+		{Name: "/tree/a", Op: Remove},
+		{Name: "/tree", Op: Settled},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestPipelineCompleteCreate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		have []Event
+	)
+	p := newPipeline(func(e Event) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		have = append(have, e)
+		return true
+	})
+	defer p.close()
+	with := getOptions(WithCompleteCreate(100 * time.Millisecond))
+
+	tmp := t.TempDir()
+	file, removed := filepath.Join(tmp, "file"), filepath.Join(tmp, "removed")
+	fp, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	if err := os.WriteFile(removed, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p.send(Event{Name: file, Op: Create}, with)
+	p.send(Event{Name: removed, Op: Create}, with)
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	p.send(Event{Name: removed, Op: Remove}, with)
+	for i := 0; i < 5; i++ {
+		if _, err := fp.WriteString("data"); err != nil {
+			t.Fatal(err)
+		}
+		p.send(Event{Name: file, Op: Write}, with)
+		time.Sleep(50 * time.Millisecond)
+	}
+	p.send(Event{Name: "/other", Op: Write}, with)
+
+	mu.Lock()
+	if want := []Event{{Name: "/other", Op: Write}}; !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+	mu.Unlock()
+
+	fp.Close()
+	time.Sleep(400 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	want := []Event{
+		{Name: "/other", Op: Write},
+		{Name: file, Op: Create},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestPipelinePriority(t *testing.T) {
+	t.Parallel()
+
+	var (
+		have    []Event
+		release = make(chan struct{})
+		sent    = make(chan struct{}, 10)
+	)
+	p := newPipeline(func(e Event) bool {
+		<-release
+		have = append(have, e)
+		sent <- struct{}{}
+		return true
+	})
+	defer p.close()
+	p.prioritize()
+	bulk, high := getOptions(), getOptions(WithPriority())
+
+	p.send(Event{Name: "/data/1", Op: Write}, bulk)
+	p.send(Event{Name: "/data/2", Op: Write}, bulk)
+	p.send(Event{Name: "/data/3", Op: Write}, bulk)
+	time.Sleep(50 * time.Millisecond) // Blocked on sending /data/1.
+	p.send(Event{Name: "/config", Op: Write}, high)
+
+	for i := 0; i < 4; i++ {
+		release <- struct{}{}
+		<-sent
+	}
+	want := []Event{
+		{Name: "/data/1", Op: Write},
+		{Name: "/config", Op: Write},
+		{Name: "/data/2", Op: Write},
+		{Name: "/data/3", Op: Write},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestPipelineRelativeNames(t *testing.T) {
+	t.Parallel()
+
+	var have []Event
+	p := newPipeline(func(e Event) bool {
+		have = append(have, e)
+		return true
+	})
+	with := getOptions(WithRelativeNames())
+	with.setRoot(filepath.FromSlash("/data"), true)
+
+	for _, n := range []string{"/data", "/data/file", "/data/sub/file", "/data/..file", "/other"} {
+		p.send(Event{Name: filepath.FromSlash(n), Op: Write}, with)
+	}
+
+	want := []Event{
+		{Name: ".", Op: Write},
+		{Name: "file", Op: Write},
+		{Name: filepath.FromSlash("sub/file"), Op: Write},
+		{Name: "..file", Op: Write},
+		{Name: filepath.FromSlash("/other"), Op: Write},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestPipelineUse(t *testing.T) {
+	t.Parallel()
+
+	var have []Event
+	p := newPipeline(func(e Event) bool {
+		have = append(have, e)
+		return true
+	})
+	p.use(func(e Event) (Event, bool) { return e, e.Op != Chmod })
+	p.use(func(e Event) (Event, bool) {
+		e.Name = strings.TrimPrefix(e.Name, "/data")
+		return e, true
+	})
+	with := getOptions()
+
+	p.send(Event{Name: "/data/a", Op: Write}, with)
+	p.send(Event{Name: "/data/a", Op: Chmod}, with)
+	p.send(Event{Name: "/data/b", Op: Create}, with)
+
+	want := []Event{
+		{Name: "/a", Op: Write},
+		{Name: "/b", Op: Create},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestPipelinePanic(t *testing.T) {
+	t.Parallel()
+
+	var (
+		have []Event
+		errs []error
+	)
+	p := newPipeline(func(e Event) bool {
+		have = append(have, e)
+		return true
+	})
+	p.sendErr = func(err error) bool {
+		errs = append(errs, err)
+		return true
+	}
+	p.use(func(e Event) (Event, bool) {
+		if e.Name == "/use" {
+			panic("use")
+		}
+		return e, true
+	})
+	ch, _ := p.subscribe(func(e Event) bool {
+		if e.Name == "/sub" {
+			panic("sub")
+		}
+		return false
+	})
+	with := getOptions()
+
+	p.send(Event{Name: "/use", Op: Write}, with)
+	p.send(Event{Name: "/sub", Op: Write}, with)
+	p.send(Event{Name: "/ok", Op: Write}, with)
+
+	want := []Event{
+		{Name: "/sub", Op: Write},
+		{Name: "/ok", Op: Write},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("event sent to subscription: %v", e)
+	default:
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("want 2 errors, have %d: %v", len(errs), errs)
+	}
+	for i, fn := range []string{"Use", "Subscribe"} {
+		var perr *PanicError
+		if !errors.As(errs[i], &perr) {
+			t.Fatalf("not a *PanicError: %#v", errs[i])
+		}
+		if perr.Func != fn || perr.Stack == "" {
+			t.Errorf("wrong error: %v", perr)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// portableDelay is how long events are held with WithPortable(), so that
+// events that arrive close together can be reordered and merged.
+const portableDelay = 50 * time.Millisecond
+
+// portableQueue holds events for portableDelay and sends them in the same
+// shape on all platforms, for WithPortable().
+type portableQueue struct {
+	deliver func(e Event, high bool) bool
+	flushMu sync.Mutex // Held while sending a batch, so batches are sent in order.
+
+	mu    sync.Mutex // Protects everything below.
+	batch []portableEvent
+	held  int // Events in batch and events being sent by flush().
+}
+
+type portableEvent struct {
+	e    Event
+	high bool // Sent WithPriority().
+}
+
+func newPortableQueue(deliver func(e Event, high bool) bool) *portableQueue {
+	return &portableQueue{deliver: deliver}
+}
+
+// len returns the number of held events; it's 0 for a nil queue.
+func (q *portableQueue) len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.held
+}
+
+// send adds e to the current batch, which is sent portableDelay after its first
+// event, according to the clock of that event.
+func (q *portableQueue) send(e Event, high bool, clock Clock, done <-chan struct{}, labels pprof.LabelSet) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.batch = append(q.batch, portableEvent{e: e, high: high})
+	q.held++
+	if len(q.batch) == 1 {
+		goLabeled(labels, "portable", func() { q.wait(clock, done) })
+	}
+	return true
+}
+
+// wait sends the current batch after portableDelay, unless done is closed
+// first.
+func (q *portableQueue) wait(clock Clock, done <-chan struct{}) {
+	t := clock.NewTimer(portableDelay)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		q.flush()
+	case <-done:
+	}
+}
+
+func (q *portableQueue) flush() {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+
+	q.mu.Lock()
+	batch := normalizeEvents(q.batch)
+	q.held -= len(q.batch) - len(batch)
+	q.batch = nil
+	q.mu.Unlock()
+
+	for i, pe := range batch {
+		ok := q.deliver(pe.e, pe.high)
+		q.mu.Lock()
+		q.held--
+		if !ok {
+			q.held -= len(batch) - i - 1
+		}
+		q.mu.Unlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// normalizeEvents merges and reorders the events in batch:
+//
+//   - A Write for a path directly after a Write for the same path is merged
+//     with it.
+//   - A Create for a path that was already created in the batch, without a
+//     Remove or Rename since, is dropped.
+//   - Remove events for paths in a directory are moved before the Remove for
+//     the directory.
+func normalizeEvents(batch []portableEvent) []portableEvent {
+	out := make([]portableEvent, 0, len(batch))
+	last := make(map[string]int) // Index in out of the last event for a path.
+	for _, pe := range batch {
+		if i, ok := last[pe.e.Name]; ok {
+			prev := &out[i]
+			if pe.e.Op == Write && prev.e.Op == Write {
+				prev.e.Size = pe.e.Size
+				prev.high = prev.high || pe.high
+				continue
+			}
+			if pe.e.Op == Create && prev.e.Has(Create) && !prev.e.Has(Remove) && !prev.e.Has(Rename) {
+				continue
+			}
+		}
+		last[pe.e.Name] = len(out)
+		out = append(out, pe)
+	}
+
+	for i := 0; i < len(out); i++ {
+		if !out[i].e.Has(Remove) {
+			continue
+		}
+		dir := out[i].e.Name + string(filepath.Separator)
+		var under, rest []portableEvent
+		for _, pe := range out[i+1:] {
+			if pe.e.Has(Remove) && strings.HasPrefix(pe.e.Name, dir) {
+				under = append(under, pe)
+			} else {
+				rest = append(rest, pe)
+			}
+		}
+		if len(under) == 0 {
+			continue
+		}
+		out = append(append(append(out[:i:i], under...), out[i]), rest...)
+		i-- // The moved events may need reordering among themselves.
+	}
+	return out
+}
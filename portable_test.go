@@ -0,0 +1,90 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeEvents(t *testing.T) {
+	j := filepath.FromSlash
+	tests := []struct {
+		name     string
+		in, want []Event
+	}{
+		{"empty", nil, []Event{}},
+		{"writes",
+			[]Event{{Name: "/a", Op: Write, Size: 1}, {Name: "/b", Op: Write}, {Name: "/a", Op: Write, Size: 2}, {Name: "/a", Op: Chmod}, {Name: "/a", Op: Write}},
+			[]Event{{Name: "/a", Op: Write, Size: 2}, {Name: "/b", Op: Write}, {Name: "/a", Op: Chmod}, {Name: "/a", Op: Write}},
+		},
+		{"creates",
+			[]Event{{Name: "/a", Op: Create}, {Name: "/a", Op: Create}, {Name: "/a", Op: Remove}, {Name: "/a", Op: Create}},
+			[]Event{{Name: "/a", Op: Create}, {Name: "/a", Op: Remove}, {Name: "/a", Op: Create}},
+		},
+		{"removes",
+			[]Event{
+				{Name: j("/dir"), Op: Remove},
+				{Name: j("/other"), Op: Write},
+				{Name: j("/dir/sub"), Op: Remove},
+				{Name: j("/dir/file"), Op: Remove},
+				{Name: j("/dir/sub/file"), Op: Remove},
+				{Name: j("/dirfile"), Op: Remove},
+			},
+			[]Event{
+				{Name: j("/dir/sub/file"), Op: Remove},
+				{Name: j("/dir/sub"), Op: Remove},
+				{Name: j("/dir/file"), Op: Remove},
+				{Name: j("/dir"), Op: Remove},
+				{Name: j("/other"), Op: Write},
+				{Name: j("/dirfile"), Op: Remove},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in []portableEvent
+			for _, e := range tt.in {
+				in = append(in, portableEvent{e: e})
+			}
+			have := []Event{}
+			for _, pe := range normalizeEvents(in) {
+				have = append(have, pe.e)
+			}
+			if !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("\nhave: %v\nwant: %v", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelinePortable(t *testing.T) {
+	t.Parallel()
+
+	have := make(chan Event, 10)
+	p := newPipeline(func(e Event) bool {
+		have <- e
+		return true
+	})
+	defer p.close()
+	p.portable = newPortableQueue(p.queue)
+	with := getOptions()
+
+	p.send(Event{Name: "/a", Op: Write}, with)
+	p.send(Event{Name: "/a", Op: Write}, with)
+	if n := p.pending(); n != 2 {
+		t.Errorf("pending: %d; want 2", n)
+	}
+	if !p.flush(time.Now().Add(time.Second)) {
+		t.Fatal("flush timed out")
+	}
+	close(have)
+
+	var events []Event
+	for e := range have {
+		events = append(events, e)
+	}
+	if want := []Event{{Name: "/a", Op: Write}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("\nhave: %v\nwant: %v", events, want)
+	}
+}
@@ -0,0 +1,138 @@
+package fsnotify
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Limit is a system limit that applies to watches, as reported by Preflight().
+type Limit struct {
+	Name string // Name of the limit, such as "fs.inotify.max_user_watches".
+	Need int    // Estimated number that's needed for the paths.
+	Used int    // Number already in use by this process; -1 if it's unknown.
+	Max  int    // The limit; -1 if it's unknown or unlimited.
+}
+
+// Exceeded reports if Need and Used together are more than the limit.
+func (l Limit) Exceeded() bool { return l.Max >= 0 && l.Need+l.used() > l.Max }
+
+func (l Limit) used() int {
+	if l.Used < 0 {
+		return 0
+	}
+	return l.Used
+}
+
+func (l Limit) String() string {
+	var used string
+	if l.Used > 0 {
+		used = fmt.Sprintf(" (%d in use)", l.Used)
+	}
+	if l.Max < 0 {
+		return fmt.Sprintf("%s: need %d%s (no known limit)", l.Name, l.Need, used)
+	}
+	return fmt.Sprintf("%s: need %d of %d%s", l.Name, l.Need, l.Max, used)
+}
+
+// PreflightReport is returned by Preflight().
+type PreflightReport struct {
+	Dirs   int     // Number of directories that would be watched.
+	Files  int     // Number of other entries in those directories, and files in the paths.
+	Limits []Limit // Limits that apply on this platform.
+}
+
+// OK reports if none of the limits are exceeded.
+func (r PreflightReport) OK() bool {
+	for _, l := range r.Limits {
+		if l.Exceeded() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r PreflightReport) String() string {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "%d directories, %d files", r.Dirs, r.Files)
+	for _, l := range r.Limits {
+		b.WriteString("\n")
+		b.WriteString(l.String())
+		if l.Exceeded() {
+			b.WriteString(" (exceeded)")
+		}
+	}
+	return b.String()
+}
+
+// Preflight estimates how many watches and file descriptors are needed to
+// watch paths, and compares that to the system limits, so that programs can
+// warn about it before adding any watches. A path ending in "/..." is counted
+// as a recursive watch, like with Add().
+//
+// The limits are:
+//
+//   - inotify: fs.inotify.max_user_watches for the directories (and files in
+//     paths), fs.inotify.max_user_instances for the watcher, and
+//     RLIMIT_NOFILE for its file descriptor.
+//   - kqueue: RLIMIT_NOFILE and kern.maxfilesperproc (kern.maxfiles on
+//     OpenBSD and NetBSD) for the file descriptors; kqueue opens every
+//     directory and every file in them.
+//   - There are no limits that apply on Windows.
+//
+// Used is what this process already uses, including the watches and files of
+// other watchers. Calling Preflight() without any paths reports just that.
+//
+// In a container the inotify limits are those of the user namespace (the
+// lowest of fs.inotify.* and user.max_inotify_*), and RLIMIT_NOFILE is the
+// limit of the container.
+//
+// This is an estimate: the inotify limits are per user, and are shared with
+// other programs running as the same user, which aren't included in Used.
+func Preflight(paths ...string) (PreflightReport, error) {
+	var r PreflightReport
+	var added int
+	for _, path := range paths {
+		path, recurse := recursivePath(path)
+		fi, err := os.Stat(path)
+		if err != nil {
+			return PreflightReport{}, err
+		}
+		if !fi.IsDir() {
+			if recurse {
+				return PreflightReport{}, fmt.Errorf("fsnotify: not a directory: %q", path)
+			}
+			r.Files++
+			added++
+			continue
+		}
+		if !recurse {
+			r.Dirs++
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return PreflightReport{}, err
+			}
+			r.Files += len(entries)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				r.Dirs++
+			} else {
+				r.Files++
+			}
+			return nil
+		})
+		if err != nil {
+			return PreflightReport{}, err
+		}
+	}
+	r.Limits = preflightLimits(r.Dirs, r.Files, added)
+	return r, nil
+}
@@ -0,0 +1,39 @@
+//go:build freebsd || openbsd || netbsd || dragonfly || darwin
+// +build freebsd openbsd netbsd dragonfly darwin
+
+package fsnotify
+
+import (
+	"math"
+
+	"golang.org/x/sys/unix"
+)
+
+// preflightLimits returns the file descriptor limits for watching dirs
+// directories with files files in them. kqueue opens every file, and the
+// kqueue and the pipe used for closing it need three more.
+func preflightLimits(dirs, files, added int) []Limit {
+	need := dirs + files + 3
+
+	nofile := -1
+	var rlim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlim); err == nil && uint64(rlim.Cur) <= math.MaxInt32 {
+		nofile = int(rlim.Cur)
+	}
+
+	name := "kern.maxfilesperproc"
+	max, err := unix.SysctlUint32(name)
+	if err != nil {
+		name = "kern.maxfiles"
+		max, err = unix.SysctlUint32(name)
+	}
+	maxfiles := -1
+	if err == nil && max <= math.MaxInt32 {
+		maxfiles = int(max)
+	}
+
+	return []Limit{
+		{Name: "RLIMIT_NOFILE", Need: need, Max: nofile},
+		{Name: name, Need: need, Max: maxfiles},
+	}
+}
@@ -0,0 +1,84 @@
+package fsnotify
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// preflightLimits returns the inotify and file descriptor limits for watching
+// dirs directories and added files.
+func preflightLimits(dirs, files, added int) []Limit {
+	watches, instances, fds := inotifyUsage()
+
+	nofile := -1
+	var rlim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlim); err == nil && rlim.Cur <= math.MaxInt32 {
+		nofile = int(rlim.Cur)
+	}
+
+	return []Limit{
+		{Name: "fs.inotify.max_user_watches", Need: dirs + added, Used: watches,
+			Max: minLimit(readLimit("/proc/sys/fs/inotify/max_user_watches"), readLimit("/proc/sys/user/max_inotify_watches"))},
+		{Name: "fs.inotify.max_user_instances", Need: 1, Used: instances,
+			Max: minLimit(readLimit("/proc/sys/fs/inotify/max_user_instances"), readLimit("/proc/sys/user/max_inotify_instances"))},
+		{Name: "RLIMIT_NOFILE", Need: 1, Used: fds, Max: nofile},
+	}
+}
+
+// inotifyUsage returns the number of inotify watches, inotify instances, and
+// file descriptors this process uses, from /proc/self/fdinfo. They're -1 if
+// that can't be read.
+func inotifyUsage() (watches, instances, fds int) {
+	entries, err := os.ReadDir("/proc/self/fdinfo")
+	if err != nil {
+		return -1, -1, -1
+	}
+	for _, e := range entries {
+		fds++
+		link, err := os.Readlink("/proc/self/fd/" + e.Name())
+		if err != nil || link != "anon_inode:inotify" {
+			continue
+		}
+		instances++
+		info, err := os.ReadFile("/proc/self/fdinfo/" + e.Name())
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(info), "\n") {
+			if strings.HasPrefix(line, "inotify wd:") {
+				watches++
+			}
+		}
+	}
+	// Don't count the directory that ReadDir() had open.
+	return watches, instances, fds - 1
+}
+
+// minLimit returns the lowest of the limits a and b, which are -1 if unknown.
+// The inotify limits in fs.inotify are those of the initial user namespace,
+// and the ones in user are those of the current user namespace; the lowest
+// applies.
+func minLimit(a, b int) int {
+	if a < 0 || (b >= 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// readLimit reads a number from a file in /proc/sys, returning -1 if it can't
+// be read.
+func readLimit(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !freebsd && !openbsd && !netbsd && !dragonfly && !darwin
+// +build !linux,!freebsd,!openbsd,!netbsd,!dragonfly,!darwin
+
+package fsnotify
+
+// preflightLimits returns no limits, as there are none that apply.
+func preflightLimits(dirs, files, added int) []Limit {
+	return nil
+}
@@ -0,0 +1,86 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "a")
+	mkdir(t, tmp, "a", "b")
+	touch(t, tmp, "file")
+	touch(t, tmp, "a", "file")
+	touch(t, tmp, "a", "b", "file")
+
+	tests := []struct {
+		paths        []string
+		dirs, files  int
+		linuxWatches int
+	}{
+		{[]string{filepath.Join(tmp, "...")}, 3, 3, 3},
+		{[]string{tmp}, 1, 2, 1},
+		{[]string{filepath.Join(tmp, "file")}, 0, 1, 1},
+		{[]string{filepath.Join(tmp, "a", "..."), filepath.Join(tmp, "file")}, 2, 3, 3},
+	}
+	for _, tt := range tests {
+		r, err := Preflight(tt.paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Dirs != tt.dirs || r.Files != tt.files {
+			t.Errorf("%q: have %d dirs, %d files; want %d dirs, %d files",
+				tt.paths, r.Dirs, r.Files, tt.dirs, tt.files)
+		}
+		if runtime.GOOS == "linux" {
+			if len(r.Limits) == 0 || r.Limits[0].Need != tt.linuxWatches {
+				t.Errorf("%q: wrong limits: %v", tt.paths, r.Limits)
+			}
+		}
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := Preflight(filepath.Join(tmp, "nonexistent")); err == nil {
+			t.Error("no error for nonexistent path")
+		}
+		if _, err := Preflight(filepath.Join(tmp, "file", "...")); err == nil {
+			t.Error("no error for recursive file")
+		}
+	})
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		l        Limit
+		exceeded bool
+		str      string
+	}{
+		{Limit{Name: "max", Need: 10, Max: 100}, false, "max: need 10 of 100"},
+		{Limit{Name: "max", Need: 100, Max: 100}, false, "max: need 100 of 100"},
+		{Limit{Name: "max", Need: 101, Max: 100}, true, "max: need 101 of 100"},
+		{Limit{Name: "max", Need: 101, Max: -1}, false, "max: need 101 (no known limit)"},
+		{Limit{Name: "max", Need: 10, Used: 90, Max: 100}, false, "max: need 10 of 100 (90 in use)"},
+		{Limit{Name: "max", Need: 10, Used: 91, Max: 100}, true, "max: need 10 of 100 (91 in use)"},
+		{Limit{Name: "max", Need: 101, Used: -1, Max: 100}, true, "max: need 101 of 100"},
+	}
+	for _, tt := range tests {
+		if have := tt.l.Exceeded(); have != tt.exceeded {
+			t.Errorf("%s: Exceeded() = %t; want %t", tt.l, have, tt.exceeded)
+		}
+		if have := tt.l.String(); have != tt.str {
+			t.Errorf("\nhave: %s\nwant: %s", have, tt.str)
+		}
+	}
+
+	r := PreflightReport{Limits: []Limit{{Name: "a", Need: 1, Max: 2}, {Name: "b", Need: 3, Max: 2}}}
+	if r.OK() {
+		t.Error("OK() is true with an exceeded limit")
+	}
+	r.Limits = r.Limits[:1]
+	if !r.OK() {
+		t.Error("OK() is false without an exceeded limit")
+	}
+}
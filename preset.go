@@ -0,0 +1,71 @@
+package fsnotify
+
+// IgnorePreset is a curated set of ignore rules for WithIgnorePreset().
+type IgnorePreset struct {
+	name  string
+	rules []string
+}
+
+// The ignore presets.
+var (
+	// Temporary, swap, and backup files from editors: Vim, Emacs, JetBrains
+	// IDEs (with "safe write"), Kate, and gedit. Classify() uses the same
+	// rules.
+	IgnoreEditors = IgnorePreset{"editors", []string{
+		// Vim swap files and backups; Vim checks if it can write to a
+		// directory by creating "4913".
+		"*.swp", "*.swo", "*.swx", "*~", "4913",
+		// Emacs auto-save files and locks.
+		`\#*#`, ".#*",
+		// JetBrains "safe write", Kate, and gedit.
+		"*___jb_tmp___", "*___jb_old___", ".*.kate-swp", ".goutputstream-*",
+	}}
+
+	// Metadata files created by the operating system or file manager.
+	IgnoreOS = IgnorePreset{"os", []string{
+		// macOS
+		".DS_Store", "._*", ".Spotlight-V100/", ".Trashes/", ".fseventsd/",
+		// Windows, and Microsoft Office lock files.
+		"Thumbs.db", "desktop.ini", "~$*",
+		// Linux desktops and NFS.
+		".directory", ".Trash-*/", ".nfs*",
+	}}
+
+	// Version control directories.
+	IgnoreVCS = IgnorePreset{"vcs", []string{
+		".git/", ".hg/", ".svn/", ".bzr/", "_darcs/", ".jj/",
+	}}
+
+	// Dependency and build output directories of common build tools.
+	IgnoreBuildDirs = IgnorePreset{"build-dirs", []string{
+		"node_modules/",
+		"target/",
+		".gradle/",
+		"__pycache__/",
+		".venv/",
+		".tox/",
+		".zig-cache/",
+		"zig-out/",
+	}}
+)
+
+// String returns the name of the preset.
+func (p IgnorePreset) String() string { return p.name }
+
+// Rules returns the ignore rules in the gitignore format.
+func (p IgnorePreset) Rules() []string {
+	return append([]string(nil), p.rules...)
+}
+
+// WithIgnorePreset excludes paths matching the rules of the presets; this is
+// the same as WithIgnore() with the rules of all presets, and can be combined
+// with it.
+//
+//	w.AddWith("dir/...", fsnotify.WithIgnorePreset(fsnotify.IgnoreEditors, fsnotify.IgnoreVCS))
+func WithIgnorePreset(presets ...IgnorePreset) addOpt {
+	var rules []string
+	for _, p := range presets {
+		rules = append(rules, p.rules...)
+	}
+	return WithIgnore(rules...)
+}
@@ -0,0 +1,81 @@
+package fsnotify
+
+import "sync/atomic"
+
+// The number of events that can be queued for watches added with and without
+// WithPriority(), before sending more events blocks.
+const (
+	priorityQueue = 1024
+	bulkQueue     = 4096
+)
+
+// deliveryQueue holds the events that are waiting to be sent, so that the
+// events for watches added WithPriority() can be sent ahead of the others when
+// the Events channel isn't read fast enough.
+type deliveryQueue struct {
+	high chan Event
+	bulk chan Event
+}
+
+// prioritize starts sending events through the delivery queue, for
+// WithPriority(). It's safe to call this more than once.
+func (p *pipeline) prioritize() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.delivery != nil || p.closed {
+		return
+	}
+	p.delivery = &deliveryQueue{
+		high: make(chan Event, priorityQueue),
+		bulk: make(chan Event, bulkQueue),
+	}
+	q := p.delivery
+	goLabeled(p.labels, "delivery", func() { p.runDelivery(q) })
+}
+
+// queue sends e, through the delivery queue if there is one.
+// Returns false if the watcher is closed.
+func (p *pipeline) queue(e Event, high bool) bool {
+	atomic.AddInt32(&p.inflight, 1)
+	p.mu.Lock()
+	q := p.delivery
+	p.mu.Unlock()
+	if q == nil {
+		defer atomic.AddInt32(&p.inflight, -1)
+		return p.dispatch(e)
+	}
+
+	ch := q.bulk
+	if high {
+		ch = q.high
+	}
+	select {
+	case ch <- e:
+		return true // runDelivery() decrements inflight.
+	case <-p.done:
+	}
+	atomic.AddInt32(&p.inflight, -1)
+	return false
+}
+
+// runDelivery sends the events in q, the ones in q.high first.
+func (p *pipeline) runDelivery(q *deliveryQueue) {
+	for {
+		var e Event
+		select {
+		case e = <-q.high:
+		default:
+			select {
+			case e = <-q.high:
+			case e = <-q.bulk:
+			case <-p.done:
+				return
+			}
+		}
+		ok := p.dispatch(e)
+		atomic.AddInt32(&p.inflight, -1)
+		if !ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package fsnotify
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// GroupQuota limits the resources a watch group can use, so that one group
+// can't use up the system limits for all of them; see WatchGroup.SetQuota().
+type GroupQuota struct {
+	// Maximum number of watches the system uses for the group, or 0 for no
+	// limit. This is one watch for every directory with inotify (Linux), one
+	// for every file and directory with kqueue (BSD, macOS), and one for every
+	// path added on Windows.
+	MaxWatches int
+
+	// Maximum number of events per second, or 0 for no limit. Bursts of up to
+	// MaxEvents events (and at least one event) are allowed; events over the
+	// limit are dropped.
+	MaxEvents float64
+}
+
+// QuotaError is returned by AddWith(), and sent on the Errors channel, when a
+// watch group exceeds its GroupQuota. errors.Is(err, ErrQuota) reports true
+// for it.
+type QuotaError struct {
+	Group string  // Name of the watch group.
+	Limit string  // The limit that was exceeded: "MaxWatches" or "MaxEvents".
+	Max   float64 // Value of the limit.
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: group %q: %s=%g", ErrQuota, e.Group, e.Limit, e.Max)
+}
+
+func (e *QuotaError) Is(target error) bool { return target == ErrQuota }
+
+// groupQuota is the quota of a group, and the state to enforce it.
+type groupQuota struct {
+	GroupQuota
+	tokens   float64   // Events that can be sent right now, for MaxEvents.
+	last     time.Time // When tokens was updated.
+	dropping bool      // Events are being dropped; the error was sent.
+	dropped  gap       // Events dropped since the last one was sent.
+	full     bool      // New watches are being skipped; the error was sent.
+}
+
+// burst is the number of events that can be sent at once; at least one, as
+// otherwise a MaxEvents below 1 would never allow any event.
+func (q *groupQuota) burst() float64 { return math.Max(1, q.MaxEvents) }
+
+// setQuota sets the quota for group; a zero GroupQuota removes it.
+func (p *pipeline) setQuota(group string, q GroupQuota) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if q == (GroupQuota{}) {
+		delete(p.quotas, group)
+		return
+	}
+	if p.quotas == nil {
+		p.quotas = make(map[string]*groupQuota)
+	}
+	gq := &groupQuota{GroupQuota: q}
+	gq.tokens = gq.burst()
+	p.quotas[group] = gq
+}
+
+// allowEvent reports if an event for the watch root can be sent for group,
+// according to its MaxEvents. The error is set for the first event that's
+// dropped, and for the first event that's sent after that, to report the gap.
+func (p *pipeline) allowEvent(group, root string, clock Clock) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q, ok := p.quotas[group]
+	if !ok || q.MaxEvents <= 0 {
+		return true, nil
+	}
+
+	now := clock.Now()
+	if !q.last.IsZero() {
+		q.tokens += now.Sub(q.last).Seconds() * q.MaxEvents
+		if b := q.burst(); q.tokens > b {
+			q.tokens = b
+		}
+	}
+	q.last = now
+	if q.tokens >= 1 {
+		q.tokens--
+		q.dropping = false
+		return true, q.dropped.take(&QuotaError{Group: group, Limit: "MaxEvents", Max: q.MaxEvents})
+	}
+	q.dropped.add(root)
+	if q.dropping {
+		return false, nil
+	}
+	q.dropping = true
+	return false, &QuotaError{Group: group, Limit: "MaxEvents", Max: q.MaxEvents}
+}
+
+// checkWatches returns a *QuotaError if group would have more than MaxWatches
+// after adding more watches; count returns the number of watches it has now.
+//
+// The lock is held while counting, so that concurrent calls can't all see
+// room for the same watches.
+func (p *pipeline) checkWatches(group string, count func(string) int, more int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.checkWatchesLocked(group, count, more)
+}
+
+// checkWatchesLocked implements checkWatches(); p.mu must be held.
+func (p *pipeline) checkWatchesLocked(group string, count func(string) int, more int) error {
+	q, ok := p.quotas[group]
+	if !ok || q.MaxWatches <= 0 {
+		return nil
+	}
+	if count(group)+more <= q.MaxWatches {
+		return nil
+	}
+	return &QuotaError{Group: group, Limit: "MaxWatches", Max: float64(q.MaxWatches)}
+}
+
+// skipWatch reports if a new watch for a directory or file that appeared in
+// group should be skipped because it's at MaxWatches. The error is set for the
+// first one that's skipped.
+func (p *pipeline) skipWatch(group string, count func(string) int) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q, ok := p.quotas[group]
+	if !ok {
+		return false, nil
+	}
+	err := p.checkWatchesLocked(group, count, 1)
+	if err == nil {
+		q.full = false
+		return false, nil
+	}
+	if q.full {
+		return true, nil
+	}
+	q.full = true
+	return true, err
+}
@@ -0,0 +1,152 @@
+package fsnotify
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupQuotaWatches(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the number of watches depends on the platform")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	mkdir(t, tmp, "a")
+	mkdir(t, tmp, "b")
+	mkdir(t, tmp, "c")
+	mkdir(t, tmp, "tree")
+
+	w := newWatcher(t)
+	defer w.Close()
+	g := w.Group("g")
+	g.SetQuota(GroupQuota{MaxWatches: 2})
+	if err := g.Add(filepath.Join(tmp, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add(filepath.Join(tmp, "b")); err != nil {
+		t.Fatal(err)
+	}
+	err := g.Add(filepath.Join(tmp, "c"))
+	var qErr *QuotaError
+	if !errors.Is(err, ErrQuota) || !errors.As(err, &qErr) || qErr.Limit != "MaxWatches" || qErr.Group != "g" {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if ErrorKindOf(err) != KindLimit {
+		t.Errorf("wrong kind: %s", ErrorKindOf(err))
+	}
+	if n := g.Watches(); n != 2 {
+		t.Errorf("Watches() = %d; want 2", n)
+	}
+	want := []string{filepath.Join(tmp, "a"), filepath.Join(tmp, "b")}
+	if have := g.WatchList(); !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+
+	// New directories in a recursive watch.
+	t2 := w.Group("tree")
+	t2.SetQuota(GroupQuota{MaxWatches: 2})
+	if err := t2.Add(filepath.Join(tmp, "tree", "...")); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range w.Events {
+		}
+	}()
+	mkdir(t, tmp, "tree", "x")
+	mkdir(t, tmp, "tree", "y")
+	mkdir(t, tmp, "tree", "z")
+	select {
+	case err := <-w.Errors:
+		if !errors.As(err, &qErr) || qErr.Group != "tree" {
+			t.Errorf("wrong error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error")
+	}
+	select {
+	case err := <-w.Errors:
+		t.Errorf("error sent twice: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if n := t2.Watches(); n != 2 {
+		t.Errorf("Watches() = %d; want 2", n)
+	}
+}
+
+func TestGroupQuotaEvents(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		have []Event
+		errs []error
+	)
+	p := newPipeline(func(e Event) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		have = append(have, e)
+		return true
+	})
+	defer p.close()
+	p.sendErr = func(err error) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+		return true
+	}
+	p.setQuota("g", GroupQuota{MaxEvents: 2})
+	with, other := getOptions(WithGroup("g")), getOptions()
+	with.setRoot("/g", false)
+
+	for i := 0; i < 5; i++ {
+		p.send(Event{Name: "/g", Op: Write}, with)
+		p.send(Event{Name: "/other", Op: Write}, other)
+	}
+	time.Sleep(600 * time.Millisecond)
+	p.send(Event{Name: "/g", Op: Create}, with)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var n int
+	for _, e := range have {
+		if e.Group == "g" {
+			n++
+		}
+	}
+	if n != 3 || len(have) != 8 {
+		t.Errorf("wrong events: %v", have)
+	}
+	if len(errs) != 2 || !errors.Is(errs[0], ErrQuota) {
+		t.Fatalf("wrong errors: %v", errs)
+	}
+
+	// The gap is reported once events are sent again.
+	var gerr *GapError
+	if !errors.As(errs[1], &gerr) || !errors.Is(gerr, ErrQuota) {
+		t.Fatalf("not a *GapError: %#v", errs[1])
+	}
+	if gerr.Dropped != 3 || !reflect.DeepEqual(gerr.Roots, []string{"/g"}) {
+		t.Errorf("wrong gap: %v", gerr)
+	}
+}
+
+func TestGroupQuotaEventsBelowOne(t *testing.T) {
+	t.Parallel()
+
+	p := newPipeline(func(Event) bool { return true })
+	defer p.close()
+	p.setQuota("g", GroupQuota{MaxEvents: 0.5})
+
+	if ok, _ := p.allowEvent("g", "/g", SystemClock); !ok {
+		t.Error("first event dropped")
+	}
+	if ok, _ := p.allowEvent("g", "/g", SystemClock); ok {
+		t.Error("second event not dropped")
+	}
+}
@@ -0,0 +1,65 @@
+package fsnotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// dirBatch is the number of directory entries that are stat'ed at a time, so
+// that the file information for a directory with a lot of files isn't all in
+// memory at once.
+const dirBatch = 1000
+
+// readDirBatches calls fn for the entries of dir sorted by name, dirBatch at a
+// time. Entries that are removed before they're stat'ed are skipped. It stops
+// early without an error once done is closed, and returns the first error from
+// fn.
+//
+// All names are read first, so that the order doesn't depend on the order the
+// filesystem returns them in.
+func readDirBatches(dir string, done <-chan struct{}, fn func([]os.FileInfo) error) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	list := make([]os.FileInfo, 0, dirBatch)
+	for len(names) > 0 {
+		n := dirBatch
+		if n > len(names) {
+			n = len(names)
+		}
+		list = list[:0]
+		for _, name := range names[:n] {
+			fi, err := os.Lstat(filepath.Join(dir, name))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			list = append(list, fi)
+		}
+		names = names[n:]
+		if len(list) > 0 {
+			if err := fn(list); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+	}
+	return nil
+}
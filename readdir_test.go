@@ -0,0 +1,57 @@
+package fsnotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestReadDirBatches(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	n := dirBatch*2 + dirBatch/2
+	for i := 0; i < n; i++ {
+		if err := os.WriteFile(filepath.Join(tmp, fmt.Sprintf("file%d", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		batches []int
+		names   []string
+	)
+	err := readDirBatches(tmp, nil, func(files []os.FileInfo) error {
+		batches = append(batches, len(files))
+		for _, fi := range files {
+			names = append(names, fi.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || batches[0] != dirBatch || batches[2] != dirBatch/2 {
+		t.Errorf("wrong batches: %v", batches)
+	}
+	if len(names) != n {
+		t.Errorf("saw %d files; want %d", len(names), n)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Error("not sorted across batches")
+	}
+
+	// Stops after the first batch once done is closed.
+	done := make(chan struct{})
+	close(done)
+	batches = batches[:0]
+	err = readDirBatches(tmp, done, func(files []os.FileInfo) error {
+		batches = append(batches, len(files))
+		return nil
+	})
+	if err != nil || len(batches) != 1 {
+		t.Errorf("not stopped: %v, %v", batches, err)
+	}
+}
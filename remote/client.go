@@ -0,0 +1,218 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc"
+)
+
+// ErrClosed is returned for operations on a closed Watcher, or a Watcher whose
+// connection to the server was lost.
+var ErrClosed = errors.New("fsnotify/remote: watcher closed")
+
+var _ fsnotify.Notifier = (*Watcher)(nil)
+
+// Watcher watches a set of files on a remote server, delivering events to a
+// channel.
+//
+// It implements fsnotify.Notifier. All paths are paths on the server.
+type Watcher struct {
+	// Events sends the events from the server.
+	Events chan fsnotify.Event
+
+	// Errors sends the errors from the server's watcher, and the error if the
+	// connection to the server is lost. The Events and Errors channels are
+	// closed after the connection is lost.
+	Errors chan error
+
+	stream   grpc.ClientStream
+	cancel   context.CancelFunc
+	sendMu   sync.Mutex // Protects sending on stream.
+	mu       sync.Mutex // Protects lastID, pending, and closed.
+	lastID   uint64
+	pending  map[uint64]chan *response
+	closed   bool
+	done     chan struct{} // Closed on Close().
+	doneResp chan struct{} // Closed once the reader goroutine exits.
+}
+
+// NewWatcher creates a new watcher on the server that cc is connected to,
+// which must have the service registered with Register().
+func NewWatcher(cc grpc.ClientConnInterface) (*Watcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := cc.NewStream(ctx, &serviceDesc.Streams[0], watchMethod,
+		grpc.CallContentSubtype(codecName))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	w := &Watcher{
+		Events:   make(chan fsnotify.Event),
+		Errors:   make(chan error),
+		stream:   stream,
+		cancel:   cancel,
+		pending:  make(map[uint64]chan *response),
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+// Close closes the watcher on the server, and the Events and Errors channels.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.isClosed() {
+		w.mu.Unlock()
+		return nil
+	}
+	close(w.done)
+	w.mu.Unlock()
+
+	w.sendMu.Lock()
+	err := w.stream.CloseSend()
+	w.sendMu.Unlock()
+	w.cancel()
+	<-w.doneResp
+	return err
+}
+
+// EventsChan returns the Events channel, to implement fsnotify.Notifier.
+func (w *Watcher) EventsChan() <-chan fsnotify.Event { return w.Events }
+
+// ErrorsChan returns the Errors channel, to implement fsnotify.Notifier.
+func (w *Watcher) ErrorsChan() <-chan error { return w.Errors }
+
+func (w *Watcher) isClosed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Add starts watching the named file or directory (non-recursively) on the
+// server.
+//
+// A path ending with "/..." is watched recursively, as with fsnotify.Watcher.
+func (w *Watcher) Add(name string) error { return w.AddWith(name) }
+
+// AddWith is like Add, but allows adding options.
+func (w *Watcher) AddWith(name string, opts ...fsnotify.AddOption) error {
+	return w.AddSpec(fsnotify.NewWatchSpec(name, opts...))
+}
+
+// AddSpec starts watching the path in spec on the server, with the options in
+// spec.
+func (w *Watcher) AddSpec(spec fsnotify.WatchSpec) error {
+	_, err := w.call(&request{Op: opAdd, Spec: &spec})
+	return err
+}
+
+// Remove stops watching the named file or directory on the server.
+func (w *Watcher) Remove(name string) error {
+	_, err := w.call(&request{Op: opRemove, Path: name})
+	return err
+}
+
+// WatchList returns the directories and files that are being monitored on
+// the server, or nil if the watcher is closed.
+func (w *Watcher) WatchList() []string {
+	resp, err := w.call(&request{Op: opList})
+	if err != nil {
+		return nil
+	}
+	if resp.List == nil {
+		return []string{}
+	}
+	return resp.List
+}
+
+// call sends the request to the server, and waits for the reply.
+func (w *Watcher) call(req *request) (*response, error) {
+	w.mu.Lock()
+	if w.closed || w.isClosed() {
+		w.mu.Unlock()
+		return nil, ErrClosed
+	}
+	w.lastID++
+	req.ID = w.lastID
+	ch := make(chan *response, 1)
+	w.pending[req.ID] = ch
+	w.mu.Unlock()
+
+	w.sendMu.Lock()
+	err := w.stream.SendMsg(req)
+	w.sendMu.Unlock()
+	if err != nil {
+		w.mu.Lock()
+		delete(w.pending, req.ID)
+		w.mu.Unlock()
+		return nil, ErrClosed
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		return nil, ErrClosed
+	}
+	return resp, resp.Err.err()
+}
+
+// readEvents reads all messages from the server until the stream ends.
+func (w *Watcher) readEvents() {
+	defer func() {
+		close(w.Events)
+		close(w.Errors)
+		close(w.doneResp)
+	}()
+	defer func() {
+		w.mu.Lock()
+		w.closed = true
+		for id, ch := range w.pending {
+			close(ch)
+			delete(w.pending, id)
+		}
+		w.mu.Unlock()
+	}()
+
+	for {
+		var resp response
+		if err := w.stream.RecvMsg(&resp); err != nil {
+			if !w.isClosed() {
+				select {
+				case w.Errors <- err:
+				case <-w.done:
+				}
+			}
+			return
+		}
+
+		switch {
+		case resp.ID != 0:
+			w.mu.Lock()
+			ch, ok := w.pending[resp.ID]
+			delete(w.pending, resp.ID)
+			w.mu.Unlock()
+			if ok {
+				ch <- &resp
+			}
+		case resp.Event != nil:
+			select {
+			case w.Events <- *resp.Event:
+			case <-w.done:
+				return
+			}
+		case resp.Error != nil:
+			select {
+			case w.Errors <- resp.Error.err():
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/fsnotify/fsnotify/remote
+
+go 1.17
+
+require (
+	github.com/fsnotify/fsnotify v1.5.4
+	google.golang.org/grpc v1.50.1
+)
+
+require (
+	github.com/golang/protobuf v1.5.2 // indirect
+	golang.org/x/net v0.0.0-20220722155237-a158d28d115b // indirect
+	golang.org/x/sys v0.0.0-20220731174439-a90be440212d // indirect
+	golang.org/x/text v0.3.8 // indirect
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
+	google.golang.org/protobuf v1.27.1 // indirect
+)
+
+replace github.com/fsnotify/fsnotify => ../
@@ -0,0 +1,132 @@
+// Package remote exposes a fsnotify.Watcher over gRPC, so that paths on
+// another host or in another mount namespace can be watched; for example from
+// a sidecar container.
+//
+// The server is registered on a grpc.Server with Register(), and the client
+// is created with NewWatcher() from a connection to that server:
+//
+//	// On the host with the files:
+//	s := grpc.NewServer()
+//	remote.Register(s)
+//	s.Serve(l)
+//
+//	// On the client:
+//	cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	w, err := remote.NewWatcher(cc)
+//	w.Add("/path/on/server")
+//
+// Every client gets its own fsnotify.Watcher on the server, which is closed
+// when the client is closed or disconnects.
+//
+// There is no access control: anyone who can connect to the server can watch
+// any path the server can read. Use the normal gRPC mechanisms to limit who
+// can connect.
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// The messages are encoded as JSON rather than protobuf; the message types are
+// simple enough that this doesn't really matter, and it means we don't need a
+// protobuf compiler.
+const codecName = "fsnotify-json"
+
+const (
+	serviceName = "fsnotify.remote.Watcher"
+	watchMethod = "/" + serviceName + "/Watch"
+)
+
+func init() { encoding.RegisterCodec(jsonCodec{}) }
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                          { return codecName }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// The operations in a request.
+const (
+	opAdd    = "add"
+	opRemove = "remove"
+	opList   = "list"
+)
+
+// request is sent from the client to the server.
+type request struct {
+	ID   uint64              `json:"id"`
+	Op   string              `json:"op"`
+	Path string              `json:"path,omitempty"`
+	Spec *fsnotify.WatchSpec `json:"spec,omitempty"`
+}
+
+// response is sent from the server to the client; it's either the reply to a
+// request (ID is set), an event, or an error from the watcher.
+type response struct {
+	ID    uint64          `json:"id,omitempty"`
+	Err   *remoteError    `json:"err,omitempty"`
+	List  []string        `json:"list,omitempty"`
+	Event *fsnotify.Event `json:"event,omitempty"`
+	Error *remoteError    `json:"error,omitempty"`
+}
+
+// remoteError is an error sent over the wire; the fsnotify errors that can be
+// checked with errors.Is() are sent as a code, so the client can return the
+// same error.
+type remoteError struct {
+	Code string `json:"code,omitempty"`
+	Msg  string `json:"msg"`
+}
+
+var errorCodes = map[string]error{
+	"nonexistent-watch": fsnotify.ErrNonExistentWatch,
+	"event-overflow":    fsnotify.ErrEventOverflow,
+	"not-exist":         fs.ErrNotExist,
+	"permission":        fs.ErrPermission,
+}
+
+func newRemoteError(err error) *remoteError {
+	if err == nil {
+		return nil
+	}
+	for code, e := range errorCodes {
+		if errors.Is(err, e) {
+			return &remoteError{Code: code, Msg: err.Error()}
+		}
+	}
+	return &remoteError{Msg: err.Error()}
+}
+
+func (e *remoteError) Error() string { return e.Msg }
+func (e *remoteError) Unwrap() error { return errorCodes[e.Code] }
+
+// err returns the error to give to the user; this is the fsnotify error itself
+// if it wasn't wrapped, so that comparing with == still works.
+func (e *remoteError) err() error {
+	if e == nil {
+		return nil
+	}
+	if err, ok := errorCodes[e.Code]; ok && err.Error() == e.Msg {
+		return err
+	}
+	return e
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Watch",
+		Handler:       serveWatch,
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
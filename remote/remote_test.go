@@ -0,0 +1,91 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newWatcher(t *testing.T) *Watcher {
+	t.Helper()
+
+	l := bufconn.Listen(1 << 16)
+	s := grpc.NewServer()
+	Register(s)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+
+	w, err := NewWatcher(cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w := newWatcher(t)
+	if err := w.Add(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if have := w.WatchList(); len(have) != 1 || have[0] != tmp {
+		t.Errorf("WatchList: %q", have)
+	}
+
+	file := filepath.Join(tmp, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-w.Events:
+		if e.Name != file || !e.Has(fsnotify.Create) {
+			t.Errorf("wrong event: %s", e)
+		}
+	case err := <-w.Errors:
+		t.Fatal(err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	if err := w.Remove(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Remove(tmp); !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+		t.Errorf("wrong error removing twice: %v", err)
+	}
+	if err := w.Add(filepath.Join(tmp, "nonexistent")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("wrong error adding nonexistent path: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-w.Events; ok {
+		t.Error("Events not closed")
+	}
+	if _, ok := <-w.Errors; ok {
+		t.Error("Errors not closed")
+	}
+	if err := w.Add(tmp); err != ErrClosed {
+		t.Errorf("wrong error after Close: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc"
+)
+
+// Register registers the watcher service on s.
+//
+// Every client stream gets a new fsnotify.Watcher, which is closed when the
+// stream ends.
+func Register(s grpc.ServiceRegistrar) {
+	s.RegisterService(&serviceDesc, nil)
+}
+
+// serverStream wraps a grpc.ServerStream so that events and replies can be
+// sent from different goroutines.
+type serverStream struct {
+	grpc.ServerStream
+	mu sync.Mutex
+}
+
+func (s *serverStream) send(r *response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.SendMsg(r)
+}
+
+func serveWatch(_ interface{}, ss grpc.ServerStream) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	stream := &serverStream{ServerStream: ss}
+	done, forwardDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(forwardDone)
+		forward(w, stream, done)
+	}()
+	// SendMsg() can't be called after we return, so wait for forward().
+	defer func() {
+		close(done)
+		<-forwardDone
+	}()
+
+	for {
+		var req request
+		if err := stream.RecvMsg(&req); err != nil {
+			if errors.Is(err, io.EOF) { // Client closed the stream.
+				return nil
+			}
+			return err
+		}
+
+		resp := &response{ID: req.ID}
+		switch req.Op {
+		case opAdd:
+			if req.Spec == nil {
+				resp.Err = newRemoteError(errors.New("fsnotify/remote: no watch in add request"))
+				break
+			}
+			resp.Err = newRemoteError(w.Import([]fsnotify.WatchSpec{*req.Spec}))
+		case opRemove:
+			resp.Err = newRemoteError(w.Remove(req.Path))
+		case opList:
+			resp.List = w.WatchList()
+		default:
+			resp.Err = newRemoteError(fmt.Errorf("fsnotify/remote: unknown operation %q", req.Op))
+		}
+
+		if err := stream.send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// forward sends all events and errors of w on the stream, until done is
+// closed, the watcher is closed, or sending fails.
+func forward(w *fsnotify.Watcher, stream *serverStream, done chan struct{}) {
+	for {
+		var resp *response
+		select {
+		case <-done:
+			return
+		case e, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			resp = &response{Event: &e}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			resp = &response{Error: newRemoteError(err)}
+		}
+		if stream.send(resp) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package fsnotify
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replacePoll is how often the path of a removed or renamed watch is checked
+// for a new directory, for WithReplace().
+const replacePoll = 10 * time.Millisecond
+
+// replaceCache records the contents of watched directories, so that the
+// differences can be sent when one is replaced, for WithReplaceDiff().
+type replaceCache struct {
+	mu    sync.Mutex
+	trees map[string]map[string]TreeEntry // key: root of the watch, then path.
+}
+
+func newReplaceCache() *replaceCache {
+	return &replaceCache{trees: make(map[string]map[string]TreeEntry)}
+}
+
+// seed records everything in the watch for root, replacing what was recorded
+// before.
+func (c *replaceCache) seed(root string, with withOpts) {
+	tree := make(map[string]TreeEntry)
+	c.walk(tree, root, with)
+	c.mu.Lock()
+	c.trees[root] = tree
+	c.mu.Unlock()
+}
+
+// walk records dir and everything in it that's part of the watch.
+func (c *replaceCache) walk(tree map[string]TreeEntry, dir string, with withOpts) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != with.root && with.skip(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi, err := d.Info(); err == nil && path != with.root {
+			tree[path] = newTreeEntry(path, fi)
+		}
+		if d.IsDir() && path != with.root && !with.recurse {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// update records the change for e.
+func (c *replaceCache) update(e Event, with withOpts) {
+	if e.Name == with.root {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tree, ok := c.trees[with.root]
+	if !ok {
+		return
+	}
+
+	fi, err := os.Lstat(e.Name)
+	if err != nil {
+		prefix := e.Name + string(filepath.Separator)
+		for name := range tree {
+			if name == e.Name || strings.HasPrefix(name, prefix) {
+				delete(tree, name)
+			}
+		}
+		return
+	}
+	tree[e.Name] = newTreeEntry(e.Name, fi)
+	if fi.IsDir() && e.Has(Create) {
+		// Moved in with everything in it.
+		c.walk(tree, e.Name, with)
+	}
+}
+
+// get returns a copy of what's recorded for root.
+func (c *replaceCache) get(root string) map[string]TreeEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tree := make(map[string]TreeEntry, len(c.trees[root]))
+	for name, e := range c.trees[root] {
+		tree[name] = e
+	}
+	return tree
+}
+
+// diff returns the events for the differences between old and what's recorded
+// for root now. The Remove events are first, deepest first, followed by the
+// Create and Write events.
+func (c *replaceCache) diff(old map[string]TreeEntry, root string) []Event {
+	cur := c.get(root)
+
+	var events []Event
+	names := sortedNames(old)
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	for _, name := range names {
+		if n, ok := cur[name]; !ok || n.IsDir != old[name].IsDir {
+			events = append(events, Event{Name: name, Op: Remove})
+		}
+	}
+	for _, name := range sortedNames(cur) {
+		o, ok := old[name]
+		n := cur[name]
+		switch {
+		case !ok || o.IsDir != n.IsDir:
+			events = append(events, Event{Name: name, Op: Create})
+		case !n.IsDir && (o.Size != n.Size || !o.ModTime.Equal(n.ModTime)):
+			events = append(events, Event{Name: name, Op: Write})
+		}
+	}
+	return events
+}
+
+// replace waits for a new directory to appear at the path of the watch after
+// the Remove or Rename event e for it. If one appears within with.replace the
+// watch is added again and a Replaced event is sent instead of e, followed by
+// the differences for WithReplaceDiff(). Otherwise e is sent.
+func (p *pipeline) replace(e Event, with withOpts, clock Clock) {
+	without := with
+	without.replace = 0
+
+	t := clock.NewTimer(replacePoll)
+	defer t.Stop()
+	deadline := clock.Now().Add(with.replace)
+	for {
+		select {
+		case <-t.C():
+		case <-p.done:
+			return
+		}
+
+		if fi, err := os.Stat(with.root); err == nil && fi.IsDir() {
+			old := p.replaces.get(with.root) // readd() records the new contents.
+			if p.readd == nil || p.readd(with.root, with) != nil {
+				break
+			}
+			if !p.send(Event{Name: with.root, Op: Replaced}, without) {
+				return
+			}
+			if with.replaceDiff {
+				for _, d := range p.replaces.diff(old, with.root) {
+					if !p.send(d, without) {
+						return
+					}
+				}
+			}
+			return
+		}
+		if !clock.Now().Before(deadline) {
+			break
+		}
+		t.Reset(replacePoll)
+	}
+	p.send(e, without)
+}
+
+// readd adds the watch for name again, after the directory was replaced.
+func (w *Watcher) readd(name string, with withOpts) error {
+	path, opts, err := newWatchSpec(name, with).options()
+	if err != nil {
+		return err
+	}
+	w.Remove(path)
+	return w.AddWith(path, opts...)
+}
@@ -0,0 +1,128 @@
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Run reads the Events and Errors channels and calls handle for every event
+// and onError for every error, until ctx is cancelled, handle or onError
+// returns an error, or the watcher is closed. The watcher is always closed
+// once Run returns.
+//
+// If onError is nil then Run stops on the first error from the watcher.
+//
+// It returns ctx.Err() once ctx is cancelled, the error from handle or onError,
+// or nil if the watcher was closed.
+//
+//	err := w.Run(ctx, func(e fsnotify.Event) error {
+//		log.Println(e)
+//		return nil
+//	}, func(err error) error {
+//		log.Println("error:", err)
+//		return nil
+//	})
+func (w *Watcher) Run(ctx context.Context, handle func(Event) error, onError func(error) error) error {
+	return run(ctx, w, handle, onError)
+}
+
+// run implements Run() for any Notifier.
+func run(ctx context.Context, n Notifier, handle func(Event) error, onError func(error) error) error {
+	closed := false
+	defer func() {
+		if !closed {
+			n.Close()
+		}
+	}()
+
+	events, errs := n.EventsChan(), n.ErrorsChan()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if onError == nil {
+				return err
+			}
+			if err := onError(err); err != nil {
+				return err
+			}
+		case e, ok := <-events:
+			if !ok {
+				closed = true
+				return nil
+			}
+			if err := handle(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// errNotStarted is returned from Wait() if Start() wasn't called.
+var errNotStarted = errors.New("fsnotify: watcher not started")
+
+// runState is the state of the loop started with Start().
+type runState struct {
+	mu   sync.Mutex
+	done chan struct{} // Closed once the loop returns; nil if not started.
+	err  error
+}
+
+// Start calls Run() in a new goroutine, for use with errgroup or similar:
+// call Wait() to wait until it returns and get its error.
+//
+//	if err := w.Start(ctx, handle, nil); err != nil {
+//		return err
+//	}
+//	g.Go(w.Wait)
+//
+// It returns an error if Start() was already called.
+func (w *Watcher) Start(ctx context.Context, handle func(Event) error, onError func(error) error) error {
+	return w.started.start(func() error { return run(ctx, w, handle, onError) })
+}
+
+// Wait blocks until the goroutine started with Start() returns, and returns
+// the error from Run(): ctx.Err() if the context was cancelled, the error from
+// the handler, or nil if the watcher was closed. Wait can be called more than
+// once, and from more than one goroutine.
+//
+// It returns an error right away if Start() wasn't called.
+func (w *Watcher) Wait() error {
+	return w.started.wait()
+}
+
+func (r *runState) start(fn func() error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done != nil {
+		return errors.New("fsnotify: watcher already started")
+	}
+	r.done = make(chan struct{})
+	go func() {
+		err := fn()
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+		close(r.done)
+	}()
+	return nil
+}
+
+func (r *runState) wait() error {
+	r.mu.Lock()
+	done := r.done
+	r.mu.Unlock()
+	if done == nil {
+		return errNotStarted
+	}
+	<-done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
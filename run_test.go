@@ -0,0 +1,122 @@
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	t.Run("closed", func(t *testing.T) {
+		t.Parallel()
+		n := chanNotifier{events: make(chan Event), errors: make(chan error)}
+		var (
+			have []Event
+			errs []error
+		)
+		done := make(chan error)
+		go func() {
+			done <- run(context.Background(), n,
+				func(e Event) error { have = append(have, e); return nil },
+				func(err error) error { errs = append(errs, err); return nil })
+		}()
+
+		n.events <- Event{Name: "/a", Op: Create}
+		n.errors <- ErrEventOverflow
+		n.events <- Event{Name: "/a", Op: Write}
+		n.Close()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		want := []Event{{Name: "/a", Op: Create}, {Name: "/a", Op: Write}}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave: %v\nwant: %v", have, want)
+		}
+		if len(errs) != 1 || errs[0] != ErrEventOverflow {
+			t.Errorf("wrong errors: %v", errs)
+		}
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		t.Parallel()
+		n := chanNotifier{events: make(chan Event), errors: make(chan error)}
+		stop := errors.New("stop")
+		done := make(chan error)
+		go func() {
+			done <- run(context.Background(), n, func(e Event) error { return stop }, nil)
+		}()
+
+		n.events <- Event{Name: "/a", Op: Create}
+		if err := <-done; err != stop {
+			t.Fatalf("wrong error: %v", err)
+		}
+		if _, ok := <-n.events; ok {
+			t.Fatal("not closed")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		n := chanNotifier{events: make(chan Event), errors: make(chan error)}
+		done := make(chan error)
+		go func() {
+			done <- run(context.Background(), n, func(e Event) error { return nil }, nil)
+		}()
+
+		n.errors <- ErrEventOverflow
+		if err := <-done; err != ErrEventOverflow {
+			t.Fatalf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		t.Parallel()
+		n := chanNotifier{events: make(chan Event), errors: make(chan error)}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- run(ctx, n, func(e Event) error { return nil }, nil)
+		}()
+
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Fatalf("wrong error: %v", err)
+		}
+		if _, ok := <-n.events; ok {
+			t.Fatal("not closed")
+		}
+	})
+}
+
+func TestRunState(t *testing.T) {
+	t.Parallel()
+
+	var r runState
+	if err := r.wait(); err != errNotStarted {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	stop := errors.New("stop")
+	release := make(chan struct{})
+	if err := r.start(func() error { <-release; return stop }); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.start(func() error { return nil }); err == nil {
+		t.Fatal("started twice")
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- r.wait() }()
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != stop {
+			t.Fatalf("wrong error: %v", err)
+		}
+	}
+}
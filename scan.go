@@ -0,0 +1,128 @@
+package fsnotify
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+)
+
+// scanning reports if the options need a scan after adding the watch.
+func (o withOpts) scanning() bool {
+	return o.initialScan != 0 || !o.catchUp.IsZero()
+}
+
+// scanEvent returns the synthetic event for path from WithInitialScan() and
+// WithCatchUp(), if any.
+func (o withOpts) scanEvent(path string, fi fs.FileInfo) (Event, bool) {
+	op := o.initialScan
+	if !fi.Mode().IsRegular() {
+		op &^= Write
+	}
+	if !o.catchUp.IsZero() && !fi.IsDir() &&
+		(fi.ModTime().After(o.catchUp) || changeTime(fi).After(o.catchUp)) {
+		op |= Write
+	}
+	return Event{Name: path, Op: op}, op != 0
+}
+
+// scan sends the synthetic events for WithInitialScan() and WithCatchUp().
+func scan(name string, with withOpts, sendEvent func(Event) bool, sendError func(error) bool) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	if !fi.IsDir() {
+		if e, ok := with.scanEvent(name, fi); ok {
+			sendEvent(e)
+		}
+		return
+	}
+
+	err = filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != name && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path == name {
+			return nil
+		}
+		if with.skip(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if e, ok := with.scanEvent(path, fi); ok && !sendEvent(e) {
+			return errClosed
+		}
+		if d.IsDir() && (!with.recurse || with.tooDeep(path)) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil && err != errClosed {
+		sendError(err)
+	}
+}
+
+// scanGate holds back new events while a scan is running, so that the
+// synthetic events are sent first.
+//
+// The zero value is ready to use.
+type scanGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	scans  int
+	labels pprof.LabelSet // pprof labels of the watcher.
+}
+
+// start registers a new scan; this must be called before the watch is added.
+func (g *scanGate) start() {
+	g.mu.Lock()
+	g.scans++
+	g.mu.Unlock()
+}
+
+// done marks a scan as finished.
+func (g *scanGate) done() {
+	g.mu.Lock()
+	g.scans--
+	if g.scans == 0 && g.cond != nil {
+		g.cond.Broadcast()
+	}
+	g.mu.Unlock()
+}
+
+// wait blocks until all scans are finished.
+func (g *scanGate) wait() {
+	g.mu.Lock()
+	for g.scans > 0 {
+		if g.cond == nil {
+			g.cond = sync.NewCond(&g.mu)
+		}
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
+
+// run starts the scan for name in a new goroutine, and marks it as done when
+// it's finished.
+func (g *scanGate) run(name string, with withOpts, sendEvent func(Event) bool, sendError func(error) bool) {
+	goLabeled(g.labels, "scan", func() {
+		defer g.done()
+		scan(name, with, sendEvent, sendError)
+	})
+}
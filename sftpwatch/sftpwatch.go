@@ -0,0 +1,334 @@
+// Package sftpwatch watches directories on a remote server over SFTP, with the
+// same API as fsnotify.Watcher.
+//
+// SFTP has no change notifications, so the watched directories are listed
+// periodically and every listing is compared to the previous one: a Create
+// event is sent for new files, Write for files with a different size or
+// modification time, Chmod for a different mode, and Remove for files that are
+// gone.
+//
+// This package doesn't depend on an SFTP library; a *sftp.Client from
+// github.com/pkg/sftp implements Client:
+//
+//	conn, err := ssh.Dial("tcp", "example.com:22", config)
+//	client, err := sftp.NewClient(conn)
+//	w := sftpwatch.NewWatcher(client, sftpwatch.Options{Interval: 10 * time.Second})
+//	defer w.Close()
+//	err = w.Add("/srv/www/...")
+//
+// Paths always use forward slashes, as on the remote server. Changes between
+// two listings are merged: a file that's written twice sends one Write, and a
+// file that's created and removed again sends nothing.
+package sftpwatch
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrClosed is returned from Add() after the watcher is closed; this is
+// fsnotify.ErrClosed, so errors.Is() works the same for all watchers.
+var ErrClosed = fsnotify.ErrClosed
+
+var _ fsnotify.Notifier = (*Watcher)(nil)
+
+// Client lists remote directories; *sftp.Client from github.com/pkg/sftp
+// implements it.
+type Client interface {
+	ReadDir(p string) ([]os.FileInfo, error)
+	Lstat(p string) (os.FileInfo, error)
+}
+
+// Options are the options for NewWatcher().
+type Options struct {
+	// How often the watched paths are listed; the default is 10 seconds.
+	Interval time.Duration
+}
+
+// Watcher watches a set of remote files and directories, delivering events to
+// a channel.
+type Watcher struct {
+	// Events sends the changes to files and directories.
+	Events chan fsnotify.Event
+
+	// Errors sends the errors from listing the directories. The previous
+	// listing is kept, so that nothing is sent for a listing that failed.
+	Errors chan error
+
+	client Client
+	opts   Options
+
+	mu       sync.Mutex        // Protects everything below.
+	watches  map[string]*watch // key: path
+	done     chan struct{}     // Closed on Close().
+	doneResp chan struct{}
+}
+
+type watch struct {
+	recurse bool
+	entries map[string]entry // Last listing; key: path. Includes the watched path itself.
+}
+
+// entry is what's compared for a single file or directory.
+type entry struct {
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// NewWatcher creates a new watcher that lists directories with client.
+func NewWatcher(client Client, opts Options) *Watcher {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	w := &Watcher{
+		Events:   make(chan fsnotify.Event),
+		Errors:   make(chan error),
+		client:   client,
+		opts:     opts,
+		watches:  make(map[string]*watch),
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	go w.poll()
+	return w
+}
+
+// Close stops watching, and closes the Events and Errors channels. It doesn't
+// close the Client.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	select {
+	case <-w.done:
+		w.mu.Unlock()
+		return nil
+	default:
+	}
+	close(w.done)
+	w.mu.Unlock()
+
+	<-w.doneResp
+	return nil
+}
+
+// Add starts watching the named file or directory (non-recursively). A path
+// ending with "/..." is watched recursively.
+//
+// The path is listed right away, to know which files exist already; no events
+// are sent for them.
+func (w *Watcher) Add(name string) error { return w.AddWith(name) }
+
+// AddWith is like Add. The options are ignored.
+func (w *Watcher) AddWith(name string, opts ...fsnotify.AddOption) error {
+	select {
+	case <-w.done:
+		return ErrClosed
+	default:
+	}
+	name, recurse := watchPath(name)
+	entries, err := w.list(name, recurse)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done:
+		return ErrClosed
+	default:
+	}
+	w.watches[name] = &watch{recurse: recurse, entries: entries}
+	return nil
+}
+
+// Remove stops watching the named file or directory.
+func (w *Watcher) Remove(name string) error {
+	name, _ = watchPath(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.watches[name]; !ok {
+		return fsnotify.ErrNonExistentWatch
+	}
+	delete(w.watches, name)
+	return nil
+}
+
+// WatchList returns all paths added with Add() (and are not yet removed).
+func (w *Watcher) WatchList() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := make([]string, 0, len(w.watches))
+	for name := range w.watches {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// EventsChan returns the Events channel, to implement fsnotify.Notifier.
+func (w *Watcher) EventsChan() <-chan fsnotify.Event { return w.Events }
+
+// ErrorsChan returns the Errors channel, to implement fsnotify.Notifier.
+func (w *Watcher) ErrorsChan() <-chan error { return w.Errors }
+
+// watchPath returns the cleaned path, and if it ends with "/...".
+func watchPath(name string) (string, bool) {
+	name = path.Clean(name)
+	if path.Base(name) == "..." {
+		return path.Dir(name), true
+	}
+	return name, false
+}
+
+// list returns the entries for name, and the files in it if it's a directory.
+// A path that doesn't exist has no entries.
+func (w *Watcher) list(name string, recurse bool) (map[string]entry, error) {
+	entries := make(map[string]entry)
+	fi, err := w.client.Lstat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries[name] = newEntry(fi)
+	if fi.IsDir() {
+		err = w.readDir(entries, name, recurse)
+	}
+	return entries, err
+}
+
+func (w *Watcher) readDir(entries map[string]entry, dir string, recurse bool) error {
+	list, err := w.client.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && len(entries) > 1 {
+			return nil // Subdirectory removed while listing.
+		}
+		return err
+	}
+	for _, fi := range list {
+		p := path.Join(dir, fi.Name())
+		entries[p] = newEntry(fi)
+		if recurse && fi.IsDir() {
+			if err := w.readDir(entries, p, recurse); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func newEntry(fi os.FileInfo) entry {
+	return entry{size: fi.Size(), mode: fi.Mode(), modTime: fi.ModTime()}
+}
+
+// poll lists the watched paths every Interval, and sends the differences,
+// until the watcher is closed.
+func (w *Watcher) poll() {
+	defer func() {
+		close(w.Events)
+		close(w.Errors)
+		close(w.doneResp)
+	}()
+
+	t := time.NewTicker(w.opts.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-t.C:
+		}
+
+		for _, name := range w.WatchList() {
+			w.mu.Lock()
+			wa, ok := w.watches[name]
+			w.mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			entries, err := w.list(name, wa.recurse)
+			if err != nil {
+				if !w.sendError(err) {
+					return
+				}
+				continue
+			}
+
+			w.mu.Lock()
+			old := wa.entries
+			ok = w.watches[name] == wa
+			if ok {
+				wa.entries = entries
+			}
+			w.mu.Unlock()
+			if !ok {
+				continue // Removed or added again while listing.
+			}
+			for _, e := range diff(old, entries) {
+				if !w.sendEvent(e) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// diff returns the events for the changes from old to cur. The Remove events
+// are first, deepest first, followed by the other events sorted by path.
+func diff(old, cur map[string]entry) []fsnotify.Event {
+	var removed, changed []fsnotify.Event
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			removed = append(removed, fsnotify.Event{Name: name, Op: fsnotify.Remove})
+		}
+	}
+	for name, c := range cur {
+		o, ok := old[name]
+		if !ok || o.mode.IsDir() != c.mode.IsDir() {
+			changed = append(changed, fsnotify.Event{Name: name, Op: fsnotify.Create})
+			continue
+		}
+		var op fsnotify.Op
+		if !c.mode.IsDir() && (o.size != c.size || !o.modTime.Equal(c.modTime)) {
+			op |= fsnotify.Write
+		}
+		if o.mode != c.mode {
+			op |= fsnotify.Chmod
+		}
+		if op != 0 {
+			changed = append(changed, fsnotify.Event{Name: name, Op: op})
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Name > removed[j].Name })
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Name < changed[j].Name })
+	return append(removed, changed...)
+}
+
+// sendEvent returns false if the watcher is closed.
+func (w *Watcher) sendEvent(e fsnotify.Event) bool {
+	select {
+	case w.Events <- e:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// sendError returns false if the watcher is closed.
+func (w *Watcher) sendError(err error) bool {
+	select {
+	case w.Errors <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
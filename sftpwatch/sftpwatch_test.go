@@ -0,0 +1,131 @@
+package sftpwatch
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// server is a fake SFTP server.
+type server struct {
+	mu sync.Mutex
+	fs fstest.MapFS
+}
+
+func (s *server) ReadDir(p string) ([]os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.fs.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, fi)
+	}
+	return list, nil
+}
+
+func (s *server) Lstat(p string) (os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fs.Stat(s.fs, p)
+}
+
+func (s *server) update(f func(fstest.MapFS)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s.fs)
+}
+
+func collect(t *testing.T, w *Watcher, n int) []fsnotify.Event {
+	t.Helper()
+	var have []fsnotify.Event
+	for len(have) < n {
+		select {
+		case e := <-w.Events:
+			have = append(have, e)
+		case err := <-w.Errors:
+			t.Fatal(err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout; have %v", have)
+		}
+	}
+	return have
+}
+
+func TestWatcher(t *testing.T) {
+	now := time.Now()
+	s := &server{fs: fstest.MapFS{
+		"www/index.html":     {Data: []byte("hello"), ModTime: now},
+		"www/old/page.html":  {Data: []byte("old"), ModTime: now},
+		"www/static/app.css": {Data: []byte("body{}"), ModTime: now},
+		"other/file":         {Data: []byte("x"), ModTime: now},
+	}}
+
+	w := NewWatcher(s, Options{Interval: 10 * time.Millisecond})
+	defer w.Close()
+	if err := w.Add("www/..."); err != nil {
+		t.Fatal(err)
+	}
+
+	s.update(func(m fstest.MapFS) {
+		m["www/index.html"] = &fstest.MapFile{Data: []byte("hello, world"), ModTime: now}
+		m["www/static/app.css"] = &fstest.MapFile{Data: []byte("body{}"), ModTime: now, Mode: 0o600}
+		m["www/static/new.js"] = &fstest.MapFile{ModTime: now}
+		m["other/new"] = &fstest.MapFile{ModTime: now}
+		delete(m, "www/old/page.html")
+	})
+
+	have := collect(t, w, 5)
+	want := []fsnotify.Event{
+		{Name: "www/old/page.html", Op: fsnotify.Remove},
+		{Name: "www/old", Op: fsnotify.Remove},
+		{Name: "www/index.html", Op: fsnotify.Write},
+		{Name: "www/static/app.css", Op: fsnotify.Chmod},
+		{Name: "www/static/new.js", Op: fsnotify.Create},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestWatcherAdd(t *testing.T) {
+	s := &server{fs: fstest.MapFS{"dir/file": {}}}
+	w := NewWatcher(s, Options{Interval: time.Hour})
+
+	if err := w.Add("dir/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("dir/..."); err != nil {
+		t.Fatal(err)
+	}
+	if have := w.WatchList(); !reflect.DeepEqual(have, []string{"dir"}) {
+		t.Errorf("WatchList: %q", have)
+	}
+	if err := w.Remove("other"); !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+		t.Errorf("wrong error: %v", err)
+	}
+	if err := w.Remove("dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Close()
+	if err := w.Add("dir"); !errors.Is(err, fsnotify.ErrClosed) {
+		t.Errorf("wrong error: %v", err)
+	}
+	if _, ok := <-w.Events; ok {
+		t.Error("Events not closed")
+	}
+}
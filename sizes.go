@@ -0,0 +1,97 @@
+package fsnotify
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// sizeCache records the sizes of files, for WithTruncate() and WithSizes().
+type sizeCache struct {
+	mu    sync.Mutex
+	sizes map[string]int64 // key: path
+}
+
+func newSizeCache() *sizeCache {
+	return &sizeCache{sizes: make(map[string]int64)}
+}
+
+// seed records the sizes of the regular files in path, or path itself if it's
+// a file. Everything below path is recorded for recursive watches.
+func (c *sizeCache) seed(path string, with withOpts) {
+	record := func(p string, fi fs.FileInfo) {
+		if fi.Mode().IsRegular() && !with.skip(p, false) {
+			c.mu.Lock()
+			c.sizes[p] = fi.Size()
+			c.mu.Unlock()
+		}
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if !fi.IsDir() {
+		record(path, fi)
+		return
+	}
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != path && (!with.recurse || with.skip(p, true)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi, err := d.Info(); err == nil {
+			record(p, fi)
+		}
+		return nil
+	})
+}
+
+// trackSizes reports if the options need the sizes of files.
+func (o withOpts) trackSizes() bool { return o.truncate || o.sizes || o.appendOnly }
+
+// update records the size of the file for e. For Write events it sets Truncate
+// if the file became smaller with WithTruncate(), and the sizes with
+// WithSizes(); WithAppendOnly() sets both.
+func (c *sizeCache) update(e Event, with withOpts) Event {
+	if e.Op&(Remove|Rename) != 0 {
+		c.mu.Lock()
+		delete(c.sizes, e.Name)
+		c.mu.Unlock()
+		return e
+	}
+	if e.Op&(Create|Write) == 0 {
+		return e
+	}
+
+	fi, err := os.Stat(e.Name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return e
+	}
+	size := fi.Size()
+
+	c.mu.Lock()
+	prev, ok := c.sizes[e.Name]
+	c.sizes[e.Name] = size
+	c.mu.Unlock()
+
+	if !e.Has(Write) {
+		return e
+	}
+	if (with.truncate || with.appendOnly) && (size == 0 || ok && size < prev) {
+		e.Op |= Truncate
+	}
+	if with.sizes || with.appendOnly {
+		e.Size, e.PrevSize = size, prev
+		if !ok {
+			e.PrevSize = -1
+		}
+	}
+	return e
+}
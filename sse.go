@@ -0,0 +1,223 @@
+package fsnotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SSEHandler is a http.Handler that streams the events of a watcher as
+// Server-Sent Events; for example for a dashboard or to reload a page in the
+// browser.
+//
+// Every event is sent as a "change" event with a JSON payload:
+//
+//	id: 42
+//	event: change
+//	data: {"name":"/path/to/file","op":"WRITE"}
+//
+// Errors are sent as "error" events with a payload of {"error":"message"}.
+//
+// Every event and error gets a sequence number as its ID. Browsers send the
+// last ID they received in the Last-Event-ID header when reconnecting, and the
+// handler will first send everything after that from the history. If some
+// events are no longer in the history a "reset" event is sent first, so the
+// client can reload everything.
+type SSEHandler struct {
+	// Heartbeat is how often to send a comment when there are no events, to
+	// prevent proxies from closing idle connections. The default is 15
+	// seconds; set to 0 or a negative value to disable.
+	Heartbeat time.Duration
+
+	// Clock to use for the Heartbeat; the default is SystemClock.
+	Clock Clock
+
+	w        *Watcher
+	size     int
+	mu       sync.Mutex // Protects everything below.
+	seq      uint64
+	history  []sseEntry    // Last size entries, oldest first.
+	notify   chan struct{} // Closed and replaced after every new entry.
+	done     chan struct{}
+	doneResp chan struct{}
+}
+
+type sseEntry struct {
+	seq   uint64
+	event string
+	data  []byte
+}
+
+// NewSSEHandler starts reading the Events and Errors of the watcher w, and
+// keeps the last history events to resume from.
+//
+// The history is also how new events get to the streams, so a history below 1
+// is set to 1; streams that fall behind by more than history events get a
+// "reset" event.
+//
+// The watcher shouldn't be read from directly after this.
+func NewSSEHandler(w *Watcher, history int) *SSEHandler {
+	if history < 1 {
+		history = 1
+	}
+	h := &SSEHandler{
+		Heartbeat: 15 * time.Second,
+		w:         w,
+		size:      history,
+		notify:    make(chan struct{}),
+		done:      make(chan struct{}),
+		doneResp:  make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+// Close closes the watcher, and ends all streams.
+func (h *SSEHandler) Close() error {
+	h.mu.Lock()
+	select {
+	case <-h.done:
+		h.mu.Unlock()
+		return nil
+	default:
+	}
+	close(h.done)
+	h.mu.Unlock()
+
+	err := h.w.Close()
+	<-h.doneResp
+	return err
+}
+
+func (h *SSEHandler) run() {
+	defer close(h.doneResp)
+	for {
+		select {
+		case <-h.done:
+			return
+		case err, ok := <-h.w.Errors:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(struct {
+				Error string `json:"error"`
+			}{err.Error()})
+			h.append("error", data)
+		case e, ok := <-h.w.Events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(struct {
+				Name string `json:"name"`
+				Op   string `json:"op"`
+			}{e.Name, e.Op.String()})
+			h.append("change", data)
+		}
+	}
+}
+
+func (h *SSEHandler) append(event string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	h.history = append(h.history, sseEntry{seq: h.seq, event: event, data: data})
+	if len(h.history) > h.size {
+		h.history = h.history[len(h.history)-h.size:]
+	}
+	close(h.notify)
+	h.notify = make(chan struct{})
+}
+
+// since returns all entries after seq, and the channel that's closed on the
+// next entry.
+//
+// If entries after seq were dropped from the history it returns no entries,
+// reset set to true, and the current sequence number as seq.
+func (h *SSEHandler) since(seq uint64) (entries []sseEntry, reset bool, cur uint64, notify chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.history {
+		if e.seq > seq {
+			entries = append(entries, e)
+		}
+	}
+	// seq > h.seq happens if the ID is from a previous run of the program.
+	if seq > h.seq || (seq < h.seq && (len(entries) == 0 || entries[0].seq > seq+1)) {
+		return nil, true, h.seq, h.notify
+	}
+	return entries, false, h.seq, h.notify
+}
+
+// ServeHTTP streams the events until the client disconnects or the handler is
+// closed.
+func (h *SSEHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Without Last-Event-ID only new events are sent.
+	h.mu.Lock()
+	last := h.seq
+	h.mu.Unlock()
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid Last-Event-ID: %q", id), http.StatusBadRequest)
+			return
+		}
+		last = n
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var heartbeat Timer
+	if h.Heartbeat > 0 {
+		heartbeat = clockOrSystem(h.Clock).NewTimer(h.Heartbeat)
+		defer heartbeat.Stop()
+	}
+
+	for {
+		entries, reset, cur, notify := h.since(last)
+		if reset {
+			fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", cur)
+			last = cur
+		}
+		for _, e := range entries {
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.seq, e.event, e.data)
+			last = e.seq
+		}
+		if reset || len(entries) > 0 {
+			flusher.Flush()
+			// The connection isn't idle, so wait a full interval again.
+			if heartbeat != nil {
+				if !heartbeat.Stop() {
+					select {
+					case <-heartbeat.C():
+					default:
+					}
+				}
+				heartbeat.Reset(h.Heartbeat)
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		case <-timerC(heartbeat):
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+			heartbeat.Reset(h.Heartbeat)
+		case <-notify:
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package fsnotify
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSEHandler(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	h := NewSSEHandler(newWatcher(t, tmp), 10)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	defer h.Close() // Must be before srv.Close() to end the streams.
+
+	// readEvent reads lines until the end of the next event.
+	readEvent := func(t *testing.T, r *bufio.Reader) string {
+		t.Helper()
+		var lines []string
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l == "\n" {
+				return strings.Join(lines, "\n")
+			}
+			lines = append(lines, strings.TrimSpace(l))
+		}
+	}
+	get := func(t *testing.T, lastID string) *bufio.Reader {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("wrong Content-Type: %q", ct)
+		}
+		return bufio.NewReader(resp.Body)
+	}
+
+	r := get(t, "")
+	touch(t, tmp, "file")
+
+	name, _ := json.Marshal(filepath.Join(tmp, "file"))
+	want := "id: 1\nevent: change\ndata: {\"name\":" + string(name) + `,"op":"CREATE"}`
+	if have := readEvent(t, r); have != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+	}
+
+	// Resume from the history.
+	if have := readEvent(t, get(t, "0")); have != want {
+		t.Errorf("resume:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+
+	// ID from before a restart.
+	want = "id: 1\nevent: reset\ndata: {}"
+	if have := readEvent(t, get(t, "42")); have != want {
+		t.Errorf("reset:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestSSEHandlerHistory(t *testing.T) {
+	t.Parallel()
+
+	for _, history := range []int{-1, 0} {
+		h := NewSSEHandler(newWatcher(t), history)
+		h.append("change", []byte("{}"))
+		h.append("change", []byte("{}"))
+		entries, reset, _, _ := h.since(1)
+		if reset || len(entries) != 1 || entries[0].seq != 2 {
+			t.Errorf("history %d: wrong entries: %v, reset=%t", history, entries, reset)
+		}
+		h.Close()
+	}
+}
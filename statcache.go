@@ -0,0 +1,98 @@
+package fsnotify
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// statCacheTTL is how long the result of an Lstat() is used; long enough to
+// cover a burst of events for the same directory, and short enough that it
+// doesn't matter that the cache doesn't see changes.
+const statCacheTTL = 50 * time.Millisecond
+
+// Stats are counters for the work a watcher did, as returned by
+// Watcher.Stats().
+type Stats struct {
+	// Number of times the file information for a path was taken from the stat
+	// cache, rather than with a system call. Only kqueue has a stat cache.
+	StatHits uint64
+
+	// Number of times the file information for a path wasn't in the stat
+	// cache.
+	StatMisses uint64
+}
+
+// statCache caches Lstat() for statCacheTTL, so that processing a burst of
+// events doesn't stat the same paths over and over again.
+//
+// Errors are never cached: a path that doesn't exist may be created at any
+// moment, and the next call should see it. This should only be used while
+// processing events, and not for Add(), which should always see the current
+// state.
+type statCache struct {
+	now func() time.Time // time.Now if nil.
+
+	mu      sync.Mutex
+	entries map[string]statEntry
+	hits    uint64
+	misses  uint64
+}
+
+type statEntry struct {
+	fi os.FileInfo
+	at time.Time
+}
+
+// lstat returns the cached result of os.Lstat() for name if it's less than
+// statCacheTTL old, or calls it. Only successful results are cached.
+func (c *statCache) lstat(name string) (os.FileInfo, error) {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[name]; ok && now().Sub(e.at) < statCacheTTL {
+		c.hits++
+		c.mu.Unlock()
+		return e.fi, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	at := now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]statEntry)
+	}
+	// Remove expired entries once in a while, so the cache doesn't grow.
+	if len(c.entries) >= 1000 {
+		for n, e := range c.entries {
+			if at.Sub(e.at) >= statCacheTTL {
+				delete(c.entries, n)
+			}
+		}
+	}
+	c.entries[name] = statEntry{fi: fi, at: at}
+	return fi, nil
+}
+
+// forget removes name from the cache, for when it's known to have changed.
+func (c *statCache) forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, name)
+}
+
+func (c *statCache) stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{StatHits: c.hits, StatMisses: c.misses}
+}
@@ -0,0 +1,52 @@
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatCache(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "file")
+	touch(t, file)
+
+	now := time.Now()
+	c := statCache{now: func() time.Time { return now }}
+	for i := 0; i < 3; i++ {
+		if _, err := c.lstat(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if have, want := c.stats(), (Stats{StatHits: 2, StatMisses: 1}); have != want {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+
+	// Cached until it expires or it's forgotten.
+	rm(t, file)
+	if _, err := c.lstat(file); err != nil {
+		t.Fatalf("not cached: %v", err)
+	}
+	now = now.Add(statCacheTTL)
+	if _, err := c.lstat(file); !os.IsNotExist(err) {
+		t.Fatalf("wrong error after expiry: %v", err)
+	}
+
+	// Errors aren't cached.
+	touch(t, file)
+	if _, err := c.lstat(file); err != nil {
+		t.Fatalf("error was cached: %v", err)
+	}
+
+	rm(t, file)
+	c.forget(file)
+	if _, err := c.lstat(file); !os.IsNotExist(err) {
+		t.Fatalf("wrong error after forget(): %v", err)
+	}
+	if have, want := c.stats(), (Stats{StatHits: 3, StatMisses: 4}); have != want {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+}
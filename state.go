@@ -0,0 +1,47 @@
+package fsnotify
+
+import "fmt"
+
+// WatcherState is the state of a watcher, as returned by Watcher.State().
+type WatcherState uint8
+
+// The watcher states.
+const (
+	// StateRunning is a watcher that watches and sends events.
+	StateRunning WatcherState = iota
+
+	// StateClosing is a watcher for which Close() was called, but which
+	// hasn't finished cleaning up; watches can't be added any more, but
+	// events may still be sent with WithDrainOnClose().
+	StateClosing
+
+	// StateClosed is a watcher that is closed, and for which the Events and
+	// Errors channels are closed.
+	StateClosed
+)
+
+func (s WatcherState) String() string {
+	switch s {
+	case StateRunning:
+		return "running"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("WatcherState(%d)", uint8(s))
+}
+
+// watcherState returns the state for a watcher for which done is closed once
+// the cleanup is finished, and closing is set once Close() is called.
+func watcherState(done <-chan struct{}, closing bool) WatcherState {
+	select {
+	case <-done:
+		return StateClosed
+	default:
+	}
+	if closing {
+		return StateClosing
+	}
+	return StateRunning
+}
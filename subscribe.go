@@ -0,0 +1,241 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type (
+	subscribeOpt  func(opt *subscribeOpts)
+	subscribeOpts struct {
+		paths    []string
+		ops      Op
+		patterns ignoreRules
+		filter   func(Event) bool
+		buffer   int
+	}
+)
+
+// SubscribeOption is an option for Watcher.SubscribeWith(), such as
+// SubscribeOps().
+type SubscribeOption = subscribeOpt
+
+func getSubscribeOptions(opts ...subscribeOpt) subscribeOpts {
+	var with subscribeOpts
+	for _, o := range opts {
+		if o != nil {
+			o(&with)
+		}
+	}
+	return with
+}
+
+// SubscribePaths only sends events for the paths, and everything below them.
+func SubscribePaths(paths ...string) subscribeOpt {
+	return func(opt *subscribeOpts) {
+		for _, p := range paths {
+			opt.paths = append(opt.paths, filepath.Clean(p))
+		}
+	}
+}
+
+// SubscribeOps only sends events that have one of the operations in ops.
+func SubscribeOps(ops Op) subscribeOpt {
+	return func(opt *subscribeOpts) { opt.ops |= ops }
+}
+
+// SubscribePatterns only sends events for paths matching one of the glob
+// patterns.
+//
+// A pattern without a "/" is matched against the filename; a pattern with a
+// "/" is matched against the full path, where "**" matches any number of
+// directories. See path.Match() for the pattern syntax; invalid patterns never
+// match.
+func SubscribePatterns(patterns ...string) subscribeOpt {
+	return func(opt *subscribeOpts) { opt.patterns = append(opt.patterns, parseGlobs(patterns...)...) }
+}
+
+// SubscribeFilter only sends events for which fn returns true; it's called
+// after all other options are checked.
+func SubscribeFilter(fn func(Event) bool) subscribeOpt {
+	return func(opt *subscribeOpts) { opt.filter = fn }
+}
+
+// SubscribeBuffer sets the size of the buffer of the Events channel; the
+// default is 0 (unbuffered). The watcher blocks once the buffer is full.
+func SubscribeBuffer(n int) subscribeOpt {
+	return func(opt *subscribeOpts) { opt.buffer = n }
+}
+
+// match reports if e matches the paths, operations, and patterns.
+func (o subscribeOpts) match(e Event) bool {
+	if o.ops != 0 && e.Op&o.ops == 0 {
+		return false
+	}
+	if len(o.paths) > 0 {
+		var below bool
+		for _, p := range o.paths {
+			if e.Name == p || strings.HasPrefix(e.Name, strings.TrimSuffix(p, string(filepath.Separator))+string(filepath.Separator)) {
+				below = true
+				break
+			}
+		}
+		if !below {
+			return false
+		}
+	}
+	if len(o.patterns) > 0 {
+		parts := strings.Split(strings.TrimLeft(filepath.ToSlash(e.Name), "/"), "/")
+		if !o.patterns.match(parts, false) {
+			return false
+		}
+	}
+	return o.filter == nil || o.filter(e)
+}
+
+// Subscription receives the events that match its options, as returned by
+// Watcher.SubscribeWith().
+type Subscription struct {
+	// Events sends the events of the watcher that match the options.
+	Events <-chan Event
+
+	cancel func()
+}
+
+// Close stops the subscription and closes the Events channel; it's safe to
+// call this more than once.
+func (s *Subscription) Close() { s.cancel() }
+
+// subscription is a channel returned by Watcher.Subscribe() or
+// Watcher.SubscribeWith().
+type subscription struct {
+	with   subscribeOpts
+	ch     chan Event
+	once   sync.Once
+	done   chan struct{} // Closed on cancel.
+	mu     sync.RWMutex  // Read-locked while sending; locked to close ch.
+	closed bool
+}
+
+// send sends e to the subscription.
+// Returns false if the watcher is closed.
+func (s *subscription) send(e Event, done <-chan struct{}) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return true
+	}
+	select {
+	case s.ch <- e:
+	case <-s.done:
+	case <-done:
+		return false
+	}
+	return true
+}
+
+// cancel closes the channel; it's safe to call this more than once.
+func (s *subscription) cancel() {
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		s.closed = true
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+// subscribe adds a new subscription for the events for which filter returns
+// true.
+func (p *pipeline) subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	return p.subscribeWith(getSubscribeOptions(SubscribeFilter(filter)))
+}
+
+// subscribeWith adds a new subscription for the events that match with.
+func (p *pipeline) subscribeWith(with subscribeOpts) (<-chan Event, func()) {
+	s := &subscription{
+		with: with,
+		ch:   make(chan Event, with.buffer),
+		done: make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		s.cancel()
+		return s.ch, func() {}
+	}
+	p.subs = append(p.subs, s)
+
+	return s.ch, func() {
+		p.mu.Lock()
+		for i := range p.subs {
+			if p.subs[i] == s {
+				p.subs = append(p.subs[:i:i], p.subs[i+1:]...)
+				break
+			}
+		}
+		p.mu.Unlock()
+		s.cancel()
+	}
+}
+
+// dispatch sends e to all subscriptions it matches, or on the Events channel
+// if there are none.
+// Returns false if the watcher is closed.
+func (p *pipeline) dispatch(e Event) bool {
+	p.mu.Lock()
+	subs, uses := p.subs, p.uses
+	p.mu.Unlock()
+
+	for _, fn := range uses {
+		var keep bool
+		if !p.callHook("Use", func() { e, keep = fn(e) }) || !keep {
+			return true
+		}
+	}
+
+	var matched bool
+	for _, s := range subs {
+		var match bool
+		if !p.callHook("Subscribe", func() { match = s.with.match(e) }) || !match {
+			continue
+		}
+		matched = true
+		if !s.send(e, p.done) {
+			return false
+		}
+	}
+	if matched {
+		return true
+	}
+	return p.emitEvent(e)
+}
+
+// close closes the channels of all subscriptions; this must be called when the
+// watcher is closed.
+func (p *pipeline) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	subs := p.subs
+	p.subs = nil
+	p.mu.Unlock()
+
+	for _, s := range subs {
+		s.cancel()
+	}
+}
+
+// use adds fn to the functions that are called for every event in dispatch(),
+// for Watcher.Use().
+func (p *pipeline) use(fn func(Event) (Event, bool)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.uses = append(p.uses[:len(p.uses):len(p.uses)], fn)
+}
@@ -0,0 +1,52 @@
+package fsnotify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// syncPoll is how often Next() checks if its context is cancelled while
+// waiting for events.
+const syncPoll = 100 * time.Millisecond
+
+// syncQueue holds the events and errors for Next(), for watchers created with
+// WithSynchronous().
+type syncQueue struct {
+	mu    sync.Mutex
+	items []syncItem
+}
+
+type syncItem struct {
+	e   Event
+	err error
+}
+
+func (q *syncQueue) push(e Event, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, syncItem{e: e, err: err})
+}
+
+// pop returns the oldest event or error, or false if there is none.
+func (q *syncQueue) pop() (syncItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return syncItem{}, false
+	}
+	it := q.items[0]
+	q.items[0] = syncItem{}
+	q.items = q.items[1:]
+	return it, true
+}
+
+// syncDeadline returns how long Next() waits for events from the kernel
+// before checking ctx and the queue again.
+func syncDeadline(ctx context.Context) time.Time {
+	d := time.Now().Add(syncPoll)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(d) {
+		return dl
+	}
+	return d
+}
@@ -0,0 +1,166 @@
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWithSynchronous(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+	case "windows":
+		if _, err := NewWatcherWith(WithSynchronous()); !errors.Is(err, ErrSynchronousNotSupported) {
+			t.Fatalf("wrong error: %v", err)
+		}
+		return
+	default:
+		t.Skip("no backend")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w, err := NewWatcherWith(WithSynchronous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	addWatch(t, w, tmp)
+
+	next := func(timeout time.Duration) (Event, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return w.Next(ctx)
+	}
+
+	touch(t, tmp, "file")
+	e, err := next(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Event{Name: filepath.Join(tmp, "file"), Op: Create}); e != want {
+		t.Errorf("wrong event\nhave: %s\nwant: %s", e, want)
+	}
+
+	// Drain any other events, such as the CHMOD for touch.
+	for {
+		if _, err = next(100 * time.Millisecond); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := w.Next(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	select {
+	case e := <-w.Events:
+		t.Fatalf("event on Events channel: %s", e)
+	default:
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := next(time.Second); !errors.Is(err, ErrClosed) {
+		t.Fatalf("wrong error after Close: %v", err)
+	}
+	if _, ok := <-w.Events; ok {
+		t.Fatal("Events not closed")
+	}
+	select {
+	case <-w.Done():
+	default:
+		t.Fatal("Done() not closed after Close()")
+	}
+}
+
+func TestWithSynchronousCloseWakesNext(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+	default:
+		t.Skip("not supported")
+	}
+	t.Parallel()
+
+	w, err := NewWatcherWith(WithSynchronous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addWatch(t, w, t.TempDir())
+
+	errs := make(chan error)
+	go func() {
+		_, err := w.Next(context.Background())
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrClosed) {
+			t.Fatalf("wrong error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Next() didn't return after Close()")
+	}
+}
+
+func TestTryRead(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+	default:
+		t.Skip("WithSynchronous() not supported")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	w, err := NewWatcherWith(WithSynchronous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addWatch(t, w, tmp)
+
+	if _, err := w.SysFd(); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok, err := w.TryRead(); ok || err != nil {
+		t.Fatalf("TryRead() without events: %s, %t, %v", e, ok, err)
+	}
+
+	touch(t, tmp, "file")
+	var (
+		e  Event
+		ok bool
+	)
+	for start := time.Now(); !ok && time.Since(start) < time.Second; {
+		e, ok, err = w.TryRead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if want := (Event{Name: filepath.Join(tmp, "file"), Op: Create}); e != want {
+		t.Errorf("wrong event\nhave: %s\nwant: %s", e, want)
+	}
+
+	w.Close()
+	if _, _, err := w.TryRead(); !errors.Is(err, ErrClosed) {
+		t.Errorf("wrong error after Close(): %v", err)
+	}
+	if _, err := w.SysFd(); !errors.Is(err, ErrClosed) {
+		t.Errorf("wrong error after Close(): %v", err)
+	}
+}
@@ -6,3 +6,7 @@ package fsnotify
 import "golang.org/x/sys/unix"
 
 const openMode = unix.O_NONBLOCK | unix.O_RDONLY | unix.O_CLOEXEC
+
+// openModeNoFollow opens a symbolic link itself for WithoutFollow(), which
+// isn't possible on these systems.
+const openModeNoFollow = 0
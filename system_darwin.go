@@ -3,7 +3,17 @@
 
 package fsnotify
 
-import "golang.org/x/sys/unix"
+import (
+	"golang.org/x/sys/unix"
+	"golang.org/x/text/unicode/norm"
+)
 
 // note: this constant is not defined on BSD
 const openMode = unix.O_EVTONLY | unix.O_CLOEXEC
+
+// openModeNoFollow opens a symbolic link itself for WithoutFollow().
+const openModeNoFollow = openMode | unix.O_SYMLINK
+
+// normalizeName converts name to Unicode NFC for WithNFC(). HFS+ stores names
+// decomposed (NFD), so names read from the directory are often NFD.
+func normalizeName(name string) string { return norm.NFC.String(name) }
@@ -121,3 +121,20 @@ func TestExchangedataInWatchedFile(t *testing.T) {
 	t.Parallel()
 	testExchangedataForWatcher(t, false)
 }
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"/tmp/file", "/tmp/file"},
+		{"/tmp/caf\u00e9", "/tmp/caf\u00e9"},           // Already NFC.
+		{"/tmp/cafe\u0301", "/tmp/caf\u00e9"},          // NFD from HFS+.
+		{"/tmp/A\u030a/e\u0301", "/tmp/\u00c5/\u00e9"}, // Every path element.
+	}
+	for _, tt := range tests {
+		if have := normalizeName(tt.in); have != tt.want {
+			t.Errorf("normalizeName(%q) = %q; want %q", tt.in, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package fsnotify
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// isHidden reports if the file at path is hidden: on Unix systems this is
+// any file starting with a ".".
+func isHidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
@@ -0,0 +1,23 @@
+//go:build windows
+// +build windows
+
+package fsnotify
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// isHidden reports if the file at path is hidden: on Windows this is any file
+// with the FILE_ATTRIBUTE_HIDDEN attribute. Files that no longer exist are
+// never hidden, as there's no way to know.
+func isHidden(path string) bool {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	attr, err := windows.GetFileAttributes(p)
+	if err != nil {
+		return false
+	}
+	return attr&windows.FILE_ATTRIBUTE_HIDDEN != 0
+}
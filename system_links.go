@@ -0,0 +1,24 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package fsnotify
+
+import (
+	"os"
+	"syscall"
+)
+
+// LinkCount returns the number of hard links to the file at path; a count
+// higher than 1 means that the file can also be changed through other paths.
+// Symbolic links are not followed.
+func LinkCount(path string) (int, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 1, nil
+	}
+	return int(st.Nlink), nil
+}
@@ -0,0 +1,12 @@
+package fsnotify
+
+import "os"
+
+// LinkCount returns the number of hard links to the file at path; this is
+// always 1 as Plan 9 doesn't have hard links.
+func LinkCount(path string) (int, error) {
+	if _, err := os.Lstat(path); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
@@ -0,0 +1,34 @@
+//go:build windows
+// +build windows
+
+package fsnotify
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// LinkCount returns the number of hard links to the file at path; a count
+// higher than 1 means that the file can also be changed through other paths.
+// Symbolic links are not followed.
+func LinkCount(path string) (int, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	h, err := windows.CreateFile(p, 0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return 0, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer windows.CloseHandle(h)
+
+	var info windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(h, &info); err != nil {
+		return 0, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	return int(info.NumberOfLinks), nil
+}
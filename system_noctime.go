@@ -0,0 +1,15 @@
+//go:build !linux && !openbsd && !dragonfly && !solaris && !darwin && !freebsd && !netbsd
+// +build !linux,!openbsd,!dragonfly,!solaris,!darwin,!freebsd,!netbsd
+
+package fsnotify
+
+import (
+	"io/fs"
+	"time"
+)
+
+// changeTime returns the time the file's metadata was last changed, or the
+// modification time if that's not available.
+func changeTime(fi fs.FileInfo) time.Time {
+	return fi.ModTime()
+}
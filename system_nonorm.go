@@ -0,0 +1,8 @@
+//go:build !darwin
+// +build !darwin
+
+package fsnotify
+
+// normalizeName converts name to Unicode NFC for WithNFC(); this only
+// applies on macOS.
+func normalizeName(name string) string { return name }
@@ -0,0 +1,9 @@
+//go:build !plan9
+// +build !plan9
+
+package fsnotify
+
+import "syscall"
+
+// unsupportedErrors are the system errors for unsupported operations.
+var unsupportedErrors = []error{syscall.ENOTSUP, syscall.EOPNOTSUPP, syscall.ENOSYS}
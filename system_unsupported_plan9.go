@@ -0,0 +1,4 @@
+package fsnotify
+
+// unsupportedErrors are the system errors for unsupported operations.
+var unsupportedErrors []error
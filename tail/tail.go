@@ -0,0 +1,318 @@
+// Package tail follows the contents of a file as it's written to, like
+// "tail -F".
+//
+// It keeps following the file if it's truncated, rotated by renaming it, or
+// removed and created again:
+//
+//	t, err := tail.File("/var/log/app.log", tail.Options{Lines: true})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer t.Close()
+//	for line := range t.Data {
+//		fmt.Printf("%s\n", line)
+//	}
+//
+// The directory of the file is watched, rather than the file itself, so that
+// a new file with the same name is noticed.
+package tail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Options are the options for File().
+type Options struct {
+	// Send the data per line, without the trailing newline, rather than in
+	// chunks as it's read. A line that doesn't end with a newline is only sent
+	// once the rest of it is written, or when the file is rotated or
+	// truncated.
+	Lines bool
+
+	// Send the existing contents of the file, rather than only what's written
+	// after File() is called. New files created after a rotation are always
+	// read from the start.
+	FromStart bool
+
+	// Maximum size of the chunks that are read; the default is 32K. In Lines
+	// mode longer lines are sent in parts of this size.
+	BufferSize int
+}
+
+// Tail follows a file; see File().
+type Tail struct {
+	// Data receives the chunks or lines that are written to the file. It's
+	// closed after Close() is called.
+	Data chan []byte
+
+	// Errors receives the errors from reading the file and from the watcher.
+	// It's closed after Close() is called.
+	Errors chan error
+
+	path string
+	opts Options
+	w    *fsnotify.Watcher
+	buf  []byte
+	line []byte // Start of a line without a newline, for Lines.
+
+	fp     *os.File // nil if the file doesn't exist.
+	offset int64    // Offset in fp.
+	gone   bool     // fp was renamed or removed, and needs to be replaced.
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// File starts following the file at path.
+//
+// The file doesn't need to exist yet; it's read once it's created. The
+// directory must exist.
+func File(path string, opts Options) (*Tail, error) {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 32 * 1024
+	}
+	path = filepath.Clean(path)
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	t := &Tail{
+		Data:   make(chan []byte),
+		Errors: make(chan error),
+		path:   path,
+		opts:   opts,
+		w:      w,
+		buf:    make([]byte, opts.BufferSize),
+		done:   make(chan struct{}),
+	}
+	if err := t.open(!opts.FromStart); err != nil && !errors.Is(err, os.ErrNotExist) {
+		w.Close()
+		return nil, err
+	}
+
+	t.wg.Add(1)
+	go t.run()
+	return t, nil
+}
+
+// Close stops following the file, and closes the Data and Errors channels.
+func (t *Tail) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+		err = t.w.Close()
+		t.wg.Wait()
+	})
+	return err
+}
+
+func (t *Tail) run() {
+	defer t.wg.Done()
+	defer close(t.Data)
+	defer close(t.Errors)
+	defer func() {
+		if t.fp != nil {
+			t.fp.Close()
+		}
+	}()
+
+	if !t.read() {
+		return
+	}
+	for {
+		select {
+		case <-t.done:
+			return
+		case err, ok := <-t.w.Errors:
+			if !ok {
+				return
+			}
+			if !t.sendError(err) {
+				return
+			}
+			// Some events may have been lost, so check the file.
+			if !t.reopen() || !t.read() {
+				return
+			}
+		case e, ok := <-t.w.Events:
+			if !ok {
+				return
+			}
+			// The watcher sends "./app.log" for the path "app.log".
+			if filepath.Clean(e.Name) != t.path {
+				continue
+			}
+			if !t.handle(e) {
+				return
+			}
+		}
+	}
+}
+
+// handle an event for the file. Returns false if the Tail is closed.
+func (t *Tail) handle(e fsnotify.Event) bool {
+	switch {
+	case e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename):
+		// Keep the old file open: the writer may still write to it before
+		// it's replaced.
+		t.gone = true
+		return t.read()
+	case e.Has(fsnotify.Create):
+		return t.reopen() && t.read()
+	case e.Has(fsnotify.Write):
+		return t.read()
+	}
+	return true
+}
+
+// open the file, at the end if seekEnd is set.
+func (t *Tail) open(seekEnd bool) error {
+	fp, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	var offset int64
+	if seekEnd {
+		offset, err = fp.Seek(0, io.SeekEnd)
+		if err != nil {
+			fp.Close()
+			return err
+		}
+	}
+	t.fp, t.offset, t.gone = fp, offset, false
+	return nil
+}
+
+// reopen the file if it was replaced, after reading the rest of the old file.
+// Returns false if the Tail is closed.
+func (t *Tail) reopen() bool {
+	if t.fp != nil {
+		fi, err := os.Stat(t.path)
+		if err != nil {
+			return true // Not created yet; wait for the Create event.
+		}
+		cur, err := t.fp.Stat()
+		if err == nil && os.SameFile(fi, cur) {
+			t.gone = false
+			return true
+		}
+
+		if !t.read() || !t.flushLine() {
+			return false
+		}
+		t.fp.Close()
+		t.fp = nil
+	}
+
+	err := t.open(false)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return t.sendError(err)
+	}
+	return true
+}
+
+// read and send everything from the current offset to the end of the file.
+// Returns false if the Tail is closed.
+func (t *Tail) read() bool {
+	if t.fp == nil {
+		return true
+	}
+	if !t.gone {
+		fi, err := t.fp.Stat()
+		if err != nil {
+			return t.sendError(err)
+		}
+		if fi.Size() < t.offset {
+			// Truncated: start again from the beginning.
+			if !t.flushLine() {
+				return false
+			}
+			if _, err := t.fp.Seek(0, io.SeekStart); err != nil {
+				return t.sendError(err)
+			}
+			t.offset = 0
+		}
+	}
+
+	for {
+		n, err := t.fp.Read(t.buf)
+		if n > 0 {
+			t.offset += int64(n)
+			if !t.send(t.buf[:n]) {
+				return false
+			}
+		}
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			return t.sendError(err)
+		}
+	}
+}
+
+// send data that was read, split in lines for Options.Lines.
+func (t *Tail) send(data []byte) bool {
+	if !t.opts.Lines {
+		return t.sendData(append([]byte(nil), data...))
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := append(t.line, data[:i]...)
+		t.line = nil
+		if !t.sendData(line) {
+			return false
+		}
+		data = data[i+1:]
+	}
+	t.line = append(t.line, data...)
+	if len(t.line) >= t.opts.BufferSize {
+		return t.flushLine()
+	}
+	return true
+}
+
+// flushLine sends a line that doesn't end with a newline.
+func (t *Tail) flushLine() bool {
+	if len(t.line) == 0 {
+		return true
+	}
+	line := t.line
+	t.line = nil
+	return t.sendData(line)
+}
+
+func (t *Tail) sendData(data []byte) bool {
+	select {
+	case t.Data <- data:
+		return true
+	case <-t.done:
+		return false
+	}
+}
+
+func (t *Tail) sendError(err error) bool {
+	select {
+	case t.Errors <- err:
+		return true
+	case <-t.done:
+		return false
+	}
+}
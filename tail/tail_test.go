@@ -0,0 +1,120 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, path, data string, flag int) {
+	t.Helper()
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	if _, err := fp.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func want(t *testing.T, tl *Tail, lines ...string) {
+	t.Helper()
+	for _, w := range lines {
+		select {
+		case have := <-tl.Data:
+			if string(have) != w {
+				t.Fatalf("have %q; want %q", have, w)
+			}
+		case err := <-tl.Errors:
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %q", w)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "app.log")
+	write(t, file, "old\n", os.O_APPEND)
+
+	tl, err := File(file, Options{Lines: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+
+	write(t, file, "one\ntw", os.O_APPEND)
+	want(t, tl, "one")
+	write(t, file, "o\n", os.O_APPEND)
+	want(t, tl, "two")
+
+	// Truncated.
+	write(t, file, "three\n", os.O_TRUNC)
+	want(t, tl, "three")
+
+	// Rotated: the rest of the old file is read before the new file.
+	if err := os.Rename(file, file+".1"); err != nil {
+		t.Fatal(err)
+	}
+	write(t, file+".1", "four\n", os.O_APPEND)
+	write(t, file, "five\n", os.O_APPEND)
+	want(t, tl, "four", "five")
+
+	// Removed and created again.
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	write(t, file, "six\n", os.O_APPEND)
+	want(t, tl, "six")
+
+	if err := tl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-tl.Data; ok {
+		t.Error("Data not closed")
+	}
+}
+
+func TestFileFromStart(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "app.log")
+
+	// Doesn't exist yet.
+	tl, err := File(file, Options{FromStart: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+
+	write(t, file, "hello", os.O_APPEND)
+	want(t, tl, "hello")
+}
+
+func TestFileRelative(t *testing.T) {
+	// Not parallel: it changes the working directory.
+	tmp := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tl, err := File("app.log", Options{Lines: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+
+	write(t, "app.log", "one\n", os.O_APPEND)
+	want(t, tl, "one")
+}
@@ -0,0 +1,450 @@
+package fsnotify
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tree maintains an in-memory mirror of a directory tree, and sends a
+// TreeChange on the Changes channel for every change to it.
+//
+// The mirror is kept up to date from the events of a recursive watch; because
+// events can be missed (for example on a queue overflow) the tree is also
+// compared against the filesystem every verify interval, and any differences
+// are sent as changes.
+type Tree struct {
+	// Changes sends the changes to the tree.
+	Changes chan TreeChange
+
+	// Errors sends any errors.
+	Errors chan error
+
+	root     string
+	verify   time.Duration
+	w        *Watcher
+	mu       sync.Mutex           // Protects entries and closing done.
+	entries  map[string]TreeEntry // Mirror of the tree (key: path).
+	renamed  []TreeEntry          // Entries removed by a rename, waiting for the Create.
+	done     chan struct{}
+	doneResp chan struct{}
+}
+
+// TreeEntry is the metadata of a single file or directory in a Tree.
+type TreeEntry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// TreeOp describes the kind of a TreeChange.
+type TreeOp uint8
+
+// The kinds of changes to a tree.
+const (
+	TreeAdded TreeOp = iota + 1
+	TreeModified
+	TreeRemoved
+	TreeRenamed
+)
+
+func (o TreeOp) String() string {
+	switch o {
+	case TreeAdded:
+		return "ADDED"
+	case TreeModified:
+		return "MODIFIED"
+	case TreeRemoved:
+		return "REMOVED"
+	case TreeRenamed:
+		return "RENAMED"
+	}
+	return fmt.Sprintf("TreeOp(%d)", uint8(o))
+}
+
+// TreeChange is a single change to a Tree.
+//
+// Before is nil for TreeAdded, and After is nil for TreeRemoved.
+type TreeChange struct {
+	Op     TreeOp
+	Before *TreeEntry
+	After  *TreeEntry
+}
+
+// String returns a string representation of the change in the form
+// "MODIFIED: file" or "RENAMED: old -> new".
+func (c TreeChange) String() string {
+	switch {
+	case c.Before == nil && c.After == nil:
+		return c.Op.String()
+	case c.Before == nil:
+		return fmt.Sprintf("%s: %s", c.Op, c.After.Name)
+	case c.After == nil || c.Before.Name == c.After.Name:
+		return fmt.Sprintf("%s: %s", c.Op, c.Before.Name)
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Op, c.Before.Name, c.After.Name)
+}
+
+// renameWait is how long a Tree waits for the Create event that goes with a
+// Rename; if it's not received by then the entry is reported as removed.
+const renameWait = 50 * time.Millisecond
+
+// NewTree creates a mirror of the directory root and starts watching it for
+// changes.
+//
+// The tree is compared against the filesystem every verify interval; use 0 to
+// disable this.
+func NewTree(root string, verify time.Duration) (*Tree, error) {
+	root = filepath.Clean(root)
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(filepath.Join(root, "...")); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	entries, err := scanTree(root)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	t := &Tree{
+		Changes:  make(chan TreeChange),
+		Errors:   make(chan error),
+		root:     root,
+		verify:   verify,
+		w:        w,
+		entries:  entries,
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	go t.run()
+	return t, nil
+}
+
+// Close stops watching the tree and closes the Changes and Errors channels.
+func (t *Tree) Close() error {
+	t.mu.Lock()
+	select {
+	case <-t.done:
+		t.mu.Unlock()
+		return nil
+	default:
+	}
+	close(t.done)
+	t.mu.Unlock()
+
+	err := t.w.Close()
+	<-t.doneResp
+	return err
+}
+
+// Entries returns a snapshot of all entries in the tree, sorted by name.
+func (t *Tree) Entries() []TreeEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := make([]TreeEntry, 0, len(t.entries))
+	for _, e := range t.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+func (t *Tree) run() {
+	defer close(t.doneResp)
+	defer close(t.Errors)
+	defer close(t.Changes)
+
+	var verify <-chan time.Time
+	if t.verify > 0 {
+		tick := time.NewTicker(t.verify)
+		defer tick.Stop()
+		verify = tick.C
+	}
+	var flush <-chan time.Time
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case err, ok := <-t.w.Errors:
+			if !ok {
+				return
+			}
+			if !t.sendError(err) {
+				return
+			}
+		case e, ok := <-t.w.Events:
+			if !ok {
+				return
+			}
+			if !t.handle(e) {
+				return
+			}
+			if len(t.renamed) > 0 && flush == nil {
+				flush = time.After(renameWait)
+			}
+		case <-flush:
+			flush = nil
+			if !t.flushRenamed() {
+				return
+			}
+		case <-verify:
+			if !t.flushRenamed() || !t.reconcile() {
+				return
+			}
+		}
+	}
+}
+
+// handle updates the tree for the event e, and sends the resulting changes.
+func (t *Tree) handle(e Event) bool {
+	// Names in the tree are cleaned; the watcher sends "./a" for the root ".".
+	e.Name = filepath.Clean(e.Name)
+	fi, err := os.Lstat(e.Name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return t.sendError(err)
+		}
+
+		t.mu.Lock()
+		old, ok := t.entries[e.Name]
+		t.mu.Unlock()
+		if !ok {
+			return true
+		}
+		if e.Has(Rename) {
+			t.renamed = append(t.renamed, old)
+			return true
+		}
+		return t.removeEntry(old)
+	}
+
+	cur := newTreeEntry(e.Name, fi)
+	t.mu.Lock()
+	old, ok := t.entries[e.Name]
+	t.mu.Unlock()
+	switch {
+	case !ok:
+		for i, r := range t.renamed {
+			if r.IsDir == cur.IsDir && r.Size == cur.Size && r.ModTime.Equal(cur.ModTime) {
+				t.renamed = append(t.renamed[:i], t.renamed[i+1:]...)
+				return t.renameEntry(r, cur)
+			}
+		}
+		return t.addEntry(cur)
+	case old.IsDir != cur.IsDir:
+		return t.removeEntry(old) && t.addEntry(cur)
+	case !cur.IsDir && (old.Size != cur.Size || !old.ModTime.Equal(cur.ModTime)):
+		t.set(cur)
+		return t.send(TreeChange{Op: TreeModified, Before: &old, After: &cur})
+	}
+	return true
+}
+
+// addEntry adds e and, if it's a directory, everything in it.
+func (t *Tree) addEntry(e TreeEntry) bool {
+	t.set(e)
+	if !t.send(TreeChange{Op: TreeAdded, After: &e}) {
+		return false
+	}
+	if !e.IsDir {
+		return true
+	}
+
+	entries, err := scanTree(e.Name)
+	if err != nil {
+		return t.sendError(err)
+	}
+	for _, name := range sortedNames(entries) {
+		if name == e.Name {
+			continue
+		}
+		t.mu.Lock()
+		_, ok := t.entries[name]
+		t.mu.Unlock()
+		if !ok {
+			ee := entries[name]
+			t.set(ee)
+			if !t.send(TreeChange{Op: TreeAdded, After: &ee}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// removeEntry removes e and, if it's a directory, everything in it.
+func (t *Tree) removeEntry(e TreeEntry) bool {
+	for _, ee := range t.below(e.Name) {
+		ee := ee
+		t.del(ee.Name)
+		if !t.send(TreeChange{Op: TreeRemoved, Before: &ee}) {
+			return false
+		}
+	}
+	t.del(e.Name)
+	return t.send(TreeChange{Op: TreeRemoved, Before: &e})
+}
+
+// renameEntry moves old to cur; the entries of a directory are moved without
+// sending any changes for them.
+func (t *Tree) renameEntry(old, cur TreeEntry) bool {
+	for _, ee := range t.below(old.Name) {
+		t.del(ee.Name)
+		ee.Name = cur.Name + strings.TrimPrefix(ee.Name, old.Name)
+		t.set(ee)
+	}
+	t.del(old.Name)
+	t.set(cur)
+	return t.send(TreeChange{Op: TreeRenamed, Before: &old, After: &cur})
+}
+
+// flushRenamed reports all renamed entries for which no Create was received
+// as removed.
+func (t *Tree) flushRenamed() bool {
+	renamed := t.renamed
+	t.renamed = nil
+	for _, r := range renamed {
+		if !t.removeEntry(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcile compares the mirror against the filesystem, and sends changes for
+// any differences.
+func (t *Tree) reconcile() bool {
+	cur, err := scanTree(t.root)
+	if err != nil {
+		return t.sendError(err)
+	}
+
+	t.mu.Lock()
+	old := t.entries
+	t.entries = cur
+	t.mu.Unlock()
+
+	for _, name := range sortedNames(old) {
+		o := old[name]
+		c, ok := cur[name]
+		switch {
+		case !ok:
+			if !t.send(TreeChange{Op: TreeRemoved, Before: &o}) {
+				return false
+			}
+		case o.IsDir != c.IsDir || (!c.IsDir && (o.Size != c.Size || !o.ModTime.Equal(c.ModTime))):
+			if !t.send(TreeChange{Op: TreeModified, Before: &o, After: &c}) {
+				return false
+			}
+		}
+	}
+	for _, name := range sortedNames(cur) {
+		if _, ok := old[name]; !ok {
+			c := cur[name]
+			if !t.send(TreeChange{Op: TreeAdded, After: &c}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// below returns all entries below the directory dir, deepest first.
+func (t *Tree) below(dir string) []TreeEntry {
+	prefix := dir + string(filepath.Separator)
+	t.mu.Lock()
+	var entries []TreeEntry
+	for name, e := range t.entries {
+		if strings.HasPrefix(name, prefix) {
+			entries = append(entries, e)
+		}
+	}
+	t.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name > entries[j].Name })
+	return entries
+}
+
+func (t *Tree) set(e TreeEntry) {
+	t.mu.Lock()
+	t.entries[e.Name] = e
+	t.mu.Unlock()
+}
+
+func (t *Tree) del(name string) {
+	t.mu.Lock()
+	delete(t.entries, name)
+	t.mu.Unlock()
+}
+
+// Returns true if the change was sent, or false if the tree is closed.
+func (t *Tree) send(c TreeChange) bool {
+	select {
+	case t.Changes <- c:
+		return true
+	case <-t.done:
+	}
+	return false
+}
+
+// Returns true if the error was sent, or false if the tree is closed.
+func (t *Tree) sendError(err error) bool {
+	select {
+	case t.Errors <- err:
+		return true
+	case <-t.done:
+	}
+	return false
+}
+
+func newTreeEntry(name string, fi fs.FileInfo) TreeEntry {
+	e := TreeEntry{Name: name, IsDir: fi.IsDir(), ModTime: fi.ModTime()}
+	if !e.IsDir {
+		e.Size = fi.Size()
+	}
+	return e
+}
+
+// scanTree reads the metadata for root and everything below it.
+func scanTree(root string) (map[string]TreeEntry, error) {
+	entries := make(map[string]TreeEntry)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		entries[path] = newTreeEntry(path, fi)
+		return nil
+	})
+	return entries, err
+}
+
+func sortedNames(m map[string]TreeEntry) []string {
+	names := make([]string, 0, len(m))
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,117 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// collectTree collects all changes from the tree in the background; the
+// returned function waits until no change has been received for a while and
+// returns them.
+func collectTree(t *testing.T, tree *Tree, root string) func() string {
+	t.Helper()
+
+	done := make(chan string)
+	go func() {
+		var have []string
+		for {
+			select {
+			case c := <-tree.Changes:
+				have = append(have, strings.ReplaceAll(filepath.ToSlash(c.String()), filepath.ToSlash(root), ""))
+			case err := <-tree.Errors:
+				t.Error(err)
+			case <-time.After(500 * time.Millisecond):
+				done <- strings.Join(have, "\n")
+				return
+			}
+		}
+	}()
+	return func() string { return <-done }
+}
+
+func TestTree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows reports the rename as a Remove and Create")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	touch(t, tmp, "file")
+	mkdir(t, tmp, "dir")
+
+	tree, err := NewTree(tmp, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	if l := len(tree.Entries()); l != 3 {
+		t.Fatalf("len(Entries()) = %d; want 3\n%v", l, tree.Entries())
+	}
+
+	stop := collectTree(t, tree, tmp)
+	touch(t, tmp, "dir", "new")
+	cat(t, "data", tmp, "dir", "new")
+	mv(t, filepath.Join(tmp, "file"), tmp, "renamed")
+	rmAll(t, tmp, "dir")
+
+	have := stop()
+	want := strings.Join([]string{
+		"ADDED: /dir/new",
+		"MODIFIED: /dir/new",
+		"RENAMED: /file -> /renamed",
+		"REMOVED: /dir/new",
+		"REMOVED: /dir",
+	}, "\n")
+	if have != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestTreeVerify(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	tree, err := NewTree(tmp, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	// Simulate a missed event.
+	tree.mu.Lock()
+	tree.entries[filepath.Join(tmp, "gone")] = TreeEntry{Name: filepath.Join(tmp, "gone")}
+	tree.mu.Unlock()
+
+	have := collectTree(t, tree, tmp)()
+	if have != "REMOVED: /gone" {
+		t.Errorf("have: %q", have)
+	}
+}
+
+func TestTreeRelative(t *testing.T) {
+	// Not parallel: it changes the working directory.
+	tmp := t.TempDir()
+	touch(t, tmp, "file")
+	chdir(t, tmp)
+
+	tree, err := NewTree(".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	stop := collectTree(t, tree, "")
+	cat(t, "data", "file")
+	rm(t, "file")
+	have := stop()
+	if want := "MODIFIED: file\nREMOVED: file"; have != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+	}
+	if l := len(tree.Entries()); l != 1 {
+		t.Errorf("len(Entries()) = %d; want 1\n%v", l, tree.Entries())
+	}
+}
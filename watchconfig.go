@@ -0,0 +1,146 @@
+package fsnotify
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// configDebounce is how long WatchConfig() waits for more events before
+	// reloading.
+	configDebounce = 100 * time.Millisecond
+
+	// configMaxBackoff is the longest WatchConfig() waits before retrying a
+	// failed reload.
+	configMaxBackoff = 30 * time.Second
+)
+
+// WatchConfigOptions are the options for WatchConfigWith().
+type WatchConfigOptions struct {
+	// Clock to use for the debounce and the delay between retries; the
+	// default is SystemClock.
+	Clock Clock
+
+	// OnError is called with the error if reload fails, before it's retried.
+	// It's called from the goroutine that called WatchConfigWith(), and may
+	// be nil.
+	OnError func(error)
+}
+
+// WatchConfig watches the configuration file at path and calls reload when its
+// content changes, until ctx is cancelled. It handles the common ways
+// configuration files are changed:
+//
+//   - Editors and tools that save the file atomically, by writing a new file
+//     and renaming it over the old one, or by removing and creating it.
+//   - Kubernetes ConfigMap and Secret volumes, where path is a symlink into a
+//     "..data" directory that's replaced (see ConfigMapWatcher).
+//   - The file being removed: nothing happens until it's created again.
+//
+// reload is called after there were no changes for 100ms, and only if the
+// content is different from the last successful reload (or from when
+// WatchConfig was called), so saving without changes doesn't reload. It's not
+// called when WatchConfig starts. If reload returns an error it's called again
+// after a delay, which doubles after every failure up to 30 seconds, until it
+// succeeds or the file changes again. Use WatchConfigWith() to see these errors
+// with WatchConfigOptions.OnError.
+//
+// The directory of path must exist. It returns ctx.Err() once ctx is
+// cancelled, and returns early if the directory can't be watched or the watcher
+// sends an error other than ErrEventOverflow.
+func WatchConfig(ctx context.Context, path string, reload func() error) error {
+	return WatchConfigWith(ctx, path, reload, WatchConfigOptions{})
+}
+
+// WatchConfigWith is like WatchConfig, but allows setting options.
+func WatchConfigWith(ctx context.Context, path string, reload func() error, opts WatchConfigOptions) error {
+	clock := clockOrSystem(opts.Clock)
+	path = filepath.Clean(path)
+	w, err := NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	last, err := fileSum(path)
+	loaded := err == nil // last is the content that's currently loaded.
+
+	timer := clock.NewTimer(configDebounce)
+	timer.Stop()
+	defer timer.Stop()
+	schedule := func(d time.Duration) {
+		if !timer.Stop() {
+			select {
+			case <-timer.C():
+			default:
+			}
+		}
+		timer.Reset(d)
+	}
+
+	var backoff time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			// The watcher sends "./app.conf" for the path "app.conf".
+			if filepath.Clean(e.Name) != path && filepath.Base(e.Name) != configMapData {
+				continue
+			}
+			backoff = 0
+			schedule(configDebounce)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			// Some events were lost, so check if the file changed.
+			if !errors.Is(err, ErrEventOverflow) {
+				return err
+			}
+			schedule(configDebounce)
+		case <-timer.C():
+			sum, err := fileSum(path)
+			if err != nil {
+				continue // Removed, or not readable; wait for the next change.
+			}
+			if loaded && sum == last {
+				continue
+			}
+			if err := reload(); err != nil {
+				if opts.OnError != nil {
+					opts.OnError(err)
+				}
+				backoff *= 2
+				if backoff == 0 {
+					backoff = configDebounce
+				}
+				if backoff > configMaxBackoff {
+					backoff = configMaxBackoff
+				}
+				schedule(backoff)
+				continue
+			}
+			last, loaded, backoff = sum, true, 0
+		}
+	}
+}
+
+// fileSum returns the SHA-256 of the content of the file at path.
+func fileSum(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,134 @@
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchConfig(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "app.conf")
+	cat(t, "one", file)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var fail int32 // Number of times reload fails.
+	reloads := make(chan string, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- WatchConfig(ctx, file, func() error {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if atomic.AddInt32(&fail, -1) >= 0 {
+				reloads <- "fail " + string(data)
+				return errors.New("oops")
+			}
+			reloads <- string(data)
+			return nil
+		})
+	}()
+	waitForEvents()
+
+	// save writes data atomically, like editors do.
+	save := func(data string) {
+		t.Helper()
+		tmpFile := filepath.Join(tmp, ".app.conf.tmp")
+		cat(t, data, tmpFile)
+		mv(t, tmpFile, file)
+	}
+	want := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case have := <-reloads:
+				if have != w {
+					t.Fatalf("have %q; want %q", have, w)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for %q", w)
+			}
+		}
+		select {
+		case have := <-reloads:
+			t.Fatalf("unexpected reload: %q", have)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	save("two")
+	want("two")
+
+	// Same content.
+	save("two")
+	want()
+
+	// Removed and created again.
+	rm(t, file)
+	want()
+	cat(t, "three", file)
+	want("three")
+
+	// Retried after a failure.
+	atomic.StoreInt32(&fail, 2)
+	save("four")
+	want("fail four", "fail four", "four")
+
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestWatchConfigRelative(t *testing.T) {
+	// Not parallel: it changes the working directory.
+	tmp := t.TempDir()
+	chdir(t, tmp)
+	if err := os.WriteFile("app.conf", []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var fail int32 = 1
+	reloads, errs := make(chan string, 10), make(chan error, 10)
+	go WatchConfigWith(ctx, "app.conf", func() error {
+		if atomic.AddInt32(&fail, -1) >= 0 {
+			return errors.New("oops")
+		}
+		data, err := os.ReadFile("app.conf")
+		reloads <- string(data)
+		return err
+	}, WatchConfigOptions{OnError: func(err error) { errs <- err }})
+	waitForEvents()
+
+	if err := os.WriteFile("app.conf", []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if err.Error() != "oops" {
+			t.Errorf("wrong error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for OnError")
+	}
+	select {
+	case have := <-reloads:
+		if have != "two" {
+			t.Errorf("have %q; want %q", have, "two")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for reload")
+	}
+}
@@ -0,0 +1,215 @@
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WriteCompleteOptions are the options for NewWriteComplete().
+type WriteCompleteOptions struct {
+	// A file is complete once there were no events for it for this long. The
+	// default is one second. On Linux this isn't needed for files that were
+	// closed after writing (see WithCloseWrite()).
+	Quiet time.Duration
+
+	// And the size of the file didn't change for this long. This catches
+	// writes that don't send events, such as on network filesystems. The
+	// default is 100ms.
+	StableFor time.Duration
+
+	// Clock to use; the default is SystemClock.
+	Clock Clock
+}
+
+// CompletedFile is a file that WriteComplete decided has finished being
+// written.
+type CompletedFile struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// WriteComplete detects when files in a directory have finished being written,
+// and sends one CompletedFile for every file. This is useful for "hot folders"
+// where other programs upload files to be processed: the events for a file
+// start when it's created, but it's only ready to be read once the upload is
+// finished.
+//
+// A file is complete once there were no events for it for a while, and its
+// size didn't change. On Linux it's also complete once it's closed after
+// writing (CloseWrite) and its size didn't change, without waiting for the
+// quiet period.
+//
+// Files that are written to again after they were sent are sent again once
+// they're complete. Files that are removed or renamed before they're
+// complete aren't sent; a file that's renamed into the directory (which is
+// common for uploads that use a temporary name) is sent once its size is
+// stable.
+type WriteComplete struct {
+	// Files sends the files that are complete.
+	Files chan CompletedFile
+
+	// Errors sends any errors.
+	Errors chan error
+
+	opts    WriteCompleteOptions
+	w       *Watcher
+	pending map[string]*pendingFile // Files being written (key: path).
+
+	mu       sync.Mutex // Protects closing done.
+	done     chan struct{}
+	doneResp chan struct{}
+}
+
+type pendingFile struct {
+	last   time.Time // Time of the last event.
+	closed bool      // Closed after writing, and not written to since.
+	size   int64     // Size when it was last checked.
+	sizeAt time.Time // When the size was last seen changing; zero if not checked yet.
+}
+
+// NewWriteComplete starts detecting completed files in dir. A dir ending in
+// "/..." is watched recursively.
+func NewWriteComplete(dir string, opts WriteCompleteOptions) (*WriteComplete, error) {
+	if opts.Quiet <= 0 {
+		opts.Quiet = time.Second
+	}
+	if opts.StableFor <= 0 {
+		opts.StableFor = 100 * time.Millisecond
+	}
+	opts.Clock = clockOrSystem(opts.Clock)
+
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.AddWith(dir, WithCloseWrite(), WithoutChmod()); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	c := &WriteComplete{
+		Files:    make(chan CompletedFile),
+		Errors:   make(chan error),
+		opts:     opts,
+		w:        w,
+		pending:  make(map[string]*pendingFile),
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+// Close stops watching and closes the Files and Errors channels.
+func (c *WriteComplete) Close() error {
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil
+	default:
+	}
+	close(c.done)
+	c.mu.Unlock()
+
+	err := c.w.Close()
+	<-c.doneResp
+	return err
+}
+
+func (c *WriteComplete) run() {
+	defer close(c.doneResp)
+	defer close(c.Errors)
+	defer close(c.Files)
+
+	// Check the pending files at least this often.
+	interval := c.opts.StableFor / 2
+	if q := c.opts.Quiet / 4; q < interval {
+		interval = q
+	}
+	check := c.opts.Clock.NewTimer(interval)
+	defer check.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case err, ok := <-c.w.Errors:
+			if !ok {
+				return
+			}
+			if !c.sendError(err) {
+				return
+			}
+		case e, ok := <-c.w.Events:
+			if !ok {
+				return
+			}
+			c.handle(e)
+		case <-check.C():
+			if !c.check() {
+				return
+			}
+			check.Reset(interval)
+		}
+	}
+}
+
+// handle updates the state of the file for the event e.
+func (c *WriteComplete) handle(e Event) {
+	switch {
+	case e.Has(Remove) || e.Has(Rename):
+		delete(c.pending, e.Name)
+	case e.Has(Create) || e.Has(Write) || e.Has(CloseWrite):
+		p := c.pending[e.Name]
+		if p == nil {
+			p = &pendingFile{}
+			c.pending[e.Name] = p
+		}
+		p.last = c.opts.Clock.Now()
+		p.closed = e.Has(CloseWrite) || (p.closed && !e.Has(Write))
+		p.sizeAt = time.Time{}
+	}
+}
+
+// check sends the pending files that are complete.
+func (c *WriteComplete) check() bool {
+	now := c.opts.Clock.Now()
+	for name, p := range c.pending {
+		if !p.closed && now.Sub(p.last) < c.opts.Quiet {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil || !fi.Mode().IsRegular() {
+			delete(c.pending, name) // Removed, or a directory.
+			continue
+		}
+		if p.sizeAt.IsZero() || fi.Size() != p.size {
+			p.size, p.sizeAt = fi.Size(), now
+			continue
+		}
+		if now.Sub(p.sizeAt) < c.opts.StableFor {
+			continue
+		}
+
+		delete(c.pending, name)
+		select {
+		case c.Files <- CompletedFile{Name: filepath.Clean(name), Size: fi.Size(), ModTime: fi.ModTime()}:
+		case <-c.done:
+			return false
+		}
+	}
+	return true
+}
+
+func (c *WriteComplete) sendError(err error) bool {
+	select {
+	case c.Errors <- err:
+		return true
+	case <-c.done:
+		return false
+	}
+}
@@ -0,0 +1,93 @@
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWriteComplete(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	c, err := NewWriteComplete(tmp, WriteCompleteOptions{Quiet: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	next := func(timeout time.Duration) (CompletedFile, bool) {
+		t.Helper()
+		select {
+		case f := <-c.Files:
+			return f, true
+		case err := <-c.Errors:
+			t.Fatal(err)
+		case <-time.After(timeout):
+		}
+		return CompletedFile{}, false
+	}
+
+	// Written in several steps, with pauses shorter than Quiet.
+	file := filepath.Join(tmp, "upload")
+	fp, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := fp.WriteString("data"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if f, ok := next(0); ok {
+			t.Fatalf("sent before the file was complete: %v", f)
+		}
+	}
+	f, ok := next(5 * time.Second)
+	if !ok {
+		t.Fatal("timeout")
+	}
+	if f.Name != file || f.Size != 16 {
+		t.Errorf("wrong file: %+v", f)
+	}
+	if f, ok := next(500 * time.Millisecond); ok {
+		t.Fatalf("sent twice: %v", f)
+	}
+
+	// Removed before it's complete.
+	cat(t, "data", tmp, "removed")
+	rm(t, tmp, "removed")
+	if f, ok := next(700 * time.Millisecond); ok {
+		t.Fatalf("sent removed file: %v", f)
+	}
+
+	fp.Close()
+}
+
+func TestWriteCompleteCloseWrite(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("CloseWrite is only supported on Linux")
+	}
+	t.Parallel()
+
+	tmp := t.TempDir()
+	c, err := NewWriteComplete(tmp, WriteCompleteOptions{Quiet: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	cat(t, "data", tmp, "file") // cat closes the file.
+	select {
+	case f := <-c.Files:
+		if f.Name != filepath.Join(tmp, "file") || f.Size != 4 {
+			t.Errorf("wrong file: %+v", f)
+		}
+	case err := <-c.Errors:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("not sent after the file was closed")
+	}
+}
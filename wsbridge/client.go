@@ -0,0 +1,178 @@
+package wsbridge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gorilla/websocket"
+)
+
+// ErrClosed is returned for operations on a closed Client, or a Client whose
+// connection was lost.
+var ErrClosed = errors.New("fsnotify/wsbridge: client closed")
+
+// Client is a connection to a Handler.
+type Client struct {
+	// Events sends the events for all subscribed paths.
+	Events chan fsnotify.Event
+
+	// Errors sends the errors from the server's watcher, and the error if the
+	// connection is lost. The Events and Errors channels are closed after the
+	// connection is closed or lost.
+	Errors chan error
+
+	ws       *websocket.Conn
+	sendMu   sync.Mutex // Protects writing to ws.
+	mu       sync.Mutex // Protects lastID, pending, and closed.
+	lastID   uint64
+	pending  map[uint64]chan message
+	closed   bool
+	done     chan struct{} // Closed on Close().
+	doneResp chan struct{} // Closed once the reader goroutine exits.
+}
+
+// Dial connects to the Handler at url, which should be a "ws://" or "wss://"
+// URL. The header is sent with the handshake, and may be nil.
+func Dial(ctx context.Context, url string, header http.Header) (*Client, error) {
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Events:   make(chan fsnotify.Event),
+		Errors:   make(chan error),
+		ws:       ws,
+		pending:  make(map[uint64]chan message),
+		done:     make(chan struct{}),
+		doneResp: make(chan struct{}),
+	}
+	go c.readEvents()
+	return c, nil
+}
+
+// Close closes the connection, and the Events and Errors channels.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.isClosed() {
+		c.mu.Unlock()
+		return nil
+	}
+	close(c.done)
+	c.mu.Unlock()
+
+	c.sendMu.Lock()
+	c.ws.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.sendMu.Unlock()
+	err := c.ws.Close()
+	<-c.doneResp
+	return err
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Subscribe starts watching the named file or directory on the server.
+func (c *Client) Subscribe(path string) error {
+	return c.call(message{Type: typeSubscribe, Path: path})
+}
+
+// Unsubscribe stops watching the named file or directory on the server.
+func (c *Client) Unsubscribe(path string) error {
+	return c.call(message{Type: typeUnsubscribe, Path: path})
+}
+
+// call sends the message to the server, and waits for the reply.
+func (c *Client) call(m message) error {
+	c.mu.Lock()
+	if c.closed || c.isClosed() {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.lastID++
+	m.ID = c.lastID
+	ch := make(chan message, 1)
+	c.pending[m.ID] = ch
+	c.mu.Unlock()
+
+	c.sendMu.Lock()
+	err := c.ws.WriteJSON(m)
+	c.sendMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, m.ID)
+		c.mu.Unlock()
+		return ErrClosed
+	}
+
+	reply, ok := <-ch
+	if !ok {
+		return ErrClosed
+	}
+	return reply.err()
+}
+
+// readEvents reads all messages from the server until the connection is
+// closed.
+func (c *Client) readEvents() {
+	defer func() {
+		close(c.Events)
+		close(c.Errors)
+		close(c.doneResp)
+	}()
+	defer func() {
+		c.mu.Lock()
+		c.closed = true
+		for id, ch := range c.pending {
+			close(ch)
+			delete(c.pending, id)
+		}
+		c.mu.Unlock()
+	}()
+
+	for {
+		var m message
+		if err := c.ws.ReadJSON(&m); err != nil {
+			if !c.isClosed() && !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				select {
+				case c.Errors <- err:
+				case <-c.done:
+				}
+			}
+			return
+		}
+
+		switch m.Type {
+		case typeReply:
+			c.mu.Lock()
+			ch, ok := c.pending[m.ID]
+			delete(c.pending, m.ID)
+			c.mu.Unlock()
+			if ok {
+				ch <- m
+			}
+		case typeEvent:
+			select {
+			case c.Events <- m.event():
+			case <-c.done:
+				return
+			}
+		case typeError:
+			select {
+			case c.Errors <- m.err():
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/fsnotify/fsnotify/wsbridge
+
+go 1.17
+
+require (
+	github.com/fsnotify/fsnotify v1.5.4
+	github.com/gorilla/websocket v1.5.0
+)
+
+require golang.org/x/sys v0.0.0-20220731174439-a90be440212d // indirect
+
+replace github.com/fsnotify/fsnotify => ../
@@ -0,0 +1,119 @@
+package wsbridge
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gorilla/websocket"
+)
+
+// Handler is a http.Handler that accepts WebSocket connections.
+//
+// Every connection gets a new fsnotify.Watcher, which is closed when the
+// connection is closed.
+type Handler struct {
+	// Upgrader to use for the WebSocket connection. Note that the default
+	// upgrader only accepts connections from the same origin as the Host.
+	Upgrader websocket.Upgrader
+
+	// Allow is called for every path a client subscribes to; the subscription
+	// is refused if it returns an error. The default is to allow all paths.
+	Allow func(r *http.Request, path string) error
+}
+
+// conn is a single WebSocket connection.
+type conn struct {
+	ws     *websocket.Conn
+	sendMu sync.Mutex // Protects writing to ws.
+}
+
+func (c *conn) send(m message) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.ws.WriteJSON(m)
+}
+
+// ServeHTTP upgrades the connection to a WebSocket, and handles messages until
+// the connection is closed.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := h.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade() already sent an error response.
+	}
+	defer ws.Close()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ws.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()))
+		return
+	}
+	defer watcher.Close()
+
+	c := &conn{ws: ws}
+	done, forwardDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(forwardDone)
+		c.forward(watcher, done)
+	}()
+	defer func() {
+		close(done)
+		<-forwardDone
+	}()
+
+	for {
+		var m message
+		if err := ws.ReadJSON(&m); err != nil {
+			return
+		}
+
+		reply := message{Type: typeReply, ID: m.ID}
+		switch m.Type {
+		case typeSubscribe:
+			err = nil
+			if h.Allow != nil {
+				err = h.Allow(r, m.Path)
+			}
+			if err == nil {
+				err = watcher.Add(m.Path)
+			}
+		case typeUnsubscribe:
+			err = watcher.Remove(m.Path)
+		default:
+			err = errors.New("unknown message type: " + m.Type)
+		}
+		if err != nil {
+			reply.Error, reply.Code = err.Error(), errorCode(err)
+		}
+		if err := c.send(reply); err != nil {
+			return
+		}
+	}
+}
+
+// forward sends all events and errors of w, until done is closed, the watcher
+// is closed, or sending fails.
+func (c *conn) forward(w *fsnotify.Watcher, done chan struct{}) {
+	for {
+		var m message
+		select {
+		case <-done:
+			return
+		case e, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			m = eventMessage(e)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			m = message{Type: typeError, Error: err.Error(), Code: errorCode(err)}
+		}
+		if c.send(m) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package wsbridge sends the events of a fsnotify.Watcher over a WebSocket;
+// for example for browser-based tools.
+//
+// The client sends subscribe and unsubscribe messages for the paths it wants
+// to watch, and the server replies to every message and sends the events for
+// all subscribed paths. All messages are JSON objects:
+//
+//	→ {"type":"subscribe","id":1,"path":"/path/to/dir"}
+//	← {"type":"reply","id":1}
+//	← {"type":"event","name":"/path/to/dir/file","op":"CREATE"}
+//	→ {"type":"unsubscribe","id":2,"path":"/path/to/dir"}
+//	← {"type":"reply","id":2}
+//	→ {"type":"unsubscribe","id":3,"path":"/path/to/dir"}
+//	← {"type":"reply","id":3,"error":"can't remove non-existent watcher: /path/to/dir","code":"nonexistent-watch"}
+//
+// Errors from the watcher are sent as {"type":"error","error":"message"}.
+//
+// Handler is the server, and Dial() connects a Go client to it.
+package wsbridge
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// The message types.
+const (
+	typeSubscribe   = "subscribe"
+	typeUnsubscribe = "unsubscribe"
+	typeReply       = "reply"
+	typeEvent       = "event"
+	typeError       = "error"
+)
+
+// message is sent in both directions; which fields are used depends on the
+// type.
+type message struct {
+	Type  string `json:"type"`
+	ID    uint64 `json:"id,omitempty"`
+	Path  string `json:"path,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Op    string `json:"op,omitempty"`
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"` // Set for errors that can be checked with errors.Is().
+}
+
+func eventMessage(e fsnotify.Event) message {
+	return message{Type: typeEvent, Name: e.Name, Op: e.Op.String()}
+}
+
+// event returns the event in an event message.
+func (m message) event() fsnotify.Event {
+	return fsnotify.Event{Name: m.Name, Op: parseOp(m.Op)}
+}
+
+var ops = map[string]fsnotify.Op{
+	"CREATE":      fsnotify.Create,
+	"WRITE":       fsnotify.Write,
+	"REMOVE":      fsnotify.Remove,
+	"RENAME":      fsnotify.Rename,
+	"CHMOD":       fsnotify.Chmod,
+	"TRUNCATE":    fsnotify.Truncate,
+	"SETTLED":     fsnotify.Settled,
+	"CLOSE_WRITE": fsnotify.CloseWrite,
+	"REPLACED":    fsnotify.Replaced,
+}
+
+// parseOp parses the output of Op.String(); unknown operations are ignored.
+func parseOp(s string) fsnotify.Op {
+	var op fsnotify.Op
+	for _, o := range strings.Split(s, "|") {
+		op |= ops[o]
+	}
+	return op
+}
+
+var errorCodes = map[string]error{
+	"nonexistent-watch": fsnotify.ErrNonExistentWatch,
+	"event-overflow":    fsnotify.ErrEventOverflow,
+	"not-exist":         fs.ErrNotExist,
+	"permission":        fs.ErrPermission,
+}
+
+func errorCode(err error) string {
+	for code, e := range errorCodes {
+		if errors.Is(err, e) {
+			return code
+		}
+	}
+	return ""
+}
+
+// remoteError is an error from the server.
+type remoteError struct{ msg, code string }
+
+func (e remoteError) Error() string { return e.msg }
+func (e remoteError) Unwrap() error { return errorCodes[e.code] }
+
+// err returns the error in the message, if any.
+func (m message) err() error {
+	if m.Error == "" {
+		return nil
+	}
+	return remoteError{msg: m.Error, code: m.Code}
+}
@@ -0,0 +1,95 @@
+package wsbridge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestParseOp(t *testing.T) {
+	for _, op := range []fsnotify.Op{0, fsnotify.Create, fsnotify.Write | fsnotify.Chmod, fsnotify.Remove | fsnotify.Rename} {
+		if have := parseOp(op.String()); have != op {
+			t.Errorf("parseOp(%q) = %s; want %s", op.String(), have, op)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	srv := httptest.NewServer(&Handler{})
+	defer srv.Close()
+
+	c, err := Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Subscribe(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(tmp, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-c.Events:
+		if e.Name != file || !e.Has(fsnotify.Create) {
+			t.Errorf("wrong event: %s", e)
+		}
+	case err := <-c.Errors:
+		t.Fatal(err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	if err := c.Unsubscribe(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Unsubscribe(tmp); !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+		t.Errorf("wrong error unsubscribing twice: %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-c.Events; ok {
+		t.Error("Events not closed")
+	}
+	if err := c.Subscribe(tmp); err != ErrClosed {
+		t.Errorf("wrong error after Close: %v", err)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	srv := httptest.NewServer(&Handler{
+		Allow: func(_ *http.Request, path string) error {
+			return errors.New("not allowed")
+		},
+	})
+	defer srv.Close()
+
+	c, err := Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Subscribe(tmp); err == nil || err.Error() != "not allowed" {
+		t.Errorf("wrong error: %v", err)
+	}
+}